@@ -0,0 +1,429 @@
+package authmw_test
+
+import (
+	"authentication/src/authmw"
+	"authentication/src/internal/auth"
+	"authentication/src/internal/models"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const secret = "test-secret-key-0123456789abcdef"
+
+var jane = &models.User{ID: uuid.New(), Email: "jane@example.com", Role: models.RoleAdmin}
+
+// newTokenService creates the service's token service on in-memory stores.
+func newTokenService(opts ...auth.TokenServiceOption) auth.TokenService {
+	return auth.NewTokenService(secret, auth.NewMemoryTokenStore(), auth.NewMemoryCodeStore(), auth.CodePolicy{}, opts...)
+}
+
+// issue issues an access token for jane.
+func issue(t *testing.T, ts auth.TokenService, scopes []string, expiry time.Duration) string {
+	t.Helper()
+
+	token, err := ts.GenerateAccessToken(jane, scopes, expiry)
+	if err != nil {
+		t.Fatalf("Failed to issue access token: %v", err)
+	}
+	return token
+}
+
+// newSecretVerifier creates a Verifier for tokens signed with the secret.
+func newSecretVerifier(t *testing.T, secret string, opts ...authmw.Option) *authmw.Verifier {
+	t.Helper()
+
+	verifier, err := authmw.NewSecretVerifier(secret, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	return verifier
+}
+
+// newSigningKey creates an Ed25519 signing key.
+func newSigningKey(t *testing.T) *auth.SigningKey {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	key, err := auth.NewSigningKey(private, "")
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+	return key
+}
+
+// jwksServer publishes the keys of the token service, which can be swapped to rotate keys.
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	ts       auth.TokenService
+	requests atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, ts auth.TokenService) *jwksServer {
+	s := &jwksServer{ts: ts}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(s.ts.JWKS())
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) rotate(ts auth.TokenService) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ts = ts
+}
+
+func TestSecretVerifier(t *testing.T) {
+	ts := newTokenService(auth.WithIssuer("https://auth.example.com"))
+	verifier := newSecretVerifier(t, secret, authmw.WithIssuer("https://auth.example.com"))
+
+	principal, err := verifier.Verify(context.Background(), issue(t, ts, []string{"orders:read"}, time.Minute))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if principal.UserID != jane.ID || principal.Email != jane.Email || !principal.HasRole(models.RoleAdmin) ||
+		!reflect.DeepEqual(principal.Scopes, []string{"orders:read"}) || principal.TokenID == "" {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	resetToken, err := ts.GenerateToken(context.Background(), jane.ID, auth.PurposePasswordReset, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	for name, tt := range map[string]struct {
+		verifier *authmw.Verifier
+		token    string
+		want     error
+	}{
+		"missing":      {verifier, "", authmw.ErrMissingToken},
+		"expired":      {verifier, issue(t, ts, nil, -time.Minute), authmw.ErrTokenExpired},
+		"wrong secret": {newSecretVerifier(t, "other-secret-key-0123456789abcdef"), issue(t, ts, nil, time.Minute), authmw.ErrInvalidToken},
+		"wrong issuer": {newSecretVerifier(t, secret, authmw.WithIssuer("https://other.example.com")), issue(t, ts, nil, time.Minute), authmw.ErrInvalidToken},
+		"one-time":     {verifier, resetToken, authmw.ErrInvalidToken},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tt.verifier.Verify(context.Background(), tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSecretVerifierRejectsShortSecrets(t *testing.T) {
+	for _, weak := range []string{"", "short-secret"} {
+		if _, err := authmw.NewSecretVerifier(weak); !errors.Is(err, authmw.ErrWeakSecret) {
+			t.Errorf("Expected secret %q to be refused, got %v", weak, err)
+		}
+	}
+}
+
+func TestAudience(t *testing.T) {
+	ts := newTokenService(auth.WithAudience("orders"))
+	token := issue(t, ts, nil, time.Minute)
+
+	if _, err := newSecretVerifier(t, secret, authmw.WithAudience("orders")).Verify(context.Background(), token); err != nil {
+		t.Errorf("Expected a token for the audience to be accepted, got %v", err)
+	}
+	if _, err := newSecretVerifier(t, secret, authmw.WithAudience("billing")).Verify(context.Background(), token); !errors.Is(err, authmw.ErrInvalidToken) {
+		t.Errorf("Expected a token for another audience to be refused, got %v", err)
+	}
+	if _, err := ts.ParseAccessToken(token); err != nil {
+		t.Errorf("Expected the service to accept its own audience, got %v", err)
+	}
+	if _, err := newTokenService(auth.WithAudience("billing")).ParseAccessToken(token); err == nil {
+		t.Error("Expected the service to refuse tokens for another audience")
+	}
+}
+
+func TestJWKSVerifier(t *testing.T) {
+	ts := newTokenService(auth.WithSigningKey(newSigningKey(t)))
+	server := newJWKSServer(t, ts)
+
+	keys, err := authmw.NewKeySet(context.Background(), server.URL, authmw.WithMinRefreshInterval(0))
+	if err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	defer keys.Close()
+	verifier := authmw.NewJWKSVerifier(keys)
+
+	if _, err := verifier.Verify(context.Background(), issue(t, ts, nil, time.Minute)); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	// Tokens signed with the shared secret are not accepted in place of a published key
+	if _, err := verifier.Verify(context.Background(), issue(t, newTokenService(), nil, time.Minute)); err == nil {
+		t.Error("Expected a token signed with the secret to be rejected")
+	}
+
+	// A token with a new key makes the key set fetch the keys again
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signingKey, err := auth.NewSigningKey(rsaKey, "rotated")
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+	rotated := newTokenService(auth.WithSigningKey(signingKey))
+	server.rotate(rotated)
+	if _, err := verifier.Verify(context.Background(), issue(t, rotated, nil, time.Minute)); err != nil {
+		t.Errorf("Expected a token with the rotated key to be accepted, got %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), issue(t, ts, nil, time.Minute)); !errors.Is(err, authmw.ErrUnknownKey) {
+		t.Errorf("Expected a token with the retired key to be rejected, got %v", err)
+	}
+}
+
+func TestPreviousSigningKeysStayValid(t *testing.T) {
+	previousKey := newSigningKey(t)
+	previous := newTokenService(auth.WithSigningKey(previousKey))
+	token := issue(t, previous, nil, time.Minute)
+
+	// After a rotation the service signs with a new key, but still publishes and accepts the old one
+	rotated := newTokenService(auth.WithSigningKey(newSigningKey(t)), auth.WithPreviousSigningKeys([]*auth.SigningKey{previousKey}))
+	if jwks := rotated.JWKS(); len(jwks.Keys) != 2 || jwks.Keys[1].Kid != previousKey.KeyID {
+		t.Fatalf("Expected the current and previous key to be published, got %+v", jwks.Keys)
+	}
+	if _, err := rotated.ParseAccessToken(token); err != nil {
+		t.Errorf("Expected the service to accept a token signed with the previous key, got %v", err)
+	}
+
+	server := newJWKSServer(t, rotated)
+	keys, err := authmw.NewKeySet(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	defer keys.Close()
+	verifier := authmw.NewJWKSVerifier(keys)
+	for name, token := range map[string]string{"previous": token, "current": issue(t, rotated, nil, time.Minute)} {
+		if _, err := verifier.Verify(context.Background(), token); err != nil {
+			t.Errorf("Expected a token signed with the %s key to be accepted, got %v", name, err)
+		}
+	}
+
+	if _, err := newTokenService(auth.WithSigningKey(newSigningKey(t))).ParseAccessToken(token); err == nil {
+		t.Error("Expected a token signed with a key that is no longer known to be refused")
+	}
+}
+
+func TestRotatedSigningKeys(t *testing.T) {
+	ctx := context.Background()
+	store := auth.NewMemorySigningKeyStore()
+	firstKey, err := auth.EnsureSigningKey(ctx, store)
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+	token := issue(t, newTokenService(auth.WithSigningKeyStore(store)), nil, time.Minute)
+
+	// The rotation job adds a key, which replicas sign with once they load it
+	secondKey, err := auth.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	if err := store.Add(ctx, secondKey); err != nil {
+		t.Fatalf("Failed to add signing key: %v", err)
+	}
+	rotated := newTokenService(auth.WithSigningKeyStore(store))
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != secondKey.KeyID || jwks.Keys[1].Kid != firstKey.KeyID {
+		t.Fatalf("Expected the new key followed by the replaced one, got %+v", jwks.Keys)
+	}
+	if _, err := rotated.ParseAccessToken(token); err != nil {
+		t.Errorf("Expected a token signed with the replaced key to be accepted, got %v", err)
+	}
+
+	server := newJWKSServer(t, rotated)
+	keys, err := authmw.NewKeySet(ctx, server.URL)
+	if err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	defer keys.Close()
+	if _, err := authmw.NewJWKSVerifier(keys).Verify(ctx, issue(t, rotated, nil, time.Minute)); err != nil {
+		t.Errorf("Expected a token signed with the new key to be accepted, got %v", err)
+	}
+
+	if err := store.Delete(ctx, firstKey.KeyID); err != nil {
+		t.Fatalf("Failed to delete signing key: %v", err)
+	}
+	if _, err := newTokenService(auth.WithSigningKeyStore(store)).ParseAccessToken(token); err == nil {
+		t.Error("Expected a token signed with a deleted key to be refused")
+	}
+}
+
+func TestKeySetWithoutBackgroundRefresh(t *testing.T) {
+	server := newJWKSServer(t, newTokenService(auth.WithSigningKey(newSigningKey(t))))
+	var logs bytes.Buffer
+	keys, err := authmw.NewKeySet(context.Background(), server.URL, authmw.WithRefreshInterval(0),
+		authmw.WithMinRefreshInterval(0), authmw.WithLogger(log.New(&logs, "", 0)))
+	if err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	keys.Close()
+	keys.Close()
+
+	// Without the service the key set keeps its keys and logs to the given logger
+	server.Close()
+	if _, err := keys.Key(context.Background(), "unknown"); !errors.Is(err, authmw.ErrUnknownKey) {
+		t.Errorf("Expected an unknown key, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "Error refreshing JWKS") {
+		t.Errorf("Expected the failed refresh to be logged, got %q", logs.String())
+	}
+}
+
+func TestKeySetFetchesOnceForBurstOfUnknownKeys(t *testing.T) {
+	ts := newTokenService(auth.WithSigningKey(newSigningKey(t)))
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(ts.JWKS())
+	}))
+	defer server.Close()
+	keys, err := authmw.NewKeySet(context.Background(), server.URL, authmw.WithMinRefreshInterval(0))
+	if err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	defer keys.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = keys.Key(context.Background(), "unknown")
+		}()
+	}
+	wg.Wait()
+	// The initial fetch and one for all of the unknown keys
+	if got := requests.Load(); got > 3 {
+		t.Errorf("Expected the unknown keys to share a fetch, got %d fetches", got)
+	}
+}
+
+func TestKeySetRefreshesInBackground(t *testing.T) {
+	server := newJWKSServer(t, newTokenService(auth.WithSigningKey(newSigningKey(t))))
+	keys, err := authmw.NewKeySet(context.Background(), server.URL, authmw.WithRefreshInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for server.requests.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	keys.Close()
+	if got := server.requests.Load(); got < 3 {
+		t.Errorf("Expected the keys to be refreshed in the background, got %d fetches", got)
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	ts := newTokenService()
+	verifier := newSecretVerifier(t, secret)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := authmw.PrincipalFromContext(r.Context())
+		_, _ = w.Write([]byte(principal.Email))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/orders", verifier.Middleware(authmw.RequireScopes("orders:read")(handler)))
+	mux.Handle("/admin", verifier.Middleware(authmw.RequireRoles(models.RoleAdmin)(handler)))
+	mux.Handle("/support", verifier.Middleware(authmw.RequireRoles("support")(handler)))
+
+	for _, tt := range []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/orders", "", http.StatusUnauthorized},
+		{"/orders", "not-a-token", http.StatusUnauthorized},
+		{"/orders", issue(t, ts, nil, time.Minute), http.StatusForbidden},
+		{"/orders", issue(t, ts, []string{"orders:read"}, time.Minute), http.StatusOK},
+		{"/admin", issue(t, ts, nil, time.Minute), http.StatusOK},
+		{"/support", issue(t, ts, nil, time.Minute), http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		if res.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.path, tt.status, res.Code, res.Body)
+		}
+		if res.Code == http.StatusOK && res.Body.String() != jane.Email {
+			t.Errorf("%s: expected the principal in the context, got %q", tt.path, res.Body)
+		}
+		if res.Code == http.StatusUnauthorized && res.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a bearer challenge", tt.path)
+		}
+	}
+}
+
+func TestFiberMiddleware(t *testing.T) {
+	ts := newTokenService()
+	verifier := newSecretVerifier(t, secret)
+
+	app := fiber.New()
+	api := app.Group("/api", verifier.Fiber())
+	api.Get("/orders", authmw.FiberRequireScopes("orders:read", "orders:write"), func(c *fiber.Ctx) error {
+		principal, _ := authmw.FiberPrincipal(c)
+		fromContext, _ := authmw.PrincipalFromContext(c.UserContext())
+		if fromContext != principal {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.SendString(principal.Email)
+	})
+	api.Get("/admin", authmw.FiberRequireRoles(models.RoleAdmin), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	for _, tt := range []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/api/orders", "", http.StatusUnauthorized},
+		{"/api/orders", issue(t, ts, []string{"orders:read"}, time.Minute), http.StatusForbidden},
+		{"/api/orders", issue(t, ts, []string{"orders:read", "orders:write"}, time.Minute), http.StatusOK},
+		{"/api/admin", issue(t, ts, nil, time.Minute), http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if res.StatusCode != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.status, res.StatusCode)
+		}
+		if res.StatusCode == http.StatusForbidden && res.Header.Get("WWW-Authenticate") != `Bearer error="insufficient_scope", scope="orders:read orders:write"` {
+			t.Errorf("%s: unexpected challenge %q", tt.path, res.Header.Get("WWW-Authenticate"))
+		}
+	}
+}
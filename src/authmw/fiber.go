@@ -0,0 +1,67 @@
+package authmw
+
+import "github.com/gofiber/fiber/v2"
+
+// principalLocalsKey holds the Principal in the Fiber locals.
+const principalLocalsKey = "principal"
+
+// Fiber is a Fiber middleware that authenticates requests by their bearer token and stores the
+// Principal in the locals and the user context. Requests without a valid token get 401.
+func (v *Verifier) Fiber() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := v.Verify(c.UserContext(), bearerToken(c.Get(fiber.HeaderAuthorization)))
+		if err != nil {
+			return fiberError(c, err, nil)
+		}
+		c.Locals(principalLocalsKey, principal)
+		c.SetUserContext(ContextWithPrincipal(c.UserContext(), principal))
+		return c.Next()
+	}
+}
+
+// FiberPrincipal returns the principal the Fiber middleware authenticated the request as.
+func FiberPrincipal(c *fiber.Ctx) (*Principal, bool) {
+	principal, ok := c.Locals(principalLocalsKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// FiberRequireScopes only lets requests through whose token was issued for all of the scopes. It
+// must run after the Fiber middleware.
+func FiberRequireScopes(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := FiberPrincipal(c)
+		if !ok {
+			return fiberError(c, ErrMissingToken, nil)
+		}
+		if missing := principal.missingScopes(scopes); len(missing) > 0 {
+			return fiberError(c, ErrInsufficientScope, scopes)
+		}
+		return c.Next()
+	}
+}
+
+// FiberRequireRoles only lets requests through whose user has one of the roles. It must run after
+// the Fiber middleware.
+func FiberRequireRoles(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := FiberPrincipal(c)
+		if !ok {
+			return fiberError(c, ErrMissingToken, nil)
+		}
+		if !principal.hasAnyRole(roles) {
+			return fiberError(c, ErrForbiddenRole, nil)
+		}
+		return c.Next()
+	}
+}
+
+// fiberError answers a request that was not authenticated or authorized.
+func fiberError(c *fiber.Ctx, err error, scopes []string) error {
+	status, challenge := errorStatus(err, scopes)
+	if challenge != "" {
+		c.Set(fiber.HeaderWWWAuthenticate, challenge)
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": errorMessage(err),
+	})
+}
@@ -0,0 +1,91 @@
+package authmw
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Middleware authenticates requests by their bearer token and stores the Principal in the request
+// context. Requests without a valid token get 401.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := v.Verify(r.Context(), bearerToken(r.Header.Get("Authorization")))
+		if err != nil {
+			writeError(w, err, nil)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+	})
+}
+
+// RequireScopes only lets requests through whose token was issued for all of the scopes. It must
+// run after Middleware.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				writeError(w, ErrMissingToken, nil)
+				return
+			}
+			if missing := principal.missingScopes(scopes); len(missing) > 0 {
+				writeError(w, ErrInsufficientScope, scopes)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles only lets requests through whose user has one of the roles. It must run after Middleware.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				writeError(w, ErrMissingToken, nil)
+				return
+			}
+			if !principal.hasAnyRole(roles) {
+				writeError(w, ErrForbiddenRole, nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeError answers a request that was not authenticated or authorized.
+func writeError(w http.ResponseWriter, err error, scopes []string) {
+	status, challenge := errorStatus(err, scopes)
+	if challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": errorMessage(err)})
+}
+
+// errorStatus returns the status and the RFC 6750 WWW-Authenticate challenge of an error.
+func errorStatus(err error, scopes []string) (int, string) {
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		return http.StatusUnauthorized, `Bearer`
+	case errors.Is(err, ErrInsufficientScope):
+		return http.StatusForbidden, `Bearer error="insufficient_scope", scope="` + strings.Join(scopes, " ") + `"`
+	case errors.Is(err, ErrForbiddenRole):
+		return http.StatusForbidden, ""
+	default:
+		return http.StatusUnauthorized, `Bearer error="invalid_token"`
+	}
+}
+
+// errorMessage hides the parser details of invalid tokens from clients.
+func errorMessage(err error) string {
+	if errors.Is(err, ErrInvalidToken) {
+		return ErrInvalidToken.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,259 @@
+package authmw
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwk is a public key in JSON Web Key format (RFC 7517), as published by the service.
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+// KeySet is a local copy of the public keys published at the JWKS URL of the service. It refreshes
+// them in the background, and right away when a token names a key it does not know yet, so keys
+// can be rotated without restarting services.
+type KeySet struct {
+	url    string
+	client *http.Client
+	// refreshInterval is how often the keys are fetched in the background; 0 or less disables it
+	refreshInterval time.Duration
+	// minRefreshInterval limits the fetches caused by tokens with unknown keys
+	minRefreshInterval time.Duration
+	logger             *log.Logger
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+	// refreshMu lets only one fetch run at a time
+	refreshMu sync.Mutex
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// KeySetOption configures optional behaviour of the KeySet.
+type KeySetOption func(*KeySet)
+
+// WithHTTPClient fetches the keys with client instead of a client with a 10 second timeout.
+func WithHTTPClient(client *http.Client) KeySetOption {
+	return func(k *KeySet) {
+		k.client = client
+	}
+}
+
+// WithRefreshInterval sets how often the keys are fetched in the background, every 15 minutes by
+// default. An interval of 0 or less turns the background refresh off, leaving only the fetches
+// caused by unknown keys.
+func WithRefreshInterval(interval time.Duration) KeySetOption {
+	return func(k *KeySet) {
+		k.refreshInterval = interval
+	}
+}
+
+// WithMinRefreshInterval sets how long after a fetch a token with an unknown key may cause the
+// next one, 30 seconds by default.
+func WithMinRefreshInterval(interval time.Duration) KeySetOption {
+	return func(k *KeySet) {
+		k.minRefreshInterval = interval
+	}
+}
+
+// WithLogger writes refresh failures and skipped keys to logger instead of the standard logger.
+func WithLogger(logger *log.Logger) KeySetOption {
+	return func(k *KeySet) {
+		k.logger = logger
+	}
+}
+
+// NewKeySet fetches the keys at url, such as https://auth.example.com/.well-known/jwks.json, and
+// keeps them up to date until Close is called.
+func NewKeySet(ctx context.Context, url string, opts ...KeySetOption) (*KeySet, error) {
+	k := &KeySet{
+		url:                url,
+		client:             &http.Client{Timeout: 10 * time.Second},
+		refreshInterval:    15 * time.Minute,
+		minRefreshInterval: 30 * time.Second,
+		logger:             log.Default(),
+		keys:               make(map[string]crypto.PublicKey),
+		stop:               make(chan struct{}),
+		done:               make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	if err := k.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	if k.refreshInterval > 0 {
+		go k.refreshLoop()
+	} else {
+		close(k.done)
+	}
+	return k, nil
+}
+
+// Close stops the background refresh. It can be called more than once.
+func (k *KeySet) Close() {
+	k.closeOnce.Do(func() {
+		close(k.stop)
+	})
+	<-k.done
+}
+
+// Key returns the public key with the ID, fetching the keys again if it is unknown.
+func (k *KeySet) Key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	if key, ok := k.lookup(keyID); ok {
+		return key, nil
+	}
+
+	k.mu.RLock()
+	recentlyRefreshed := time.Since(k.lastRefresh) < k.minRefreshInterval
+	k.mu.RUnlock()
+	if !recentlyRefreshed {
+		if err := k.Refresh(ctx); err != nil {
+			k.logger.Printf("Error refreshing JWKS: %v", err)
+		}
+		if key, ok := k.lookup(keyID); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+}
+
+// lookup returns the known key with the ID.
+func (k *KeySet) lookup(keyID string) (crypto.PublicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[keyID]
+	return key, ok
+}
+
+// Refresh fetches the keys and replaces the known ones. On failure the known keys are kept. When
+// another fetch finished while this one waited for it, its keys are used instead of fetching again,
+// so a burst of tokens with a new key causes a single fetch.
+func (k *KeySet) Refresh(ctx context.Context) error {
+	requested := time.Now()
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	k.mu.RLock()
+	refreshedMeanwhile := k.lastRefresh.After(requested)
+	k.mu.RUnlock()
+	if refreshedMeanwhile {
+		return nil
+	}
+
+	keys, err := k.fetch(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// Failed fetches count too, so an unreachable service is not asked on every request
+	k.lastRefresh = time.Now()
+	if err != nil {
+		return err
+	}
+	k.keys = keys
+	return nil
+}
+
+// fetch downloads and parses the key set.
+func (k *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: unexpected status %d", res.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, entry := range set.Keys {
+		if entry.Use != "" && entry.Use != "sig" {
+			continue
+		}
+		key, err := entry.publicKey()
+		if err != nil {
+			// One unusable key should not take the others down
+			k.logger.Printf("Skipping JWKS key %q: %v", entry.Kid, err)
+			continue
+		}
+		keys[entry.Kid] = key
+	}
+	return keys, nil
+}
+
+// refreshLoop fetches the keys every refreshInterval until Close is called.
+func (k *KeySet) refreshLoop() {
+	defer close(k.done)
+
+	ticker := time.NewTicker(k.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), k.refreshInterval)
+			if err := k.Refresh(ctx); err != nil {
+				k.logger.Printf("Error refreshing JWKS: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// publicKey decodes an RSA or Ed25519 key.
+func (j jwk) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if j.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
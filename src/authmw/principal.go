@@ -0,0 +1,80 @@
+// Package authmw lets other services authenticate requests with the access tokens of the
+// authentication service. Tokens are verified against its published JWKS or the shared token
+// secret, and the caller is made available as a Principal to net/http and Fiber handlers.
+package authmw
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"slices"
+	"time"
+)
+
+// Errors returned when a request cannot be authenticated or authorized.
+var (
+	ErrMissingToken      = errors.New("missing bearer token")
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrTokenExpired      = errors.New("token expired")
+	ErrUnknownKey        = errors.New("token signed with an unknown key")
+	ErrInsufficientScope = errors.New("insufficient scope")
+	ErrForbiddenRole     = errors.New("insufficient permissions")
+	// ErrWeakSecret is returned by NewSecretVerifier for a secret too short to check tokens with.
+	ErrWeakSecret = errors.New("token secret is too short")
+)
+
+// Principal is the user an access token was issued to.
+type Principal struct {
+	UserID uuid.UUID
+	Email  string
+	Roles  []string
+	Scopes []string
+	// TokenID is the unique ID ("jti") of the token.
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// HasRole reports whether the principal has the role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// HasScope reports whether the token was issued for the scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// principalKey is the context key of the Principal.
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying the principal.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal the middleware stored in ctx.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// missingScopes returns the scopes the principal lacks.
+func (p *Principal) missingScopes(scopes []string) []string {
+	var missing []string
+	for _, scope := range scopes {
+		if !p.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// hasAnyRole reports whether the principal has one of the roles.
+func (p *Principal) hasAnyRole(roles []string) bool {
+	for _, role := range roles {
+		if p.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
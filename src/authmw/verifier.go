@@ -0,0 +1,156 @@
+package authmw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// accessPurpose is the purpose claim of access tokens; the service signs one-time tokens for
+// emails with the same secret, and those must not authenticate requests.
+const accessPurpose = "access"
+
+// MinSecretLength is the length of the shortest shared secret NewSecretVerifier accepts.
+const MinSecretLength = 32
+
+// accessClaims mirror the claims of the access tokens the authentication service issues.
+type accessClaims struct {
+	UserID  uuid.UUID `json:"userId"`
+	Purpose string    `json:"purpose"`
+	Email   string    `json:"email"`
+	Roles   []string  `json:"roles"`
+	Scope   string    `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Verifier checks access tokens and turns them into a Principal.
+type Verifier struct {
+	// key returns the key to check a token with
+	key      func(ctx context.Context, token *jwt.Token) (interface{}, error)
+	methods  []string
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+// Option configures optional behaviour of the Verifier.
+type Option func(*Verifier)
+
+// WithIssuer requires the "iss" claim of tokens to be issuer, the TOKEN_ISSUER of the service.
+func WithIssuer(issuer string) Option {
+	return func(v *Verifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience requires the "aud" claim of tokens to include audience, the TOKEN_AUDIENCE of the
+// service, so tokens issued for other services are refused.
+func WithAudience(audience string) Option {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+// WithLeeway accepts tokens up to leeway after they expired, to allow for clock skew.
+func WithLeeway(leeway time.Duration) Option {
+	return func(v *Verifier) {
+		v.leeway = leeway
+	}
+}
+
+// NewSecretVerifier creates a Verifier for tokens signed with the shared TOKEN_SECRET of the service.
+// Secrets shorter than MinSecretLength are refused with ErrWeakSecret.
+func NewSecretVerifier(secret string, opts ...Option) (*Verifier, error) {
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("%w: %d characters, at least %d are required", ErrWeakSecret, len(secret), MinSecretLength)
+	}
+
+	v := &Verifier{
+		key: func(ctx context.Context, token *jwt.Token) (interface{}, error) {
+			return []byte(secret), nil
+		},
+		methods: []string{jwt.SigningMethodHS256.Alg()},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v, nil
+}
+
+// NewJWKSVerifier creates a Verifier for tokens signed with one of the keys of the key set.
+func NewJWKSVerifier(keys *KeySet, opts ...Option) *Verifier {
+	v := &Verifier{
+		key: func(ctx context.Context, token *jwt.Token) (interface{}, error) {
+			keyID, _ := token.Header["kid"].(string)
+			return keys.Key(ctx, keyID)
+		},
+		methods: []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Verify checks the signature, expiry, issuer, audience and purpose of an access token and returns
+// its principal.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.leeway),
+	}
+	if v.issuer != "" {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		options = append(options, jwt.WithAudience(v.audience))
+	}
+
+	parsedToken, err := jwt.ParseWithClaims(token, &accessClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return v.key(ctx, token)
+	}, options...)
+	if err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrTokenExpired
+		case errors.Is(err, ErrUnknownKey):
+			return nil, ErrUnknownKey
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, ok := parsedToken.Claims.(*accessClaims)
+	if !ok || claims.Purpose != accessPurpose || claims.UserID == uuid.Nil {
+		return nil, ErrInvalidToken
+	}
+
+	principal := &Principal{
+		UserID:  claims.UserID,
+		Email:   claims.Email,
+		Roles:   claims.Roles,
+		Scopes:  strings.Fields(claims.Scope),
+		TokenID: claims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		principal.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return principal, nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header value, or "".
+func bearerToken(authorization string) string {
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
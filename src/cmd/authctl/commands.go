@@ -0,0 +1,598 @@
+package main
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/auth"
+	"authentication/src/internal/db"
+	"authentication/src/internal/dto"
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"authentication/src/internal/password"
+	"authentication/src/internal/privacy"
+	"authentication/src/utils"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runUser handles the user subcommands.
+func (c *cli) runUser(subcommand string, args []string) error {
+	ctx := context.Background()
+	flags := newFlagSet("user " + subcommand)
+	email := flags.String("email", "", "email address of the user")
+
+	switch subcommand {
+	case "create":
+		name := flags.String("name", "", "full name of the user")
+		password := flags.String("password", "", "initial password")
+		verified := flags.Bool("verified", false, "mark the email address as verified")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		createUserDTO := &dto.CreateUserDTO{
+			FullName: *name,
+			Email:    *email,
+			Password: *password,
+		}
+		if err := utils.ValidateStruct(createUserDTO); err != nil {
+			return err
+		}
+
+		created, err := c.userService.CreateUser(ctx, createUserDTO)
+		if err != nil {
+			return err
+		}
+		if *verified {
+			created.Verified = true
+			if created, err = c.userService.UpdateUser(ctx, created); err != nil {
+				return err
+			}
+		}
+
+		c.print(dto.ToUserResponse(created), "created user %s (%s)", created.ID, created.Email)
+		return nil
+
+	case "verify":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		registration, err := c.userService.GetPendingRegistration(ctx, *email)
+		if err != nil {
+			return err
+		}
+		if registration != nil {
+			created, err := c.userService.CompleteRegistration(ctx, registration.ID)
+			if err != nil {
+				return err
+			}
+			c.print(dto.ToUserResponse(created), "verified user %s (%s)", created.ID, created.Email)
+			return nil
+		}
+
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+
+		existingUser.Verified = true
+		if _, err := c.userService.UpdateUser(ctx, existingUser); err != nil {
+			return err
+		}
+
+		c.print(dto.ToUserResponse(existingUser), "verified user %s (%s)", existingUser.ID, existingUser.Email)
+		return nil
+
+	case "reset-password":
+		password := flags.String("password", "", "new password")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+
+		// Go through the regular reset flow so the same rules apply as for users
+		token, err := c.tokenService.GenerateToken(ctx, existingUser.ID, auth.PurposePasswordReset, 5*time.Minute)
+		if err != nil {
+			return err
+		}
+		resetReq := &dto.ResetPasswordRequest{
+			UserID:      existingUser.ID,
+			ResetToken:  token,
+			NewPassword: *password,
+		}
+		if err := utils.ValidateStruct(resetReq); err != nil {
+			return err
+		}
+		if err := c.authService.ResetPassword(ctx, resetReq); err != nil {
+			return err
+		}
+
+		revoked, err := c.authService.RevokeAllSessions(ctx, existingUser.ID)
+		if err != nil {
+			return err
+		}
+
+		c.print(map[string]interface{}{
+			"user_id":          existingUser.ID,
+			"sessions_revoked": revoked,
+		}, "reset password for %s, revoked %d session(s)", existingUser.Email, revoked)
+		return nil
+
+	case "status":
+		status := flags.String("status", "", "new status: active, suspended, banned or deactivated")
+		reason := flags.String("reason", "", "reason recorded with the change")
+		until := flags.String("until", "", "end of a suspension, RFC 3339 timestamp or duration such as 72h")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+		if *status == "" {
+			c.print(dto.ToAccountStatusResponse(existingUser), "%s is %s", existingUser.Email, existingUser.AccountStatus(time.Now()))
+			return nil
+		}
+
+		statusReq := &dto.ChangeAccountStatusRequest{Status: *status, Reason: *reason}
+		if *until != "" {
+			end, err := time.Parse(time.RFC3339, *until)
+			if err != nil {
+				duration, durationErr := time.ParseDuration(*until)
+				if durationErr != nil {
+					return fmt.Errorf("invalid -until %q: expected an RFC 3339 timestamp or a duration", *until)
+				}
+				end = time.Now().Add(duration)
+			}
+			statusReq.Until = &end
+		}
+		if err := utils.ValidateStruct(statusReq); err != nil {
+			return err
+		}
+
+		updatedUser, err := c.authService.ChangeAccountStatus(ctx, existingUser.ID, statusReq, "authctl")
+		if err != nil {
+			return err
+		}
+		c.print(dto.ToAccountStatusResponse(updatedUser), "%s is now %s", updatedUser.Email, updatedUser.AccountStatus(time.Now()))
+		return nil
+
+	case "role":
+		role := flags.String("role", "", "new role: user or admin")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if *role != models.RoleUser && *role != models.RoleAdmin {
+			return fmt.Errorf("-role must be %s or %s", models.RoleUser, models.RoleAdmin)
+		}
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+
+		updatedUser, err := c.authService.ChangeRole(ctx, existingUser.ID, *role, "authctl")
+		if err != nil {
+			return err
+		}
+		c.print(dto.ToAccountStatusResponse(updatedUser), "%s now has role %s", updatedUser.Email, *role)
+		return nil
+
+	case "login-history":
+		limit := flags.Int("limit", 20, "number of login attempts to show")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+
+		events, err := c.authService.LoginHistory(ctx, existingUser.ID, *limit)
+		if err != nil {
+			return err
+		}
+
+		lines := make([]string, 0, len(events))
+		for _, e := range events {
+			outcome := "ok"
+			if !e.Success {
+				outcome = "failed: " + e.FailureReason
+			}
+			lines = append(lines, fmt.Sprintf("%s  %-12s %-15s %s on %s  %s", e.CreatedAt.Format(time.RFC3339), e.Method, e.IP, e.Browser, e.OS, outcome))
+		}
+		c.print(events, "%d login attempt(s)\n%s", len(events), strings.Join(lines, "\n"))
+		return nil
+
+	case "export":
+		out := flags.String("out", "", "file to write (standard output when omitted)")
+		format := flags.String("format", dto.ExportFormatJSON, "json or zip")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if *format != dto.ExportFormatJSON && *format != dto.ExportFormatZIP {
+			return fmt.Errorf("-format must be json or zip")
+		}
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+
+		export, err := c.privacyService.Export(ctx, existingUser.ID)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		if *format == dto.ExportFormatZIP {
+			err = privacy.WriteArchive(w, export)
+		} else {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(export)
+		}
+		if err != nil {
+			return err
+		}
+		if *out != "" {
+			c.print(map[string]interface{}{"user_id": existingUser.ID, "file": *out}, "exported data of %s to %s", existingUser.Email, *out)
+		}
+		return nil
+
+	case "erase":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+
+		tombstone, err := c.privacyService.Erase(ctx, existingUser.ID, privacy.ActorAdmin)
+		if err != nil {
+			return err
+		}
+		c.print(tombstone, "erased user %s, tombstone %s", existingUser.ID, tombstone.ID)
+		return nil
+	}
+
+	return fmt.Errorf("unknown user subcommand %q", subcommand)
+}
+
+// runSession handles the session subcommands.
+func (c *cli) runSession(subcommand string, args []string) error {
+	ctx := context.Background()
+	flags := newFlagSet("session " + subcommand)
+	email := flags.String("email", "", "email address of the user")
+
+	switch subcommand {
+	case "list":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+
+		sessions, err := c.authService.ListSessions(ctx, existingUser.ID)
+		if err != nil {
+			return err
+		}
+
+		lines := make([]string, 0, len(sessions))
+		for _, s := range sessions {
+			lines = append(lines, fmt.Sprintf("%s  created %s", s.ID, s.CreatedAt.Format(time.RFC3339)))
+		}
+		c.print(sessions, "%d session(s)\n%s", len(sessions), strings.Join(lines, "\n"))
+		return nil
+
+	case "revoke":
+		sessionID := flags.String("id", "", "session to revoke (all sessions when omitted)")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		existingUser, err := c.findUser(ctx, *email)
+		if err != nil {
+			return err
+		}
+
+		revoked := 1
+		if *sessionID == "" {
+			revoked, err = c.authService.RevokeAllSessions(ctx, existingUser.ID)
+		} else {
+			err = c.authService.RevokeSession(ctx, existingUser.ID, *sessionID)
+		}
+		if err != nil {
+			return err
+		}
+
+		c.print(map[string]interface{}{
+			"user_id":          existingUser.ID,
+			"sessions_revoked": revoked,
+		}, "revoked %d session(s) for %s", revoked, existingUser.Email)
+		return nil
+	}
+
+	return fmt.Errorf("unknown session subcommand %q", subcommand)
+}
+
+// runToken handles the token subcommands.
+func (c *cli) runToken(subcommand string, args []string) error {
+	if subcommand != "issue" {
+		return fmt.Errorf("unknown token subcommand %q", subcommand)
+	}
+
+	ctx := context.Background()
+	flags := newFlagSet("token issue")
+	email := flags.String("email", "", "email address of the user")
+	purpose := flags.String("purpose", "", fmt.Sprintf("token purpose, e.g. %s or %s", auth.PurposeEmailVerification, auth.PurposePasswordReset))
+	ttl := flags.Duration("ttl", 30*time.Minute, "token lifetime")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"purpose": *purpose}); err != nil {
+		return err
+	}
+
+	existingUser, err := c.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	token, err := c.tokenService.GenerateToken(ctx, existingUser.ID, *purpose, *ttl)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(*ttl).UTC()
+	c.print(map[string]interface{}{
+		"user_id":    existingUser.ID,
+		"purpose":    *purpose,
+		"token":      token,
+		"expires_at": expiresAt,
+	}, "%s", token)
+	return nil
+}
+
+// runKeys handles the keys subcommands.
+func (c *cli) runKeys(subcommand string, args []string) error {
+	if subcommand != "generate" {
+		return fmt.Errorf("unknown keys subcommand %q", subcommand)
+	}
+
+	flags := newFlagSet("keys generate")
+	size := flags.Int("bytes", 32, "key size in bytes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *size < 32 {
+		return fmt.Errorf("-bytes must be at least 32")
+	}
+
+	key, err := utils.GenerateRandomString(*size)
+	if err != nil {
+		return err
+	}
+
+	c.print(map[string]interface{}{
+		"key":   key,
+		"bytes": *size,
+	}, "TOKEN_SECRET=%s", key)
+	return nil
+}
+
+// runBreach handles the breach subcommands.
+func (c *cli) runBreach(subcommand string, args []string) error {
+	if subcommand != "build" {
+		return fmt.Errorf("unknown breach subcommand %q", subcommand)
+	}
+
+	flags := newFlagSet("breach build")
+	in := flags.String("in", "", "Have I Been Pwned SHA-1 dump ordered by hash, optionally gzip compressed")
+	out := flags.String("out", "", "index file to write")
+	minCount := flags.Int("min-count", 1, "skip hashes seen fewer times than this")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(map[string]string{"in": *in, "out": *out}); err != nil {
+		return err
+	}
+
+	dumpFile, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer dumpFile.Close()
+
+	var dump io.Reader = dumpFile
+	if strings.HasSuffix(*in, ".gz") {
+		gzipReader, err := gzip.NewReader(dumpFile)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		dump = gzipReader
+	}
+
+	// Write to a temporary file so a failed build never replaces a working index
+	tmpPath := *out + ".tmp"
+	indexFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	count, err := password.BuildBreachIndex(dump, indexFile, *minCount)
+	if closeErr := indexFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, *out); err != nil {
+		return err
+	}
+
+	c.print(map[string]interface{}{
+		"index":  *out,
+		"hashes": count,
+	}, "wrote %d hash(es) to %s, set PASSWORD_BREACH_INDEX=%s to enable screening", count, *out, *out)
+	return nil
+}
+
+// runMigrate handles the migrate subcommands.
+func (c *cli) runMigrate(subcommand string, args []string) error {
+	ctx := context.Background()
+	flags := newFlagSet("migrate " + subcommand)
+	steps := flags.Int("steps", 1, "number of migrations to roll back")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := config.Init(); err != nil {
+		return fmt.Errorf("failed to initialize config: %w", err)
+	}
+	if err := db.Open(); err != nil {
+		return fmt.Errorf("database connection error: %w", err)
+	}
+	migrator, err := db.NewMigrator(db.GetDB())
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "up", "down":
+		var migrations []db.Migration
+		verb := "applied"
+		if subcommand == "up" {
+			migrations, err = migrator.Up(ctx)
+		} else {
+			verb = "reverted"
+			migrations, err = migrator.Down(ctx, *steps)
+		}
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(migrations))
+		for _, m := range migrations {
+			names = append(names, fmt.Sprintf("%04d_%s", m.Version, m.Name))
+		}
+		c.print(map[string]interface{}{verb: names}, "%s %d migration(s) %s", verb, len(names), strings.Join(names, ", "))
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		lines := make([]string, 0, len(statuses))
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			lines = append(lines, fmt.Sprintf("%04d_%-40s %s", s.Version, s.Name, state))
+		}
+		c.print(statuses, "%s", strings.Join(lines, "\n"))
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate subcommand %q", subcommand)
+}
+
+// runJob handles the job subcommands.
+func (c *cli) runJob(subcommand string, args []string) error {
+	ctx := context.Background()
+	flags := newFlagSet("job " + subcommand)
+	name := flags.String("name", "", "name of the job")
+
+	switch subcommand {
+	case "list":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		infos := c.scheduler.Jobs()
+		lines := make([]string, 0, len(infos))
+		for _, info := range infos {
+			lines = append(lines, fmt.Sprintf("%-30s %-15s next %s", info.Name, info.Schedule, info.NextRun.Format(time.RFC3339)))
+		}
+		c.print(infos, "%s", strings.Join(lines, "\n"))
+		return nil
+
+	case "run":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if err := requireFlags(map[string]string{"name": *name}); err != nil {
+			return err
+		}
+
+		run, err := c.scheduler.Trigger(ctx, *name)
+		if err != nil {
+			return err
+		}
+		if run.Status == models.JobRunFailed {
+			return fmt.Errorf("job %s failed: %s", run.Job, run.Error)
+		}
+		c.print(run, "job %s %s: %s", run.Job, run.Status, run.Result)
+		return nil
+
+	case "history":
+		limit := flags.Int("limit", 20, "number of runs to show")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		runs, err := c.scheduler.History(ctx, *name, *limit)
+		if err != nil {
+			return err
+		}
+
+		lines := make([]string, 0, len(runs))
+		for _, run := range runs {
+			outcome := run.Result
+			if run.Error != "" {
+				outcome = run.Error
+			}
+			lines = append(lines, fmt.Sprintf("%s  %-30s %-9s %-9s %s", run.StartedAt.Format(time.RFC3339), run.Job, run.Trigger, run.Status, outcome))
+		}
+		c.print(runs, "%d run(s)\n%s", len(runs), strings.Join(lines, "\n"))
+		return nil
+	}
+
+	return fmt.Errorf("unknown job subcommand %q", subcommand)
+}
+
+// findUser looks up a user by email address.
+func (c *cli) findUser(ctx context.Context, email string) (*models.User, error) {
+	if err := requireFlags(map[string]string{"email": email}); err != nil {
+		return nil, err
+	}
+
+	existingUser, err := c.userService.GetUserByEmail(ctx, &dto.GetUserByEmailDTO{Email: email})
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return nil, errs.ErrUserNotFound
+	}
+	return existingUser, nil
+}
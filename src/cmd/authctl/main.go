@@ -0,0 +1,236 @@
+// Command authctl is an operator tool for managing users, sessions, tokens and the database schema.
+package main
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/auth"
+	"authentication/src/internal/db"
+	"authentication/src/internal/jobs"
+	"authentication/src/internal/password"
+	"authentication/src/internal/privacy"
+	"authentication/src/internal/user"
+	"authentication/src/utils"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+const usageText = `Usage: authctl [-json] <command> <subcommand> [flags]
+
+Commands:
+  user create          -email -name -password [-verified]
+  user verify          -email
+  user reset-password  -email -password
+  user status          -email [-status active|suspended|banned|deactivated [-reason TEXT] [-until TIME]]
+  user role            -email -role user|admin
+  user login-history   -email [-limit N]
+  user export          -email [-format json|zip] [-out FILE]
+  user erase           -email
+  session list         -email
+  session revoke       -email [-id SESSION_ID]
+  keys generate        [-bytes N]
+  breach build         -in DUMP -out INDEX [-min-count N]
+  token issue          -email -purpose [-ttl DURATION]
+  job list
+  job run              -name JOB
+  job history          [-name JOB] [-limit N]
+  migrate up
+  migrate down         [-steps N]
+  migrate status
+`
+
+// cli holds the services shared by all commands and the selected output mode.
+type cli struct {
+	jsonOutput     bool
+	userService    user.UserService
+	authService    auth.AuthService
+	tokenService   auth.TokenService
+	scheduler      *jobs.Scheduler
+	privacyService privacy.Service
+}
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print results as JSON")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usageText) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &cli{jsonOutput: *jsonOutput}
+
+	command, subcommand, rest := args[0], args[1], args[2:]
+	var err error
+	switch command {
+	case "keys":
+		err = c.runKeys(subcommand, rest)
+	case "migrate":
+		err = c.runMigrate(subcommand, rest)
+	case "breach":
+		err = c.runBreach(subcommand, rest)
+	case "user", "session", "token", "job":
+		if err := c.initServices(); err != nil {
+			c.fail(err)
+		}
+		switch command {
+		case "user":
+			err = c.runUser(subcommand, rest)
+		case "session":
+			err = c.runSession(subcommand, rest)
+		case "token":
+			err = c.runToken(subcommand, rest)
+		case "job":
+			err = c.runJob(subcommand, rest)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		c.fail(err)
+	}
+}
+
+// initServices connects to Postgres and Redis and wires the same services the API server uses.
+func (c *cli) initServices() error {
+	if err := config.Init(); err != nil {
+		return fmt.Errorf("failed to initialize config: %w", err)
+	}
+	if err := db.Connect(); err != nil {
+		return fmt.Errorf("database connection error: %w", err)
+	}
+	db.InitRedisFromConfig()
+	redisClient := db.GetRedisClient()
+	sessions := auth.NewSessionStore(auth.NewRedisSessionStorage(), auth.NewSessionPolicyFromConfig(config.GetSessionConfig()))
+
+	tokenConfig := config.GetTokenConfig()
+	if err := auth.ValidateTokenSecret(tokenConfig.Secret); err != nil {
+		return fmt.Errorf("invalid TOKEN_SECRET: %w", err)
+	}
+	tokenStore, err := auth.NewTokenStore(tokenConfig.Store, redisClient, db.GetDB())
+	if err != nil {
+		return err
+	}
+	codeStore, err := auth.NewCodeStore(tokenConfig.Store, redisClient, db.GetDB())
+	if err != nil {
+		return err
+	}
+
+	passwordConfig := config.GetPasswordConfig()
+	passwordHasher, err := password.NewHasherFromConfig(passwordConfig)
+	if err != nil {
+		return err
+	}
+
+	passwordPolicy := password.NewPolicyFromConfig(passwordConfig)
+	var userOptions []user.UserServiceOption
+	if passwordConfig.BreachIndex != "" {
+		// The index stays open until the command exits
+		breachIndex, err := password.OpenBreachIndex(passwordConfig.BreachIndex)
+		if err != nil {
+			return err
+		}
+		passwordPolicy.BreachChecker = breachIndex
+		userOptions = append(userOptions, user.WithBreachChecker(breachIndex))
+	}
+
+	authConfig := config.GetAuthConfig()
+	userOptions = append(userOptions, user.WithPendingRegistrationTTL(time.Duration(authConfig.PendingRegistrationTTLHours)*time.Hour))
+
+	userRepository := user.NewUserRepository(db.GetDB())
+	pendingRegistrations := user.NewPendingRegistrationRepository(db.GetDB())
+	c.userService = user.NewUserService(userRepository, pendingRegistrations, passwordHasher, userOptions...)
+	c.tokenService = auth.NewTokenService(tokenConfig.Secret, tokenStore, codeStore, auth.CodePolicy{
+		Length:      tokenConfig.CodeLength,
+		MaxAttempts: tokenConfig.CodeMaxAttempts,
+	})
+	passwordHistory := user.NewPasswordHistoryRepository(db.GetDB())
+	loginHistory := auth.NewPostgresLoginHistory(db.GetDB())
+	c.authService = auth.NewAuthService(c.userService, c.tokenService, sessions, auth.NewRedisSessionIndex(redisClient), utils.NewMailer(), passwordHasher,
+		auth.WithPasswordPolicy(passwordPolicy),
+		auth.WithPasswordHistory(passwordHistory),
+		auth.WithLoginHistory(loginHistory, authConfig.NewDeviceAlerts),
+	)
+
+	exportJobs := privacy.NewExportJobRepository(db.GetDB())
+	auditLog := auth.NewPostgresAuditLog(db.GetDB())
+	privacyConfig := config.GetPrivacyConfig()
+	if err := privacy.ValidateEmailHashKey(privacyConfig.EmailHashKey, tokenConfig.Secret); err != nil {
+		return fmt.Errorf("invalid PRIVACY_EMAIL_HASH_KEY: %w", err)
+	}
+	c.privacyService = privacy.NewService(c.userService, c.authService, c.tokenService, passwordHasher,
+		privacy.NewTombstoneRepository(db.GetDB()), privacyConfig.EmailHashKey,
+		privacy.WithPasswordHistory(passwordHistory),
+		privacy.WithLoginHistory(loginHistory),
+		privacy.WithAuditLog(auditLog),
+		privacy.WithExportJobs(exportJobs, time.Duration(privacyConfig.ExportTTLHours)*time.Hour),
+	)
+
+	// The scheduler is not started; manual runs take the same locks as the servers' schedules
+	jobsConfig := config.GetJobsConfig()
+	locker, err := jobs.NewLocker(jobsConfig.LockBackend, redisClient, db.GetDB())
+	if err != nil {
+		return err
+	}
+	jobHistory := jobs.NewPostgresHistoryStore(db.GetDB())
+	stores := jobs.CleanupStores{
+		Users:                userRepository,
+		PendingRegistrations: pendingRegistrations,
+		History:              jobHistory,
+		LoginHistory:         loginHistory,
+		ExportJobs:           exportJobs,
+		AuditLog:             auditLog,
+	}
+	if tokenConfig.RotateAccessKeys {
+		stores.SigningKeys, err = auth.NewPostgresSigningKeyStore(db.GetDB(), tokenConfig.Secret)
+		if err != nil {
+			return err
+		}
+	}
+	c.scheduler = jobs.NewScheduler(locker, jobHistory)
+	return jobs.RegisterCleanupJobs(c.scheduler, jobsConfig, stores)
+}
+
+// print writes v as JSON in JSON mode, or the formatted text otherwise.
+func (c *cli) print(v interface{}, format string, args ...interface{}) {
+	if c.jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(v)
+		return
+	}
+	fmt.Printf(format+"\n", args...)
+}
+
+// fail reports err in the selected output mode and exits.
+func (c *cli) fail(err error) {
+	if c.jsonOutput {
+		_ = json.NewEncoder(os.Stderr).Encode(map[string]string{"error": err.Error()})
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	os.Exit(1)
+}
+
+// newFlagSet creates a flag set for a subcommand that reports errors instead of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	return flags
+}
+
+// requireFlags returns an error naming the first empty required flag.
+func requireFlags(values map[string]string) error {
+	for name, value := range values {
+		if value == "" {
+			return fmt.Errorf("-%s is required", name)
+		}
+	}
+	return nil
+}
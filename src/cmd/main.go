@@ -2,12 +2,17 @@ package main
 
 import (
 	"authentication/src/config"
+	"authentication/src/internal/app"
 	"authentication/src/internal/auth"
 	"authentication/src/internal/db"
+	"authentication/src/internal/jobs"
+	"authentication/src/internal/password"
+	"authentication/src/internal/privacy"
+	"authentication/src/internal/risk"
+	"authentication/src/internal/security"
 	"authentication/src/internal/user"
-	"encoding/gob"
-	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
+	"authentication/src/utils"
+	"context"
 	"log"
 	"os"
 )
@@ -18,46 +23,171 @@ func main() {
 		log.Fatalf("Failed to initialize config: %v", err)
 	}
 
-	app := fiber.New()
-
 	err := db.Connect()
 	if err != nil {
 		log.Printf("Database connection error: %v", err)
 		os.Exit(1)
 	}
 
-	auth.InitSessionStore()
-
 	database := db.GetDB()
 	if database == nil {
 		log.Fatal("Failed to initialize database")
 	}
 
 	db.InitRedisFromConfig()
+	redisClient := db.GetRedisClient()
 
-	gob.Register(uuid.UUID{})
-	userRepo := user.NewUserRepository(database)
-	userService := user.NewUserService(userRepo)
+	tokenConfig := config.GetTokenConfig()
+	if err := auth.ValidateTokenSecret(tokenConfig.Secret); err != nil {
+		log.Fatalf("Invalid TOKEN_SECRET: %v", err)
+	}
+	tokenStore, err := auth.NewTokenStore(tokenConfig.Store, redisClient, database)
+	if err != nil {
+		log.Fatalf("Failed to initialize token store: %v", err)
+	}
+	codeStore, err := auth.NewCodeStore(tokenConfig.Store, redisClient, database)
+	if err != nil {
+		log.Fatalf("Failed to initialize code store: %v", err)
+	}
+	var accessTokenKey *auth.SigningKey
+	if tokenConfig.AccessKeyFile != "" {
+		accessTokenKey, err = auth.LoadSigningKey(tokenConfig.AccessKeyFile, tokenConfig.AccessKeyID)
+		if err != nil {
+			log.Fatalf("Failed to load access token signing key: %v", err)
+		}
+		log.Printf("Signing access tokens with key %s", accessTokenKey.KeyID)
+	}
+	previousAccessTokenKeys, err := auth.LoadSigningKeys(tokenConfig.PreviousAccessKeyFiles)
+	if err != nil {
+		log.Fatalf("Failed to load previous access token signing keys: %v", err)
+	}
+	var signingKeyStore auth.SigningKeyStore
+	if tokenConfig.RotateAccessKeys {
+		signingKeyStore, err = auth.NewPostgresSigningKeyStore(database, tokenConfig.Secret)
+		if err != nil {
+			log.Fatalf("Failed to initialize signing key store: %v", err)
+		}
+		signingKey, err := auth.EnsureSigningKey(context.Background(), signingKeyStore)
+		if err != nil {
+			log.Fatalf("Failed to load rotated access token signing key: %v", err)
+		}
+		log.Printf("Signing access tokens with rotated key %s", signingKey.KeyID)
+	}
+	passwordConfig := config.GetPasswordConfig()
+	passwordHasher, err := password.NewHasherFromConfig(passwordConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize password hasher: %v", err)
+	}
+	passwordPolicy := password.NewPolicyFromConfig(passwordConfig)
+	sessionPolicy := auth.NewSessionPolicyFromConfig(config.GetSessionConfig())
+	corsPolicy, err := security.NewCORSPolicyFromConfig(config.GetCORSConfig())
+	if err != nil {
+		log.Fatalf("Invalid CORS configuration: %v", err)
+	}
+	headerPolicy := security.NewHeaderPolicyFromConfig(config.GetSecurityHeadersConfig())
+	privacyConfig := config.GetPrivacyConfig()
+	if err := privacy.ValidateEmailHashKey(privacyConfig.EmailHashKey, tokenConfig.Secret); err != nil {
+		log.Fatalf("Invalid PRIVACY_EMAIL_HASH_KEY: %v", err)
+	}
+
+	var breachChecker password.BreachChecker
+	if passwordConfig.BreachIndex != "" {
+		breachIndex, err := password.OpenBreachIndex(passwordConfig.BreachIndex)
+		if err != nil {
+			log.Fatalf("Failed to open breached password index: %v", err)
+		}
+		defer breachIndex.Close()
+		log.Printf("Screening passwords against %d breached password hashes", breachIndex.Count())
+		breachChecker = breachIndex
+	}
+
+	userRepository := user.NewUserRepository(database)
+	pendingRegistrations := user.NewPendingRegistrationRepository(database)
+	loginHistory := auth.NewPostgresLoginHistory(database)
+	auditLog := auth.NewPostgresAuditLog(database)
+	exportJobs := privacy.NewExportJobRepository(database)
+
+	var riskEngine *risk.Engine
+	riskConfig := config.GetRiskConfig()
+	if riskConfig.Enabled {
+		var riskOptions []risk.EngineOption
+		if riskConfig.GeoIPDatabase != "" {
+			geoIPDatabase, err := risk.OpenGeoIPDatabase(riskConfig.GeoIPDatabase)
+			if err != nil {
+				log.Fatalf("Failed to open GeoIP database: %v", err)
+			}
+			defer geoIPDatabase.Close()
+			log.Printf("Locating logins with the %s database", geoIPDatabase.Type())
+			riskOptions = append(riskOptions, risk.WithLocator(geoIPDatabase))
+		}
+		if riskConfig.BadIPList != "" {
+			badIPs, err := risk.LoadIPList(riskConfig.BadIPList)
+			if err != nil {
+				log.Fatalf("Failed to load bad IP list: %v", err)
+			}
+			log.Printf("Scoring logins against %d known-bad addresses and networks", badIPs.Len())
+			riskOptions = append(riskOptions, risk.WithBadIPs(badIPs))
+		}
+		riskEngine = risk.NewEngine(loginHistory, risk.NewPolicyFromConfig(riskConfig), riskOptions...)
+	}
+
+	jobsConfig := config.GetJobsConfig()
+	if jobsConfig.Enabled {
+		locker, err := jobs.NewLocker(jobsConfig.LockBackend, redisClient, database)
+		if err != nil {
+			log.Fatalf("Failed to initialize job locker: %v", err)
+		}
+		jobHistory := jobs.NewPostgresHistoryStore(database)
+		scheduler := jobs.NewScheduler(locker, jobHistory)
+		err = jobs.RegisterCleanupJobs(scheduler, jobsConfig, jobs.CleanupStores{
+			Users:                userRepository,
+			PendingRegistrations: pendingRegistrations,
+			History:              jobHistory,
+			LoginHistory:         loginHistory,
+			ExportJobs:           exportJobs,
+			AuditLog:             auditLog,
+			SigningKeys:          signingKeyStore,
+		})
+		if err != nil {
+			log.Fatalf("Failed to register background jobs: %v", err)
+		}
+		scheduler.Start(context.Background())
+		defer scheduler.Stop()
+	}
 
-	tokenService := auth.NewTokenService("your-secret-key") // Replace with your actual secret key
-	if tokenService == nil {
-		log.Fatal("Failed to initialize token service")
-	}
-	authService := auth.NewAuthService(userService, tokenService)
-	if authService == nil {
-		log.Fatal("Failed to initialize auth service")
-	}
-	authHandler := auth.NewAuthHandler(authService)
-	authGroup := app.Group("/auth")
-	authGroup.Post("/register", authHandler.Register)
-	authGroup.Post("/login", authHandler.Login)
-	authGroup.Post("/logout", auth.RequireAuth(), authHandler.Logout)
-	authGroup.Post("/forgot-password", authHandler.ForgotPassword)
-	authGroup.Post("/resend-verification-email", authHandler.SendVerificationEmail)
-	authGroup.Post("/verify-email/", authHandler.VerifyEmail)
-	authGroup.Post("/reset-password", authHandler.ResetPassword)
+	application := app.New(app.Dependencies{
+		UserRepository:          userRepository,
+		PendingRegistrations:    pendingRegistrations,
+		PasswordHistory:         user.NewPasswordHistoryRepository(database),
+		Tombstones:              privacy.NewTombstoneRepository(database),
+		ExportJobs:              exportJobs,
+		LoginHistory:            loginHistory,
+		AuditLog:                auditLog,
+		TokenStore:              tokenStore,
+		CodeStore:               codeStore,
+		SessionStorage:          auth.NewRedisSessionStorage(),
+		SessionIndex:            auth.NewRedisSessionIndex(redisClient),
+		AccessTokenKey:          accessTokenKey,
+		PreviousAccessTokenKeys: previousAccessTokenKeys,
+		SigningKeyStore:         signingKeyStore,
+		RateLimiter:             auth.NewRedisRateLimiter(redisClient),
+		ForwardAuthCache:        auth.NewRedisForwardAuthCache(redisClient),
+		Mailer:                  utils.NewMailer(),
+		PasswordHasher:          passwordHasher,
+		PasswordPolicy:          &passwordPolicy,
+		BreachChecker:           breachChecker,
+		RiskEngine:              riskEngine,
+		SessionPolicy:           &sessionPolicy,
+		CORSPolicy:              corsPolicy,
+		SecurityHeaders:         &headerPolicy,
+		ProxyConfig:             config.GetProxyConfig(),
+		PrivacyConfig:           privacyConfig,
+		TokenConfig:             tokenConfig,
+		AuthConfig:              config.GetAuthConfig(),
+		ForwardAuthConfig:       config.GetForwardAuthConfig(),
+	})
 
-	err = app.Listen(":3000")
+	err = application.Listen(":3000")
 	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
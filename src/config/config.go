@@ -5,6 +5,7 @@ import (
 	"github.com/joho/godotenv"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Init loads environment variables and performs additional configuration initialization.
@@ -37,6 +38,57 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// getEnvBool retrieves a boolean environment variable or returns a default value if not set or invalid.
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvInt retrieves an integer environment variable or returns a default value if not set or invalid.
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList retrieves a comma-separated environment variable as a list, skipping empty entries.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvListOr retrieves a comma-separated environment variable as a list, or returns a default value if it has no entries.
+func getEnvListOr(key string, defaultValue []string) []string {
+	if values := getEnvList(key); len(values) > 0 {
+		return values
+	}
+	return defaultValue
+}
+
+// getEnvIntMap retrieves a comma-separated list of name=number pairs, skipping invalid entries.
+func getEnvIntMap(key string) map[string]int {
+	values := make(map[string]int)
+	for _, entry := range getEnvList(key) {
+		name, value, found := strings.Cut(entry, "=")
+		number, err := strconv.Atoi(strings.TrimSpace(value))
+		if !found || err != nil {
+			continue
+		}
+		values[strings.TrimSpace(name)] = number
+	}
+	return values
+}
+
 // GetMailerConfig returns the mailer configuration from environment variables.
 func GetMailerConfig() MailerConfig {
 	return MailerConfig{
@@ -62,11 +114,173 @@ func GetRedisConfig() RedisConfig {
 // GetDBConfig returns the database configuration from environment variables.
 func GetDBConfig() DBConfig {
 	return DBConfig{
-		Host:     getEnv("DB_HOST", "localhost"),
-		Port:     getEnv("DB_PORT", "5432"),
-		Username: getEnv("DB_USERNAME", "postgres"),
-		Password: getEnv("DB_PASSWORD", "admin"),
-		Database: getEnv("DB_DATABASE", "testdb"),
-		SSLMode:  getEnv("DB_SSLMODE", "disable"),
+		Host:        getEnv("DB_HOST", "localhost"),
+		Port:        getEnv("DB_PORT", "5432"),
+		Username:    getEnv("DB_USERNAME", "postgres"),
+		Password:    getEnv("DB_PASSWORD", "admin"),
+		Database:    getEnv("DB_DATABASE", "testdb"),
+		SSLMode:     getEnv("DB_SSLMODE", "disable"),
+		AutoMigrate: getEnvBool("DB_AUTO_MIGRATE", true),
+	}
+}
+
+// GetTokenConfig returns the token signing configuration from environment variables.
+func GetTokenConfig() TokenConfig {
+	return TokenConfig{
+		Secret:                 getEnv("TOKEN_SECRET", ""),
+		Store:                  getEnv("TOKEN_STORE", "redis"),
+		CodeLength:             getEnvInt("TOKEN_CODE_LENGTH", 6),
+		CodeMaxAttempts:        getEnvInt("TOKEN_CODE_MAX_ATTEMPTS", 5),
+		AccessKeyFile:          getEnv("TOKEN_ACCESS_KEY_FILE", ""),
+		AccessKeyID:            getEnv("TOKEN_ACCESS_KEY_ID", ""),
+		PreviousAccessKeyFiles: getEnvList("TOKEN_PREVIOUS_ACCESS_KEY_FILES"),
+		RotateAccessKeys:       getEnvBool("TOKEN_ROTATE_ACCESS_KEYS", false),
+		Issuer:                 getEnv("TOKEN_ISSUER", ""),
+		Audience:               getEnv("TOKEN_AUDIENCE", ""),
+	}
+}
+
+// GetAuthConfig returns the authentication behaviour configuration from environment variables.
+func GetAuthConfig() AuthConfig {
+	return AuthConfig{
+		EnumerationSafe:                getEnvBool("AUTH_ENUMERATION_SAFE", false),
+		PendingRegistrationTTLHours:    getEnvInt("PENDING_REGISTRATION_TTL_HOURS", 24),
+		NewDeviceAlerts:                getEnvBool("AUTH_NEW_DEVICE_ALERTS", true),
+		ReauthenticationMaxAgeMinutes:  getEnvInt("AUTH_REAUTHENTICATION_MAX_AGE_MINUTES", 10),
+		ReauthenticationMaxFailures:    getEnvInt("AUTH_REAUTHENTICATION_MAX_FAILURES", 5),
+		ReauthenticationLockoutMinutes: getEnvInt("AUTH_REAUTHENTICATION_LOCKOUT_MINUTES", 15),
+		AccessTokenTTLMinutes:          getEnvInt("AUTH_ACCESS_TOKEN_TTL_MINUTES", 15),
+		AccessTokenScopes:              getEnvList("AUTH_ACCESS_TOKEN_SCOPES"),
+		MailRateLimit:                  getEnvInt("AUTH_MAIL_RATE_LIMIT", 5),
+		MailRateLimitWindowMinutes:     getEnvInt("AUTH_MAIL_RATE_LIMIT_WINDOW_MINUTES", 60),
+	}
+}
+
+// GetPasswordConfig returns the password hashing configuration from environment variables.
+func GetPasswordConfig() PasswordConfig {
+	return PasswordConfig{
+		Algorithm:         getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2Memory:      getEnvInt("PASSWORD_ARGON2_MEMORY", 64*1024),
+		Argon2Time:        getEnvInt("PASSWORD_ARGON2_TIME", 3),
+		Argon2Parallelism: getEnvInt("PASSWORD_ARGON2_PARALLELISM", 2),
+		BcryptCost:        getEnvInt("PASSWORD_BCRYPT_COST", 12),
+		Pepper:            getEnv("PASSWORD_PEPPER", ""),
+		MinLength:         getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:         getEnvInt("PASSWORD_MAX_LENGTH", 128),
+		RequireUppercase:  getEnvBool("PASSWORD_REQUIRE_UPPERCASE", false),
+		RequireLowercase:  getEnvBool("PASSWORD_REQUIRE_LOWERCASE", false),
+		RequireDigit:      getEnvBool("PASSWORD_REQUIRE_DIGIT", false),
+		RequireSymbol:     getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		MaxRepeats:        getEnvInt("PASSWORD_MAX_REPEATS", 3),
+		BannedWords:       getEnvList("PASSWORD_BANNED_WORDS"),
+		MinScore:          getEnvInt("PASSWORD_MIN_SCORE", 2),
+		HistorySize:       getEnvInt("PASSWORD_HISTORY_SIZE", 5),
+		MaxAgeDays:        getEnvInt("PASSWORD_MAX_AGE_DAYS", 0),
+		BreachIndex:       getEnv("PASSWORD_BREACH_INDEX", ""),
+	}
+}
+
+// GetJobsConfig returns the background job scheduler configuration from environment variables.
+func GetJobsConfig() JobsConfig {
+	return JobsConfig{
+		Enabled:                           getEnvBool("JOBS_ENABLED", true),
+		LockBackend:                       getEnv("JOBS_LOCK_BACKEND", "redis"),
+		PurgePendingRegistrationsSchedule: getEnv("JOBS_PURGE_PENDING_REGISTRATIONS_SCHEDULE", "@hourly"),
+		PurgeDeletedUsersSchedule:         getEnv("JOBS_PURGE_DELETED_USERS_SCHEDULE", "0 3 * * *"),
+		DeletedUserRetentionDays:          getEnvInt("JOBS_DELETED_USER_RETENTION_DAYS", 30),
+		PruneJobRunsSchedule:              getEnv("JOBS_PRUNE_JOB_RUNS_SCHEDULE", "30 3 * * *"),
+		JobRunRetentionDays:               getEnvInt("JOBS_JOB_RUN_RETENTION_DAYS", 30),
+		PruneLoginHistorySchedule:         getEnv("JOBS_PRUNE_LOGIN_HISTORY_SCHEDULE", "45 3 * * *"),
+		LoginHistoryRetentionDays:         getEnvInt("JOBS_LOGIN_HISTORY_RETENTION_DAYS", 90),
+		PurgeDataExportsSchedule:          getEnv("JOBS_PURGE_DATA_EXPORTS_SCHEDULE", "@hourly"),
+		PruneAuditLogSchedule:             getEnv("JOBS_PRUNE_AUDIT_LOG_SCHEDULE", "15 4 * * *"),
+		AuditLogRetentionDays:             getEnvInt("JOBS_AUDIT_LOG_RETENTION_DAYS", 365),
+		RotateSigningKeySchedule:          getEnv("JOBS_ROTATE_SIGNING_KEY_SCHEDULE", "0 4 1 * *"),
+		SigningKeyRetentionDays:           getEnvInt("JOBS_SIGNING_KEY_RETENTION_DAYS", 1),
+	}
+}
+
+// GetRiskConfig returns the login risk scoring configuration from environment variables.
+func GetRiskConfig() RiskConfig {
+	return RiskConfig{
+		Enabled:                getEnvBool("RISK_ENABLED", false),
+		GeoIPDatabase:          getEnv("RISK_GEOIP_DATABASE", ""),
+		BadIPList:              getEnv("RISK_BAD_IP_LIST", ""),
+		WeightBadIP:            getEnvInt("RISK_WEIGHT_BAD_IP", 100),
+		WeightImpossibleTravel: getEnvInt("RISK_WEIGHT_IMPOSSIBLE_TRAVEL", 60),
+		WeightNewCountry:       getEnvInt("RISK_WEIGHT_NEW_COUNTRY", 30),
+		WeightNewDevice:        getEnvInt("RISK_WEIGHT_NEW_DEVICE", 20),
+		MaxTravelSpeedKmh:      getEnvInt("RISK_MAX_TRAVEL_SPEED_KMH", 1000),
+		StepUpThreshold:        getEnvInt("RISK_STEP_UP_THRESHOLD", 50),
+		BlockThreshold:         getEnvInt("RISK_BLOCK_THRESHOLD", 100),
+	}
+}
+
+// GetSessionConfig returns the session lifetime and binding configuration from environment variables.
+func GetSessionConfig() SessionConfig {
+	return SessionConfig{
+		IdleTimeoutMinutes:            getEnvInt("SESSION_IDLE_TIMEOUT_MINUTES", 30),
+		AbsoluteTimeoutHours:          getEnvInt("SESSION_ABSOLUTE_TIMEOUT_HOURS", 24),
+		RememberMeIdleTimeoutHours:    getEnvInt("SESSION_REMEMBER_ME_IDLE_TIMEOUT_HOURS", 7*24),
+		RememberMeAbsoluteTimeoutDays: getEnvInt("SESSION_REMEMBER_ME_ABSOLUTE_TIMEOUT_DAYS", 30),
+		Binding:                       getEnv("SESSION_BINDING", "off"),
+		BindUserAgent:                 getEnvBool("SESSION_BIND_USER_AGENT", true),
+		BindIPPrefix:                  getEnvBool("SESSION_BIND_IP_PREFIX", true),
+		IPv4PrefixLength:              getEnvInt("SESSION_IPV4_PREFIX_LENGTH", 24),
+		IPv6PrefixLength:              getEnvInt("SESSION_IPV6_PREFIX_LENGTH", 64),
+		MaxConcurrent:                 getEnvInt("SESSION_MAX_CONCURRENT", 0),
+		MaxConcurrentByRole:           getEnvIntMap("SESSION_MAX_CONCURRENT_BY_ROLE"),
+		LimitStrategy:                 getEnv("SESSION_LIMIT_STRATEGY", "reject"),
+	}
+}
+
+// GetCORSConfig returns the cross-origin resource sharing configuration from environment variables.
+func GetCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS"),
+		AllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", true),
+		AllowedMethods:   getEnvListOr("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"}),
+		AllowedHeaders:   getEnvListOr("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization", "X-CSRF-Token"}),
+		ExposedHeaders:   getEnvListOr("CORS_EXPOSED_HEADERS", []string{"X-CSRF-Token"}),
+		MaxAgeSeconds:    getEnvInt("CORS_MAX_AGE_SECONDS", 600),
+	}
+}
+
+// GetSecurityHeadersConfig returns the security header configuration from environment variables.
+func GetSecurityHeadersConfig() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		HSTSMaxAgeSeconds:     getEnvInt("SECURITY_HSTS_MAX_AGE_SECONDS", 365*24*60*60),
+		HSTSIncludeSubdomains: getEnvBool("SECURITY_HSTS_INCLUDE_SUBDOMAINS", true),
+		HSTSPreload:           getEnvBool("SECURITY_HSTS_PRELOAD", false),
+		ContentSecurityPolicy: getEnv("SECURITY_CONTENT_SECURITY_POLICY", "default-src 'none'; frame-ancestors 'none'"),
+		FrameOptions:          getEnv("SECURITY_FRAME_OPTIONS", "DENY"),
+		ReferrerPolicy:        getEnv("SECURITY_REFERRER_POLICY", "no-referrer"),
+		PermissionsPolicy:     getEnv("SECURITY_PERMISSIONS_POLICY", "camera=(), microphone=(), geolocation=(), payment=()"),
+	}
+}
+
+// GetPrivacyConfig returns the data export and erasure configuration from environment variables.
+func GetPrivacyConfig() PrivacyConfig {
+	return PrivacyConfig{
+		EmailHashKey:   getEnv("PRIVACY_EMAIL_HASH_KEY", ""),
+		ExportTTLHours: getEnvInt("PRIVACY_EXPORT_TTL_HOURS", 24),
+	}
+}
+
+// GetProxyConfig returns the reverse proxy configuration from environment variables.
+func GetProxyConfig() ProxyConfig {
+	return ProxyConfig{
+		Header:            getEnv("PROXY_HEADER", ""),
+		TrustedProxyCheck: getEnvBool("PROXY_TRUSTED_PROXY_CHECK", true),
+		TrustedProxies:    getEnvList("PROXY_TRUSTED_PROXIES"),
+	}
+}
+
+// GetForwardAuthConfig returns the forward-auth configuration from environment variables.
+func GetForwardAuthConfig() ForwardAuthConfig {
+	return ForwardAuthConfig{
+		CacheTTLSeconds:      getEnvInt("FORWARD_AUTH_CACHE_TTL_SECONDS", 5),
+		LoginURL:             getEnv("FORWARD_AUTH_LOGIN_URL", ""),
+		AllowedRedirectHosts: getEnvList("FORWARD_AUTH_ALLOWED_REDIRECT_HOSTS"),
 	}
 }
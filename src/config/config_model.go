@@ -9,6 +9,8 @@ type DBConfig struct {
 	Password string
 	Database string
 	SSLMode  string
+	// AutoMigrate applies pending migrations when the application connects.
+	AutoMigrate bool
 }
 
 // MailerConfig holds mailer configuration values.
@@ -26,3 +28,235 @@ type RedisConfig struct {
 	Database int
 	SSLMode  string
 }
+
+// TokenConfig holds token signing configuration values.
+type TokenConfig struct {
+	// Secret signs one-time and access tokens. It is required and must be at least 32 characters long.
+	Secret string
+	// Store selects the one-time token and code backend: "redis", "postgres" or "memory".
+	Store string
+	// CodeLength is the number of digits in numeric verification codes (6-8).
+	CodeLength int
+	// CodeMaxAttempts is the number of wrong guesses allowed per code.
+	CodeMaxAttempts int
+	// AccessKeyFile is the path of a PEM-encoded RSA or Ed25519 private key to sign access tokens
+	// with; when empty they are signed with Secret.
+	AccessKeyFile string
+	// AccessKeyID is the key ID of the access token key; the key thumbprint is used when empty.
+	AccessKeyID string
+	// PreviousAccessKeyFiles are the private keys access tokens were signed with before AccessKeyFile,
+	// each a path or "keyID=path". Tokens signed with them stay valid and their public keys published.
+	PreviousAccessKeyFiles []string
+	// RotateAccessKeys signs access tokens with generated keys kept in Postgres, which the
+	// rotate-signing-key job replaces, instead of AccessKeyFile.
+	RotateAccessKeys bool
+	// Issuer is the "iss" claim of access tokens; when empty they carry none.
+	Issuer string
+	// Audience is the "aud" claim of access tokens; when empty they carry none.
+	Audience string
+}
+
+// AuthConfig holds authentication behaviour configuration values.
+type AuthConfig struct {
+	// EnumerationSafe makes auth endpoints respond identically whether or not an account exists.
+	EnumerationSafe bool
+	// PendingRegistrationTTLHours is how long an unverified signup is kept before it must be repeated.
+	PendingRegistrationTTLHours int
+	// NewDeviceAlerts mails users when their account is logged into from an unrecognized browser.
+	NewDeviceAlerts bool
+	// ReauthenticationMaxAgeMinutes is how long after the last authentication sensitive actions
+	// such as changing the password are allowed without authenticating again.
+	ReauthenticationMaxAgeMinutes int
+	// ReauthenticationMaxFailures is how many reauthentication attempts in a row may fail before
+	// reauthentication is locked for ReauthenticationLockoutMinutes; 0 disables the lockout.
+	ReauthenticationMaxFailures    int
+	ReauthenticationLockoutMinutes int
+	// AccessTokenTTLMinutes is how long access tokens issued by /auth/token are valid.
+	AccessTokenTTLMinutes int
+	// AccessTokenScopes are the scopes access tokens can be requested with.
+	AccessTokenScopes []string
+	// MailRateLimit is how many verification, password reset or sign-in mails of each kind can be
+	// requested for an address per MailRateLimitWindowMinutes; 0 disables the limit.
+	MailRateLimit              int
+	MailRateLimitWindowMinutes int
+}
+
+// PasswordConfig holds password hashing configuration values.
+type PasswordConfig struct {
+	// Algorithm used for new hashes: "argon2id" or "bcrypt".
+	Algorithm string
+	// Argon2Memory is the argon2id memory cost in KiB.
+	Argon2Memory int
+	// Argon2Time is the argon2id number of iterations.
+	Argon2Time int
+	// Argon2Parallelism is the argon2id number of lanes.
+	Argon2Parallelism int
+	// BcryptCost is the bcrypt work factor.
+	BcryptCost int
+	// Pepper is an optional server-side secret mixed into password hashes.
+	Pepper string
+
+	// MinLength and MaxLength bound the number of characters of new passwords.
+	MinLength int
+	MaxLength int
+	// Require* demand at least one character of the class in new passwords.
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	// MaxRepeats is the longest allowed run of one character, 0 disables the rule.
+	MaxRepeats int
+	// BannedWords may not appear in new passwords.
+	BannedWords []string
+	// MinScore is the minimum strength score from 0 to 4.
+	MinScore int
+	// HistorySize is the number of recent passwords that may not be reused.
+	HistorySize int
+	// MaxAgeDays is the number of days after which a password expires; 0 disables expiry.
+	MaxAgeDays int
+	// BreachIndex is the path of a breached-password index built with authctl; empty disables screening.
+	BreachIndex string
+}
+
+// JobsConfig holds background job scheduler configuration values.
+type JobsConfig struct {
+	// Enabled starts the scheduler with the API server.
+	Enabled bool
+	// LockBackend selects where replicas coordinate job runs: "redis", "postgres" or "memory".
+	LockBackend string
+	// PurgePendingRegistrationsSchedule is the cron expression of the expired pending registration cleanup.
+	PurgePendingRegistrationsSchedule string
+	// PurgeDeletedUsersSchedule is the cron expression of the soft-deleted user cleanup.
+	PurgeDeletedUsersSchedule string
+	// DeletedUserRetentionDays is how long soft-deleted users are kept before they are removed for good.
+	DeletedUserRetentionDays int
+	// PruneJobRunsSchedule is the cron expression of the job run history cleanup.
+	PruneJobRunsSchedule string
+	// JobRunRetentionDays is how long job run history is kept.
+	JobRunRetentionDays int
+	// PruneLoginHistorySchedule is the cron expression of the login history cleanup.
+	PruneLoginHistorySchedule string
+	// LoginHistoryRetentionDays is how long login attempts are kept.
+	LoginHistoryRetentionDays int
+	// PurgeDataExportsSchedule is the cron expression of the expired data export cleanup.
+	PurgeDataExportsSchedule string
+	// PruneAuditLogSchedule is the cron expression of the audit log cleanup.
+	PruneAuditLogSchedule string
+	// AuditLogRetentionDays is how long audit events are kept.
+	AuditLogRetentionDays int
+	// RotateSigningKeySchedule is the cron expression of the access token signing key rotation.
+	RotateSigningKeySchedule string
+	// SigningKeyRetentionDays is how long a rotated signing key stays valid after it was replaced;
+	// it must be longer than the access token lifetime.
+	SigningKeyRetentionDays int
+}
+
+// RiskConfig holds login risk scoring configuration values.
+type RiskConfig struct {
+	// Enabled scores every login with valid credentials.
+	Enabled bool
+	// GeoIPDatabase is the path of a MaxMind-format country or city database; empty disables
+	// the new country and impossible travel signals.
+	GeoIPDatabase string
+	// BadIPList is the path of a file of known-bad addresses and CIDR ranges, one per line.
+	BadIPList string
+
+	// The weights add up to the score of a login.
+	WeightBadIP            int
+	WeightImpossibleTravel int
+	WeightNewCountry       int
+	WeightNewDevice        int
+	// MaxTravelSpeedKmh is the fastest plausible travel between two logins.
+	MaxTravelSpeedKmh int
+
+	// StepUpThreshold is the score from which a login must be confirmed by email.
+	StepUpThreshold int
+	// BlockThreshold is the score from which a login is refused.
+	BlockThreshold int
+}
+
+// SessionConfig holds session lifetime and binding configuration values.
+type SessionConfig struct {
+	// IdleTimeoutMinutes ends sessions that were not used for this long.
+	IdleTimeoutMinutes int
+	// AbsoluteTimeoutHours ends sessions this long after login, however active they are.
+	AbsoluteTimeoutHours int
+	// RememberMeIdleTimeoutHours and RememberMeAbsoluteTimeoutDays apply to logins with "remember me".
+	RememberMeIdleTimeoutHours    int
+	RememberMeAbsoluteTimeoutDays int
+
+	// Binding selects what happens when a session is used from another client: "off", "warn" or "enforce".
+	Binding string
+	// BindUserAgent and BindIPPrefix select what a session is bound to.
+	BindUserAgent bool
+	BindIPPrefix  bool
+	// IPv4PrefixLength and IPv6PrefixLength are the sizes of the networks sessions are bound to.
+	IPv4PrefixLength int
+	IPv6PrefixLength int
+
+	// MaxConcurrent limits the sessions a user can have at the same time; 0 means no limit.
+	MaxConcurrent int
+	// MaxConcurrentByRole overrides MaxConcurrent for roles, parsed from "admin=1,user=3".
+	MaxConcurrentByRole map[string]int
+	// LimitStrategy selects what a login over the limit does: "reject" it or "evict_oldest" session.
+	LimitStrategy string
+}
+
+// CORSConfig holds the cross-origin resource sharing configuration values.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins, like https://app.example.com, that may call the API from a
+	// browser; empty disables CORS.
+	AllowedOrigins []string
+	// AllowCredentials lets the allowed origins send the session cookie.
+	AllowCredentials bool
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	// ExposedHeaders lists the response headers scripts of the allowed origins can read.
+	ExposedHeaders []string
+	// MaxAgeSeconds is how long browsers may cache a preflight response.
+	MaxAgeSeconds int
+}
+
+// SecurityHeadersConfig holds the values of the security headers sent with every response.
+type SecurityHeadersConfig struct {
+	// HSTSMaxAgeSeconds is the max-age of Strict-Transport-Security; 0 omits the header.
+	HSTSMaxAgeSeconds     int
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// The remaining headers are sent as configured; "off" omits one.
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+}
+
+// PrivacyConfig holds data export and erasure configuration values.
+type PrivacyConfig struct {
+	// EmailHashKey keys the hashes of erased email addresses in tombstones. It is required and must
+	// be a secret of its own, at least 32 characters long.
+	EmailHashKey string
+	// ExportTTLHours is how long a finished data export can be downloaded.
+	ExportTTLHours int
+}
+
+// ProxyConfig holds the configuration of the reverse proxies in front of the API.
+type ProxyConfig struct {
+	// Header is the header proxies put the client address in, like X-Forwarded-For; when empty the
+	// address of the connection is used.
+	Header string
+	// TrustedProxyCheck only takes the client address from Header on connections from TrustedProxies.
+	TrustedProxyCheck bool
+	// TrustedProxies lists the addresses and CIDR ranges of the proxies.
+	TrustedProxies []string
+}
+
+// ForwardAuthConfig holds the configuration of the /auth/verify endpoint for reverse proxies.
+type ForwardAuthConfig struct {
+	// CacheTTLSeconds is how long successful checks are cached; 0 disables the cache.
+	CacheTTLSeconds int
+	// LoginURL is where browsers are redirected when the proxy asks for redirects.
+	LoginURL string
+	// AllowedRedirectHosts lists the hosts, like wiki.example.com or *.example.com, of the pages
+	// passed to the login page to return to; pages on other hosts are left out.
+	AllowedRedirectHosts []string
+}
@@ -0,0 +1,215 @@
+// Package app wires the services and HTTP routes of the authentication API.
+package app
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/auth"
+	"authentication/src/internal/models"
+	"authentication/src/internal/password"
+	"authentication/src/internal/privacy"
+	"authentication/src/internal/risk"
+	"authentication/src/internal/security"
+	"authentication/src/internal/user"
+	"authentication/src/utils"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"time"
+)
+
+// Dependencies holds the storage backends and settings the application is built from.
+type Dependencies struct {
+	UserRepository user.UserRepository
+	// PendingRegistrations holds signups until their email address is verified.
+	PendingRegistrations user.PendingRegistrationRepository
+	// PasswordHistory keeps previous password hashes; only the current password is checked for reuse when nil.
+	PasswordHistory user.PasswordHistoryRepository
+	// Tombstones records account erasures.
+	Tombstones privacy.TombstoneRepository
+	// ExportJobs holds requested data exports until they are downloaded.
+	ExportJobs privacy.ExportJobRepository
+	// LoginHistory records login attempts; logins are not recorded when nil.
+	LoginHistory auth.LoginHistory
+	// AuditLog records the risk decisions about logins; they are only logged when nil.
+	AuditLog       auth.AuditLog
+	TokenStore     auth.TokenStore
+	CodeStore      auth.CodeStore
+	SessionStorage fiber.Storage
+	SessionIndex   auth.SessionIndex
+	Mailer         utils.Mailer
+	PasswordHasher password.Hasher
+	// PasswordPolicy applies to new passwords; password.DefaultPolicy is used when nil.
+	PasswordPolicy *password.Policy
+	// BreachChecker rejects passwords known from data breaches; screening is disabled when nil.
+	BreachChecker password.BreachChecker
+	// RiskEngine scores logins; logins are not scored when nil.
+	RiskEngine *risk.Engine
+	// SessionPolicy sets session lifetimes and binding; auth.DefaultSessionPolicy is used when nil.
+	SessionPolicy *auth.SessionPolicy
+	// AccessTokenKey signs access tokens and is published as JWKS; they are signed with the token secret when nil.
+	AccessTokenKey *auth.SigningKey
+	// PreviousAccessTokenKeys signed access tokens before AccessTokenKey; they are still accepted and published.
+	PreviousAccessTokenKeys []*auth.SigningKey
+	// SigningKeyStore holds rotated keys; access tokens are signed with its newest key when set.
+	SigningKeyStore auth.SigningKeyStore
+	// RateLimiter counts requests for rate limits; nothing is rate limited when nil.
+	RateLimiter auth.RateLimiter
+	// ForwardAuthCache caches the checks of /auth/verify; every check loads the session when nil.
+	ForwardAuthCache auth.ForwardAuthCache
+	// CORSPolicy lets browser apps on other origins call the API; cross-origin calls are not allowed when nil.
+	CORSPolicy *security.CORSPolicy
+	// SecurityHeaders are sent with every response; security.DefaultHeaderPolicy is used when nil.
+	SecurityHeaders   *security.HeaderPolicy
+	ProxyConfig       config.ProxyConfig
+	PrivacyConfig     config.PrivacyConfig
+	TokenConfig       config.TokenConfig
+	AuthConfig        config.AuthConfig
+	ForwardAuthConfig config.ForwardAuthConfig
+}
+
+// New creates the Fiber application with every route registered.
+func New(deps Dependencies) *fiber.App {
+	sessionPolicy := auth.DefaultSessionPolicy()
+	if deps.SessionPolicy != nil {
+		sessionPolicy = *deps.SessionPolicy
+	}
+	sessions := auth.NewSessionStore(deps.SessionStorage, sessionPolicy)
+
+	userService := user.NewUserService(deps.UserRepository, deps.PendingRegistrations, deps.PasswordHasher,
+		user.WithBreachChecker(deps.BreachChecker),
+		user.WithPendingRegistrationTTL(time.Duration(deps.AuthConfig.PendingRegistrationTTLHours)*time.Hour),
+	)
+	codePolicy := auth.CodePolicy{
+		Length:      deps.TokenConfig.CodeLength,
+		MaxAttempts: deps.TokenConfig.CodeMaxAttempts,
+	}
+	tokenService := auth.NewTokenService(deps.TokenConfig.Secret, deps.TokenStore, deps.CodeStore, codePolicy,
+		auth.WithSigningKey(deps.AccessTokenKey),
+		auth.WithPreviousSigningKeys(deps.PreviousAccessTokenKeys),
+		auth.WithSigningKeyStore(deps.SigningKeyStore),
+		auth.WithIssuer(deps.TokenConfig.Issuer),
+		auth.WithAudience(deps.TokenConfig.Audience),
+	)
+	passwordPolicy := password.DefaultPolicy()
+	if deps.PasswordPolicy != nil {
+		passwordPolicy = *deps.PasswordPolicy
+	}
+	passwordPolicy.BreachChecker = deps.BreachChecker
+
+	authService := auth.NewAuthService(userService, tokenService, sessions, deps.SessionIndex, deps.Mailer, deps.PasswordHasher,
+		auth.WithEnumerationProtection(deps.AuthConfig.EnumerationSafe),
+		auth.WithPasswordPolicy(passwordPolicy),
+		auth.WithPasswordHistory(deps.PasswordHistory),
+		auth.WithLoginHistory(deps.LoginHistory, deps.AuthConfig.NewDeviceAlerts),
+		auth.WithRiskEngine(deps.RiskEngine),
+		auth.WithAuditLog(deps.AuditLog),
+		auth.WithAccessTokenTTL(time.Duration(deps.AuthConfig.AccessTokenTTLMinutes)*time.Minute),
+		auth.WithAccessTokenScopes(deps.AuthConfig.AccessTokenScopes),
+		auth.WithMailRateLimit(deps.RateLimiter, deps.AuthConfig.MailRateLimit,
+			time.Duration(deps.AuthConfig.MailRateLimitWindowMinutes)*time.Minute),
+		auth.WithReauthenticationLimit(deps.RateLimiter, deps.AuthConfig.ReauthenticationMaxFailures,
+			time.Duration(deps.AuthConfig.ReauthenticationLockoutMinutes)*time.Minute),
+	)
+
+	privacyService := privacy.NewService(userService, authService, tokenService, deps.PasswordHasher, deps.Tombstones, deps.PrivacyConfig.EmailHashKey,
+		privacy.WithPasswordHistory(deps.PasswordHistory),
+		privacy.WithLoginHistory(deps.LoginHistory),
+		privacy.WithAuditLog(deps.AuditLog),
+		privacy.WithExportJobs(deps.ExportJobs, time.Duration(deps.PrivacyConfig.ExportTTLHours)*time.Hour),
+	)
+
+	reauthenticationMaxAge := auth.DefaultReauthenticationMaxAge
+	if deps.AuthConfig.ReauthenticationMaxAgeMinutes > 0 {
+		reauthenticationMaxAge = time.Duration(deps.AuthConfig.ReauthenticationMaxAgeMinutes) * time.Minute
+	}
+
+	headerPolicy := security.DefaultHeaderPolicy()
+	if deps.SecurityHeaders != nil {
+		headerPolicy = *deps.SecurityHeaders
+	}
+
+	app := fiber.New(fiberConfig(deps.ProxyConfig))
+	app.Use(security.SecurityHeaders(headerPolicy))
+	// Preflight requests are answered here, before they could be refused for lacking a CSRF token
+	if deps.CORSPolicy != nil {
+		app.Use(security.CORS(*deps.CORSPolicy))
+	}
+	var forwardAuthOptions []auth.ForwardAuthOption
+	if deps.ForwardAuthCache != nil {
+		forwardAuthOptions = append(forwardAuthOptions, auth.WithForwardAuthCache(deps.ForwardAuthCache,
+			time.Duration(deps.ForwardAuthConfig.CacheTTLSeconds)*time.Second))
+	}
+	if deps.ForwardAuthConfig.LoginURL != "" {
+		forwardAuthOptions = append(forwardAuthOptions, auth.WithLoginURL(deps.ForwardAuthConfig.LoginURL),
+			auth.WithAllowedRedirectHosts(deps.ForwardAuthConfig.AllowedRedirectHosts))
+	}
+	forwardAuthHandler := auth.NewForwardAuthHandler(authService, forwardAuthOptions...)
+
+	registerRoutes(app, authService, tokenService, privacyService, forwardAuthHandler, reauthenticationMaxAge)
+	return app
+}
+
+// fiberConfig makes Fiber take client addresses, which sessions are bound to and logins are scored
+// by, from the proxy header only when the connection comes from a trusted proxy.
+func fiberConfig(proxy config.ProxyConfig) fiber.Config {
+	if proxy.Header != "" && !proxy.TrustedProxyCheck {
+		log.Printf("Trusting the %s header from any client, which lets them choose their address", proxy.Header)
+	}
+	if proxy.Header != "" && proxy.TrustedProxyCheck && len(proxy.TrustedProxies) == 0 {
+		log.Printf("No trusted proxies are configured, so the %s header is ignored", proxy.Header)
+	}
+	return fiber.Config{
+		ProxyHeader:             proxy.Header,
+		EnableTrustedProxyCheck: proxy.TrustedProxyCheck,
+		TrustedProxies:          proxy.TrustedProxies,
+		// Takes the client address out of a list like X-Forwarded-For instead of the whole header
+		EnableIPValidation: true,
+	}
+}
+
+// registerRoutes registers the HTTP routes of the API.
+func registerRoutes(app *fiber.App, authService auth.AuthService, tokenService auth.TokenService, privacyService privacy.Service, forwardAuthHandler *auth.ForwardAuthHandler, reauthenticationMaxAge time.Duration) {
+	requireRecentAuth := auth.RequireRecentAuth(authService.Sessions(), reauthenticationMaxAge)
+
+	// Before any route, so new state-changing routes are covered without opting in. Proxies forward
+	// the method of the request they check to /auth/verify, which only reads the session.
+	app.Use(auth.RequireCSRFToken(authService.Sessions(), "/auth/verify"))
+
+	authHandler := auth.NewAuthHandler(authService)
+	authGroup := app.Group("/auth")
+	authGroup.Post("/register", authHandler.Register)
+	authGroup.Post("/login", auth.RequireLoginCSRFToken(authService.Sessions()), authHandler.Login)
+	authGroup.Post("/logout", auth.RequireAuth(authService), authHandler.Logout)
+	authGroup.Post("/forgot-password", authHandler.ForgotPassword)
+	authGroup.Post("/resend-verification-email", authHandler.SendVerificationEmail)
+	authGroup.Post("/verify-email/", authHandler.VerifyEmail)
+	authGroup.Post("/verify-email/code", authHandler.VerifyEmailWithCode)
+	authGroup.Post("/reset-password", authHandler.ResetPassword)
+	authGroup.Post("/reset-password/code", authHandler.ResetPasswordWithCode)
+	authGroup.Post("/change-password", auth.RequireAuth(authService), requireRecentAuth, authHandler.ChangePassword)
+	authGroup.Post("/password/strength", authHandler.PasswordStrength)
+	authGroup.Post("/password/expired", authHandler.ChangeExpiredPassword)
+	authGroup.Post("/passwordless/start", authHandler.PasswordlessStart)
+	authGroup.Post("/passwordless/verify", auth.RequireLoginCSRFToken(authService.Sessions()), authHandler.PasswordlessVerify)
+	authGroup.Post("/reauthenticate", auth.RequireAuth(authService), authHandler.Reauthenticate)
+	authGroup.Post("/reauthenticate/code", auth.RequireAuth(authService), authHandler.StartReauthentication)
+	authGroup.Get("/csrf", authHandler.CSRFToken)
+	authGroup.Post("/token", auth.RequireAuth(authService), authHandler.AccessToken)
+	authGroup.All("/verify", forwardAuthHandler.Verify)
+
+	privacyHandler := privacy.NewHandler(privacyService)
+	usersGroup := app.Group("/users")
+	usersGroup.Post("/me/exports", auth.RequireAuth(authService), requireRecentAuth, privacyHandler.RequestExport)
+	usersGroup.Get("/me/exports/:id", auth.RequireAuth(authService), privacyHandler.ExportStatus)
+	usersGroup.Get("/me/exports/:id/download", auth.RequireAuth(authService), requireRecentAuth, privacyHandler.DownloadExport)
+	usersGroup.Delete("/me", auth.RequireAuth(authService), requireRecentAuth, privacyHandler.Erase)
+	usersGroup.Post("/me/deactivate", auth.RequireAuth(authService), requireRecentAuth, authHandler.DeactivateAccount)
+	usersGroup.Get("/me/login-history", auth.RequireAuth(authService), authHandler.LoginHistory)
+
+	app.Get("/.well-known/jwks.json", auth.JWKSHandler(tokenService))
+
+	adminGroup := app.Group("/admin", auth.RequireAuth(authService), auth.RequireRole(models.RoleAdmin))
+	adminGroup.Put("/users/:id/status", authHandler.ChangeAccountStatus)
+	adminGroup.Post("/users/:id/exports", privacyHandler.RequestUserExport)
+	adminGroup.Get("/exports/:id", privacyHandler.UserExportStatus)
+	adminGroup.Get("/exports/:id/download", privacyHandler.DownloadUserExport)
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// AuditLog stores security decisions about accounts for later review.
+type AuditLog interface {
+	// Add records an event.
+	Add(ctx context.Context, event *models.AuditEvent) error
+	// List returns up to limit of the user's events, newest first. A negative limit returns all of them.
+	List(ctx context.Context, userID uuid.UUID, limit int) ([]models.AuditEvent, error)
+	// DeleteBefore removes events recorded before the given time and returns how many were removed.
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+	// Anonymize blanks the IP and details of the user's events, keeping the action, outcome and time.
+	Anonymize(ctx context.Context, userID uuid.UUID) error
+}
+
+// postgresAuditLog implements AuditLog with the audit_events table.
+type postgresAuditLog struct {
+	db *gorm.DB
+}
+
+// NewPostgresAuditLog creates an AuditLog backed by Postgres.
+func NewPostgresAuditLog(db *gorm.DB) AuditLog {
+	return &postgresAuditLog{
+		db: db,
+	}
+}
+
+// Add records an event.
+func (p *postgresAuditLog) Add(ctx context.Context, event *models.AuditEvent) error {
+	return p.db.WithContext(ctx).Create(event).Error
+}
+
+// List returns the user's events, newest first.
+func (p *postgresAuditLog) List(ctx context.Context, userID uuid.UUID, limit int) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	err := p.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// DeleteBefore removes events recorded before the given time.
+func (p *postgresAuditLog) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := p.db.WithContext(ctx).Delete(&models.AuditEvent{}, "created_at < ?", before)
+	return result.RowsAffected, result.Error
+}
+
+// Anonymize blanks the IP and details of the user's events.
+func (p *postgresAuditLog) Anonymize(ctx context.Context, userID uuid.UUID) error {
+	return p.db.WithContext(ctx).Model(&models.AuditEvent{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"ip": "", "details": ""}).Error
+}
+
+// memoryAuditLog implements AuditLog in memory, for tests and local development.
+type memoryAuditLog struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+// NewMemoryAuditLog creates an in-memory AuditLog.
+func NewMemoryAuditLog() AuditLog {
+	return &memoryAuditLog{}
+}
+
+// Add records an event.
+func (m *memoryAuditLog) Add(ctx context.Context, event *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	// Events arrive in order, so prepending keeps the newest first
+	m.events = append([]models.AuditEvent{*event}, m.events...)
+	return nil
+}
+
+// List returns the user's events, newest first.
+func (m *memoryAuditLog) List(ctx context.Context, userID uuid.UUID, limit int) ([]models.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.AuditEvent
+	for _, event := range m.events {
+		if limit >= 0 && len(events) == limit {
+			break
+		}
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// DeleteBefore removes events recorded before the given time.
+func (m *memoryAuditLog) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	kept := m.events[:0]
+	for _, event := range m.events {
+		if event.CreatedAt.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, event)
+	}
+	m.events = kept
+	return deleted, nil
+}
+
+// Anonymize blanks the IP and details of the user's events.
+func (m *memoryAuditLog) Anonymize(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.events {
+		if m.events[i].UserID == userID {
+			m.events[i].IP = ""
+			m.events[i].Details = ""
+		}
+	}
+	return nil
+}
@@ -3,10 +3,25 @@ package auth
 import (
 	"authentication/src/internal/dto"
 	"authentication/src/internal/errs"
+	"authentication/src/internal/password"
 	"authentication/src/utils"
 	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"log"
+	"time"
+)
+
+// deviceCookieName is the long-lived cookie that recognizes a browser across sessions.
+const deviceCookieName = "device_id"
+
+// deviceCookieLifetime is how long a browser keeps its device cookie.
+const deviceCookieLifetime = 400 * 24 * time.Hour
+
+// Limits of the login history endpoint.
+const (
+	defaultLoginHistoryLimit = 50
+	maxLoginHistoryLimit     = 200
 )
 
 // AuthHandler provides HTTP handlers for authentication endpoints.
@@ -40,27 +55,26 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 			validationErr, "Validation failed"))
 	}
 
-	res, err := h.AuthService.Register(ctx, &req)
+	_, err := h.AuthService.Register(ctx, &req)
 	if err != nil {
 		log.Printf("Error during registration: %v", err)
 
+		if errors.Is(err, errs.ErrWeakPassword) {
+			return weakPasswordResponse(c, err)
+		}
+
 		if errors.Is(err, errs.ErrUserAlreadyExists) {
 			return c.Status(fiber.StatusConflict).JSON(utils.ErrorResponse(
 				err, "A user with this email address already exists"))
 		}
 
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
-			err, "Registration failed"))
-	}
+		if errors.Is(err, errs.ErrTooManyRequests) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many verification emails requested"))
+		}
 
-	emailReq := &dto.SendEmailVerificationRequest{
-		ID:    res.UserID,
-		Email: req.Email,
-	}
-	err = h.AuthService.SendVerificationEmail(ctx, emailReq)
-	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
-			err, "Failed to send verification email"))
+			err, "Registration failed"))
 	}
 
 	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "User registered successfully, please check your email for verification instructions"))
@@ -84,13 +98,14 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 			validationErr, "Validation failed"))
 	}
 
-	sess, err := store.Get(c)
+	sess, err := h.Sessions().Get(c)
 	if err != nil {
 		log.Printf("Error retrieving session: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
 			err, "Failed to retrieve session"))
 	}
 
+	req.Client = clientInfo(c)
 	loggedInUser, err := h.AuthService.Login(ctx, &req, sess)
 	if err != nil {
 		log.Printf("Error during login: %v", err)
@@ -110,6 +125,30 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 				err, "Email not verified, please check your inbox for the verification email or sign up again"))
 		}
 
+		if errors.Is(err, errs.ErrPasswordExpired) {
+			return c.Status(fiber.StatusForbidden).JSON(utils.ErrorResponse(
+				err, "Your password has expired, please choose a new one to continue"))
+		}
+
+		if errors.Is(err, errs.ErrStepUpRequired) {
+			return c.Status(fiber.StatusForbidden).JSON(utils.ErrorResponse(
+				err, "This login looks unusual, please confirm it with the sign-in link or code sent to your email"))
+		}
+
+		if errors.Is(err, errs.ErrLoginBlocked) {
+			return c.Status(fiber.StatusForbidden).JSON(utils.ErrorResponse(
+				err, "This login was blocked for security reasons"))
+		}
+
+		if errors.Is(err, errs.ErrTooManySessions) {
+			return c.Status(fiber.StatusConflict).JSON(utils.ErrorResponse(
+				err, "Too many active sessions, please log out on another device first"))
+		}
+
+		if isAccountStatusError(err) {
+			return accountStatusResponse(c, err)
+		}
+
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
 			err, "Login failed"))
 	}
@@ -130,7 +169,7 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	ctx := c.Context()
 	var req dto.LogoutRequest
 
-	sess, err := store.Get(c)
+	sess, err := h.Sessions().Get(c)
 	if err != nil {
 		log.Printf("Error retrieving session: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
@@ -168,7 +207,8 @@ func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
 	if err != nil {
 		log.Printf("Error during email verification: %v", err)
 
-		if errors.Is(err, errs.ErrInvalidToken) {
+		// A link that was used or replaced by a newer one is no longer stored
+		if errors.Is(err, errs.ErrInvalidToken) || errors.Is(err, errs.ErrTokenNotFound) {
 			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
 				err, "Invalid verification link"))
 		}
@@ -183,6 +223,16 @@ func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
 				err, "Invalid token purpose, please request a new verification email"))
 		}
 
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Registration has expired, please register again"))
+		}
+
+		if errors.Is(err, errs.ErrUserAlreadyExists) {
+			return c.Status(fiber.StatusConflict).JSON(utils.ErrorResponse(
+				err, "This email address is already verified"))
+		}
+
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
 			err, "Email verification failed"))
 	}
@@ -210,6 +260,14 @@ func (h *AuthHandler) SendVerificationEmail(c *fiber.Ctx) error {
 
 	err := h.AuthService.SendVerificationEmail(ctx, &req)
 	if err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(utils.ErrorResponse(
+				err, "No pending registration for this email address"))
+		}
+		if errors.Is(err, errs.ErrTooManyRequests) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many verification emails requested"))
+		}
 		log.Printf("Error sending verification email: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
 			err, "Failed to send verification email"))
@@ -243,11 +301,19 @@ func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusNotFound).JSON(utils.ErrorResponse(
 				err, "This email address is not registered"))
 		}
+		if errors.Is(err, errs.ErrTooManyRequests) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many password resets requested"))
+		}
 		log.Printf("Error during forgot password: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
 			err, "Forgot password failed"))
 	}
 
+	if req.Mode == dto.DeliveryModeCode {
+		return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "A password reset code has been sent to your email"))
+	}
+
 	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "A password reset link has been sent to your email"))
 }
 
@@ -270,7 +336,7 @@ func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
 	}
 
 	//Get and destroy any previously existing sessions
-	sess, err := store.Get(c)
+	sess, err := h.Sessions().Get(c)
 	if err != nil {
 		log.Printf("Error retrieving session: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
@@ -287,11 +353,21 @@ func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
 	if err != nil {
 		log.Printf("Error during password reset: %v", err)
 
-		if errors.Is(err, errs.ErrInvalidToken) {
+		if errors.Is(err, errs.ErrWeakPassword) {
+			return weakPasswordResponse(c, err)
+		}
+
+		// A link that was used or replaced by a newer one is no longer stored
+		if errors.Is(err, errs.ErrInvalidToken) || errors.Is(err, errs.ErrTokenNotFound) {
 			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
 				err, "Invalid reset link"))
 		}
 
+		if errors.Is(err, errs.ErrInvalidTokenPurpose) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Invalid token purpose, please request a new reset link"))
+		}
+
 		if errors.Is(err, errs.ErrTokenExpired) {
 			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
 				err, "Reset link has expired, please request a new one"))
@@ -303,3 +379,656 @@ func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "Password reset successfully, you can now log in with your new password"))
 }
+
+// VerifyEmailWithCode verifies the user's email address using an emailed numeric code
+func (h *AuthHandler) VerifyEmailWithCode(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.VerifyEmailCodeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	err := h.AuthService.VerifyEmailWithCode(ctx, &req)
+	if err != nil {
+		log.Printf("Error during email verification with code: %v", err)
+
+		if errors.Is(err, errs.ErrInvalidCode) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Invalid or expired verification code"))
+		}
+
+		if errors.Is(err, errs.ErrTooManyAttempts) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many attempts, please request a new verification code"))
+		}
+
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Registration has expired, please register again"))
+		}
+
+		if errors.Is(err, errs.ErrUserAlreadyExists) {
+			return c.Status(fiber.StatusConflict).JSON(utils.ErrorResponse(
+				err, "This email address is already verified"))
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Email verification failed"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "Email verified successfully, you can now log in"))
+}
+
+// ResetPasswordWithCode handles password reset requests using an emailed numeric code.
+func (h *AuthHandler) ResetPasswordWithCode(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.ResetPasswordCodeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	//Get and destroy any previously existing sessions
+	sess, err := h.Sessions().Get(c)
+	if err != nil {
+		log.Printf("Error retrieving session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to retrieve session"))
+	}
+	err = sess.Destroy()
+	if err != nil {
+		log.Printf("Error destroying session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to destroy session"))
+	}
+
+	err = h.AuthService.ResetPasswordWithCode(ctx, &req)
+	if err != nil {
+		log.Printf("Error during password reset with code: %v", err)
+
+		if errors.Is(err, errs.ErrWeakPassword) {
+			return weakPasswordResponse(c, err)
+		}
+
+		if errors.Is(err, errs.ErrInvalidCode) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Invalid or expired reset code"))
+		}
+
+		if errors.Is(err, errs.ErrTooManyAttempts) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many attempts, please request a new reset code"))
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Password reset failed"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "Password reset successfully, you can now log in with your new password"))
+}
+
+// PasswordlessStart emails a single-use sign-in link or code to the user.
+func (h *AuthHandler) PasswordlessStart(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.PasswordlessStartRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	sess, err := h.Sessions().Get(c)
+	if err != nil {
+		log.Printf("Error retrieving session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to retrieve session"))
+	}
+
+	err = h.AuthService.StartPasswordlessLogin(ctx, &req, sess)
+	if err != nil {
+		log.Printf("Error starting passwordless login: %v", err)
+
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(utils.ErrorResponse(
+				err, "This email address is not registered"))
+		}
+
+		if errors.Is(err, errs.ErrEmailNotVerified) {
+			return c.Status(fiber.StatusForbidden).JSON(utils.ErrorResponse(
+				err, "Email not verified, please check your inbox for the verification email or sign up again"))
+		}
+
+		if errors.Is(err, errs.ErrTooManyRequests) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many sign-in emails requested"))
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to send sign-in email"))
+	}
+
+	if req.Mode == dto.DeliveryModeCode {
+		return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "A sign-in code has been sent to your email"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "A sign-in link has been sent to your email"))
+}
+
+// PasswordlessVerify redeems a sign-in link or code and logs the user in.
+func (h *AuthHandler) PasswordlessVerify(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.PasswordlessVerifyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	sess, err := h.Sessions().Get(c)
+	if err != nil {
+		log.Printf("Error retrieving session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to retrieve session"))
+	}
+
+	req.Client = clientInfo(c)
+	loggedInUser, err := h.AuthService.CompletePasswordlessLogin(ctx, &req, sess)
+	if err != nil {
+		log.Printf("Error during passwordless login: %v", err)
+
+		if errors.Is(err, errs.ErrLoginBindingMismatch) {
+			return c.Status(fiber.StatusForbidden).JSON(utils.ErrorResponse(
+				err, "Please open the sign-in link in the same browser you requested it from"))
+		}
+
+		if errors.Is(err, errs.ErrInvalidToken) || errors.Is(err, errs.ErrTokenNotFound) || errors.Is(err, errs.ErrInvalidCode) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Invalid sign-in link or code"))
+		}
+
+		if errors.Is(err, errs.ErrTokenExpired) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Sign-in link has expired, please request a new one"))
+		}
+
+		if errors.Is(err, errs.ErrTooManyAttempts) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many attempts, please request a new sign-in code"))
+		}
+
+		if errors.Is(err, errs.ErrLoginBlocked) {
+			return c.Status(fiber.StatusForbidden).JSON(utils.ErrorResponse(
+				err, "This login was blocked for security reasons"))
+		}
+
+		if errors.Is(err, errs.ErrTooManySessions) {
+			return c.Status(fiber.StatusConflict).JSON(utils.ErrorResponse(
+				err, "Too many active sessions, please log out on another device first"))
+		}
+
+		if isAccountStatusError(err) {
+			return accountStatusResponse(c, err)
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Login failed"))
+	}
+
+	loginResponse := dto.LoginResponse{
+		User: dto.ToUserResponse(loggedInUser),
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(loginResponse, "Login successful"))
+}
+
+// ChangePassword changes the password of the logged in user.
+func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.ChangePasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	userID := c.Locals("userID").(uuid.UUID)
+	err := h.AuthService.ChangePassword(ctx, userID, &req)
+	if err != nil {
+		log.Printf("Error during password change: %v", err)
+
+		if errors.Is(err, errs.ErrInvalidCredentials) {
+			return c.Status(fiber.StatusUnauthorized).JSON(utils.ErrorResponse(
+				err, "Current password is incorrect"))
+		}
+
+		if errors.Is(err, errs.ErrWeakPassword) {
+			return weakPasswordResponse(c, err)
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Password change failed"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "Password changed successfully"))
+}
+
+// ChangeExpiredPassword replaces an expired password after login and completes the login.
+func (h *AuthHandler) ChangeExpiredPassword(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.ExpiredPasswordChangeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	sess, err := h.Sessions().Get(c)
+	if err != nil {
+		log.Printf("Error retrieving session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to retrieve session"))
+	}
+
+	req.Client = clientInfo(c)
+	loggedInUser, err := h.AuthService.ChangeExpiredPassword(ctx, &req, sess)
+	if err != nil {
+		log.Printf("Error during expired password change: %v", err)
+
+		if errors.Is(err, errs.ErrNoPasswordChangeDue) {
+			return c.Status(fiber.StatusUnauthorized).JSON(utils.ErrorResponse(
+				err, "Please log in with your current password first"))
+		}
+
+		if errors.Is(err, errs.ErrWeakPassword) {
+			return weakPasswordResponse(c, err)
+		}
+
+		if errors.Is(err, errs.ErrTooManySessions) {
+			return c.Status(fiber.StatusConflict).JSON(utils.ErrorResponse(
+				err, "Too many active sessions, please log out on another device first"))
+		}
+
+		if isAccountStatusError(err) {
+			return accountStatusResponse(c, err)
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Password change failed"))
+	}
+
+	loginResponse := dto.LoginResponse{
+		User: dto.ToUserResponse(loggedInUser),
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(loginResponse, "Password changed, login successful"))
+}
+
+// CSRFToken returns the CSRF token of the session, for single-page apps to send with state-changing
+// requests. It also sets the token in the X-CSRF-Token response header.
+func (h *AuthHandler) CSRFToken(c *fiber.Ctx) error {
+	sess, err := h.Sessions().Get(c)
+	if err != nil {
+		log.Printf("Error retrieving session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to retrieve session"))
+	}
+
+	token, err := sessionCSRFToken(sess)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to create CSRF token"))
+	}
+
+	c.Set(CSRFHeader, token)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(dto.CSRFTokenResponse{
+		Token:  token,
+		Header: CSRFHeader,
+	}, "CSRF token retrieved"))
+}
+
+// AccessToken issues the logged in user a short-lived access token for APIs that take bearer tokens.
+func (h *AuthHandler) AccessToken(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.AccessTokenRequest
+
+	// The body is optional, tokens without scopes need none
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			log.Printf("Error parsing request body: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Failed to parse request body"))
+		}
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	userID := c.Locals("userID").(uuid.UUID)
+	res, err := h.AuthService.IssueAccessToken(ctx, userID, &req)
+	if err != nil {
+		log.Printf("Error issuing access token for user %s: %v", userID, err)
+
+		if errors.Is(err, errs.ErrInvalidScope) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "The requested scope is not allowed"))
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to issue access token"))
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(res, "Access token issued"))
+}
+
+// LoginHistory lists the recent login attempts against the logged in user's account.
+func (h *AuthHandler) LoginHistory(c *fiber.Ctx) error {
+	ctx := c.Context()
+
+	limit := c.QueryInt("limit", defaultLoginHistoryLimit)
+	if limit <= 0 || limit > maxLoginHistoryLimit {
+		limit = defaultLoginHistoryLimit
+	}
+
+	userID := c.Locals("userID").(uuid.UUID)
+	events, err := h.AuthService.LoginHistory(ctx, userID, limit)
+	if err != nil {
+		log.Printf("Error listing login history of user %s: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to load login history"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(events, "Login history retrieved"))
+}
+
+// StartReauthentication emails the logged in user a code to reauthenticate with.
+func (h *AuthHandler) StartReauthentication(c *fiber.Ctx) error {
+	ctx := c.Context()
+
+	userID := c.Locals("userID").(uuid.UUID)
+	err := h.AuthService.StartReauthentication(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errs.ErrTooManyRequests) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many confirmation codes requested"))
+		}
+		log.Printf("Error sending reauthentication code to user %s: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to send confirmation code"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "Confirmation code sent"))
+}
+
+// Reauthenticate confirms the identity of the logged in user with their password or an emailed
+// code, which allows sensitive actions for a while.
+func (h *AuthHandler) Reauthenticate(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.ReauthenticateRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	sess, err := h.Sessions().Get(c)
+	if err != nil {
+		log.Printf("Error retrieving session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Failed to retrieve session"))
+	}
+
+	userID := c.Locals("userID").(uuid.UUID)
+	authentication, err := h.AuthService.Reauthenticate(ctx, userID, &req, sess)
+	if err != nil {
+		log.Printf("Error during reauthentication: %v", err)
+
+		if errors.Is(err, errs.ErrInvalidCredentials) {
+			return c.Status(fiber.StatusUnauthorized).JSON(utils.ErrorResponse(
+				err, "Password is incorrect"))
+		}
+
+		if errors.Is(err, errs.ErrInvalidCode) {
+			return c.Status(fiber.StatusUnauthorized).JSON(utils.ErrorResponse(
+				err, "Invalid or expired confirmation code"))
+		}
+
+		if errors.Is(err, errs.ErrTooManyAttempts) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many attempts, please request a new confirmation code"))
+		}
+
+		if errors.Is(err, errs.ErrTooManyRequests) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.ErrorResponse(
+				err, "Too many failed attempts, please try again later"))
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Reauthentication failed"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(authentication, "Reauthenticated"))
+}
+
+// DeactivateAccount deactivates the logged in user's own account after confirming their password.
+func (h *AuthHandler) DeactivateAccount(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.DeactivateAccountRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	userID := c.Locals("userID").(uuid.UUID)
+	err := h.AuthService.DeactivateAccount(ctx, userID, &req)
+	if err != nil {
+		log.Printf("Error during account deactivation: %v", err)
+
+		if errors.Is(err, errs.ErrInvalidCredentials) {
+			return c.Status(fiber.StatusUnauthorized).JSON(utils.ErrorResponse(
+				err, "Password is incorrect"))
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Account deactivation failed"))
+	}
+
+	c.ClearCookie("session_id")
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "Your account has been deactivated, log in with reactivate set to use it again"))
+}
+
+// ChangeAccountStatus lets an administrator suspend, ban, deactivate or reactivate an account.
+func (h *AuthHandler) ChangeAccountStatus(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.ChangeAccountStatusRequest
+
+	targetID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Invalid user ID"))
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	adminID := c.Locals("userID").(uuid.UUID)
+	if targetID == adminID {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			errs.ErrInvalidAccountStatus, "Administrators cannot change the status of their own account"))
+	}
+
+	updatedUser, err := h.AuthService.ChangeAccountStatus(ctx, targetID, &req, "admin:"+adminID.String())
+	if err != nil {
+		log.Printf("Error changing account status: %v", err)
+
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(utils.ErrorResponse(
+				err, "This user does not exist"))
+		}
+
+		if errors.Is(err, errs.ErrInvalidAccountStatus) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Invalid account status change"))
+		}
+
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Account status change failed"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(dto.ToAccountStatusResponse(updatedUser), "Account status changed"))
+}
+
+// PasswordStrength checks a candidate password against the password policy while the user is typing.
+func (h *AuthHandler) PasswordStrength(c *fiber.Ctx) error {
+	var req dto.PasswordStrengthRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	evaluation := h.AuthService.EvaluatePassword(&req)
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(evaluation, "Password evaluated"))
+}
+
+// weakPasswordResponse reports the violated password policy rules so the UI can show them.
+func weakPasswordResponse(c *fiber.Ctx, err error) error {
+	response := utils.ErrorResponse(err, "Password does not meet the requirements")
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		response.Data = policyErr.Violations
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(response)
+}
+
+// accountStatusResponse explains why a suspended, banned or deactivated account cannot log in.
+func accountStatusResponse(c *fiber.Ctx, err error) error {
+	message := "This account cannot be used"
+	switch {
+	case errors.Is(err, errs.ErrAccountSuspended):
+		message = "This account is suspended"
+	case errors.Is(err, errs.ErrAccountBanned):
+		message = "This account is banned"
+	case errors.Is(err, errs.ErrAccountDeactivated):
+		message = "This account is deactivated, log in with reactivate set to use it again"
+	}
+	return c.Status(fiber.StatusForbidden).JSON(utils.ErrorResponse(err, message))
+}
+
+// clientInfo describes the client of a login request. Browsers without a device cookie get a new one.
+func clientInfo(c *fiber.Ctx) dto.ClientInfo {
+	deviceID := c.Cookies(deviceCookieName)
+	if deviceID == "" || len(deviceID) > 64 {
+		var err error
+		deviceID, err = utils.GenerateRandomString(32)
+		if err != nil {
+			log.Printf("Error generating device ID: %v", err)
+			deviceID = ""
+		} else {
+			c.Cookie(&fiber.Cookie{
+				Name:     deviceCookieName,
+				Value:    deviceID,
+				Expires:  time.Now().Add(deviceCookieLifetime),
+				Secure:   true,
+				HTTPOnly: true,
+				SameSite: fiber.CookieSameSiteLaxMode,
+			})
+		}
+	}
+
+	return dto.ClientInfo{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		DeviceID:  deviceID,
+	}
+}
@@ -1,29 +1,161 @@
 package auth
 
 import (
+	"authentication/src/internal/dto"
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/google/uuid"
+	"log"
+	"time"
 )
 
 // RequireAuth is a middleware that ensures the user is authenticated before accessing protected routes.
-func RequireAuth() fiber.Handler {
+// Sessions past their idle or absolute timeout, or used from another client while binding is
+// enforced, are destroyed.
+// The account is checked on every request, so the sessions of suspended, banned, deactivated or
+// deleted accounts stop working immediately and are destroyed.
+func RequireAuth(as AuthService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		sess, err := store.Get(c)
+		activeUser, err := authenticateSession(c, as)
+		if err != nil {
+			return authenticationErrorResponse(c, err)
+		}
+
+		// You can make userID available to handlers
+		c.Locals("userID", activeUser.ID)
+		c.Locals("user", activeUser)
+		return c.Next()
+	}
+}
+
+// authenticateSession returns the active user of the request's session, or errs.ErrSessionNotFound
+// when the request has no authenticated session. Sessions that timed out, are used from another
+// client while binding is enforced or belong to an account that can no longer be used are destroyed.
+func authenticateSession(c *fiber.Ctx, as AuthService) (*models.User, error) {
+	sessions := as.Sessions()
+	sess, err := sessions.Get(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	userID, ok := sess.Get("userID").(uuid.UUID)
+	if !ok {
+		return nil, errs.ErrSessionNotFound
+	}
+
+	now := time.Now()
+	client := dto.ClientInfo{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+	upgraded := sessions.upgradeLegacySession(sess, client, now)
+	if err := sessions.checkSession(sess, client, now); err != nil {
+		endSession(c, as, sess, userID)
+		return nil, err
+	}
+
+	activeUser, err := as.ActiveUser(c.Context(), userID)
+	if err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) || isAccountStatusError(err) {
+			endSession(c, as, sess, userID)
+		}
+		return nil, err
+	}
+
+	if upgraded {
+		if err := sess.Save(); err != nil {
+			log.Printf("Error upgrading session: %v", err)
+		}
+	} else if _, err := sessions.touchSession(sess, now); err != nil {
+		log.Printf("Error recording session activity: %v", err)
+	}
+	return activeUser, nil
+}
+
+// endSession destroys a session that can no longer be used and removes it from the session index.
+func endSession(c *fiber.Ctx, as AuthService, sess *session.Session, userID uuid.UUID) {
+	if err := as.RevokeSession(c.Context(), userID, sess.ID()); err != nil && !errors.Is(err, errs.ErrSessionNotFound) {
+		log.Printf("Error removing session from index: %v", err)
+	}
+	if err := sess.Destroy(); err != nil {
+		log.Printf("Error destroying session: %v", err)
+	}
+}
+
+// authenticationErrorResponse answers a request whose session or access token was refused.
+func authenticationErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errs.ErrSessionNotFound), errors.Is(err, errs.ErrUserNotFound):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	case errors.Is(err, errs.ErrSessionExpired), errors.Is(err, errs.ErrSessionBindingMismatch),
+		errors.Is(err, errs.ErrTokenExpired), errors.Is(err, errs.ErrInvalidTokenPurpose):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, errs.ErrInvalidToken):
+		// The wrapped parser error is of no use to clients
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": errs.ErrInvalidToken.Error(),
+		})
+	case isAccountStatusError(err):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	default:
+		log.Printf("Error authenticating request: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check account",
+		})
+	}
+}
+
+// RequireRole is a middleware that only lets users with one of the given roles through. It must
+// run after RequireAuth.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		currentUser, ok := c.Locals("user").(*models.User)
+		if ok {
+			for _, role := range roles {
+				if currentUser.EffectiveRole() == role {
+					return c.Next()
+				}
+			}
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": errs.ErrForbidden.Error(),
+		})
+	}
+}
+
+// RequireRecentAuth is a middleware that only lets sessions through that were authenticated within
+// maxAge, by logging in or through /auth/reauthenticate. It must run after RequireAuth.
+func RequireRecentAuth(sessions *SessionStore, maxAge time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sess, err := sessions.Get(c)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to get session",
 			})
 		}
 
-		userID := sess.Get("userID")
-		if userID == nil {
+		authTime, _ := sessionAuthentication(sess)
+		if authTime.IsZero() || time.Since(authTime) > maxAge {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Unauthorized",
+				"error": errs.ErrRecentAuthRequired.Error(),
 			})
 		}
-
-		// You can make userID available to handlers
-		c.Locals("userID", userID.(uuid.UUID))
 		return c.Next()
 	}
 }
+
+// isAccountStatusError reports whether err means the account cannot be used because of its status.
+func isAccountStatusError(err error) bool {
+	return errors.Is(err, errs.ErrAccountSuspended) ||
+		errors.Is(err, errs.ErrAccountBanned) ||
+		errors.Is(err, errs.ErrAccountDeactivated) ||
+		errors.Is(err, errs.ErrInvalidAccountStatus)
+}
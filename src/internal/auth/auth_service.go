@@ -4,22 +4,83 @@ import (
 	"authentication/src/internal/dto"
 	"authentication/src/internal/errs"
 	"authentication/src/internal/models"
+	"authentication/src/internal/password"
+	"authentication/src/internal/risk"
 	"authentication/src/internal/user"
 	"authentication/src/utils"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/google/uuid"
+	"log"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Token purposes issued by the authentication flows.
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+	PurposePasswordlessLogin = "passwordless_login"
+	PurposeReauthentication  = "reauthentication"
+	// PurposeAccess marks access tokens, which are not one-time tokens
+	PurposeAccess = "access"
+)
+
+// Authentication methods recorded on sessions, as registered in RFC 8176.
+const (
+	// AMRPassword is a password check
+	AMRPassword = "pwd"
+	// AMROneTimeCode is an emailed sign-in link or code
+	AMROneTimeCode = "otp"
+)
+
+// DefaultAccessTokenTTL is how long access tokens are valid when no other lifetime is configured.
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+// DefaultReauthenticationMaxAge is how long after authenticating sensitive actions are allowed
+// when no other maximum age is configured.
+const DefaultReauthenticationMaxAge = 10 * time.Minute
+
+// Session keys binding a pending passwordless login to the browser that requested it.
+const (
+	sessionKeyPasswordlessUserID = "passwordlessUserID"
+	sessionKeyPasswordlessEmail  = "passwordlessEmail"
+)
+
+// Session keys marking a login that succeeded with an expired password, which only allows changing it.
+const (
+	sessionKeyExpiredPasswordUserID = "expiredPasswordUserID"
+	sessionKeyExpiredPasswordAt     = "expiredPasswordAt"
+)
+
+// expiredPasswordChangeWindow is how long after such a login the password can be changed.
+const expiredPasswordChangeWindow = 10 * time.Minute
+
+// ActorSelf is recorded as the actor of account status changes made by the user themselves.
+const ActorSelf = "self"
+
+// codeExpiry is how long emailed numeric codes stay valid.
+const codeExpiry = 10 * time.Minute
+
+// maxPendingLoginChecks is how many pending registrations of an address a login checks the password
+// against, so signups piled up by others do not make logging in slow.
+const maxPendingLoginChecks = 3
+
 // AuthService defines authentication-related operations for users.
 type AuthService interface {
 	// Login authenticates a user with the provided credentials.
 	Login(ctx context.Context, req *dto.LoginRequest, sess *session.Session) (*models.User, error)
-	// Register creates a new user with the provided details.
+	// Register creates a new user with the provided details and sends the verification email.
 	Register(ctx context.Context, req *dto.RegisterRequest) (*dto.RegisterResponse, error)
 	// Logout logs out the user.
 	Logout(ctx context.Context, req *dto.LogoutRequest, sess *session.Session) error
-	// SendVerificationEmail sends a verification email to the user.
+	// SendVerificationEmail sends a new verification email for a pending registration.
 	SendVerificationEmail(ctx context.Context, req *dto.SendEmailVerificationRequest) error
 	// VerifyEmail verifies the user's email using the provided token.
 	VerifyEmail(ctx context.Context, req *dto.VerifyEmailRequest) error
@@ -27,6 +88,52 @@ type AuthService interface {
 	ForgotPassword(ctx context.Context, req *dto.ForgotPasswordRequest) error
 	// ResetPassword resets the user's password using the provided reset token.
 	ResetPassword(ctx context.Context, req *dto.ResetPasswordRequest) error
+	// VerifyEmailWithCode verifies the user's email using an emailed numeric code.
+	VerifyEmailWithCode(ctx context.Context, req *dto.VerifyEmailCodeRequest) error
+	// ResetPasswordWithCode resets the user's password using an emailed numeric code.
+	ResetPasswordWithCode(ctx context.Context, req *dto.ResetPasswordCodeRequest) error
+	// ChangePassword replaces the password of a logged in user after checking the current one.
+	ChangePassword(ctx context.Context, userID uuid.UUID, req *dto.ChangePasswordRequest) error
+	// ChangeExpiredPassword sets a new password after a login was refused because the password
+	// expired, and then logs the user in.
+	ChangeExpiredPassword(ctx context.Context, req *dto.ExpiredPasswordChangeRequest, sess *session.Session) (*models.User, error)
+	// EvaluatePassword checks a candidate password against the password policy and estimates its strength.
+	EvaluatePassword(req *dto.PasswordStrengthRequest) password.Evaluation
+	// StartPasswordlessLogin emails a single-use sign-in link or code bound to the requesting session.
+	StartPasswordlessLogin(ctx context.Context, req *dto.PasswordlessStartRequest, sess *session.Session) error
+	// CompletePasswordlessLogin redeems a sign-in link or code and logs the user in.
+	CompletePasswordlessLogin(ctx context.Context, req *dto.PasswordlessVerifyRequest, sess *session.Session) (*models.User, error)
+	// ListSessions lists the active sessions of the user.
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]SessionRecord, error)
+	// RevokeSession revokes a single session of the user.
+	RevokeSession(ctx context.Context, userID uuid.UUID, sessionID string) error
+	// RevokeAllSessions revokes every session of the user and returns how many were revoked.
+	RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int, error)
+	// ActiveUser returns the user if their account can currently be used, or the error
+	// describing why it cannot.
+	ActiveUser(ctx context.Context, userID uuid.UUID) (*models.User, error)
+	// ChangeAccountStatus sets the status of an account on behalf of actor and ends every session
+	// of the account.
+	ChangeAccountStatus(ctx context.Context, userID uuid.UUID, req *dto.ChangeAccountStatusRequest, actor string) (*models.User, error)
+	// ChangeRole sets the role of a user on behalf of actor and ends every session of the user, so
+	// no session outlives the privileges it was started with.
+	ChangeRole(ctx context.Context, userID uuid.UUID, role string, actor string) (*models.User, error)
+	// DeactivateAccount deactivates the logged in user's own account after checking their password.
+	DeactivateAccount(ctx context.Context, userID uuid.UUID, req *dto.DeactivateAccountRequest) error
+	// LoginHistory returns up to limit of the user's login attempts, newest first.
+	LoginHistory(ctx context.Context, userID uuid.UUID, limit int) ([]models.LoginEvent, error)
+	// StartReauthentication emails the logged in user a code to reauthenticate with.
+	StartReauthentication(ctx context.Context, userID uuid.UUID) error
+	// Reauthenticate checks the password or emailed code of the logged in user and refreshes
+	// the authentication time of their session.
+	Reauthenticate(ctx context.Context, userID uuid.UUID, req *dto.ReauthenticateRequest, sess *session.Session) (*dto.AuthenticationResponse, error)
+	// IssueAccessToken issues the logged in user a short-lived access token to send as a bearer token,
+	// with the requested scopes if they are all allowed.
+	IssueAccessToken(ctx context.Context, userID uuid.UUID, req *dto.AccessTokenRequest) (*dto.AccessTokenResponse, error)
+	// VerifyAccessToken returns the user an access token was issued to, if their account can still be used.
+	VerifyAccessToken(ctx context.Context, token string) (*models.User, error)
+	// Sessions returns the store of the sessions the service authenticates.
+	Sessions() *SessionStore
 
 	// Additional methods can be added as needed
 
@@ -37,19 +144,184 @@ type authService struct {
 	UserService  user.UserService
 	TokenService TokenService
 	Mailer       utils.Mailer
+	SessionStore *SessionStore
+	SessionIndex SessionIndex
+	Hasher       password.Hasher
+
+	// enumerationSafe makes responses identical whether or not an account exists
+	enumerationSafe bool
+	// dummyPasswordHash is compared against for unknown users to equalize login timing
+	dummyPasswordHash string
+	dummyPasswordMu   sync.Mutex
+	// passwordPolicy is enforced for every new password
+	passwordPolicy password.Policy
+	// passwordHistory holds previous password hashes to prevent reuse, when set
+	passwordHistory user.PasswordHistoryRepository
+	// loginHistory records login attempts, when set
+	loginHistory LoginHistory
+	// newDeviceAlerts mails users about logins from unrecognized browsers
+	newDeviceAlerts bool
+	// riskEngine scores logins with valid credentials, when set
+	riskEngine *risk.Engine
+	// auditLog records risk decisions, when set
+	auditLog AuditLog
+	// accessTokenTTL is how long issued access tokens are valid
+	accessTokenTTL time.Duration
+	// accessTokenScopes are the scopes access tokens can be requested with
+	accessTokenScopes []string
+	// mailLimiter limits the mails requested for an address, when set
+	mailLimiter     RateLimiter
+	mailLimit       int
+	mailLimitWindow time.Duration
+	// reauthLimiter locks reauthentication after repeated failures, when set
+	reauthLimiter     RateLimiter
+	reauthMaxFailures int
+	reauthLockout     time.Duration
+}
+
+// AuthServiceOption configures optional behaviour of the AuthService.
+type AuthServiceOption func(*authService)
+
+// WithEnumerationProtection makes login, registration, password reset and passwordless
+// login respond identically whether or not an account exists for the email address.
+func WithEnumerationProtection(enabled bool) AuthServiceOption {
+	return func(s *authService) {
+		s.enumerationSafe = enabled
+	}
+}
+
+// WithPasswordPolicy sets the policy new passwords have to meet instead of password.DefaultPolicy.
+func WithPasswordPolicy(policy password.Policy) AuthServiceOption {
+	return func(s *authService) {
+		s.passwordPolicy = policy
+	}
+}
+
+// WithPasswordHistory keeps previous password hashes so that recent passwords cannot be reused.
+// Without it only the current password is rejected as a new one.
+func WithPasswordHistory(repo user.PasswordHistoryRepository) AuthServiceOption {
+	return func(s *authService) {
+		s.passwordHistory = repo
+	}
+}
+
+// WithLoginHistory records every login attempt against an existing account. With alertNewDevices,
+// users are mailed when their account is logged into from a browser it was never used from before.
+func WithLoginHistory(history LoginHistory, alertNewDevices bool) AuthServiceOption {
+	return func(s *authService) {
+		s.loginHistory = history
+		s.newDeviceAlerts = alertNewDevices
+	}
+}
+
+// WithRiskEngine scores every login with valid credentials. Risky password logins have to be
+// confirmed with an emailed sign-in link or code, and logins above the block threshold are refused.
+func WithRiskEngine(engine *risk.Engine) AuthServiceOption {
+	return func(s *authService) {
+		s.riskEngine = engine
+	}
+}
+
+// WithAuditLog records the risk decision about every scored login in the audit log.
+func WithAuditLog(log AuditLog) AuthServiceOption {
+	return func(s *authService) {
+		s.auditLog = log
+	}
+}
+
+// WithAccessTokenTTL sets how long access tokens are valid instead of DefaultAccessTokenTTL.
+func WithAccessTokenTTL(ttl time.Duration) AuthServiceOption {
+	return func(s *authService) {
+		if ttl > 0 {
+			s.accessTokenTTL = ttl
+		}
+	}
+}
+
+// WithAccessTokenScopes sets the scopes access tokens can be requested with. Without it access
+// tokens carry no scopes.
+func WithAccessTokenScopes(scopes []string) AuthServiceOption {
+	return func(s *authService) {
+		s.accessTokenScopes = scopes
+	}
+}
+
+// WithMailRateLimit allows at most limit verification, password reset and sign-in mails of each kind
+// to be requested for an email address per window. Further requests fail with errs.ErrTooManyRequests
+// whether or not an account exists for the address.
+func WithMailRateLimit(limiter RateLimiter, limit int, window time.Duration) AuthServiceOption {
+	return func(s *authService) {
+		if limiter != nil && limit > 0 && window > 0 {
+			s.mailLimiter = limiter
+			s.mailLimit = limit
+			s.mailLimitWindow = window
+		}
+	}
 }
 
 // NewAuthService creates a new AuthService instance.
-func NewAuthService(us user.UserService, ts TokenService) AuthService {
-	return &authService{
+func NewAuthService(us user.UserService, ts TokenService, sessions *SessionStore, si SessionIndex, mailer utils.Mailer, hasher password.Hasher, opts ...AuthServiceOption) AuthService {
+	s := &authService{
 		UserService:  us,
 		TokenService: ts,
-		Mailer:       utils.NewMailer(), // Assuming you have a Mailer implementation
+		Mailer:       mailer,
+		SessionStore: sessions,
+		SessionIndex: si,
+		Hasher:       hasher,
+
+		passwordPolicy: password.DefaultPolicy(),
+		accessTokenTTL: DefaultAccessTokenTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.enumerationSafe {
+		if _, err := s.dummyHash(); err != nil {
+			log.Printf("Error creating dummy password hash: %v", err)
+		}
 	}
+
+	return s
+}
+
+// dummyHash returns the hash passwords for unknown accounts are checked against, creating it if
+// that did not succeed before. Without it the check would return at once and reveal the account.
+func (s *authService) dummyHash() (string, error) {
+	s.dummyPasswordMu.Lock()
+	defer s.dummyPasswordMu.Unlock()
+
+	if s.dummyPasswordHash == "" {
+		hash, err := s.Hasher.Hash("enumeration-protection-dummy-password")
+		if err != nil {
+			return "", err
+		}
+		s.dummyPasswordHash = hash
+	}
+	return s.dummyPasswordHash, nil
+}
+
+// issueDecoy does the work of issuing a link or code of the purpose without sending it, so that
+// enumeration-safe requests for addresses without an account take as long as the others.
+func (s *authService) issueDecoy(ctx context.Context, email, purpose, mode string) error {
+	if mode == dto.DeliveryModeCode {
+		_, err := s.TokenService.GenerateCode(ctx, email, purpose, codeExpiry)
+		return err
+	}
+	_, err := s.TokenService.GenerateToken(ctx, uuid.New(), purpose, codeExpiry)
+	return err
 }
 
 // Login authenticates a user with the provided credentials.
 func (s *authService) Login(ctx context.Context, req *dto.LoginRequest, sess *session.Session) (*models.User, error) {
+	attempt := &loginAttempt{method: models.LoginMethodPassword, client: req.Client, rememberMe: req.RememberMe}
+	loggedInUser, err := s.login(ctx, req, sess, attempt)
+	s.recordLogin(ctx, req.Email, loggedInUser, attempt, err)
+	return loggedInUser, err
+}
+
+// login checks the credentials and starts the session
+func (s *authService) login(ctx context.Context, req *dto.LoginRequest, sess *session.Session, attempt *loginAttempt) (*models.User, error) {
 
 	getUserByEmailDTO := &dto.GetUserByEmailDTO{
 		Email: req.Email,
@@ -61,19 +333,89 @@ func (s *authService) Login(ctx context.Context, req *dto.LoginRequest, sess *se
 	}
 
 	if loggedInUser == nil {
+		// A signup that was never verified has no user yet, but deserves a helpful answer
+		registrations, err := s.UserService.ListPendingRegistrations(ctx, req.Email)
+		if err != nil {
+			return nil, err
+		}
+		for i, registration := range registrations {
+			if i == maxPendingLoginChecks {
+				break
+			}
+			if matches, _ := s.Hasher.Verify(req.Password, registration.PasswordHash); matches {
+				return nil, s.unverifiedLogin(ctx, registration.ID, registration.Email)
+			}
+		}
+		if len(registrations) > 0 {
+			return nil, errs.ErrInvalidCredentials
+		}
+
+		if s.enumerationSafe {
+			// Spend the same time as a real password check so timing does not reveal unknown accounts
+			dummyHash, err := s.dummyHash()
+			if err != nil {
+				return nil, err
+			}
+			_, _ = s.Hasher.Verify(req.Password, dummyHash)
+			return nil, errs.ErrInvalidCredentials
+		}
 		return nil, errs.ErrUserNotFound
 	}
 
-	if isPasswordValid := utils.ComparePassword(req.Password, loggedInUser.PasswordHash); !isPasswordValid {
+	isPasswordValid, err := s.Hasher.Verify(req.Password, loggedInUser.PasswordHash)
+	if err != nil {
+		log.Printf("Error verifying password hash of user %s: %v", loggedInUser.ID, err)
+	}
+	if !isPasswordValid {
 		return nil, errs.ErrInvalidCredentials
 	}
 
+	if s.Hasher.NeedsRehash(loggedInUser.PasswordHash) {
+		s.rehashPassword(ctx, loggedInUser, req.Password)
+	}
+
 	if !loggedInUser.Verified {
-		return nil, errs.ErrEmailNotVerified
+		return nil, s.unverifiedLogin(ctx, loggedInUser.ID, loggedInUser.Email)
 	}
 
-	sess.Set("userID", loggedInUser.ID)
-	err = sess.Save()
+	// The status is only revealed to someone who knows the password
+	if req.Reactivate && loggedInUser.AccountStatus(time.Now()) == models.AccountStatusDeactivated {
+		if err := s.setAccountStatus(ctx, loggedInUser, models.AccountStatusActive, "", ActorSelf, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := accountStatusError(loggedInUser, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if s.riskEngine != nil {
+		assessment, err := s.assessLogin(ctx, loggedInUser, attempt)
+		if err != nil {
+			return nil, err
+		}
+		switch assessment.Decision {
+		case risk.DecisionBlock:
+			return nil, errs.ErrLoginBlocked
+		case risk.DecisionStepUp:
+			// The emailed link or code finishes the login as a passwordless one in this browser
+			if err := s.sendPasswordlessLogin(ctx, loggedInUser, req.StepUpMode, sess); err != nil {
+				return nil, err
+			}
+			return nil, errs.ErrStepUpRequired
+		}
+	}
+
+	if s.passwordPolicy.Expired(loggedInUser.PasswordAge(time.Now())) {
+		// Only allow changing the password until a new one is set
+		sess.Set(sessionKeyExpiredPasswordUserID, loggedInUser.ID)
+		sess.Set(sessionKeyExpiredPasswordAt, time.Now().Unix())
+		if err := sess.Save(); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrPasswordExpired
+	}
+
+	err = s.startSession(ctx, loggedInUser, sess, AMRPassword, attempt)
 	if err != nil {
 		return nil, err
 	}
@@ -81,23 +423,133 @@ func (s *authService) Login(ctx context.Context, req *dto.LoginRequest, sess *se
 	return loggedInUser, nil
 }
 
+// startSession marks the session as authenticated for the user by method, binds it to the client of
+// the attempt and records it in the session index
+func (s *authService) startSession(ctx context.Context, loggedInUser *models.User, sess *session.Session, method string, attempt *loginAttempt) error {
+	// Every way of logging in ends here, so no flow can skip the status check
+	now := time.Now()
+	if err := accountStatusError(loggedInUser, now); err != nil {
+		return err
+	}
+
+	// A new ID keeps a session ID planted before the login from becoming authenticated
+	if err := sess.Regenerate(); err != nil {
+		return err
+	}
+
+	// After the regeneration, so logging in again in the same browser does not count its old session
+	limit := s.SessionStore.policy.sessionLimit(loggedInUser.EffectiveRole())
+	if limit > 0 {
+		// Only sessions still in storage count, expired ones are dropped from the index here
+		if _, err := s.ListSessions(ctx, loggedInUser.ID); err != nil {
+			return err
+		}
+	}
+
+	sess.Set("userID", loggedInUser.ID)
+	sess.Set(sessionKeyAuthTime, now.Unix())
+	sess.Set(sessionKeyAMR, []string{method})
+	s.SessionStore.bindSession(sess, attempt.client, attempt.rememberMe, now)
+	// A token fetched before the login may be known to whoever planted the session
+	if err := setCSRFToken(sess); err != nil {
+		return err
+	}
+	// Save releases the session, so its ID has to be read first
+	sessionID := sess.ID()
+	err := sess.Save()
+	if err != nil {
+		return err
+	}
+
+	if limit <= 0 {
+		return s.SessionIndex.Add(ctx, loggedInUser.ID, sessionID, now)
+	}
+	return s.addSessionWithinLimit(ctx, loggedInUser.ID, sessionID, now, limit)
+}
+
+// addSessionWithinLimit records a saved session in the session index, ending the oldest sessions
+// of the user or refusing the new one when the user is at the concurrent session limit of their
+// role. The index counts and adds atomically, so concurrent logins cannot both take the last place.
+func (s *authService) addSessionWithinLimit(ctx context.Context, userID uuid.UUID, sessionID string, now time.Time, limit int) error {
+	evictOldest := s.SessionStore.policy.LimitStrategy == SessionLimitEvictOldest
+	evicted, err := s.SessionIndex.AddWithinLimit(ctx, userID, sessionID, now, limit, evictOldest)
+	if err != nil {
+		if deleteErr := s.SessionStore.Delete(sessionID); deleteErr != nil {
+			log.Printf("Error deleting refused session: %v", deleteErr)
+		}
+		return err
+	}
+
+	for _, id := range evicted {
+		if err := s.SessionStore.Delete(id); err != nil {
+			return err
+		}
+		log.Printf("Ended session of user %s to stay within %d concurrent sessions", userID, limit)
+	}
+	return nil
+}
+
+// unverifiedLogin answers a login with the right password for an address that was never verified.
+// Enumeration-safe logins fail like a wrong password would and mail a new verification link instead,
+// so only the owner of the address learns that the signup exists.
+func (s *authService) unverifiedLogin(ctx context.Context, id uuid.UUID, email string) error {
+	if !s.enumerationSafe {
+		return errs.ErrEmailNotVerified
+	}
+
+	err := s.allowMail(ctx, PurposeEmailVerification, email)
+	if err == nil {
+		err = s.sendVerification(ctx, id, email, dto.DeliveryModeLink)
+	}
+	if err != nil && !errors.Is(err, errs.ErrTooManyRequests) {
+		log.Printf("Error resending verification email after login: %v", err)
+	}
+	return errs.ErrInvalidCredentials
+}
+
 // Register creates a new user with the provided details
 func (s *authService) Register(ctx context.Context, req *dto.RegisterRequest) (*dto.RegisterResponse, error) {
 
+	if err := s.passwordPolicy.Check(req.Password, req.FullName, req.Email); err != nil {
+		return nil, err
+	}
+
+	// Registering mails the address whether or not it has an account, so both count against the limit
+	if err := s.allowMail(ctx, PurposeEmailVerification, req.Email); err != nil {
+		if s.enumerationSafe && errors.Is(err, errs.ErrTooManyRequests) {
+			// Nothing is mailed, but the response does not tell whether the address has an account
+			return &dto.RegisterResponse{}, nil
+		}
+		return nil, err
+	}
+
 	createUserDTO := &dto.CreateUserDTO{
 		Email:    req.Email,
 		FullName: req.FullName,
 		Password: req.Password,
 	}
 
-	createdUser, err := s.UserService.CreateUser(ctx, createUserDTO)
+	registration, err := s.UserService.RegisterPending(ctx, createUserDTO)
+
+	if err != nil {
+		if s.enumerationSafe && errors.Is(err, errs.ErrUserAlreadyExists) {
+			// Tell the owner of the address instead of telling the requester, after the same work as
+			// a new signup
+			if err := s.issueDecoy(ctx, req.Email, PurposeEmailVerification, req.Mode); err != nil {
+				return nil, err
+			}
+			return &dto.RegisterResponse{}, s.Mailer.SendRegistrationAttemptMail(req.Email)
+		}
+		return nil, err
+	}
 
+	err = s.sendVerification(ctx, registration.ID, registration.Email, req.Mode)
 	if err != nil {
 		return nil, err
 	}
 
 	res := &dto.RegisterResponse{
-		UserID: createdUser.ID,
+		UserID: registration.ID,
 	}
 
 	return res, nil
@@ -105,20 +557,101 @@ func (s *authService) Register(ctx context.Context, req *dto.RegisterRequest) (*
 
 // Logout logs out the user
 func (s *authService) Logout(ctx context.Context, req *dto.LogoutRequest, sess *session.Session) error {
+	if userID, ok := sess.Get("userID").(uuid.UUID); ok {
+		if err := s.SessionIndex.Remove(ctx, userID, sess.ID()); err != nil {
+			log.Printf("Error removing session from index: %v", err)
+		}
+	}
+
 	// Destroy the session
 	return sess.Destroy()
 }
 
-// SendVerificationEmail sends a verification email to the user
+// SendVerificationEmail sends a new verification email for a pending registration
 func (s *authService) SendVerificationEmail(ctx context.Context, req *dto.SendEmailVerificationRequest) error {
-	purpose := "email_verification"
+	if err := s.allowMail(ctx, PurposeEmailVerification, req.Email); err != nil {
+		return err
+	}
+
+	registration, err := s.UserService.GetPendingRegistration(ctx, req.Email)
+	if err != nil {
+		return err
+	}
+	if registration != nil {
+		return s.sendVerification(ctx, registration.ID, registration.Email, req.Mode)
+	}
+
+	// Unverified users created before pending registrations existed
+	existingUser, err := s.UserService.GetUserByEmail(ctx, &dto.GetUserByEmailDTO{Email: req.Email})
+	if err != nil {
+		return err
+	}
+	if existingUser != nil && !existingUser.Verified {
+		return s.sendVerification(ctx, existingUser.ID, existingUser.Email, req.Mode)
+	}
+
+	if s.enumerationSafe {
+		return s.issueDecoy(ctx, req.Email, PurposeEmailVerification, req.Mode)
+	}
+	return errs.ErrUserNotFound
+}
+
+// allowMail counts a request for a mail of the purpose to the address against the mail rate limit.
+// The address is normalized, so its case and surrounding spaces do not reset the count.
+func (s *authService) allowMail(ctx context.Context, purpose, email string) error {
+	if s.mailLimiter == nil {
+		return nil
+	}
+
+	allowed, err := s.mailLimiter.Allow(ctx, "mail:"+purpose+":"+utils.NormalizeEmail(email), s.mailLimit, s.mailLimitWindow)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errs.ErrTooManyRequests
+	}
+	return nil
+}
+
+// WithReauthenticationLimit locks reauthentication of a user for lockout once maxFailures attempts
+// in a row have failed. A successful attempt starts the count again.
+func WithReauthenticationLimit(limiter RateLimiter, maxFailures int, lockout time.Duration) AuthServiceOption {
+	return func(s *authService) {
+		if limiter != nil && maxFailures > 0 && lockout > 0 {
+			s.reauthLimiter = limiter
+			s.reauthMaxFailures = maxFailures
+			s.reauthLockout = lockout
+		}
+	}
+}
+
+// verificationCodePurpose is the purpose of verification codes for a pending registration or
+// unverified user. Each signup of an address has its own code, so a later signup does not replace
+// the code mailed for an earlier one.
+func verificationCodePurpose(id uuid.UUID) string {
+	return PurposeEmailVerification + ":" + id.String()
+}
+
+// sendVerification emails a verification link or code. Both are bound to the ID of the
+// pending registration, or of the unverified user.
+func (s *authService) sendVerification(ctx context.Context, id uuid.UUID, email, mode string) error {
+	purpose := PurposeEmailVerification
+
+	if mode == dto.DeliveryModeCode {
+		code, err := s.TokenService.GenerateCode(ctx, email, verificationCodePurpose(id), codeExpiry)
+		if err != nil {
+			return err
+		}
+		return s.Mailer.SendVerificationCodeMail(email, code)
+	}
+
 	expiry := time.Duration(time.Minute * 30)
-	token, err := s.TokenService.GenerateToken(ctx, req.ID, purpose, expiry)
+	token, err := s.TokenService.GenerateToken(ctx, id, purpose, expiry)
 	if err != nil {
 		return err
 	}
 
-	err = s.Mailer.SendVerificationMail(req.Email, token)
+	err = s.Mailer.SendVerificationMail(email, token)
 	if err != nil {
 		return err
 	}
@@ -128,7 +661,7 @@ func (s *authService) SendVerificationEmail(ctx context.Context, req *dto.SendEm
 // VerifyEmail verifies the user's email using the provided token
 func (s *authService) VerifyEmail(ctx context.Context, req *dto.VerifyEmailRequest) error {
 
-	expectedPurpose := "email_verification"
+	expectedPurpose := PurposeEmailVerification
 
 	claims, err := s.TokenService.ValidateToken(ctx, req.Token, expectedPurpose)
 
@@ -136,25 +669,40 @@ func (s *authService) VerifyEmail(ctx context.Context, req *dto.VerifyEmailReque
 		return err
 	}
 
-	unverifiedUser, err := s.UserService.GetUserByID(ctx, claims.UserID)
-
+	registration, err := s.UserService.GetPendingRegistrationByID(ctx, claims.UserID)
 	if err != nil {
 		return err
 	}
+	if registration != nil {
+		_, err = s.UserService.CompleteRegistration(ctx, registration.ID)
+		return err
+	}
 
-	unverifiedUser.Verified = true
-
-	_, err = s.UserService.UpdateUser(ctx, unverifiedUser)
-
+	unverifiedUser, err := s.UserService.GetUserByID(ctx, claims.UserID)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.markVerified(ctx, unverifiedUser)
+}
+
+// markVerified verifies an unverified user created before pending registrations existed
+func (s *authService) markVerified(ctx context.Context, unverifiedUser *models.User) error {
+	if unverifiedUser == nil {
+		return errs.ErrUserNotFound
+	}
+
+	unverifiedUser.Verified = true
+
+	_, err := s.UserService.UpdateUser(ctx, unverifiedUser)
+	return err
 }
 
 // ForgotPassword initiates the forgot password process for the user
 func (s *authService) ForgotPassword(ctx context.Context, req *dto.ForgotPasswordRequest) error {
+	if err := s.allowMail(ctx, PurposePasswordReset, req.Email); err != nil {
+		return err
+	}
 
 	getUserByEmailDTO := &dto.GetUserByEmailDTO{
 		Email: req.Email,
@@ -166,10 +714,21 @@ func (s *authService) ForgotPassword(ctx context.Context, req *dto.ForgotPasswor
 	}
 
 	if existingUser == nil {
+		if s.enumerationSafe {
+			return s.issueDecoy(ctx, req.Email, PurposePasswordReset, req.Mode)
+		}
 		return errs.ErrUserNotFound
 	}
 
-	purpose := "password_reset"
+	purpose := PurposePasswordReset
+
+	if req.Mode == dto.DeliveryModeCode {
+		code, err := s.TokenService.GenerateCode(ctx, existingUser.Email, purpose, codeExpiry)
+		if err != nil {
+			return err
+		}
+		return s.Mailer.SendPasswordResetCodeMail(existingUser.Email, code)
+	}
 
 	expiry := time.Duration(time.Minute * 30)
 
@@ -189,9 +748,10 @@ func (s *authService) ForgotPassword(ctx context.Context, req *dto.ForgotPasswor
 
 // ResetPassword resets the user's password using the provided reset token
 func (s *authService) ResetPassword(ctx context.Context, req *dto.ResetPasswordRequest) error {
-	expectedPurpose := "password_reset"
+	expectedPurpose := PurposePasswordReset
 
-	claims, err := s.TokenService.ValidateToken(ctx, req.ResetToken, expectedPurpose)
+	// Check the new password before the single-use token is spent, so a rejected password can be retried
+	claims, err := s.TokenService.InspectToken(ctx, req.ResetToken, expectedPurpose)
 
 	if err != nil {
 		return err
@@ -207,15 +767,829 @@ func (s *authService) ResetPassword(ctx context.Context, req *dto.ResetPasswordR
 		return errs.ErrUserNotFound
 	}
 
-	existingUser.PasswordHash, err = utils.HashPassword(req.NewPassword)
+	if err := s.checkNewPassword(ctx, existingUser, req.NewPassword); err != nil {
+		return err
+	}
+
+	_, err = s.TokenService.ValidateToken(ctx, req.ResetToken, expectedPurpose)
+	if err != nil {
+		return err
+	}
+
+	return s.storePassword(ctx, existingUser, req.NewPassword)
+}
+
+// VerifyEmailWithCode verifies the user's email using an emailed numeric code
+func (s *authService) VerifyEmailWithCode(ctx context.Context, req *dto.VerifyEmailCodeRequest) error {
+	// Every signup of the address has its own code, so the code tells which one to complete
+	registrations, err := s.UserService.ListPendingRegistrations(ctx, req.Email)
+	if err != nil {
+		return err
+	}
+	for _, registration := range registrations {
+		err = s.TokenService.ValidateCode(ctx, req.Email, req.Code, verificationCodePurpose(registration.ID))
+		if err == nil {
+			_, err = s.UserService.CompleteRegistration(ctx, registration.ID)
+			return err
+		}
+		if !errors.Is(err, errs.ErrInvalidCode) && !errors.Is(err, errs.ErrTooManyAttempts) {
+			return err
+		}
+	}
+	if len(registrations) > 0 {
+		return err
+	}
+
+	// Unverified users created before pending registrations existed. Unknown addresses are checked
+	// against the decoy codes mailed for them, so they fail like a wrong code.
+	unverifiedUser, err := s.UserService.GetUserByEmail(ctx, &dto.GetUserByEmailDTO{Email: req.Email})
+	if err != nil {
+		return err
+	}
+	purpose := PurposeEmailVerification
+	if unverifiedUser != nil && !unverifiedUser.Verified {
+		purpose = verificationCodePurpose(unverifiedUser.ID)
+	}
+
+	err = s.TokenService.ValidateCode(ctx, req.Email, req.Code, purpose)
+	if err != nil {
+		return err
+	}
+
+	return s.markVerified(ctx, unverifiedUser)
+}
+
+// ResetPasswordWithCode resets the user's password using an emailed numeric code
+func (s *authService) ResetPasswordWithCode(ctx context.Context, req *dto.ResetPasswordCodeRequest) error {
+	// Check the new password before the single-use code is spent, so a rejected password can be retried
+	err := s.TokenService.InspectCode(ctx, req.Email, req.Code, PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	existingUser, err := s.UserService.GetUserByEmail(ctx, &dto.GetUserByEmailDTO{Email: req.Email})
+	if err != nil {
+		return err
+	}
+
+	if existingUser == nil {
+		return errs.ErrUserNotFound
+	}
+
+	if err := s.checkNewPassword(ctx, existingUser, req.NewPassword); err != nil {
+		return err
+	}
+
+	err = s.TokenService.ValidateCode(ctx, req.Email, req.Code, PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	return s.storePassword(ctx, existingUser, req.NewPassword)
+}
+
+// ChangePassword replaces the password of a logged in user after checking the current one
+func (s *authService) ChangePassword(ctx context.Context, userID uuid.UUID, req *dto.ChangePasswordRequest) error {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	isPasswordValid, err := s.Hasher.Verify(req.CurrentPassword, existingUser.PasswordHash)
+	if err != nil {
+		log.Printf("Error verifying password hash of user %s: %v", existingUser.ID, err)
+	}
+	if !isPasswordValid {
+		return errs.ErrInvalidCredentials
+	}
+
+	return s.setPassword(ctx, existingUser, req.NewPassword)
+}
+
+// EvaluatePassword checks a candidate password against the password policy and estimates its strength
+func (s *authService) EvaluatePassword(req *dto.PasswordStrengthRequest) password.Evaluation {
+	return s.passwordPolicy.Evaluate(req.Password, req.FullName, req.Email)
+}
+
+// ChangeExpiredPassword sets a new password after a login was refused because the password expired
+func (s *authService) ChangeExpiredPassword(ctx context.Context, req *dto.ExpiredPasswordChangeRequest, sess *session.Session) (*models.User, error) {
+	pendingUserID, ok := sess.Get(sessionKeyExpiredPasswordUserID).(uuid.UUID)
+	pendingAt, _ := sess.Get(sessionKeyExpiredPasswordAt).(int64)
+	if !ok || time.Since(time.Unix(pendingAt, 0)) > expiredPasswordChangeWindow {
+		return nil, errs.ErrNoPasswordChangeDue
+	}
+
+	existingUser, err := s.UserService.GetUserByID(ctx, pendingUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.setPassword(ctx, existingUser, req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.Delete(sessionKeyExpiredPasswordUserID)
+	sess.Delete(sessionKeyExpiredPasswordAt)
+
+	attempt := &loginAttempt{method: models.LoginMethodPassword, client: req.Client, rememberMe: req.RememberMe}
+	err = s.startSession(ctx, existingUser, sess, AMRPassword, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	return existingUser, nil
+}
+
+// setPassword checks and stores a new password
+func (s *authService) setPassword(ctx context.Context, existingUser *models.User, newPassword string) error {
+	if err := s.checkNewPassword(ctx, existingUser, newPassword); err != nil {
+		return err
+	}
+	return s.storePassword(ctx, existingUser, newPassword)
+}
+
+// checkNewPassword enforces the password policy and rejects the user's recent passwords
+func (s *authService) checkNewPassword(ctx context.Context, existingUser *models.User, newPassword string) error {
+	err := s.passwordPolicy.Check(newPassword, existingUser.FullName, existingUser.Email)
+	if err != nil {
+		return err
+	}
+
+	if s.passwordPolicy.HistorySize <= 0 {
+		return nil
+	}
+
+	recentHashes := []string{existingUser.PasswordHash}
+	if s.passwordHistory != nil && s.passwordPolicy.HistorySize > 1 {
+		history, err := s.passwordHistory.List(ctx, existingUser.ID, s.passwordPolicy.HistorySize-1)
+		if err != nil {
+			return err
+		}
+		for _, entry := range history {
+			recentHashes = append(recentHashes, entry.PasswordHash)
+		}
+	}
+
+	for _, hash := range recentHashes {
+		if reused, _ := s.Hasher.Verify(newPassword, hash); reused {
+			return s.passwordPolicy.ReusedError()
+		}
+	}
+	return nil
+}
+
+// storePassword replaces the user's password, records the previous one and invalidates outstanding tokens
+func (s *authService) storePassword(ctx context.Context, existingUser *models.User, newPassword string) error {
+	previousHash := existingUser.PasswordHash
+
+	var err error
+	existingUser.PasswordHash, err = s.Hasher.Hash(newPassword)
 	if err != nil {
 		return errs.ErrInternalServerError // Error hashing password
 	}
+	now := time.Now()
+	existingUser.PasswordChangedAt = &now
 
 	_, err = s.UserService.UpdateUser(ctx, existingUser)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if s.passwordHistory != nil && s.passwordPolicy.HistorySize > 1 {
+		entry := &models.PasswordHistory{UserID: existingUser.ID, PasswordHash: previousHash}
+		if err := s.passwordHistory.Add(ctx, entry, s.passwordPolicy.HistorySize-1); err != nil {
+			return err
+		}
+	}
+
+	// Invalidate any other outstanding tokens issued before the password change
+	return s.TokenService.RevokeUserTokens(ctx, existingUser.ID)
+}
+
+// rehashPassword upgrades an outdated password hash while the plaintext is known after a
+// successful login. Failures are only logged, the old hash keeps working.
+func (s *authService) rehashPassword(ctx context.Context, existingUser *models.User, plainPassword string) {
+	newHash, err := s.Hasher.Hash(plainPassword)
+	if err != nil {
+		log.Printf("Error rehashing password of user %s: %v", existingUser.ID, err)
+		return
+	}
+
+	existingUser.PasswordHash = newHash
+	if _, err := s.UserService.UpdateUser(ctx, existingUser); err != nil {
+		log.Printf("Error storing rehashed password of user %s: %v", existingUser.ID, err)
+	}
+}
+
+// StartPasswordlessLogin emails a single-use sign-in link or code bound to the requesting session
+func (s *authService) StartPasswordlessLogin(ctx context.Context, req *dto.PasswordlessStartRequest, sess *session.Session) error {
+	if err := s.allowMail(ctx, PurposePasswordlessLogin, req.Email); err != nil {
+		return err
+	}
+
+	existingUser, err := s.UserService.GetUserByEmail(ctx, &dto.GetUserByEmailDTO{Email: req.Email})
+	if err != nil {
+		return err
+	}
+
+	if existingUser == nil || !existingUser.Verified {
+		if s.enumerationSafe {
+			return s.issueDecoy(ctx, req.Email, PurposePasswordlessLogin, req.Mode)
+		}
+		if existingUser == nil {
+			return errs.ErrUserNotFound
+		}
+		return errs.ErrEmailNotVerified
+	}
+
+	return s.sendPasswordlessLogin(ctx, existingUser, req.Mode, sess)
+}
+
+// sendPasswordlessLogin binds a pending passwordless login to the session and emails its link or code
+func (s *authService) sendPasswordlessLogin(ctx context.Context, existingUser *models.User, mode string, sess *session.Session) error {
+	// Only the browser holding this session can redeem the link or code, so a
+	// forwarded or intercepted email cannot be used elsewhere
+	sess.Set(sessionKeyPasswordlessUserID, existingUser.ID)
+	sess.Set(sessionKeyPasswordlessEmail, utils.NormalizeEmail(existingUser.Email))
+	err := sess.Save()
+	if err != nil {
+		return err
+	}
+
+	purpose := PurposePasswordlessLogin
+
+	if mode == dto.DeliveryModeCode {
+		code, err := s.TokenService.GenerateCode(ctx, existingUser.Email, purpose, codeExpiry)
+		if err != nil {
+			return err
+		}
+		return s.Mailer.SendLoginCodeMail(existingUser.Email, code)
+	}
+
+	expiry := time.Duration(time.Minute * 15)
+	token, err := s.TokenService.GenerateToken(ctx, existingUser.ID, purpose, expiry)
+	if err != nil {
+		return err
+	}
+
+	return s.Mailer.SendMagicLinkMail(existingUser.Email, token)
+}
+
+// CompletePasswordlessLogin redeems a sign-in link or code and logs the user in
+func (s *authService) CompletePasswordlessLogin(ctx context.Context, req *dto.PasswordlessVerifyRequest, sess *session.Session) (*models.User, error) {
+	attempt := &loginAttempt{method: models.LoginMethodPasswordless, client: req.Client, rememberMe: req.RememberMe}
+	loggedInUser, err := s.completePasswordlessLogin(ctx, req, sess, attempt)
+	s.recordLogin(ctx, req.Email, loggedInUser, attempt, err)
+	return loggedInUser, err
+}
+
+// completePasswordlessLogin redeems the link or code and starts the session
+func (s *authService) completePasswordlessLogin(ctx context.Context, req *dto.PasswordlessVerifyRequest, sess *session.Session, attempt *loginAttempt) (*models.User, error) {
+	pendingUserID, ok := sess.Get(sessionKeyPasswordlessUserID).(uuid.UUID)
+	pendingEmail, _ := sess.Get(sessionKeyPasswordlessEmail).(string)
+	if !ok {
+		return nil, errs.ErrLoginBindingMismatch
+	}
+
+	var userID uuid.UUID
+	if req.Token != "" {
+		// The binding is checked before the link is spent, so opening it in another browser does
+		// not keep the one that asked for it from using it
+		claims, err := s.TokenService.InspectToken(ctx, req.Token, PurposePasswordlessLogin)
+		if err != nil {
+			return nil, err
+		}
+		if claims.UserID != pendingUserID {
+			return nil, errs.ErrLoginBindingMismatch
+		}
+		if _, err := s.TokenService.ValidateToken(ctx, req.Token, PurposePasswordlessLogin); err != nil {
+			return nil, err
+		}
+		userID = claims.UserID
+	} else {
+		if utils.NormalizeEmail(req.Email) != pendingEmail {
+			return nil, errs.ErrLoginBindingMismatch
+		}
+		err := s.TokenService.ValidateCode(ctx, req.Email, req.Code, PurposePasswordlessLogin)
+		if err != nil {
+			return nil, err
+		}
+		userID = pendingUserID
+	}
+
+	loggedInUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.Delete(sessionKeyPasswordlessUserID)
+	sess.Delete(sessionKeyPasswordlessEmail)
+
+	// Redeeming the email already is the confirmation a step-up asks for, so only blocking applies
+	if s.riskEngine != nil {
+		assessment, err := s.assessLogin(ctx, loggedInUser, attempt)
+		if err != nil {
+			return nil, err
+		}
+		if assessment.Decision == risk.DecisionBlock {
+			return nil, errs.ErrLoginBlocked
+		}
+	}
+
+	err = s.startSession(ctx, loggedInUser, sess, AMROneTimeCode, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	return loggedInUser, nil
+}
+
+// ListSessions lists the active sessions of the user
+func (s *authService) ListSessions(ctx context.Context, userID uuid.UUID) ([]SessionRecord, error) {
+	records, err := s.SessionIndex.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop index entries whose session has already expired from storage
+	active := make([]SessionRecord, 0, len(records))
+	for _, record := range records {
+		data, err := s.SessionStore.Storage.Get(record.ID)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			if err := s.SessionIndex.Remove(ctx, userID, record.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		active = append(active, record)
+	}
+
+	return active, nil
+}
+
+// RevokeSession revokes a single session of the user
+func (s *authService) RevokeSession(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	records, err := s.SessionIndex.List(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.ID == sessionID {
+			if err := s.SessionStore.Delete(sessionID); err != nil {
+				return err
+			}
+			return s.SessionIndex.Remove(ctx, userID, sessionID)
+		}
+	}
+
+	return errs.ErrSessionNotFound
+}
+
+// RevokeAllSessions revokes every session of the user
+func (s *authService) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int, error) {
+	records, err := s.SessionIndex.List(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, record := range records {
+		if err := s.SessionStore.Delete(record.ID); err != nil {
+			return 0, err
+		}
+		if err := s.SessionIndex.Remove(ctx, userID, record.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(records), nil
+}
+
+// ActiveUser returns the user if their account can currently be used
+func (s *authService) ActiveUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := accountStatusError(existingUser, time.Now()); err != nil {
+		return nil, err
+	}
+	return existingUser, nil
+}
+
+// IssueAccessToken issues the logged in user a short-lived access token
+func (s *authService) IssueAccessToken(ctx context.Context, userID uuid.UUID, req *dto.AccessTokenRequest) (*dto.AccessTokenResponse, error) {
+	scopes := strings.Fields(req.Scope)
+	for _, scope := range scopes {
+		if !slices.Contains(s.accessTokenScopes, scope) {
+			return nil, fmt.Errorf("%w: %s", errs.ErrInvalidScope, scope)
+		}
+	}
+
+	activeUser, err := s.ActiveUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.TokenService.GenerateAccessToken(activeUser, scopes, s.accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.AccessTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.accessTokenTTL / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// VerifyAccessToken returns the user an access token was issued to
+func (s *authService) VerifyAccessToken(ctx context.Context, token string) (*models.User, error) {
+	claims, err := s.TokenService.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	// The token outlives changes to the account, so its status is looked up every time
+	return s.ActiveUser(ctx, claims.UserID)
+}
+
+// Sessions returns the store of the sessions the service authenticates
+func (s *authService) Sessions() *SessionStore {
+	return s.SessionStore
+}
+
+// ChangeAccountStatus sets the status of an account and ends its sessions
+func (s *authService) ChangeAccountStatus(ctx context.Context, userID uuid.UUID, req *dto.ChangeAccountStatusRequest, actor string) (*models.User, error) {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var suspendedUntil *time.Time
+	if req.Status == models.AccountStatusSuspended {
+		if req.Until == nil || !req.Until.After(time.Now()) {
+			return nil, fmt.Errorf("%w: a suspension needs an end time in the future", errs.ErrInvalidAccountStatus)
+		}
+		suspendedUntil = req.Until
+	}
+
+	err = s.setAccountStatus(ctx, existingUser, req.Status, req.Reason, actor, suspendedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Ended %d session(s) of user %s after status change to %s by %s", revoked, userID, req.Status, actor)
+
+	return existingUser, nil
+}
+
+// ChangeRole sets the role of a user and ends their sessions
+func (s *authService) ChangeRole(ctx context.Context, userID uuid.UUID, role string, actor string) (*models.User, error) {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser.Role == role {
+		return existingUser, nil
+	}
+
+	existingUser.Role = role
+	if _, err := s.UserService.UpdateUser(ctx, existingUser); err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Ended %d session(s) of user %s after role change to %s by %s", revoked, userID, role, actor)
+
+	return existingUser, nil
+}
+
+// DeactivateAccount deactivates the logged in user's own account
+func (s *authService) DeactivateAccount(ctx context.Context, userID uuid.UUID, req *dto.DeactivateAccountRequest) error {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	isPasswordValid, err := s.Hasher.Verify(req.Password, existingUser.PasswordHash)
+	if err != nil {
+		log.Printf("Error verifying password hash of user %s: %v", existingUser.ID, err)
+	}
+	if !isPasswordValid {
+		return errs.ErrInvalidCredentials
+	}
+
+	err = s.setAccountStatus(ctx, existingUser, models.AccountStatusDeactivated, req.Reason, ActorSelf, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.RevokeAllSessions(ctx, userID)
+	return err
+}
+
+// setAccountStatus records a status change of the account
+func (s *authService) setAccountStatus(ctx context.Context, existingUser *models.User, status, reason, actor string, suspendedUntil *time.Time) error {
+	now := time.Now()
+	existingUser.Status = status
+	existingUser.StatusReason = reason
+	existingUser.StatusActor = actor
+	existingUser.StatusChangedAt = &now
+	existingUser.SuspendedUntil = suspendedUntil
+
+	_, err := s.UserService.UpdateUser(ctx, existingUser)
+	return err
+}
+
+// accountStatusError returns the error explaining why the account cannot be used at now, or nil
+func accountStatusError(existingUser *models.User, now time.Time) error {
+	switch status := existingUser.AccountStatus(now); status {
+	case models.AccountStatusActive:
+		return nil
+	case models.AccountStatusSuspended:
+		if existingUser.SuspendedUntil != nil {
+			return fmt.Errorf("%w until %s", errs.ErrAccountSuspended, existingUser.SuspendedUntil.UTC().Format(time.RFC3339))
+		}
+		return errs.ErrAccountSuspended
+	case models.AccountStatusBanned:
+		return errs.ErrAccountBanned
+	case models.AccountStatusDeactivated:
+		return errs.ErrAccountDeactivated
+	default:
+		return fmt.Errorf("%w: unknown status %q", errs.ErrInvalidAccountStatus, status)
+	}
+}
+
+// StartReauthentication emails the logged in user a code to reauthenticate with
+func (s *authService) StartReauthentication(ctx context.Context, userID uuid.UUID) error {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.allowMail(ctx, PurposeReauthentication, existingUser.Email); err != nil {
+		return err
+	}
+	code, err := s.TokenService.GenerateCode(ctx, existingUser.Email, PurposeReauthentication, codeExpiry)
+	if err != nil {
+		return err
+	}
+	return s.Mailer.SendReauthenticationCodeMail(existingUser.Email, code)
+}
+
+// Reauthenticate checks the password or emailed code and refreshes the authentication time of the session
+func (s *authService) Reauthenticate(ctx context.Context, userID uuid.UUID, req *dto.ReauthenticateRequest, sess *session.Session) (*dto.AuthenticationResponse, error) {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every attempt counts until one succeeds, so a stolen session cannot guess the password
+	limitKey := "reauthentication:" + userID.String()
+	if s.reauthLimiter != nil {
+		allowed, err := s.reauthLimiter.Allow(ctx, limitKey, s.reauthMaxFailures, s.reauthLockout)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			log.Printf("Reauthentication of user %s is locked after repeated failures", userID)
+			return nil, errs.ErrTooManyRequests
+		}
+	}
+
+	method := AMRPassword
+	if req.Password != "" {
+		isPasswordValid, err := s.Hasher.Verify(req.Password, existingUser.PasswordHash)
+		if err != nil {
+			log.Printf("Error verifying password hash of user %s: %v", existingUser.ID, err)
+		}
+		if !isPasswordValid {
+			return nil, errs.ErrInvalidCredentials
+		}
+	} else {
+		if err := s.TokenService.ValidateCode(ctx, existingUser.Email, req.Code, PurposeReauthentication); err != nil {
+			return nil, err
+		}
+		method = AMROneTimeCode
+	}
+	if s.reauthLimiter != nil {
+		if err := s.reauthLimiter.Reset(ctx, limitKey); err != nil {
+			log.Printf("Error resetting reauthentication failures of user %s: %v", userID, err)
+		}
+	}
+
+	_, amr := sessionAuthentication(sess)
+	amr = append([]string(nil), amr...)
+	found := false
+	for _, existing := range amr {
+		found = found || existing == method
+	}
+	if !found {
+		amr = append(amr, method)
+	}
+
+	// The elevated session gets a new ID, so one captured before cannot be used for sensitive actions
+	oldSessionID := sess.ID()
+	if err := sess.Regenerate(); err != nil {
+		return nil, err
+	}
+
+	// The session only keeps whole seconds
+	now := time.Now()
+	authTime := time.Unix(now.Unix(), 0).UTC()
+	sess.Set(sessionKeyAuthTime, authTime.Unix())
+	sess.Set(sessionKeyAMR, amr)
+	s.SessionStore.setSessionExpiry(sess, now)
+	sessionID := sess.ID()
+	if err := sess.Save(); err != nil {
+		return nil, err
+	}
+
+	if err := s.SessionIndex.Remove(ctx, userID, oldSessionID); err != nil && !errors.Is(err, errs.ErrSessionNotFound) {
+		return nil, err
+	}
+	if err := s.SessionIndex.Add(ctx, userID, sessionID, sessionCreatedAt(sess)); err != nil {
+		return nil, err
+	}
+
+	return &dto.AuthenticationResponse{AuthTime: authTime, AMR: amr}, nil
+}
+
+// LoginHistory returns the user's login attempts, newest first
+func (s *authService) LoginHistory(ctx context.Context, userID uuid.UUID, limit int) ([]models.LoginEvent, error) {
+	if s.loginHistory == nil {
+		return []models.LoginEvent{}, nil
+	}
+	return s.loginHistory.List(ctx, userID, limit)
+}
+
+// loginAttempt carries what is learned about a login attempt to its entry in the login history
+type loginAttempt struct {
+	method string
+	client dto.ClientInfo
+	// rememberMe selects the longer session lifetime
+	rememberMe bool
+	// assessment is the risk assessment of the attempt, when it got far enough to be scored
+	assessment *risk.Assessment
+}
+
+// assessLogin scores a login with valid credentials and keeps the assessment for the login history
+func (s *authService) assessLogin(ctx context.Context, loggedInUser *models.User, attempt *loginAttempt) (*risk.Assessment, error) {
+	newDevice := false
+	if s.loginHistory != nil && attempt.client.DeviceID != "" {
+		known, err := s.loginHistory.KnownDevice(ctx, loggedInUser.ID, hashDeviceID(attempt.client.DeviceID))
+		if err != nil {
+			return nil, err
+		}
+		newDevice = !known
+	}
+
+	assessment, err := s.riskEngine.Assess(ctx, risk.Attempt{
+		UserID:    loggedInUser.ID,
+		IP:        attempt.client.IP,
+		NewDevice: newDevice,
+		At:        time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if assessment.Decision != risk.DecisionAllow {
+		log.Printf("Login of user %s scored %d (%s): %s", loggedInUser.ID, assessment.Score,
+			strings.Join(assessment.Reasons, ", "), assessment.Decision)
+	}
+	s.auditRiskDecision(ctx, loggedInUser.ID, attempt, assessment)
+
+	attempt.assessment = assessment
+	return assessment, nil
+}
+
+// auditRiskDecision records a risk decision in the audit log. A failure is logged rather than
+// refusing the login, like failures to record the login history.
+func (s *authService) auditRiskDecision(ctx context.Context, userID uuid.UUID, attempt *loginAttempt, assessment *risk.Assessment) {
+	if s.auditLog == nil {
+		return
+	}
+	details := fmt.Sprintf("method=%s score=%d reasons=%s", attempt.method, assessment.Score, strings.Join(assessment.Reasons, ","))
+	if location := assessment.Location; location != nil && location.Country != "" {
+		details += " country=" + location.Country
+	}
+	event := &models.AuditEvent{
+		UserID:    userID,
+		Action:    models.AuditActionLoginRisk,
+		Outcome:   assessment.Decision,
+		IP:        truncate(attempt.client.IP, 45),
+		Details:   truncate(details, 500),
+		CreatedAt: time.Now(),
+	}
+	if err := s.auditLog.Add(ctx, event); err != nil {
+		log.Printf("Error auditing risk decision about user %s: %v", userID, err)
+	}
+}
+
+// recordLogin records the outcome of a login attempt, updates the time of the last login and alerts
+// the user about logins from unrecognized browsers. Attempts against unknown accounts are not
+// recorded, and failures here are only logged so they never affect the login itself.
+func (s *authService) recordLogin(ctx context.Context, email string, loggedInUser *models.User, attempt *loginAttempt, loginErr error) {
+	client := attempt.client
+	account := loggedInUser
+	if account == nil {
+		if s.loginHistory == nil || email == "" {
+			return
+		}
+		existingUser, err := s.UserService.GetUserByEmail(ctx, &dto.GetUserByEmailDTO{Email: email})
+		if err != nil || existingUser == nil {
+			return
+		}
+		account = existingUser
+	}
+
+	now := time.Now()
+	agent := utils.ParseUserAgent(client.UserAgent)
+	event := &models.LoginEvent{
+		UserID:    account.ID,
+		Method:    attempt.method,
+		Success:   loginErr == nil,
+		IP:        truncate(client.IP, 45),
+		UserAgent: truncate(client.UserAgent, 512),
+		Device:    agent.Device,
+		Browser:   agent.Browser,
+		OS:        agent.OS,
+		CreatedAt: now,
+	}
+	if client.DeviceID != "" {
+		event.DeviceHash = hashDeviceID(client.DeviceID)
+	}
+	if assessment := attempt.assessment; assessment != nil {
+		event.RiskScore = assessment.Score
+		event.RiskDecision = assessment.Decision
+		event.RiskReasons = truncate(strings.Join(assessment.Reasons, ","), 200)
+		if location := assessment.Location; location != nil {
+			event.Country = location.Country
+			if location.HasCoordinates {
+				event.Latitude = &location.Latitude
+				event.Longitude = &location.Longitude
+			}
+		}
+	}
+
+	alert := false
+	if loginErr != nil {
+		event.FailureReason = truncate(loginErr.Error(), 100)
+	} else {
+		// The very first login is from the browser used to sign up, nothing to warn about
+		firstLogin := account.LastLoginAt == nil
+		account.LastLoginAt = &now
+		if err := s.UserService.UpdateLastLogin(ctx, account.ID, now); err != nil {
+			log.Printf("Error storing last login of user %s: %v", account.ID, err)
+		}
+
+		if s.loginHistory != nil && event.DeviceHash != "" {
+			known, err := s.loginHistory.KnownDevice(ctx, account.ID, event.DeviceHash)
+			if err != nil {
+				log.Printf("Error looking up devices of user %s: %v", account.ID, err)
+			} else {
+				event.NewDevice = !known
+				alert = event.NewDevice && !firstLogin && s.newDeviceAlerts
+			}
+		}
+	}
+
+	if s.loginHistory != nil {
+		if err := s.loginHistory.Add(ctx, event); err != nil {
+			log.Printf("Error recording login of user %s: %v", account.ID, err)
+		}
+	}
+
+	if alert {
+		details := fmt.Sprintf("%s, IP address %s, at %s", agent, event.IP, now.UTC().Format(time.RFC1123))
+		if err := s.Mailer.SendNewDeviceLoginMail(account.Email, details); err != nil {
+			log.Printf("Error sending new device mail to user %s: %v", account.ID, err)
+		}
+	}
+}
+
+// hashDeviceID hashes a device cookie so the stored history cannot be used to forge one
+func hashDeviceID(deviceID string) string {
+	sum := sha256.Sum256([]byte(deviceID))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return strings.ToValidUTF8(s[:n], "")
+	}
+	return s
 }
@@ -1,25 +1,2284 @@
 package auth_test
 
 import (
+	"authentication/src/authmw"
+	"authentication/src/config"
+	"authentication/src/internal/app"
 	"authentication/src/internal/auth"
+	"authentication/src/internal/dto"
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"authentication/src/internal/password"
+	"authentication/src/internal/risk"
+	"authentication/src/internal/testutil"
+	"authentication/src/internal/user"
+	"authentication/src/utils"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-func TestHashPassword(t *testing.T) {
-	password := "securePassword123"
-	hash, err := auth.HashPassword(password)
+func TestRegisterVerifyLoginLogout(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	res := h.Login("jane@example.com", "securePassword123")
+	if !res.Body.Success {
+		t.Errorf("Expected a successful login response, got %s", res.RawBody)
+	}
+	if h.Cookie("session_id") == "" {
+		t.Fatal("Expected a session cookie after login")
+	}
+
+	res = h.Do(http.MethodPost, "/auth/logout", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected logout to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/logout", nil)
+	if res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected logout without a session to be unauthorized, got %d", res.Status)
+	}
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "Jane Doe",
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Registration failed with status %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusForbidden {
+		t.Errorf("Expected unverified login to be forbidden, got %d", res.Status)
+	}
+}
+
+func TestLoginWithWrongPassword(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	res := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "wrongPassword123",
+	})
+	if res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected wrong password to be unauthorized, got %d", res.Status)
+	}
+}
+
+func TestRegisterDuplicateVerifiedEmail(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "Jane Again",
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusConflict {
+		t.Errorf("Expected duplicate registration to conflict, got %d", res.Status)
+	}
+}
+
+func TestReRegistrationKeepsPendingSignup(t *testing.T) {
+	h := testutil.NewHarness(t)
+	register := func(name string) string {
+		res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+			"name":     name,
+			"email":    "jane@example.com",
+			"password": "securePassword123",
+		})
+		if res.Status != http.StatusOK {
+			t.Fatalf("Registration failed with status %d: %s", res.Status, res.RawBody)
+		}
+		return h.LastMail(utils.MailKindVerification, "jane@example.com")
+	}
+
+	firstLink := register("Jane")
+	if _, err := h.Users.GetUserByEmail(t.Context(), "jane@example.com"); err == nil {
+		t.Fatal("Expected no user row before the email address is verified")
+	}
+
+	// Registering again, e.g. after losing the first mail, adds a signup next to the first one
+	secondLink := register("Jane Doe")
+	registrations, err := h.Registrations.ListByEmail(t.Context(), "jane@example.com")
+	if err != nil || len(registrations) != 2 {
+		t.Fatalf("Expected two pending registrations, got %d (%v)", len(registrations), err)
+	}
+	secondID := registrations[0].ID
+
+	res := h.Do(http.MethodPost, "/auth/verify-email/", map[string]string{"token": secondLink})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Email verification failed with status %d: %s", res.Status, res.RawBody)
+	}
+
+	h.Login("jane@example.com", "securePassword123")
+	verifiedUser, err := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	if err != nil {
+		t.Fatalf("Expected a user after verification: %v", err)
+	}
+	if verifiedUser.ID != secondID || verifiedUser.FullName != "Jane Doe" || !verifiedUser.Verified {
+		t.Errorf("Unexpected user after verification: %+v", verifiedUser)
+	}
+	if registrations, _ := h.Registrations.ListByEmail(t.Context(), "jane@example.com"); len(registrations) != 0 {
+		t.Error("Expected the pending registrations to be removed after verification")
+	}
+	res = h.Do(http.MethodPost, "/auth/verify-email/", map[string]string{"token": firstLink})
+	if res.Status == http.StatusOK {
+		t.Error("Expected the link of the other signup not to verify once the address is taken")
+	}
+}
+
+func TestReRegistrationCannotHijackPendingSignup(t *testing.T) {
+	register := func(h *testutil.Harness, email, password, mode string) {
+		res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+			"name":     "Jane Doe",
+			"email":    email,
+			"password": password,
+			"mode":     mode,
+		})
+		if res.Status != http.StatusOK {
+			t.Fatalf("Registration failed with status %d: %s", res.Status, res.RawBody)
+		}
+	}
+	rejectsPassword := func(h *testutil.Harness, password string) {
+		res := h.Do(http.MethodPost, "/auth/login", map[string]string{
+			"email":    "jane@example.com",
+			"password": password,
+		})
+		if res.Status == http.StatusOK {
+			t.Error("Expected the password of the other signup not to log in")
+		}
+	}
+
+	t.Run("link", func(t *testing.T) {
+		h := testutil.NewHarness(t)
+		register(h, "jane@example.com", "ownersPassword123", dto.DeliveryModeLink)
+		ownerLink := h.LastMail(utils.MailKindVerification, "jane@example.com")
+
+		// Someone else registers the address, in another case, with a password they know
+		register(h, "Jane@Example.com", "attackersPassword123", dto.DeliveryModeLink)
+
+		res := h.Do(http.MethodPost, "/auth/verify-email/", map[string]string{"token": ownerLink})
+		if res.Status != http.StatusOK {
+			t.Fatalf("Expected the owner's original link to verify, got %d: %s", res.Status, res.RawBody)
+		}
+		h.Login("jane@example.com", "ownersPassword123")
+		rejectsPassword(h, "attackersPassword123")
+	})
+
+	t.Run("code", func(t *testing.T) {
+		h := testutil.NewHarness(t)
+		register(h, "jane@example.com", "ownersPassword123", dto.DeliveryModeCode)
+		ownerCode := h.LastMail(utils.MailKindVerificationCode, "jane@example.com")
+
+		register(h, "Jane@Example.com", "attackersPassword123", dto.DeliveryModeCode)
+
+		res := h.Do(http.MethodPost, "/auth/verify-email/code", map[string]string{"email": "jane@example.com", "code": ownerCode})
+		if res.Status != http.StatusOK {
+			t.Fatalf("Expected the owner's original code to verify, got %d: %s", res.Status, res.RawBody)
+		}
+		h.Login("jane@example.com", "ownersPassword123")
+		rejectsPassword(h, "attackersPassword123")
+	})
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	res := h.Do(http.MethodPost, "/auth/resend-verification-email", map[string]string{"email": "jane@example.com"})
+	if res.Status != http.StatusNotFound {
+		t.Errorf("Expected resending without a registration to be not found, got %d", res.Status)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "Jane Doe",
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Registration failed with status %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/resend-verification-email", map[string]string{"email": "jane@example.com", "mode": "code"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected resend to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	res = h.Do(http.MethodPost, "/auth/verify-email/code", map[string]string{
+		"email": "jane@example.com",
+		"code":  h.LastMail(utils.MailKindVerificationCode, "jane@example.com"),
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected code verification to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	h.Login("jane@example.com", "securePassword123")
+}
+
+func TestMailRequestsAreRateLimitedPerAddress(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	for i := 0; i < 5; i++ {
+		if res := h.Do(http.MethodPost, "/auth/forgot-password", map[string]string{"email": "jane@example.com"}); res.Status != http.StatusOK {
+			t.Fatalf("Expected reset request %d to succeed, got %d: %s", i+1, res.Status, res.RawBody)
+		}
+	}
+	res := h.Do(http.MethodPost, "/auth/forgot-password", map[string]string{"email": "jane@example.com"})
+	if res.Status != http.StatusTooManyRequests {
+		t.Errorf("Expected the sixth reset request to be rate limited, got %d: %s", res.Status, res.RawBody)
+	}
+
+	// Other kinds of mail are counted separately
+	if res := h.Do(http.MethodPost, "/auth/passwordless/start", map[string]string{"email": "jane@example.com"}); res.Status != http.StatusOK {
+		t.Errorf("Expected a sign-in mail to be sent, got %d: %s", res.Status, res.RawBody)
+	}
+
+	// Unknown addresses are counted too, and changing the case of one does not start a new count
+	for _, email := range []string{"nobody@example.com", "Nobody@Example.com", "nobody@Example.COM", "NOBODY@EXAMPLE.COM", "nobody@example.com"} {
+		h.Do(http.MethodPost, "/auth/resend-verification-email", map[string]string{"email": email})
+	}
+	res = h.Do(http.MethodPost, "/auth/resend-verification-email", map[string]string{"email": "nobody@EXAMPLE.com"})
+	if res.Status != http.StatusTooManyRequests {
+		t.Errorf("Expected the sixth resend to be rate limited, got %d", res.Status)
+	}
+	// Registering mails the address as well
+	for i := 0; i < 5; i++ {
+		h.Do(http.MethodPost, "/auth/register", map[string]string{"name": "Sam", "email": "sam@example.com", "password": "securePassword123"})
+	}
+	res = h.Do(http.MethodPost, "/auth/register", map[string]string{"name": "Sam", "email": "sam@example.com", "password": "securePassword123"})
+	if res.Status != http.StatusTooManyRequests {
+		t.Errorf("Expected the sixth registration to be rate limited, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestVerificationTokenIsSingleUse(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "Jane Doe",
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	token := h.LastMail(utils.MailKindVerification, "jane@example.com")
+
+	res := h.Do(http.MethodPost, "/auth/verify-email/", map[string]string{"token": token})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected verification to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/verify-email/", map[string]string{"token": token})
+	if res.Status != http.StatusBadRequest {
+		t.Errorf("Expected a reused verification token to be rejected with 400, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestForgotAndResetPassword(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	res := h.Do(http.MethodPost, "/auth/forgot-password", map[string]string{"email": "jane@example.com"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected forgot password to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	token := h.LastMail(utils.MailKindPasswordReset, "jane@example.com")
+
+	users, err := h.Users.ListUsers(t.Context(), 10, 0)
+	if err != nil || len(users) != 1 {
+		t.Fatalf("Expected exactly one user, got %d (%v)", len(users), err)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/reset-password", map[string]interface{}{
+		"user_id":      users[0].ID,
+		"reset_token":  token,
+		"new_password": "brandNewPassword456",
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected reset to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+
+	h.Login("jane@example.com", "brandNewPassword456")
+
+	res = h.Do(http.MethodPost, "/auth/reset-password", map[string]interface{}{
+		"user_id":      users[0].ID,
+		"reset_token":  token,
+		"new_password": "yetAnotherPassword789",
+	})
+	if res.Status != http.StatusBadRequest {
+		t.Errorf("Expected a reused reset link to be rejected with 400, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestTokenCanOnlyBeRedeemedOnceConcurrently(t *testing.T) {
+	ctx := context.Background()
+	tokenService := auth.NewTokenService("test-secret-key", auth.NewMemoryTokenStore(), auth.NewMemoryCodeStore(), auth.CodePolicy{})
+	userID := uuid.New()
+
+	token, err := tokenService.GenerateToken(ctx, userID, auth.PurposePasswordReset, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var successes atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tokenService.ValidateToken(ctx, token, auth.PurposePasswordReset); err == nil {
+				successes.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successes.Load() != 1 {
+		t.Errorf("Expected exactly one successful redemption, got %d", successes.Load())
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	ctx := context.Background()
+	tokenService := auth.NewTokenService("test-secret-key", auth.NewMemoryTokenStore(), auth.NewMemoryCodeStore(), auth.CodePolicy{})
+	userID := uuid.New()
+
+	token, err := tokenService.GenerateToken(ctx, userID, auth.PurposeEmailVerification, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if err := tokenService.RevokeUserTokens(ctx, userID); err != nil {
+		t.Fatalf("Failed to revoke tokens: %v", err)
+	}
+
+	_, err = tokenService.ValidateToken(ctx, token, auth.PurposeEmailVerification)
+	if !errors.Is(err, errs.ErrTokenNotFound) {
+		t.Errorf("Expected ErrTokenNotFound for a revoked token, got %v", err)
+	}
+}
+
+func TestTokenPurposeMismatch(t *testing.T) {
+	ctx := context.Background()
+	tokenService := auth.NewTokenService("test-secret-key", auth.NewMemoryTokenStore(), auth.NewMemoryCodeStore(), auth.CodePolicy{})
+
+	token, err := tokenService.GenerateToken(ctx, uuid.New(), auth.PurposeEmailVerification, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	_, err = tokenService.ValidateToken(ctx, token, auth.PurposePasswordReset)
+	if !errors.Is(err, errs.ErrInvalidTokenPurpose) {
+		t.Errorf("Expected ErrInvalidTokenPurpose, got %v", err)
+	}
+}
+
+func TestValidateTokenSecret(t *testing.T) {
+	for _, secret := range []string{"", "your-secret-key", strings.Repeat("x", auth.MinTokenSecretLength-1)} {
+		if err := auth.ValidateTokenSecret(secret); err == nil {
+			t.Errorf("Expected the token secret %q to be refused", secret)
+		}
+	}
+	if err := auth.ValidateTokenSecret(strings.Repeat("x", auth.MinTokenSecretLength)); err != nil {
+		t.Errorf("Expected a long token secret to be accepted, got %v", err)
+	}
+}
+
+func TestOnlyTokenHashIsStored(t *testing.T) {
+	ctx := context.Background()
+	tokenStore := auth.NewMemoryTokenStore()
+	tokenService := auth.NewTokenService("test-secret-key", tokenStore, auth.NewMemoryCodeStore(), auth.CodePolicy{})
+	userID := uuid.New()
+
+	token, err := tokenService.GenerateToken(ctx, userID, auth.PurposePasswordReset, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	stored, err := tokenStore.Fetch(ctx, userID, auth.PurposePasswordReset)
+	if err != nil {
+		t.Fatalf("Failed to fetch stored token: %v", err)
+	}
+	if stored == token || strings.Contains(stored, token) {
+		t.Error("The raw token must not be persisted")
+	}
+
+	// Presenting the stored hash itself must not work
+	if _, err := tokenService.ValidateToken(ctx, stored, auth.PurposePasswordReset); err == nil {
+		t.Error("Expected the stored hash to be rejected as a token")
+	}
+	if _, err := tokenService.ValidateToken(ctx, token, auth.PurposePasswordReset); err != nil {
+		t.Errorf("Expected the token to validate, got %v", err)
+	}
+}
+
+func TestLegacyRawTokenIsStillAccepted(t *testing.T) {
+	ctx := context.Background()
+	tokenStore := auth.NewMemoryTokenStore()
+	tokenService := auth.NewTokenService("test-secret-key", tokenStore, auth.NewMemoryCodeStore(), auth.CodePolicy{})
+	userID := uuid.New()
+
+	token, err := tokenService.GenerateToken(ctx, userID, auth.PurposeEmailVerification, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	// Simulate a token stored raw before hashing was introduced
+	if err := tokenStore.Store(ctx, userID, auth.PurposeEmailVerification, token, time.Minute); err != nil {
+		t.Fatalf("Failed to store legacy token: %v", err)
+	}
+
+	if _, err := tokenService.ValidateToken(ctx, token, auth.PurposeEmailVerification); err != nil {
+		t.Errorf("Expected the legacy token to validate, got %v", err)
+	}
+}
+
+func TestVerifyEmailAndResetPasswordWithCodes(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "Jane Doe",
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+		"mode":     "code",
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Registration failed with status %d: %s", res.Status, res.RawBody)
+	}
+	code := h.LastMail(utils.MailKindVerificationCode, "jane@example.com")
+	if len(code) != 6 {
+		t.Fatalf("Expected a 6 digit code, got %q", code)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/verify-email/code", map[string]string{"email": "jane@example.com", "code": code})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected code verification to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	h.Login("jane@example.com", "securePassword123")
+
+	res = h.Do(http.MethodPost, "/auth/forgot-password", map[string]string{"email": "jane@example.com", "mode": "code"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected forgot password to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	code = h.LastMail(utils.MailKindPasswordResetCode, "jane@example.com")
+
+	res = h.Do(http.MethodPost, "/auth/reset-password/code", map[string]string{
+		"email":        "jane@example.com",
+		"code":         code,
+		"new_password": "brandNewPassword456",
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected reset with code to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	h.Login("jane@example.com", "brandNewPassword456")
+}
+
+func TestCodeAttemptsAreLimited(t *testing.T) {
+	ctx := context.Background()
+	tokenService := auth.NewTokenService("test-secret-key", auth.NewMemoryTokenStore(), auth.NewMemoryCodeStore(), auth.CodePolicy{Length: 8, MaxAttempts: 3})
+
+	code, err := tokenService.GenerateCode(ctx, "jane@example.com", auth.PurposeEmailVerification, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	if len(code) != 8 {
+		t.Fatalf("Expected an 8 digit code, got %q", code)
+	}
+
+	wrong := "00000000"
+	if wrong == code {
+		wrong = "11111111"
+	}
+	for i := 0; i < 2; i++ {
+		if err := tokenService.ValidateCode(ctx, "jane@example.com", wrong, auth.PurposeEmailVerification); !errors.Is(err, errs.ErrInvalidCode) {
+			t.Fatalf("Expected ErrInvalidCode, got %v", err)
+		}
+	}
+	if err := tokenService.ValidateCode(ctx, "jane@example.com", wrong, auth.PurposeEmailVerification); !errors.Is(err, errs.ErrTooManyAttempts) {
+		t.Fatalf("Expected ErrTooManyAttempts, got %v", err)
+	}
+
+	// The code is discarded once the attempts are exhausted
+	if err := tokenService.ValidateCode(ctx, "jane@example.com", code, auth.PurposeEmailVerification); !errors.Is(err, errs.ErrInvalidCode) {
+		t.Errorf("Expected the correct code to be rejected after too many attempts, got %v", err)
+	}
+}
+
+func TestCodeIsBoundToEmail(t *testing.T) {
+	ctx := context.Background()
+	tokenService := auth.NewTokenService("test-secret-key", auth.NewMemoryTokenStore(), auth.NewMemoryCodeStore(), auth.CodePolicy{})
+
+	code, err := tokenService.GenerateCode(ctx, "jane@example.com", auth.PurposePasswordReset, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	if err := tokenService.ValidateCode(ctx, "john@example.com", code, auth.PurposePasswordReset); err == nil {
+		t.Error("Expected a code to be rejected for a different email address")
+	}
+	if err := tokenService.ValidateCode(ctx, "jane@example.com", code, auth.PurposePasswordReset); err != nil {
+		t.Errorf("Expected the code to validate for its own address, got %v", err)
+	}
+}
+
+func TestPasswordlessMagicLinkLogin(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	res := h.Do(http.MethodPost, "/auth/passwordless/start", map[string]string{"email": "jane@example.com"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected passwordless start to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	token := h.LastMail(utils.MailKindMagicLink, "jane@example.com")
+
+	res = h.Do(http.MethodPost, "/auth/passwordless/verify", map[string]string{"token": token})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected magic link login to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/logout", nil)
+	if res.Status != http.StatusOK {
+		t.Errorf("Expected the passwordless session to be authenticated, got %d", res.Status)
+	}
+}
+
+func TestPasswordlessLinkIsBoundToBrowser(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	h.Do(http.MethodPost, "/auth/passwordless/start", map[string]string{"email": "jane@example.com"})
+	token := h.LastMail(utils.MailKindMagicLink, "jane@example.com")
+	browser := h.Cookie("session_id")
+
+	// Opening the forwarded link in another browser must fail
+	h.ClearCookies()
+	res := h.Do(http.MethodPost, "/auth/passwordless/verify", map[string]string{"token": token})
+	if res.Status != http.StatusForbidden {
+		t.Errorf("Expected a forwarded link to be rejected, got %d: %s", res.Status, res.RawBody)
+	}
+
+	// Nor in a browser waiting for another account's sign-in, and the link stays usable where it was asked for
+	h.RegisterVerifiedUser("John Doe", "john@example.com", "securePassword456")
+	h.Do(http.MethodPost, "/auth/passwordless/start", map[string]string{"email": "john@example.com"})
+	res = h.Do(http.MethodPost, "/auth/passwordless/verify", map[string]string{"token": token})
+	if res.Status != http.StatusForbidden {
+		t.Errorf("Expected a link for another account to be rejected, got %d: %s", res.Status, res.RawBody)
+	}
+	h.ClearCookies()
+	h.SetCookie("session_id", browser)
+	res = h.Do(http.MethodPost, "/auth/passwordless/verify", map[string]string{"token": token})
+	if res.Status != http.StatusOK {
+		t.Errorf("Expected the link to still work in the browser that asked for it, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestPasswordlessCodeLogin(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	h.Do(http.MethodPost, "/auth/passwordless/start", map[string]string{"email": "jane@example.com", "mode": "code"})
+	code := h.LastMail(utils.MailKindLoginCode, "jane@example.com")
+
+	res := h.Do(http.MethodPost, "/auth/passwordless/verify", map[string]string{"email": "jane@example.com", "code": code})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected code login to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/passwordless/verify", map[string]string{"email": "jane@example.com", "code": code})
+	if res.Status == http.StatusOK {
+		t.Error("Expected a used sign-in code to be rejected")
+	}
+}
+
+func enumerationSafe(deps *app.Dependencies) {
+	deps.AuthConfig.EnumerationSafe = true
+}
+
+func TestEnumerationSafeLoginIsUniform(t *testing.T) {
+	h := testutil.NewHarness(t, enumerationSafe)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	wrongPassword := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "wrongPassword123",
+	})
+	unknownUser := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "nobody@example.com",
+		"password": "wrongPassword123",
+	})
+	if wrongPassword.Status != http.StatusUnauthorized || unknownUser.Status != http.StatusUnauthorized {
+		t.Fatalf("Expected both logins to be unauthorized, got %d and %d", wrongPassword.Status, unknownUser.Status)
+	}
+	if wrongPassword.Body.Message != unknownUser.Body.Message {
+		t.Errorf("Expected identical messages, got %q and %q", wrongPassword.Body.Message, unknownUser.Body.Message)
+	}
+
+	// An unverified signup fails like a wrong password, and only its owner is told by mail
+	h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "John Doe",
+		"email":    "john@example.com",
+		"password": "securePassword456",
+	})
+	firstMail := h.LastMail(utils.MailKindVerification, "john@example.com")
+	unverified := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "john@example.com",
+		"password": "securePassword456",
+	})
+	if unverified.Status != http.StatusUnauthorized || unverified.Body.Message != unknownUser.Body.Message {
+		t.Errorf("Expected an unverified login to look like a wrong password, got %d: %s", unverified.Status, unverified.RawBody)
+	}
+	if h.LastMail(utils.MailKindVerification, "john@example.com") == firstMail {
+		t.Error("Expected a new verification mail after logging in unverified")
+	}
+}
+
+// countingHasher counts the passwords hashed by the hasher it wraps.
+type countingHasher struct {
+	password.Hasher
+	hashed atomic.Int32
+}
+
+func (c *countingHasher) Hash(plain string) (string, error) {
+	c.hashed.Add(1)
+	return c.Hasher.Hash(plain)
+}
+
+func TestEnumerationSafeForgotPasswordIsUniform(t *testing.T) {
+	h := testutil.NewHarness(t, enumerationSafe)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	known := h.Do(http.MethodPost, "/auth/forgot-password", map[string]string{"email": "jane@example.com"})
+	unknown := h.Do(http.MethodPost, "/auth/forgot-password", map[string]string{"email": "nobody@example.com"})
+	if known.Status != http.StatusOK || unknown.Status != http.StatusOK {
+		t.Fatalf("Expected both requests to succeed, got %d and %d", known.Status, unknown.Status)
+	}
+	if known.Body.Message != unknown.Body.Message {
+		t.Errorf("Expected identical messages, got %q and %q", known.Body.Message, unknown.Body.Message)
+	}
+	if _, ok := h.Mailer.Last(utils.MailKindPasswordReset, "nobody@example.com"); ok {
+		t.Error("Expected no reset mail for an unknown address")
+	}
+}
+
+func TestEnumerationSafeRegisterNotifiesOwner(t *testing.T) {
+	hasher := &countingHasher{}
+	h := testutil.NewHarness(t, enumerationSafe, func(deps *app.Dependencies) {
+		hasher.Hasher = deps.PasswordHasher
+		deps.PasswordHasher = hasher
+	})
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	hashed := hasher.hashed.Load()
+
+	res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "Jane Again",
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected duplicate registration to look successful, got %d: %s", res.Status, res.RawBody)
+	}
+	h.LastMail(utils.MailKindRegistrationAttempt, "jane@example.com")
+	if hasher.hashed.Load() != hashed+1 {
+		t.Error("Expected the password of the duplicate registration to be hashed like a new one")
+	}
+
+	// Past the mail rate limit the owner is not mailed again, and the response does not change
+	for i := 0; i < 5; i++ {
+		res := h.Do(http.MethodPost, "/auth/register", map[string]string{"name": "Jane Again", "email": "jane@example.com", "password": "securePassword123"})
+		if res.Status != http.StatusOK {
+			t.Fatalf("Expected rate limited duplicate registration to look successful, got %d: %s", res.Status, res.RawBody)
+		}
+	}
+	attempts := 0
+	for _, mail := range h.Mailer.Messages() {
+		if mail.Kind == utils.MailKindRegistrationAttempt {
+			attempts++
+		}
+	}
+	// The signup mail and the registration attempt mails share the limit of five
+	if attempts != 4 {
+		t.Errorf("Expected four registration attempt mails, got %d", attempts)
+	}
+
+	// The existing account must be untouched
+	h.Login("jane@example.com", "securePassword123")
+}
+
+func TestLoginUpgradesLegacyPasswordHash(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	// Simulate an account created before argon2id was introduced
+	legacy, err := bcrypt.GenerateFromPassword([]byte("securePassword123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error creating legacy hash: %v", err)
+	}
+	existingUser, err := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	if err != nil {
+		t.Fatalf("Failed to load user: %v", err)
+	}
+	existingUser.PasswordHash = string(legacy)
+	if err := h.Users.UpdateUser(t.Context(), existingUser); err != nil {
+		t.Fatalf("Failed to store legacy hash: %v", err)
+	}
+
+	h.Login("jane@example.com", "securePassword123")
+
+	existingUser, err = h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	if err != nil {
+		t.Fatalf("Failed to load user: %v", err)
+	}
+	if !strings.HasPrefix(existingUser.PasswordHash, "$argon2id$") {
+		t.Errorf("Expected the hash to be upgraded to argon2id, got %q", existingUser.PasswordHash)
+	}
+	if h.PasswordHasher.NeedsRehash(existingUser.PasswordHash) {
+		t.Error("Expected the upgraded hash to use the current parameters")
+	}
+}
+
+func TestRegisterEnforcesPasswordPolicy(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "Jane Doe",
+		"email":    "jane@example.com",
+		"password": "jane1985",
+	})
+	if res.Status != http.StatusBadRequest {
+		t.Fatalf("Expected a weak password to be rejected, got %d: %s", res.Status, res.RawBody)
+	}
+	if !strings.Contains(string(res.RawBody), `"rule":"banned_word"`) {
+		t.Errorf("Expected the violated rules in the response, got %s", res.RawBody)
+	}
+}
+
+func TestPasswordStrengthEndpoint(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	res := h.Do(http.MethodPost, "/auth/password/strength", map[string]string{"password": "password"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the strength check to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	evaluation, _ := res.Body.Data.(map[string]interface{})
+	if evaluation["valid"] != false || evaluation["score"] != float64(0) {
+		t.Errorf("Expected a weak evaluation, got %s", res.RawBody)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+
+	res := h.Do(http.MethodPost, "/auth/change-password", map[string]string{
+		"current_password": "wrongPassword123",
+		"new_password":     "brandNewPassword456",
+	})
+	if res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong current password to be rejected, got %d", res.Status)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/change-password", map[string]string{
+		"current_password": "securePassword123",
+		"new_password":     "password",
+	})
+	if res.Status != http.StatusBadRequest {
+		t.Errorf("Expected a weak new password to be rejected, got %d", res.Status)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/change-password", map[string]string{
+		"current_password": "securePassword123",
+		"new_password":     "brandNewPassword456",
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the password change to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+
+	h.ClearCookies()
+	h.Login("jane@example.com", "brandNewPassword456")
+}
+
+// breachList is a password.BreachChecker for a fixed set of passwords.
+type breachList map[string]bool
+
+func (b breachList) IsBreached(candidate string) (bool, error) {
+	return b[candidate], nil
+}
+
+func TestBreachedPasswordsAreRejected(t *testing.T) {
+	h := testutil.NewHarness(t, func(deps *app.Dependencies) {
+		deps.BreachChecker = breachList{"brandNewPassword456": true}
+	})
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     "John Doe",
+		"email":    "john@example.com",
+		"password": "brandNewPassword456",
+	})
+	if res.Status != http.StatusBadRequest || !strings.Contains(string(res.RawBody), `"rule":"breached"`) {
+		t.Errorf("Expected a breached password to be rejected at registration, got %d: %s", res.Status, res.RawBody)
+	}
+
+	h.Login("jane@example.com", "securePassword123")
+	res = h.Do(http.MethodPost, "/auth/change-password", map[string]string{
+		"current_password": "securePassword123",
+		"new_password":     "brandNewPassword456",
+	})
+	if res.Status != http.StatusBadRequest {
+		t.Errorf("Expected a breached password to be rejected on change, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestResetRejectsCurrentPasswordWithoutSpendingToken(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	h.Do(http.MethodPost, "/auth/forgot-password", map[string]string{"email": "jane@example.com"})
+	token := h.LastMail(utils.MailKindPasswordReset, "jane@example.com")
+	existingUser, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+
+	reset := func(newPassword string) *testutil.Response {
+		return h.Do(http.MethodPost, "/auth/reset-password", map[string]interface{}{
+			"user_id":      existingUser.ID,
+			"reset_token":  token,
+			"new_password": newPassword,
+		})
+	}
+
+	res := reset("securePassword123")
+	if res.Status != http.StatusBadRequest || !strings.Contains(string(res.RawBody), `"rule":"reused"`) {
+		t.Fatalf("Expected the current password to be rejected, got %d: %s", res.Status, res.RawBody)
+	}
+
+	res = reset("brandNewPassword456")
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the reset link to still work, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestResetWithCodeRejectsCurrentPasswordWithoutSpendingCode(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	h.Do(http.MethodPost, "/auth/forgot-password", map[string]string{"email": "jane@example.com", "mode": "code"})
+	code := h.LastMail(utils.MailKindPasswordResetCode, "jane@example.com")
+
+	reset := func(newPassword string) *testutil.Response {
+		return h.Do(http.MethodPost, "/auth/reset-password/code", map[string]string{
+			"email":        "jane@example.com",
+			"code":         code,
+			"new_password": newPassword,
+		})
+	}
+
+	res := reset("securePassword123")
+	if res.Status != http.StatusBadRequest || !strings.Contains(string(res.RawBody), `"rule":"reused"`) {
+		t.Fatalf("Expected the current password to be rejected, got %d: %s", res.Status, res.RawBody)
+	}
+
+	res = reset("brandNewPassword456")
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the reset code to still work, got %d: %s", res.Status, res.RawBody)
+	}
+	if res := reset("anotherPassword789"); res.Status != http.StatusBadRequest {
+		t.Errorf("Expected the code to be spent by the reset, got %d", res.Status)
+	}
+}
+
+func TestChangePasswordRejectsRecentPasswords(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+
+	change := func(current, next string) int {
+		return h.Do(http.MethodPost, "/auth/change-password", map[string]string{
+			"current_password": current,
+			"new_password":     next,
+		}).Status
+	}
+
+	if status := change("securePassword123", "brandNewPassword456"); status != http.StatusOK {
+		t.Fatalf("Expected the first change to succeed, got %d", status)
+	}
+	if status := change("brandNewPassword456", "securePassword123"); status != http.StatusBadRequest {
+		t.Errorf("Expected a previous password to be rejected, got %d", status)
+	}
+	if status := change("brandNewPassword456", "anotherFreshPassword789"); status != http.StatusOK {
+		t.Errorf("Expected an unused password to be accepted, got %d", status)
+	}
+}
+
+func TestUntrackedPasswordDoesNotExpire(t *testing.T) {
+	h := testutil.NewHarness(t, func(deps *app.Dependencies) {
+		policy := password.DefaultPolicy()
+		policy.MaxAge = 90 * 24 * time.Hour
+		deps.PasswordPolicy = &policy
+	})
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	// An old account from before password changes were tracked
+	existingUser, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	existingUser.CreatedAt = time.Now().Add(-365 * 24 * time.Hour)
+	existingUser.PasswordChangedAt = nil
+	if err := h.Users.UpdateUser(t.Context(), existingUser); err != nil {
+		t.Fatalf("Failed to age the account: %v", err)
+	}
+
+	h.Login("jane@example.com", "securePassword123")
+}
+
+func TestExpiredPasswordMustBeChanged(t *testing.T) {
+	h := testutil.NewHarness(t, func(deps *app.Dependencies) {
+		policy := password.DefaultPolicy()
+		policy.MaxAge = 90 * 24 * time.Hour
+		deps.PasswordPolicy = &policy
+	})
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	existingUser, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	changedAt := time.Now().Add(-100 * 24 * time.Hour)
+	existingUser.PasswordChangedAt = &changedAt
+	if err := h.Users.UpdateUser(t.Context(), existingUser); err != nil {
+		t.Fatalf("Failed to age the password: %v", err)
+	}
+
+	res := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusForbidden {
+		t.Fatalf("Expected the expired password to be refused, got %d: %s", res.Status, res.RawBody)
+	}
+	if res := h.Do(http.MethodPost, "/auth/logout", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected no full session with an expired password, got %d", res.Status)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/password/expired", map[string]string{"new_password": "securePassword123"})
+	if res.Status != http.StatusBadRequest {
+		t.Errorf("Expected the expired password to be rejected as the new one, got %d", res.Status)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/password/expired", map[string]string{"new_password": "brandNewPassword456"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the password change to log in, got %d: %s", res.Status, res.RawBody)
+	}
+	if res := h.Do(http.MethodPost, "/auth/logout", nil); res.Status != http.StatusOK {
+		t.Errorf("Expected a full session after changing the password, got %d", res.Status)
+	}
+
+	h.ClearCookies()
+	res = h.Do(http.MethodPost, "/auth/password/expired", map[string]string{"new_password": "anotherFreshPassword789"})
+	if res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a change without a pending login to be refused, got %d", res.Status)
+	}
+}
+
+// registerAdmin registers a verified user, grants them the admin role and logs them in.
+func registerAdmin(t *testing.T, h *testutil.Harness) {
+	t.Helper()
+
+	h.RegisterVerifiedUser("Ada Admin", "admin@example.com", "correctHorseBattery42")
+	admin, err := h.Users.GetUserByEmail(t.Context(), "admin@example.com")
+	if err != nil {
+		t.Fatalf("Failed to look up admin: %v", err)
+	}
+	admin.Role = models.RoleAdmin
+	if err := h.Users.UpdateUser(t.Context(), admin); err != nil {
+		t.Fatalf("Failed to grant admin role: %v", err)
+	}
+	h.Login("admin@example.com", "correctHorseBattery42")
+}
+
+func TestAdminSuspendsAndBansAccount(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	statusPath := "/admin/users/" + jane.ID.String() + "/status"
+
+	h.Login("jane@example.com", "securePassword123")
+	janeSession := h.Cookie("session_id")
+	if res := h.Do(http.MethodPut, statusPath, map[string]string{"status": "banned"}); res.Status != http.StatusForbidden {
+		t.Errorf("Expected a regular user to be refused, got %d", res.Status)
+	}
+
+	h.ClearCookies()
+	registerAdmin(t, h)
+	if res := h.Do(http.MethodPut, statusPath, map[string]string{"status": "suspended"}); res.Status != http.StatusBadRequest {
+		t.Errorf("Expected a suspension without an end to be rejected, got %d", res.Status)
+	}
+	res := h.Do(http.MethodPut, statusPath, map[string]interface{}{
+		"status": "suspended",
+		"reason": "spam",
+		"until":  time.Now().Add(time.Hour),
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the suspension to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	adminSession := h.Cookie("session_id")
+
+	// The live session is kicked out
+	h.SetCookie("session_id", janeSession)
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusForbidden && res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the suspended session to stop working, got %d", res.Status)
+	}
+
+	h.ClearCookies()
+	res = h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusForbidden || !strings.Contains(res.Body.Error, errs.ErrAccountSuspended.Error()) {
+		t.Errorf("Expected login to be refused as suspended, got %d: %s", res.Status, res.RawBody)
+	}
+
+	h.SetCookie("session_id", adminSession)
+	if res := h.Do(http.MethodPut, statusPath, map[string]string{"status": "banned", "reason": "repeat offender"}); res.Status != http.StatusOK {
+		t.Fatalf("Expected the ban to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	h.ClearCookies()
+	res = h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusForbidden || !strings.Contains(res.Body.Error, errs.ErrAccountBanned.Error()) {
+		t.Errorf("Expected login to be refused as banned, got %d: %s", res.Status, res.RawBody)
+	}
+
+	banned, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	if banned.StatusReason != "repeat offender" || !strings.HasPrefix(banned.StatusActor, "admin:") {
+		t.Errorf("Expected reason and actor to be recorded, got %q by %q", banned.StatusReason, banned.StatusActor)
+	}
+
+	h.SetCookie("session_id", adminSession)
+	if res := h.Do(http.MethodPut, statusPath, map[string]string{"status": "active"}); res.Status != http.StatusOK {
+		t.Fatalf("Expected the reactivation to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	h.ClearCookies()
+	h.Login("jane@example.com", "securePassword123")
+}
+
+func TestSuspensionEndsByItself(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	ended := time.Now().Add(-time.Minute)
+	jane.Status = models.AccountStatusSuspended
+	jane.SuspendedUntil = &ended
+	if err := h.Users.UpdateUser(t.Context(), jane); err != nil {
+		t.Fatalf("Failed to suspend user: %v", err)
+	}
+
+	h.Login("jane@example.com", "securePassword123")
+}
+
+func TestDeactivateAndReactivateAccount(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+
+	if res := h.Do(http.MethodPost, "/users/me/deactivate", map[string]string{"password": "wrongPassword123"}); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to be rejected, got %d", res.Status)
+	}
+	res := h.Do(http.MethodPost, "/users/me/deactivate", map[string]string{"password": "securePassword123"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the deactivation to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusForbidden || !strings.Contains(res.Body.Error, errs.ErrAccountDeactivated.Error()) {
+		t.Errorf("Expected login to be refused as deactivated, got %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/login", map[string]interface{}{
+		"email":      "jane@example.com",
+		"password":   "securePassword123",
+		"reactivate": true,
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected login to reactivate the account, got %d: %s", res.Status, res.RawBody)
+	}
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	if jane.AccountStatus(time.Now()) != models.AccountStatusActive || jane.StatusActor != auth.ActorSelf {
+		t.Errorf("Expected the account to be active again, got %q by %q", jane.Status, jane.StatusActor)
+	}
+}
+
+const (
+	chromeOnWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36"
+	safariOnIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Mobile/15E148 Safari/604.1"
+)
+
+// loginWithAgent logs in with the given User-Agent header.
+func loginWithAgent(h *testutil.Harness, email, password, userAgent string) *testutil.Response {
+	body := `{"email":"` + email + `","password":"` + password + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	return h.DoRequest(req)
+}
+
+func TestLoginHistory(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	if res := loginWithAgent(h, "jane@example.com", "wrongPassword123", chromeOnWindows); res.Status != http.StatusUnauthorized {
+		t.Fatalf("Expected the wrong password to be rejected, got %d", res.Status)
+	}
+	if res := loginWithAgent(h, "jane@example.com", "securePassword123", chromeOnWindows); res.Status != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	if _, ok := h.Mailer.Last(utils.MailKindNewDeviceLogin, "jane@example.com"); ok {
+		t.Error("Expected no new device mail for the first login")
+	}
+
+	res := h.Do(http.MethodGet, "/users/me/login-history", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the login history, got %d: %s", res.Status, res.RawBody)
+	}
+	var events []models.LoginEvent
+	if err := json.Unmarshal(mustMarshal(t, res.Body.Data), &events); err != nil {
+		t.Fatalf("Failed to decode login history: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected two login attempts, got %d", len(events))
+	}
+	if !events[0].Success || events[0].Browser != "Chrome" || events[0].OS != "Windows" || events[0].Device != utils.DeviceDesktop {
+		t.Errorf("Unexpected successful attempt: %+v", events[0])
+	}
+	if events[1].Success || events[1].FailureReason != errs.ErrInvalidCredentials.Error() {
+		t.Errorf("Unexpected failed attempt: %+v", events[1])
+	}
+
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	if jane.LastLoginAt == nil {
+		t.Error("Expected the last login time to be recorded")
+	}
+}
+
+func TestNewDeviceLoginMail(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	loginWithAgent(h, "jane@example.com", "securePassword123", chromeOnWindows)
+	firstDevice := h.Cookie("device_id")
+	if firstDevice == "" {
+		t.Fatal("Expected a device cookie after login")
+	}
+
+	// Another browser
+	h.ClearCookies()
+	loginWithAgent(h, "jane@example.com", "securePassword123", safariOnIPhone)
+	mail, ok := h.Mailer.Last(utils.MailKindNewDeviceLogin, "jane@example.com")
+	if !ok {
+		t.Fatal("Expected a new device mail for a login from another browser")
+	}
+	if !strings.Contains(mail.Content, "Safari on iOS") {
+		t.Errorf("Expected the mail to name the browser, got %q", mail.Content)
+	}
+
+	// Back in the first browser
+	h.Mailer.Reset()
+	h.ClearCookies()
+	h.SetCookie("device_id", firstDevice)
+	loginWithAgent(h, "jane@example.com", "securePassword123", chromeOnWindows)
+	if _, ok := h.Mailer.Last(utils.MailKindNewDeviceLogin, "jane@example.com"); ok {
+		t.Error("Expected no new device mail for a known browser")
+	}
+}
+
+// mustMarshal re-encodes a decoded JSON value so it can be decoded into a typed value.
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to encode value: %v", err)
+	}
+	return data
+}
+
+// travellingLocator places every address wherever the test moved it last.
+type travellingLocator struct {
+	location *risk.Location
+}
+
+func (l *travellingLocator) Locate(ip net.IP) (*risk.Location, error) {
+	return l.location, nil
+}
+
+// withRiskEngine scores logins against the harness login history.
+func withRiskEngine(opts ...risk.EngineOption) testutil.HarnessOption {
+	return func(deps *app.Dependencies) {
+		deps.RiskEngine = risk.NewEngine(deps.LoginHistory, risk.DefaultPolicy(), opts...)
+	}
+}
+
+func TestUnusualLoginRequiresEmailConfirmation(t *testing.T) {
+	locator := &travellingLocator{location: &risk.Location{Country: "DE", HasCoordinates: true, Latitude: 52.52, Longitude: 13.40}}
+	h := testutil.NewHarness(t, withRiskEngine(risk.WithLocator(locator)))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	h.Do(http.MethodPost, "/auth/logout", nil)
+
+	// Moments later from the other side of the world
+	locator.location = &risk.Location{Country: "AU", HasCoordinates: true, Latitude: -33.87, Longitude: 151.21}
+	res := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusForbidden || res.Body.Error != errs.ErrStepUpRequired.Error() {
+		t.Fatalf("Expected the login to require confirmation, got %d: %s", res.Status, res.RawBody)
+	}
+	if res := h.Do(http.MethodPost, "/auth/logout", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected no session before the confirmation, got %d", res.Status)
+	}
+
+	token := h.LastMail(utils.MailKindMagicLink, "jane@example.com")
+	res = h.Do(http.MethodPost, "/auth/passwordless/verify", map[string]string{"token": token})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the confirmation to log in, got %d: %s", res.Status, res.RawBody)
+	}
+
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	events, _ := h.LoginHistory.List(t.Context(), jane.ID, -1)
+	if len(events) != 3 {
+		t.Fatalf("Expected three login attempts, got %d", len(events))
+	}
+	if stepUp := events[1]; stepUp.Success || stepUp.RiskDecision != risk.DecisionStepUp || stepUp.Country != "AU" ||
+		!strings.Contains(stepUp.RiskReasons, risk.ReasonImpossibleTravel) {
+		t.Errorf("Unexpected step-up attempt: %+v", stepUp)
+	}
+	if confirmed := events[0]; !confirmed.Success || confirmed.Method != models.LoginMethodPasswordless || confirmed.Country != "AU" {
+		t.Errorf("Unexpected confirmed attempt: %+v", confirmed)
+	}
+
+	// The new country is known from now on
+	h.Do(http.MethodPost, "/auth/logout", nil)
+	h.Login("jane@example.com", "securePassword123")
+}
+
+func TestLoginFromBadAddressIsBlocked(t *testing.T) {
+	badIPs, err := risk.ParseIPList(strings.NewReader("0.0.0.0/0\n::/0\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse IP list: %v", err)
+	}
+	h := testutil.NewHarness(t, withRiskEngine(risk.WithBadIPs(badIPs)))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	res := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status != http.StatusForbidden || res.Body.Error != errs.ErrLoginBlocked.Error() {
+		t.Fatalf("Expected the login to be blocked, got %d: %s", res.Status, res.RawBody)
+	}
+
+	// An emailed sign-in link does not get around the block
+	h.Do(http.MethodPost, "/auth/passwordless/start", map[string]string{"email": "jane@example.com"})
+	token := h.LastMail(utils.MailKindMagicLink, "jane@example.com")
+	res = h.Do(http.MethodPost, "/auth/passwordless/verify", map[string]string{"token": token})
+	if res.Status != http.StatusForbidden {
+		t.Errorf("Expected the passwordless login to be blocked, got %d", res.Status)
+	}
+
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	audited, _ := h.AuditLog.List(t.Context(), jane.ID, -1)
+	if len(audited) != 2 {
+		t.Fatalf("Expected both risk decisions in the audit log, got %d", len(audited))
+	}
+	for _, event := range audited {
+		if event.Action != models.AuditActionLoginRisk || event.Outcome != risk.DecisionBlock ||
+			!strings.Contains(event.Details, risk.ReasonBadIP) {
+			t.Errorf("Unexpected audit event: %+v", event)
+		}
+	}
+	if !strings.Contains(audited[0].Details, "method="+models.LoginMethodPasswordless) {
+		t.Errorf("Expected the latest audit event to be about the passwordless login: %+v", audited[0])
+	}
+}
+
+func TestClientAddressIsOnlyTakenFromTrustedProxies(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		proxies []string
+		wantIP  bool
+	}{
+		{name: "untrusted", proxies: []string{"192.0.2.1"}, wantIP: false},
+		{name: "trusted", proxies: []string{"0.0.0.0/0"}, wantIP: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := testutil.NewHarness(t, func(deps *app.Dependencies) {
+				deps.ProxyConfig = config.ProxyConfig{Header: fiber.HeaderXForwardedFor, TrustedProxyCheck: true, TrustedProxies: tc.proxies}
+			})
+			h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"jane@example.com","password":"securePassword123"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			req.Header.Set(fiber.HeaderXForwardedFor, "203.0.113.7, 198.51.100.2")
+			if res := h.DoRequest(req); res.Status != http.StatusOK {
+				t.Fatalf("Login failed with status %d: %s", res.Status, res.RawBody)
+			}
+
+			jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+			events, _ := h.LoginHistory.List(t.Context(), jane.ID, 1)
+			if len(events) != 1 || (events[0].IP == "203.0.113.7") != tc.wantIP {
+				t.Errorf("Unexpected login address: %+v", events)
+			}
+		})
+	}
+}
+
+// ageSession moves a time recorded in the harness session, such as "authTime", back by d.
+func ageSession(t *testing.T, h *testutil.Harness, key string, d time.Duration) {
+	t.Helper()
+
+	editSession(t, h, func(data map[string]interface{}) {
+		data[key] = data[key].(int64) - int64(d/time.Second)
+	})
+}
+
+// loadSession returns the values stored in the harness session.
+func loadSession(t *testing.T, h *testutil.Harness) map[string]interface{} {
+	t.Helper()
+
+	raw, err := h.SessionStorage.Get(h.Cookie("session_id"))
+	if err != nil || raw == nil {
+		t.Fatalf("Failed to load session: %v", err)
+	}
+	data := make(map[string]interface{})
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&data); err != nil {
+		t.Fatalf("Failed to decode session: %v", err)
+	}
+	return data
+}
+
+// editSession changes the values stored in the harness session.
+func editSession(t *testing.T, h *testutil.Harness, edit func(data map[string]interface{})) {
+	t.Helper()
+
+	sessionID := h.Cookie("session_id")
+	data := loadSession(t, h)
+	edit(data)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&data); err != nil {
+		t.Fatalf("Failed to encode session: %v", err)
+	}
+	if err := h.SessionStorage.Set(sessionID, buf.Bytes(), time.Hour); err != nil {
+		t.Fatalf("Failed to store session: %v", err)
+	}
+}
+
+func TestChangePasswordRequiresRecentAuthentication(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	ageSession(t, h, "authTime", auth.DefaultReauthenticationMaxAge+time.Minute)
+
+	changePassword := map[string]string{
+		"current_password": "securePassword123",
+		"new_password":     "brandNewPassword456",
+	}
+	res := h.Do(http.MethodPost, "/auth/change-password", changePassword)
+	if res.Status != http.StatusUnauthorized || !strings.Contains(string(res.RawBody), errs.ErrRecentAuthRequired.Error()) {
+		t.Fatalf("Expected an old session to need reauthentication, got %d: %s", res.Status, res.RawBody)
+	}
+
+	if res := h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{"password": "wrongPassword123"}); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to be rejected, got %d", res.Status)
+	}
+	if res := h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{}); res.Status != http.StatusBadRequest {
+		t.Errorf("Expected a password or code to be required, got %d", res.Status)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{"password": "securePassword123"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected reauthentication to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	var authentication dto.AuthenticationResponse
+	if err := json.Unmarshal(mustMarshal(t, res.Body.Data), &authentication); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if time.Since(authentication.AuthTime) > time.Minute || len(authentication.AMR) != 1 || authentication.AMR[0] != auth.AMRPassword {
+		t.Errorf("Unexpected authentication: %+v", authentication)
+	}
+
+	if res := h.Do(http.MethodPost, "/auth/change-password", changePassword); res.Status != http.StatusOK {
+		t.Errorf("Expected the password change to succeed after reauthenticating, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestAccountDataActionsRequireRecentAuthentication(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	ageSession(t, h, "authTime", auth.DefaultReauthenticationMaxAge+time.Minute)
+
+	actions := []struct {
+		method, path string
+		body         map[string]string
+	}{
+		{http.MethodPost, "/users/me/exports", nil},
+		{http.MethodPost, "/users/me/deactivate", map[string]string{"password": "securePassword123"}},
+		{http.MethodDelete, "/users/me", map[string]string{"password": "securePassword123"}},
+	}
+	for _, action := range actions {
+		res := h.Do(action.method, action.path, action.body)
+		if res.Status != http.StatusUnauthorized || !strings.Contains(string(res.RawBody), errs.ErrRecentAuthRequired.Error()) {
+			t.Errorf("Expected %s %s to need reauthentication, got %d: %s", action.method, action.path, res.Status, res.RawBody)
+		}
+	}
+
+	h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{"password": "securePassword123"})
+	if res := h.Do(http.MethodPost, "/users/me/exports", nil); res.Status != http.StatusAccepted {
+		t.Errorf("Expected the export to start after reauthenticating, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestReauthenticationLocksAfterRepeatedFailures(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	reauthenticate := func(password string) int {
+		return h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{"password": password}).Status
+	}
+
+	// A success starts the count again
+	for i := 0; i < 4; i++ {
+		reauthenticate("wrongPassword123")
+	}
+	if status := reauthenticate("securePassword123"); status != http.StatusOK {
+		t.Fatalf("Expected reauthentication to succeed, got %d", status)
+	}
+
+	for i := 0; i < 5; i++ {
+		if status := reauthenticate("wrongPassword123"); status != http.StatusUnauthorized {
+			t.Fatalf("Expected failed attempt %d to be rejected, got %d", i+1, status)
+		}
+	}
+	if status := reauthenticate("securePassword123"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected reauthentication to be locked, got %d", status)
+	}
+}
+
+func TestReauthenticateWithEmailedCode(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	ageSession(t, h, "authTime", time.Hour)
+
+	if res := h.Do(http.MethodPost, "/auth/reauthenticate/code", nil); res.Status != http.StatusOK {
+		t.Fatalf("Expected a confirmation code to be sent, got %d: %s", res.Status, res.RawBody)
+	}
+	code := h.LastMail(utils.MailKindReauthenticationCode, "jane@example.com")
+
+	if res := h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{"code": "000000"}); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong code to be rejected, got %d", res.Status)
+	}
+	res := h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{"code": code})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected reauthentication to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	var authentication dto.AuthenticationResponse
+	if err := json.Unmarshal(mustMarshal(t, res.Body.Data), &authentication); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if strings.Join(authentication.AMR, " ") != auth.AMRPassword+" "+auth.AMROneTimeCode {
+		t.Errorf("Expected both methods to be recorded, got %v", authentication.AMR)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/change-password", map[string]string{
+		"current_password": "securePassword123",
+		"new_password":     "brandNewPassword456",
+	})
+	if res.Status != http.StatusOK {
+		t.Errorf("Expected the password change to succeed after reauthenticating, got %d: %s", res.Status, res.RawBody)
+	}
+
+	h.ClearCookies()
+	if res := h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{"password": "brandNewPassword456"}); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected reauthentication to require a session, got %d", res.Status)
+	}
+}
+
+func TestLoginAndReauthenticationRegenerateSessionID(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	// A session that exists before the login, as one planted by an attacker would
+	h.Do(http.MethodPost, "/auth/passwordless/start", map[string]string{"email": "jane@example.com"})
+	preLoginID := h.Cookie("session_id")
+	if preLoginID == "" {
+		t.Fatal("Expected a session before login")
+	}
+
+	h.Login("jane@example.com", "securePassword123")
+	loginID := h.Cookie("session_id")
+	if loginID == preLoginID {
+		t.Fatal("Expected login to issue a new session ID")
+	}
+	if data, _ := h.SessionStorage.Get(preLoginID); data != nil {
+		t.Error("Expected the pre-login session to be deleted")
+	}
+
+	res := h.Do(http.MethodPost, "/auth/reauthenticate", map[string]string{"password": "securePassword123"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected reauthentication to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	if h.Cookie("session_id") == loginID {
+		t.Error("Expected reauthentication to issue a new session ID")
+	}
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	records, _ := h.SessionIndex.List(t.Context(), jane.ID)
+	if len(records) != 1 || records[0].ID != h.Cookie("session_id") {
+		t.Errorf("Expected the index to hold only the new session, got %+v", records)
+	}
+}
+
+// operatorAuthService builds an AuthService over the storage of the harness, the way authctl does.
+func operatorAuthService(h *testutil.Harness) auth.AuthService {
+	userService := user.NewUserService(h.Users, h.Registrations, h.PasswordHasher)
+	tokenService := auth.NewTokenService("test-secret-key", h.Tokens, h.Codes, auth.CodePolicy{Length: 6, MaxAttempts: 5})
+	sessions := auth.NewSessionStore(h.SessionStorage, auth.DefaultSessionPolicy())
+	return auth.NewAuthService(userService, tokenService, sessions, h.SessionIndex, h.Mailer, h.PasswordHasher)
+}
+
+func TestOperatorListsAndRevokesSessions(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	operator := operatorAuthService(h)
+
+	h.Login("jane@example.com", "securePassword123")
+	first := h.Cookie("session_id")
+	h.ClearCookies()
+	h.Login("jane@example.com", "securePassword123")
+	second := h.Cookie("session_id")
+
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	sessions, err := operator.ListSessions(t.Context(), jane.ID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, record := range sessions {
+		if record.ID == "" {
+			t.Fatal("Expected every listed session to have an ID")
+		}
+		ids[record.ID] = true
+	}
+	if len(sessions) != 2 || !ids[first] || !ids[second] {
+		t.Fatalf("Expected the sessions of both logins, got %+v", sessions)
+	}
+
+	if err := operator.RevokeSession(t.Context(), jane.ID, first); err != nil {
+		t.Fatalf("Failed to revoke session: %v", err)
+	}
+	h.ClearCookies()
+	h.SetCookie("session_id", first)
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked session to be rejected, got %d", res.Status)
+	}
+	h.ClearCookies()
+	h.SetCookie("session_id", second)
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusOK {
+		t.Errorf("Expected the other session to keep working, got %d", res.Status)
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	policy := auth.DefaultSessionPolicy()
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	h.Login("jane@example.com", "securePassword123")
+	ageSession(t, h, "lastSeen", policy.IdleTimeout+time.Minute)
+	res := h.Do(http.MethodGet, "/users/me/login-history", nil)
+	if res.Status != http.StatusUnauthorized || !strings.Contains(string(res.RawBody), errs.ErrSessionExpired.Error()) {
+		t.Errorf("Expected an idle session to expire, got %d: %s", res.Status, res.RawBody)
+	}
+	if h.Cookie("session_id") != "" {
+		t.Error("Expected the expired session cookie to be cleared")
+	}
+
+	res = h.Do(http.MethodPost, "/auth/login", map[string]interface{}{
+		"email":       "jane@example.com",
+		"password":    "securePassword123",
+		"remember_me": true,
+	})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	ageSession(t, h, "lastSeen", policy.IdleTimeout+time.Minute)
+	ageSession(t, h, "createdAt", policy.AbsoluteTimeout+time.Minute)
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusOK {
+		t.Errorf("Expected a remembered session to outlive the normal timeouts, got %d", res.Status)
+	}
+
+	ageSession(t, h, "createdAt", policy.RememberMeAbsoluteTimeout)
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a remembered session to end after the absolute timeout, got %d", res.Status)
+	}
+}
+
+func TestLegacySessionIsUpgraded(t *testing.T) {
+	policy := auth.DefaultSessionPolicy()
+	h := testutil.NewHarness(t, withSessionBinding(auth.SessionBindingEnforce))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+
+	// Sessions from before timeouts and binding only recorded who logged in and when
+	editSession(t, h, func(data map[string]interface{}) {
+		for _, key := range []string{"createdAt", "lastSeen", "rememberMe", "userAgentHash", "ipPrefix"} {
+			delete(data, key)
+		}
+	})
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusOK {
+		t.Fatalf("Expected the legacy session to keep working, got %d: %s", res.Status, res.RawBody)
+	}
+	data := loadSession(t, h)
+	if _, ok := data["createdAt"].(int64); !ok {
+		t.Fatalf("Expected the session start to be recorded, got %v", data)
+	}
+	if data["createdAt"] != data["authTime"] {
+		t.Errorf("Expected the session to start at its last authentication, got %v and %v", data["createdAt"], data["authTime"])
+	}
+
+	if res := getWithAgent(h, "/users/me/login-history", chromeOnWindows); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the upgraded session to be bound to its client, got %d", res.Status)
+	}
+
+	h.Login("jane@example.com", "securePassword123")
+	editSession(t, h, func(data map[string]interface{}) {
+		delete(data, "createdAt")
+		delete(data, "lastSeen")
+	})
+	h.Do(http.MethodGet, "/users/me/login-history", nil)
+	ageSession(t, h, "lastSeen", policy.IdleTimeout+time.Minute)
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the upgraded session to follow the idle timeout, got %d", res.Status)
+	}
+}
+
+func TestSessionTimeoutsFallBackToDefaults(t *testing.T) {
+	h := testutil.NewHarness(t, func(deps *app.Dependencies) {
+		policy := auth.NewSessionPolicyFromConfig(config.SessionConfig{IdleTimeoutMinutes: 0, AbsoluteTimeoutHours: -1})
+		deps.SessionPolicy = &policy
+	})
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusOK {
+		t.Errorf("Expected sessions to last with timeouts that are not positive, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+// withSessionBinding binds sessions to their user agent and IP prefix in the given mode.
+func withSessionBinding(mode string) testutil.HarnessOption {
+	return func(deps *app.Dependencies) {
+		policy := auth.DefaultSessionPolicy()
+		policy.Binding = mode
+		deps.SessionPolicy = &policy
+	}
+}
+
+// getWithAgent sends a GET request with the given User-Agent header.
+func getWithAgent(h *testutil.Harness, path, userAgent string) *testutil.Response {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("User-Agent", userAgent)
+	return h.DoRequest(req)
+}
+
+func TestSessionBinding(t *testing.T) {
+	h := testutil.NewHarness(t, withSessionBinding(auth.SessionBindingWarn))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	loginWithAgent(h, "jane@example.com", "securePassword123", chromeOnWindows)
+	if res := getWithAgent(h, "/users/me/login-history", safariOnIPhone); res.Status != http.StatusOK {
+		t.Errorf("Expected a binding mismatch only to be logged, got %d", res.Status)
+	}
+
+	h = testutil.NewHarness(t, withSessionBinding(auth.SessionBindingEnforce))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	loginWithAgent(h, "jane@example.com", "securePassword123", chromeOnWindows)
+	if res := getWithAgent(h, "/users/me/login-history", chromeOnWindows); res.Status != http.StatusOK {
+		t.Fatalf("Expected the bound client to be let through, got %d: %s", res.Status, res.RawBody)
+	}
+	res := getWithAgent(h, "/users/me/login-history", safariOnIPhone)
+	if res.Status != http.StatusUnauthorized || !strings.Contains(string(res.RawBody), errs.ErrSessionBindingMismatch.Error()) {
+		t.Errorf("Expected another client to be rejected, got %d: %s", res.Status, res.RawBody)
+	}
+	if res := getWithAgent(h, "/users/me/login-history", chromeOnWindows); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the session to be ended, got %d", res.Status)
+	}
+}
+
+// withSessionLimit limits users to max concurrent sessions, and admins to one.
+func withSessionLimit(max int, strategy string) testutil.HarnessOption {
+	return func(deps *app.Dependencies) {
+		policy := auth.DefaultSessionPolicy()
+		policy.MaxConcurrent = max
+		policy.MaxConcurrentByRole = map[string]int{models.RoleAdmin: 1}
+		policy.LimitStrategy = strategy
+		deps.SessionPolicy = &policy
+	}
+}
+
+func TestConcurrentSessionLimitRejectsNewLogin(t *testing.T) {
+	h := testutil.NewHarness(t, withSessionLimit(2, auth.SessionLimitReject))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	credentials := map[string]string{"email": "jane@example.com", "password": "securePassword123"}
+
+	h.Login("jane@example.com", "securePassword123")
+	// Logging in again in the same browser replaces its session instead of adding one
+	h.Login("jane@example.com", "securePassword123")
+	h.ClearCookies()
+	h.Login("jane@example.com", "securePassword123")
+
+	h.ClearCookies()
+	res := h.Do(http.MethodPost, "/auth/login", credentials)
+	if res.Status != http.StatusConflict || res.Body.Error != errs.ErrTooManySessions.Error() {
+		t.Fatalf("Expected a third session to be refused, got %d: %s", res.Status, res.RawBody)
+	}
+
+	// An expired session no longer counts
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	records, _ := h.SessionIndex.List(t.Context(), jane.ID)
+	if err := h.SessionStorage.Delete(records[0].ID); err != nil {
+		t.Fatalf("Failed to expire session: %v", err)
+	}
+	if res := h.Do(http.MethodPost, "/auth/login", credentials); res.Status != http.StatusOK {
+		t.Errorf("Expected login to succeed once a session expired, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestConcurrentSessionLimitEvictsOldestSession(t *testing.T) {
+	h := testutil.NewHarness(t, withSessionLimit(2, auth.SessionLimitEvictOldest))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	h.Login("jane@example.com", "securePassword123")
+	oldest := h.Cookie("session_id")
+	h.ClearCookies()
+	h.Login("jane@example.com", "securePassword123")
+	h.ClearCookies()
+	h.Login("jane@example.com", "securePassword123")
+
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	records, _ := h.SessionIndex.List(t.Context(), jane.ID)
+	if len(records) != 2 {
+		t.Fatalf("Expected two sessions, got %d", len(records))
+	}
+	h.ClearCookies()
+	h.SetCookie("session_id", oldest)
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the oldest session to be ended, got %d", res.Status)
+	}
+}
+
+func TestConcurrentLoginsCannotExceedSessionLimit(t *testing.T) {
+	h := testutil.NewHarness(t, withSessionLimit(2, auth.SessionLimitReject))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	var wg sync.WaitGroup
+	var successes atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each login comes from a browser of its own, which needs a CSRF token first
+			res, err := h.App.Test(httptest.NewRequest(http.MethodGet, "/auth/csrf", nil), -1)
+			if err != nil {
+				t.Errorf("Fetching the CSRF token failed: %v", err)
+				return
+			}
+			res.Body.Close()
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"jane@example.com","password":"securePassword123"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			req.Header.Set(auth.CSRFHeader, res.Header.Get(auth.CSRFHeader))
+			for _, cookie := range res.Cookies() {
+				req.AddCookie(cookie)
+			}
+			res, err = h.App.Test(req, -1)
+			if err != nil {
+				t.Errorf("Login failed: %v", err)
+				return
+			}
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				successes.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	records, _ := h.SessionIndex.List(t.Context(), jane.ID)
+	if successes.Load() != 2 || len(records) != 2 {
+		t.Errorf("Expected exactly two concurrent logins to get a session, got %d logins and %d sessions", successes.Load(), len(records))
+	}
+}
+
+func TestConcurrentSessionLimitPerRole(t *testing.T) {
+	h := testutil.NewHarness(t, withSessionLimit(0, auth.SessionLimitReject))
+	registerAdmin(t, h)
+
+	h.ClearCookies()
+	res := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "admin@example.com",
+		"password": "correctHorseBattery42",
+	})
+	if res.Status != http.StatusConflict {
+		t.Errorf("Expected admins to be limited to one session, got %d", res.Status)
+	}
+
+	// Users without a role limit are not limited
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	for i := 0; i < 3; i++ {
+		h.ClearCookies()
+		h.Login("jane@example.com", "securePassword123")
+	}
+}
+
+func TestCSRFTokenRequiredWithSessionCookie(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	h.AutoCSRF = false
+
+	res := h.Do(http.MethodPost, "/auth/logout", nil)
+	if res.Status != http.StatusForbidden {
+		t.Fatalf("Expected logout without a CSRF token to be forbidden, got %d", res.Status)
+	}
+	if !strings.Contains(string(res.RawBody), errs.ErrInvalidCSRFToken.Error()) {
+		t.Errorf("Expected the CSRF error, got %s", res.RawBody)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set(auth.CSRFHeader, "not-the-token")
+	if res := h.DoRequest(req); res.Status != http.StatusForbidden {
+		t.Errorf("Expected logout with a wrong CSRF token to be forbidden, got %d", res.Status)
+	}
+
+	res = h.Do(http.MethodGet, "/auth/csrf", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the CSRF token, got %d: %s", res.Status, res.RawBody)
+	}
+	var body dto.CSRFTokenResponse
+	if err := json.Unmarshal(mustMarshal(t, res.Body.Data), &body); err != nil {
+		t.Fatalf("Failed to decode CSRF token: %v", err)
+	}
+	if body.Token == "" || body.Token != res.Header.Get(auth.CSRFHeader) {
+		t.Fatalf("Expected the token in body and header, got %q and %q", body.Token, res.Header.Get(auth.CSRFHeader))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set(auth.CSRFHeader, body.Token)
+	if res := h.DoRequest(req); res.Status != http.StatusOK {
+		t.Errorf("Expected logout with the CSRF token to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestCSRFTokenInFormField(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	h.AutoCSRF = false
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader("_csrf="+h.CSRFToken()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res := h.DoRequest(req); res.Status != http.StatusOK {
+		t.Errorf("Expected logout with the CSRF form field to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestCSRFTokenRotatedOnLogin(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	// A token handed out before the login, e.g. to someone who planted the session
+	res := h.Do(http.MethodGet, "/auth/csrf", nil)
+	planted := res.Header.Get(auth.CSRFHeader)
+	if planted == "" {
+		t.Fatal("Expected a CSRF token before login")
+	}
+	h.Login("jane@example.com", "securePassword123")
+	h.AutoCSRF = false
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set(auth.CSRFHeader, planted)
+	if res := h.DoRequest(req); res.Status != http.StatusForbidden {
+		t.Errorf("Expected the token from before the login to be rejected, got %d", res.Status)
+	}
+	if token := h.CSRFToken(); token == planted {
+		t.Error("Expected a new CSRF token after login")
+	}
+}
+
+func TestCSRFExemptions(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	h.AutoCSRF = false
+
+	if res := h.Do(http.MethodGet, "/users/me/login-history", nil); res.Status != http.StatusOK {
+		t.Errorf("Expected safe methods to need no CSRF token, got %d", res.Status)
+	}
+
+	// The session cookie authenticates the request, whatever bearer token comes with it
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer some-token")
+	if res := h.DoRequest(req); res.Status != http.StatusForbidden {
+		t.Errorf("Expected a bogus bearer token next to the session cookie to need a CSRF token, got %d: %s", res.Status, res.RawBody)
+	}
+
+	// Without the session cookie the bearer token is all a request could be authenticated with
+	h.ClearCookies()
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer some-token")
+	if res := h.DoRequest(req); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a bearer token without a session cookie to need no CSRF token, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestLoginRequiresCSRFToken(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.ClearCookies()
+	h.AutoCSRF = false
+	credentials := map[string]string{"email": "jane@example.com", "password": "securePassword123"}
+
+	crossSite := func(path string, body string, header, value string) *testutil.Response {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(header, value)
+		return h.DoRequest(req)
+	}
+
+	// A cross-site page could otherwise log the browser into the attacker's account
+	for header, value := range map[string]string{"Sec-Fetch-Site": "cross-site", fiber.HeaderOrigin: "https://evil.example"} {
+		res := crossSite("/auth/login", `{"email":"jane@example.com","password":"securePassword123"}`, header, value)
+		if res.Status != http.StatusForbidden || res.Body.Error != errs.ErrInvalidCSRFToken.Error() {
+			t.Errorf("Expected login with %s and without a CSRF token to be forbidden, got %d: %s", header, res.Status, res.RawBody)
+		}
+		res = crossSite("/auth/passwordless/verify", `{"email":"jane@example.com","code":"123456"}`, header, value)
+		if res.Status != http.StatusForbidden {
+			t.Errorf("Expected passwordless login with %s and without a CSRF token to be forbidden, got %d: %s", header, res.Status, res.RawBody)
+		}
+	}
+
+	// API and mobile clients send neither cookies nor browser headers and need no token or session
+	res := h.Do(http.MethodPost, "/auth/login", credentials)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected login from a client without cookies to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	h.ClearCookies()
+
+	res = h.Do(http.MethodGet, "/auth/csrf", nil)
+	if res.Status != http.StatusOK || h.Cookie("session_id") == "" {
+		t.Fatalf("Expected the CSRF token to start a session, got %d: %s", res.Status, res.RawBody)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"jane@example.com","password":"securePassword123"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderOrigin, "https://app.example.com")
+	req.Header.Set(auth.CSRFHeader, res.Header.Get(auth.CSRFHeader))
+	if res := h.DoRequest(req); res.Status != http.StatusOK {
+		t.Errorf("Expected login with the CSRF token of the session to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+// withForwardAuth sets the forward-auth cache lifetime, login URL and allowed redirect hosts.
+func withForwardAuth(cacheTTLSeconds int, loginURL string, allowedRedirectHosts ...string) testutil.HarnessOption {
+	return func(deps *app.Dependencies) {
+		deps.ForwardAuthConfig = config.ForwardAuthConfig{
+			CacheTTLSeconds:      cacheTTLSeconds,
+			LoginURL:             loginURL,
+			AllowedRedirectHosts: allowedRedirectHosts,
+		}
+	}
+}
+
+// issueAccessToken requests an access token for the logged in user.
+func issueAccessToken(t *testing.T, h *testutil.Harness) string {
+	t.Helper()
+
+	res := h.Do(http.MethodPost, "/auth/token", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Issuing an access token failed with status %d: %s", res.Status, res.RawBody)
+	}
+	var token dto.AccessTokenResponse
+	if err := json.Unmarshal(mustMarshal(t, res.Body.Data), &token); err != nil {
+		t.Fatalf("Failed to decode access token: %v", err)
+	}
+	if token.TokenType != "Bearer" || token.ExpiresIn != int(auth.DefaultAccessTokenTTL/time.Second) {
+		t.Errorf("Unexpected access token response %+v", token)
+	}
+	return token.AccessToken
+}
+
+// verifyWithBearer sends a forward-auth check authenticated by the access token.
+func verifyWithBearer(h *testutil.Harness, token string) *testutil.Response {
+	req := httptest.NewRequest(http.MethodGet, "/auth/verify", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return h.DoRequest(req)
+}
+
+func TestForwardAuthWithSession(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+
+	if res := h.Do(http.MethodGet, "/auth/verify", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a session, got %d", res.Status)
+	}
+
+	h.Login("jane@example.com", "securePassword123")
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	res := h.Do(http.MethodGet, "/auth/verify", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the session to be accepted, got %d: %s", res.Status, res.RawBody)
+	}
+	for name, want := range map[string]string{
+		auth.HeaderAuthUserID: jane.ID.String(),
+		auth.HeaderAuthEmail:  "jane@example.com",
+		auth.HeaderAuthRoles:  models.RoleUser,
+	} {
+		if got := res.Header.Get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	// Proxies may forward the method of the request they check, without a CSRF token
+	h.AutoCSRF = false
+	if res := h.Do(http.MethodPost, "/auth/verify", nil); res.Status != http.StatusOK {
+		t.Errorf("Expected a forwarded POST to be accepted, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestForwardAuthWithAccessToken(t *testing.T) {
+	h := testutil.NewHarness(t, withForwardAuth(0, ""))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	token := issueAccessToken(t, h)
+	h.ClearCookies()
+
+	res := verifyWithBearer(h, token)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the access token to be accepted, got %d: %s", res.Status, res.RawBody)
+	}
+	if got := res.Header.Get(auth.HeaderAuthEmail); got != "jane@example.com" {
+		t.Errorf("Expected the email header, got %q", got)
+	}
+
+	if res := verifyWithBearer(h, token+"x"); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a tampered token to be rejected, got %d", res.Status)
+	}
+
+	// One-time tokens are signed with the same key but are no access tokens
+	jane, _ := h.Users.GetUserByEmail(t.Context(), "jane@example.com")
+	tokenService := auth.NewTokenService("test-secret-key", h.Tokens, h.Codes, auth.CodePolicy{})
+	resetToken, err := tokenService.GenerateToken(t.Context(), jane.ID, auth.PurposePasswordReset, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if res := verifyWithBearer(h, resetToken); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a password reset token to be rejected, got %d", res.Status)
+	}
+
+	// The account is checked on every request, not only when the token was issued
+	h.Login("jane@example.com", "securePassword123")
+	if res := h.Do(http.MethodPost, "/users/me/deactivate", map[string]string{"password": "securePassword123"}); res.Status != http.StatusOK {
+		t.Fatalf("Deactivation failed with status %d: %s", res.Status, res.RawBody)
+	}
+	if res := verifyWithBearer(h, token); res.Status != http.StatusForbidden {
+		t.Errorf("Expected the token of a deactivated account to be refused, got %d", res.Status)
+	}
+}
+
+func TestForwardAuthRedirectsToLogin(t *testing.T) {
+	h := testutil.NewHarness(t, withForwardAuth(5, "https://login.example.com/", "*.example.com"))
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/verify?redirect=true", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "wiki.example.com")
+	req.Header.Set("X-Forwarded-Uri", "/pages/1")
+	res := h.DoRequest(req)
+	if res.Status != http.StatusFound {
+		t.Fatalf("Expected a redirect to the login page, got %d", res.Status)
+	}
+	if got, want := res.Header.Get("Location"), "https://login.example.com/?rd=https%3A%2F%2Fwiki.example.com%2Fpages%2F1"; got != want {
+		t.Errorf("Expected redirect to %q, got %q", want, got)
+	}
+
+	// nginx auth_request only understands 2xx, 401 and 403
+	if res := h.Do(http.MethodGet, "/auth/verify", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without ?redirect=true, got %d", res.Status)
+	}
+
+	// Pages on other hosts would turn the login page into an open redirect
+	for _, original := range []string{
+		"https://evil.example.org/phish",
+		"https://wiki.example.com.evil.org/",
+		"javascript:alert(1)",
+		"//evil.example.org/",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/auth/verify?redirect=true", nil)
+		req.Header.Set("X-Original-URL", original)
+		res := h.DoRequest(req)
+		if got := res.Header.Get("Location"); res.Status != http.StatusFound || got != "https://login.example.com/" {
+			t.Errorf("Expected %q to be left out of the redirect, got %d to %q", original, res.Status, got)
+		}
+	}
+}
+
+func TestForwardAuthCachesDecisions(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		cacheTTLSeconds int
+		want            int
+	}{
+		{"cached", 5, http.StatusOK},
+		{"uncached", 0, http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testutil.NewHarness(t, withForwardAuth(tt.cacheTTLSeconds, ""))
+			h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+			h.Login("jane@example.com", "securePassword123")
+			if res := h.Do(http.MethodGet, "/auth/verify", nil); res.Status != http.StatusOK {
+				t.Fatalf("Expected the session to be accepted, got %d", res.Status)
+			}
+
+			if err := h.SessionStorage.Delete(h.Cookie("session_id")); err != nil {
+				t.Fatalf("Failed to expire session: %v", err)
+			}
+			if res := h.Do(http.MethodGet, "/auth/verify", nil); res.Status != tt.want {
+				t.Errorf("Expected %d after the session expired, got %d", tt.want, res.Status)
+			}
+		})
+	}
+}
+
+// withSignedAccessTokens signs access tokens with a generated Ed25519 key and allows the scopes.
+func withSignedAccessTokens(t *testing.T, scopes ...string) testutil.HarnessOption {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	key, err := auth.NewSigningKey(private, "test-key")
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+	return func(deps *app.Dependencies) {
+		deps.AccessTokenKey = key
+		deps.AuthConfig.AccessTokenScopes = scopes
+	}
+}
+
+func TestAccessTokensVerifiableWithPublishedKeys(t *testing.T) {
+	h := testutil.NewHarness(t, withSignedAccessTokens(t, "orders:read", "orders:write"))
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+
+	jwks := h.Do(http.MethodGet, "/.well-known/jwks.json", nil)
+	if jwks.Status != http.StatusOK {
+		t.Fatalf("Fetching the keys failed with status %d", jwks.Status)
+	}
+	var keys auth.JWKSet
+	if err := json.Unmarshal(jwks.RawBody, &keys); err != nil {
+		t.Fatalf("Failed to decode keys: %v", err)
+	}
+	if len(keys.Keys) != 1 || keys.Keys[0].Kid != "test-key" || keys.Keys[0].Alg != "EdDSA" {
+		t.Fatalf("Unexpected keys %+v", keys)
+	}
+
+	if res := h.Do(http.MethodPost, "/auth/token", dto.AccessTokenRequest{Scope: "orders:read admin"}); res.Status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a scope that is not allowed, got %d", res.Status)
+	}
+	res := h.Do(http.MethodPost, "/auth/token", dto.AccessTokenRequest{Scope: "orders:read"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Issuing an access token failed with status %d: %s", res.Status, res.RawBody)
+	}
+	var token dto.AccessTokenResponse
+	if err := json.Unmarshal(mustMarshal(t, res.Body.Data), &token); err != nil {
+		t.Fatalf("Failed to decode access token: %v", err)
+	}
+	if token.Scope != "orders:read" {
+		t.Errorf("Expected the requested scope, got %q", token.Scope)
+	}
+
+	// A downstream service verifies the token with the published keys alone
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(jwks.RawBody)
+	}))
+	defer server.Close()
+	keySet, err := authmw.NewKeySet(context.Background(), server.URL)
 	if err != nil {
-		t.Fatalf("Error hashing password: %v", err)
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	defer keySet.Close()
+	principal, err := authmw.NewJWKSVerifier(keySet).Verify(context.Background(), token.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if principal.Email != "jane@example.com" || !principal.HasScope("orders:read") || principal.HasScope("orders:write") {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	// The forward-auth endpoint accepts the signed token as well
+	if res := verifyWithBearer(h, token.AccessToken); res.Status != http.StatusOK {
+		t.Errorf("Expected the signed token to be accepted, got %d", res.Status)
 	}
-	if hash == password {
-		t.Error("Hashed password should not match original password")
+}
+
+// unavailableKeyStore is a signing key store whose database cannot be reached.
+type unavailableKeyStore struct {
+	auth.SigningKeyStore
+	mu        sync.Mutex
+	loads     int
+	deadlines int
+}
+
+func (s *unavailableKeyStore) List(ctx context.Context) ([]auth.StoredSigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loads++
+	if _, ok := ctx.Deadline(); ok {
+		s.deadlines++
 	}
+	return nil, errors.New("connection refused")
 }
 
-func TestCheckPasswordHash(t *testing.T) {
-	password := "securePassword123"
-	hash, _ := auth.HashPassword(password)
-	if !auth.CheckPasswordHash(password, hash) {
-		t.Error("Password hash check failed")
+func TestFailedSigningKeyLoadIsNotRetriedOnEveryRequest(t *testing.T) {
+	store := &unavailableKeyStore{}
+	tokenService := auth.NewTokenService("test-secret-key", auth.NewMemoryTokenStore(), auth.NewMemoryCodeStore(), auth.CodePolicy{},
+		auth.WithSigningKeyStore(store))
+
+	for i := 0; i < 3; i++ {
+		tokenService.JWKS()
+	}
+	if store.loads != 1 {
+		t.Errorf("Expected one load of the unavailable key store, got %d", store.loads)
+	}
+	if store.deadlines != store.loads {
+		t.Error("Expected the key store to be loaded with a deadline")
 	}
 }
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"authentication/src/internal/errs"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"time"
+)
+
+// CodeStore persists short numeric verification codes, one per email address and
+// purpose, together with the number of failed attempts made against them.
+type CodeStore interface {
+	// Save stores the code hash for the email and purpose, replacing any previous
+	// code and resetting its attempt counter.
+	Save(ctx context.Context, purpose, email, codeHash string, ttl time.Duration) error
+	// Verify atomically checks codeHash against the stored code. A match consumes
+	// the code. A mismatch counts as a failed attempt and returns errs.ErrInvalidCode,
+	// or errs.ErrTooManyAttempts once maxAttempts is reached, which also discards the code.
+	Verify(ctx context.Context, purpose, email, codeHash string, maxAttempts int) error
+	// Check checks codeHash like Verify, counting a mismatch as a failed attempt, but leaves a
+	// matching code in place to be consumed later.
+	Check(ctx context.Context, purpose, email, codeHash string, maxAttempts int) error
+	// Delete discards the code for the email and purpose, if any.
+	Delete(ctx context.Context, purpose, email string) error
+}
+
+// NewCodeStore creates the CodeStore for the configured backend: "redis", "postgres" or "memory".
+func NewCodeStore(backend string, redisClient *redis.Client, database *gorm.DB) (CodeStore, error) {
+	switch backend {
+	case "redis":
+		return NewRedisCodeStore(redisClient), nil
+	case "postgres":
+		return NewPostgresCodeStore(database), nil
+	case "memory":
+		return NewMemoryCodeStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown code store backend %q", backend)
+	}
+}
+
+// redisCodeStore implements CodeStore with a Redis hash per email and purpose.
+type redisCodeStore struct {
+	client *redis.Client
+}
+
+// NewRedisCodeStore creates a CodeStore backed by Redis.
+func NewRedisCodeStore(client *redis.Client) CodeStore {
+	return &redisCodeStore{
+		client: client,
+	}
+}
+
+func codeKey(purpose, email string) string {
+	return fmt.Sprintf("code:%s:%s", purpose, email)
+}
+
+// verifyCodeScript returns 1 when the code matched, and consumes it if ARGV[3] is "1",
+// 0 on a mismatch, -1 when no code exists and -2 when the attempts are exhausted.
+var verifyCodeScript = redis.NewScript(`
+local stored = redis.call('HGET', KEYS[1], 'hash')
+if not stored then
+	return -1
+end
+if stored == ARGV[1] then
+	if ARGV[3] == '1' then
+		redis.call('DEL', KEYS[1])
+	end
+	return 1
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1])
+	return -2
+end
+return 0
+`)
+
+// Save stores the code hash for the email and purpose.
+func (r *redisCodeStore) Save(ctx context.Context, purpose, email, codeHash string, ttl time.Duration) error {
+	key := codeKey(purpose, email)
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "hash", codeHash, "attempts", 0)
+	pipe.PExpire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Verify atomically checks codeHash against the stored code.
+func (r *redisCodeStore) Verify(ctx context.Context, purpose, email, codeHash string, maxAttempts int) error {
+	return r.verify(ctx, purpose, email, codeHash, maxAttempts, true)
+}
+
+// Check checks codeHash against the stored code without consuming it.
+func (r *redisCodeStore) Check(ctx context.Context, purpose, email, codeHash string, maxAttempts int) error {
+	return r.verify(ctx, purpose, email, codeHash, maxAttempts, false)
+}
+
+// Delete discards the code for the email and purpose.
+func (r *redisCodeStore) Delete(ctx context.Context, purpose, email string) error {
+	return r.client.Del(ctx, codeKey(purpose, email)).Err()
+}
+
+func (r *redisCodeStore) verify(ctx context.Context, purpose, email, codeHash string, maxAttempts int, consume bool) error {
+	consumeFlag := "0"
+	if consume {
+		consumeFlag = "1"
+	}
+	result, err := verifyCodeScript.Run(ctx, r.client, []string{codeKey(purpose, email)}, codeHash, maxAttempts, consumeFlag).Int()
+	if err != nil {
+		return err
+	}
+	return codeVerifyResult(result)
+}
+
+// codeVerifyResult maps the verification outcome codes shared by the stores to errors.
+func codeVerifyResult(result int) error {
+	switch result {
+	case 1:
+		return nil
+	case -2:
+		return errs.ErrTooManyAttempts
+	default:
+		return errs.ErrInvalidCode
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryCode struct {
+	hash      string
+	attempts  int
+	expiresAt time.Time
+}
+
+// memoryCodeStore implements CodeStore in memory, for tests and local development.
+type memoryCodeStore struct {
+	mu    sync.Mutex
+	codes map[string]memoryCode
+}
+
+// NewMemoryCodeStore creates an in-memory CodeStore.
+func NewMemoryCodeStore() CodeStore {
+	return &memoryCodeStore{
+		codes: make(map[string]memoryCode),
+	}
+}
+
+// Save stores the code hash for the email and purpose.
+func (m *memoryCodeStore) Save(ctx context.Context, purpose, email, codeHash string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.codes[codeKey(purpose, email)] = memoryCode{hash: codeHash, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Verify atomically checks codeHash against the stored code.
+func (m *memoryCodeStore) Verify(ctx context.Context, purpose, email, codeHash string, maxAttempts int) error {
+	return m.verify(purpose, email, codeHash, maxAttempts, true)
+}
+
+// Check checks codeHash against the stored code without consuming it.
+func (m *memoryCodeStore) Check(ctx context.Context, purpose, email, codeHash string, maxAttempts int) error {
+	return m.verify(purpose, email, codeHash, maxAttempts, false)
+}
+
+// Delete discards the code for the email and purpose.
+func (m *memoryCodeStore) Delete(ctx context.Context, purpose, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.codes, codeKey(purpose, email))
+	return nil
+}
+
+func (m *memoryCodeStore) verify(purpose, email, codeHash string, maxAttempts int, consume bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := codeKey(purpose, email)
+	code, ok := m.codes[key]
+	if !ok || time.Now().After(code.expiresAt) {
+		delete(m.codes, key)
+		return codeVerifyResult(-1)
+	}
+	if code.hash == codeHash {
+		if consume {
+			delete(m.codes, key)
+		}
+		return codeVerifyResult(1)
+	}
+
+	code.attempts++
+	if code.attempts >= maxAttempts {
+		delete(m.codes, key)
+		return codeVerifyResult(-2)
+	}
+	m.codes[key] = code
+	return codeVerifyResult(0)
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// postgresCodeStore implements CodeStore with the verification_codes table.
+type postgresCodeStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresCodeStore creates a CodeStore backed by Postgres.
+func NewPostgresCodeStore(db *gorm.DB) CodeStore {
+	return &postgresCodeStore{
+		db: db,
+	}
+}
+
+// Save stores the code hash for the email and purpose.
+func (p *postgresCodeStore) Save(ctx context.Context, purpose, email, codeHash string, ttl time.Duration) error {
+	code := &models.VerificationCode{
+		Purpose:   purpose,
+		Email:     email,
+		CodeHash:  codeHash,
+		Attempts:  0,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	return p.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "purpose"}, {Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"code_hash", "attempts", "expires_at", "created_at"}),
+	}).Create(code).Error
+}
+
+// Verify atomically checks codeHash against the stored code.
+func (p *postgresCodeStore) Verify(ctx context.Context, purpose, email, codeHash string, maxAttempts int) error {
+	return p.verify(ctx, purpose, email, codeHash, maxAttempts, true)
+}
+
+// Check checks codeHash against the stored code without consuming it.
+func (p *postgresCodeStore) Check(ctx context.Context, purpose, email, codeHash string, maxAttempts int) error {
+	return p.verify(ctx, purpose, email, codeHash, maxAttempts, false)
+}
+
+// Delete discards the code for the email and purpose.
+func (p *postgresCodeStore) Delete(ctx context.Context, purpose, email string) error {
+	return p.db.WithContext(ctx).Delete(&models.VerificationCode{}, "purpose = ? AND email = ?", purpose, email).Error
+}
+
+func (p *postgresCodeStore) verify(ctx context.Context, purpose, email, codeHash string, maxAttempts int, consume bool) error {
+	result := -1
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var code models.VerificationCode
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("purpose = ? AND email = ? AND expires_at > ?", purpose, email, time.Now()).
+			First(&code).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		where := tx.Where("purpose = ? AND email = ?", purpose, email)
+		if code.CodeHash == codeHash {
+			result = 1
+			if !consume {
+				return nil
+			}
+			return where.Delete(&models.VerificationCode{}).Error
+		}
+
+		if code.Attempts+1 >= maxAttempts {
+			result = -2
+			return where.Delete(&models.VerificationCode{}).Error
+		}
+		result = 0
+		return where.Model(&models.VerificationCode{}).Update("attempts", code.Attempts+1).Error
+	})
+	if err != nil {
+		return err
+	}
+	return codeVerifyResult(result)
+}
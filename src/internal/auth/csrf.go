@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"authentication/src/internal/errs"
+	"authentication/src/utils"
+	"crypto/subtle"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"log"
+)
+
+// CSRFHeader is the request header carrying the CSRF token of the session.
+const CSRFHeader = "X-CSRF-Token"
+
+// csrfFormField is the form field carrying the CSRF token for plain HTML forms.
+const csrfFormField = "_csrf"
+
+// sessionKeyCSRFToken holds the synchronizer token of the session.
+const sessionKeyCSRFToken = "csrfToken"
+
+// RequireCSRFToken is a middleware that refuses state-changing requests made with an authenticated
+// session cookie unless they carry the session's CSRF token in the X-CSRF-Token header or the _csrf
+// form field. Safe methods and requests without an authenticated session are let through, and so
+// are requests with a bearer token but no session cookie, which a cross-site page cannot send.
+// A bearer token next to the session cookie does not exempt a request, since the session is what
+// authenticates it. Requests to exemptPaths, which must not change state, are let through as well.
+func RequireCSRFToken(sessions *SessionStore, exemptPaths ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+			return c.Next()
+		}
+		if bearerToken(c) != "" && c.Cookies(sessionCookieName) == "" {
+			return c.Next()
+		}
+		for _, path := range exemptPaths {
+			if c.Path() == path {
+				return c.Next()
+			}
+		}
+
+		sess, err := sessions.Get(c)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get session",
+			})
+		}
+		if sess.Get("userID") == nil {
+			return c.Next()
+		}
+
+		if !validCSRFToken(c, sess) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": errs.ErrInvalidCSRFToken.Error(),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// RequireLoginCSRFToken is a middleware for routes that log in. Requests a browser may have sent for
+// a cross-site page are refused unless they carry the CSRF token of the session the browser already
+// has, fetched from /auth/csrf before logging in, so the page cannot log the user into an account of
+// its choosing. API and mobile clients send no cookies and none of the browser headers, so they log
+// in without a token and without creating a session beforehand.
+func RequireLoginCSRFToken(sessions *SessionStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !fromBrowser(c) {
+			return c.Next()
+		}
+
+		sess, err := sessions.Get(c)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get session",
+			})
+		}
+
+		if !validCSRFToken(c, sess) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": errs.ErrInvalidCSRFToken.Error(),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// fromBrowser reports whether a request may have been sent by a browser for a page of another site:
+// it carries cookies, a Sec-Fetch-Site header other than same-origin, or, from browsers that do not
+// send Sec-Fetch-Site, an Origin header. Browsers set these headers themselves; pages cannot remove them.
+func fromBrowser(c *fiber.Ctx) bool {
+	if len(c.Request().Header.Peek(fiber.HeaderCookie)) > 0 {
+		return true
+	}
+	switch c.Get("Sec-Fetch-Site") {
+	case "":
+		return c.Get(fiber.HeaderOrigin) != ""
+	case "same-origin", "none":
+		return false
+	default:
+		return true
+	}
+}
+
+// validCSRFToken reports whether the request carries the CSRF token of the session.
+func validCSRFToken(c *fiber.Ctx, sess *session.Session) bool {
+	expected, _ := sess.Get(sessionKeyCSRFToken).(string)
+	provided := c.Get(CSRFHeader)
+	if provided == "" {
+		provided = c.FormValue(csrfFormField)
+	}
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(provided)) == 1
+}
+
+// setCSRFToken gives the session a new CSRF token.
+func setCSRFToken(sess *session.Session) error {
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+	sess.Set(sessionKeyCSRFToken, token)
+	return nil
+}
+
+// sessionCSRFToken returns the CSRF token of the session, creating and saving one if it has none.
+func sessionCSRFToken(sess *session.Session) (string, error) {
+	if token, ok := sess.Get(sessionKeyCSRFToken).(string); ok && token != "" {
+		return token, nil
+	}
+
+	if err := setCSRFToken(sess); err != nil {
+		return "", err
+	}
+	token := sess.Get(sessionKeyCSRFToken).(string)
+	if err := sess.Save(); err != nil {
+		log.Printf("Error saving CSRF token: %v", err)
+		return "", err
+	}
+	return token, nil
+}
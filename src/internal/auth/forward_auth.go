@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"authentication/src/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Headers describing the authenticated user in forward-auth responses.
+const (
+	HeaderAuthUserID = "X-Auth-User-Id"
+	HeaderAuthEmail  = "X-Auth-Email"
+	HeaderAuthRoles  = "X-Auth-Roles"
+)
+
+// loginRedirectParam is the query parameter of the login URL that holds the page to return to.
+const loginRedirectParam = "rd"
+
+// ForwardAuthHandler answers the authentication subrequests of reverse proxies such as nginx
+// auth_request and Traefik ForwardAuth, so that apps behind them can rely on this service's sessions.
+type ForwardAuthHandler struct {
+	AuthService AuthService
+
+	// cache remembers successful checks for cacheTTL, when set
+	cache    ForwardAuthCache
+	cacheTTL time.Duration
+	// loginURL is where unauthenticated browsers are sent when the proxy asks for redirects
+	loginURL string
+	// allowedRedirectHosts are the hosts of the pages the login page may send browsers back to
+	allowedRedirectHosts []string
+}
+
+// ForwardAuthOption configures optional behaviour of the ForwardAuthHandler.
+type ForwardAuthOption func(*ForwardAuthHandler)
+
+// WithForwardAuthCache caches successful checks for ttl. A session or token stays accepted for up
+// to ttl after it was ended, so it should be a few seconds.
+func WithForwardAuthCache(cache ForwardAuthCache, ttl time.Duration) ForwardAuthOption {
+	return func(h *ForwardAuthHandler) {
+		if ttl > 0 {
+			h.cache = cache
+			h.cacheTTL = ttl
+		}
+	}
+}
+
+// WithLoginURL redirects unauthenticated requests that ask for it with ?redirect=true to the login
+// page, passing the page they came from in the rd parameter.
+func WithLoginURL(loginURL string) ForwardAuthOption {
+	return func(h *ForwardAuthHandler) {
+		h.loginURL = loginURL
+	}
+}
+
+// WithAllowedRedirectHosts lists the hosts whose pages are passed to the login page in rd. An entry
+// like "*.example.com" allows every subdomain. Pages on other hosts are left out, so the login page
+// cannot be made to send users to a site of an attacker's choosing.
+func WithAllowedRedirectHosts(hosts []string) ForwardAuthOption {
+	return func(h *ForwardAuthHandler) {
+		h.allowedRedirectHosts = hosts
+	}
+}
+
+// NewForwardAuthHandler creates a new ForwardAuthHandler instance.
+func NewForwardAuthHandler(as AuthService, opts ...ForwardAuthOption) *ForwardAuthHandler {
+	h := &ForwardAuthHandler{
+		AuthService: as,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Verify authenticates the request by its bearer token or session cookie and answers 200 with the
+// X-Auth-User-Id, X-Auth-Email and X-Auth-Roles headers, or 401 (302 to the login page when asked for).
+// Accounts that can no longer be used get 403.
+func (h *ForwardAuthHandler) Verify(c *fiber.Ctx) error {
+	ctx := c.Context()
+
+	token := bearerToken(c)
+	credential := token
+	if credential == "" {
+		credential = c.Cookies(sessionCookieName)
+	}
+	if credential == "" {
+		return h.unauthenticated(c, errs.ErrSessionNotFound)
+	}
+
+	key := forwardAuthKey(c, credential)
+	if h.cache != nil {
+		identity, err := h.cache.Get(ctx, key)
+		if err != nil {
+			log.Printf("Error reading forward-auth cache: %v", err)
+		} else if identity != nil {
+			return identityResponse(c, identity)
+		}
+	}
+
+	var authenticated *models.User
+	var err error
+	if token != "" {
+		authenticated, err = h.AuthService.VerifyAccessToken(ctx, token)
+	} else {
+		authenticated, err = authenticateSession(c, h.AuthService)
+	}
+	if err != nil {
+		return h.unauthenticated(c, err)
+	}
+
+	identity := &ForwardAuthIdentity{
+		UserID: authenticated.ID,
+		Email:  authenticated.Email,
+		Roles:  []string{authenticated.EffectiveRole()},
+	}
+	if h.cache != nil {
+		if err := h.cache.Set(ctx, key, identity, h.cacheTTL); err != nil {
+			log.Printf("Error writing forward-auth cache: %v", err)
+		}
+	}
+	return identityResponse(c, identity)
+}
+
+// unauthenticated answers a request that could not be authenticated.
+func (h *ForwardAuthHandler) unauthenticated(c *fiber.Ctx, err error) error {
+	if h.loginURL != "" && c.QueryBool("redirect") && isUnauthenticatedError(err) {
+		return c.Redirect(h.loginRedirectURL(c), fiber.StatusFound)
+	}
+	return authenticationErrorResponse(c, err)
+}
+
+// identityResponse answers a successful forward-auth check.
+func identityResponse(c *fiber.Ctx, identity *ForwardAuthIdentity) error {
+	c.Set(HeaderAuthUserID, identity.UserID.String())
+	c.Set(HeaderAuthEmail, identity.Email)
+	c.Set(HeaderAuthRoles, strings.Join(identity.Roles, ","))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(identity, "Authenticated"))
+}
+
+// forwardAuthKey derives the cache key of a credential used from the requesting client. The client
+// is part of the key so a cached check never skips session binding.
+func forwardAuthKey(c *fiber.Ctx, credential string) string {
+	sum := sha256.Sum256([]byte(credential + "\x00" + c.Get(fiber.HeaderUserAgent) + "\x00" + c.IP()))
+	return hex.EncodeToString(sum[:])
+}
+
+// loginRedirectURL returns the login URL with the page the proxied request was for, as told by the
+// X-Original-URL header of nginx or the X-Forwarded-* headers of Traefik. The page is left out
+// unless it is an http or https URL on one of the allowed redirect hosts.
+func (h *ForwardAuthHandler) loginRedirectURL(c *fiber.Ctx) string {
+	original := c.Get("X-Original-URL")
+	if host := c.Get(fiber.HeaderXForwardedHost); original == "" && host != "" {
+		proto := c.Get(fiber.HeaderXForwardedProto)
+		if proto == "" {
+			proto = "https"
+		}
+		original = proto + "://" + host + c.Get("X-Forwarded-Uri")
+	}
+
+	target, err := url.Parse(h.loginURL)
+	if err != nil || original == "" {
+		return h.loginURL
+	}
+	if !h.allowedRedirect(original) {
+		log.Printf("Leaving out login redirect to %q, which is not on an allowed host", original)
+		return h.loginURL
+	}
+	query := target.Query()
+	query.Set(loginRedirectParam, original)
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+// allowedRedirect reports whether the login page may send the browser back to the page.
+func (h *ForwardAuthHandler) allowedRedirect(page string) bool {
+	parsed, err := url.Parse(page)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.User != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host == "" {
+		return false
+	}
+	for _, allowed := range h.allowedRedirectHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasPrefix(suffix, ".") && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or "".
+func bearerToken(c *fiber.Ctx) string {
+	scheme, token, found := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !found || !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// isUnauthenticatedError reports whether err means the request carries no usable session or token,
+// as opposed to an unusable account or a failure to check.
+func isUnauthenticatedError(err error) bool {
+	return errors.Is(err, errs.ErrSessionNotFound) ||
+		errors.Is(err, errs.ErrUserNotFound) ||
+		errors.Is(err, errs.ErrSessionExpired) ||
+		errors.Is(err, errs.ErrSessionBindingMismatch) ||
+		errors.Is(err, errs.ErrTokenExpired) ||
+		errors.Is(err, errs.ErrInvalidToken) ||
+		errors.Is(err, errs.ErrInvalidTokenPurpose)
+}
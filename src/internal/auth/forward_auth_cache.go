@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// ForwardAuthIdentity is who a forward-auth request was authenticated as.
+type ForwardAuthIdentity struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+	Roles  []string  `json:"roles"`
+}
+
+// ForwardAuthCache remembers successful forward-auth checks for a short time, so that a reverse
+// proxy asking about every request of a page does not load the session and account each time.
+type ForwardAuthCache interface {
+	// Get returns the cached identity for the key, or nil if there is none.
+	Get(ctx context.Context, key string) (*ForwardAuthIdentity, error)
+	// Set caches the identity for the key for ttl.
+	Set(ctx context.Context, key string, identity *ForwardAuthIdentity, ttl time.Duration) error
+}
+
+// redisForwardAuthCache implements ForwardAuthCache with Redis, one JSON value per key.
+type redisForwardAuthCache struct {
+	client *redis.Client
+}
+
+// NewRedisForwardAuthCache creates a ForwardAuthCache backed by Redis.
+func NewRedisForwardAuthCache(client *redis.Client) ForwardAuthCache {
+	return &redisForwardAuthCache{
+		client: client,
+	}
+}
+
+func forwardAuthCacheKey(key string) string {
+	return "forward_auth:" + key
+}
+
+// Get returns the cached identity for the key, or nil if there is none.
+func (r *redisForwardAuthCache) Get(ctx context.Context, key string) (*ForwardAuthIdentity, error) {
+	data, err := r.client.Get(ctx, forwardAuthCacheKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var identity ForwardAuthIdentity
+	if err := json.Unmarshal(data, &identity); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// Set caches the identity for the key for ttl.
+func (r *redisForwardAuthCache) Set(ctx context.Context, key string, identity *ForwardAuthIdentity, ttl time.Duration) error {
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, forwardAuthCacheKey(key), data, ttl).Err()
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryForwardAuthEntry struct {
+	identity  ForwardAuthIdentity
+	expiresAt time.Time
+}
+
+// memoryForwardAuthCache implements ForwardAuthCache in memory, for tests and local development.
+type memoryForwardAuthCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryForwardAuthEntry
+}
+
+// NewMemoryForwardAuthCache creates an in-memory ForwardAuthCache.
+func NewMemoryForwardAuthCache() ForwardAuthCache {
+	return &memoryForwardAuthCache{
+		entries: make(map[string]memoryForwardAuthEntry),
+	}
+}
+
+// Get returns the cached identity for the key, or nil if there is none.
+func (m *memoryForwardAuthCache) Get(ctx context.Context, key string) (*ForwardAuthIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil, nil
+	}
+	identity := entry.identity
+	return &identity, nil
+}
+
+// Set caches the identity for the key for ttl.
+func (m *memoryForwardAuthCache) Set(ctx context.Context, key string, identity *ForwardAuthIdentity, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = memoryForwardAuthEntry{identity: *identity, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
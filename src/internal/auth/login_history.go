@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// LoginHistory stores the login attempts made against accounts.
+type LoginHistory interface {
+	// Add records a login attempt.
+	Add(ctx context.Context, event *models.LoginEvent) error
+	// List returns up to limit of the user's login attempts, newest first. A negative limit returns all of them.
+	List(ctx context.Context, userID uuid.UUID, limit int) ([]models.LoginEvent, error)
+	// KnownDevice reports whether the user has logged in successfully from the device before.
+	KnownDevice(ctx context.Context, userID uuid.UUID, deviceHash string) (bool, error)
+	// LastSuccess returns the user's most recent successful login, or nil if there is none.
+	LastSuccess(ctx context.Context, userID uuid.UUID) (*models.LoginEvent, error)
+	// KnownCountry reports whether the user has logged in successfully from the country before.
+	KnownCountry(ctx context.Context, userID uuid.UUID, country string) (bool, error)
+	// DeleteAll removes the whole history of the user.
+	DeleteAll(ctx context.Context, userID uuid.UUID) error
+	// DeleteBefore removes attempts made before the given time and returns how many were removed.
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// postgresLoginHistory implements LoginHistory with the login_events table.
+type postgresLoginHistory struct {
+	db *gorm.DB
+}
+
+// NewPostgresLoginHistory creates a LoginHistory backed by Postgres.
+func NewPostgresLoginHistory(db *gorm.DB) LoginHistory {
+	return &postgresLoginHistory{
+		db: db,
+	}
+}
+
+// Add records a login attempt.
+func (p *postgresLoginHistory) Add(ctx context.Context, event *models.LoginEvent) error {
+	return p.db.WithContext(ctx).Create(event).Error
+}
+
+// List returns the user's login attempts, newest first.
+func (p *postgresLoginHistory) List(ctx context.Context, userID uuid.UUID, limit int) ([]models.LoginEvent, error) {
+	var events []models.LoginEvent
+	err := p.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// KnownDevice reports whether the user has logged in successfully from the device before.
+func (p *postgresLoginHistory) KnownDevice(ctx context.Context, userID uuid.UUID, deviceHash string) (bool, error) {
+	var count int64
+	err := p.db.WithContext(ctx).Model(&models.LoginEvent{}).
+		Where("user_id = ? AND device_hash = ? AND success", userID, deviceHash).Count(&count).Error
+	return count > 0, err
+}
+
+// LastSuccess returns the user's most recent successful login.
+func (p *postgresLoginHistory) LastSuccess(ctx context.Context, userID uuid.UUID) (*models.LoginEvent, error) {
+	var events []models.LoginEvent
+	err := p.db.WithContext(ctx).Where("user_id = ? AND success", userID).Order("created_at DESC").Limit(1).Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+// KnownCountry reports whether the user has logged in successfully from the country before.
+func (p *postgresLoginHistory) KnownCountry(ctx context.Context, userID uuid.UUID, country string) (bool, error) {
+	var count int64
+	err := p.db.WithContext(ctx).Model(&models.LoginEvent{}).
+		Where("user_id = ? AND country = ? AND success", userID, country).Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteAll removes the whole history of the user.
+func (p *postgresLoginHistory) DeleteAll(ctx context.Context, userID uuid.UUID) error {
+	return p.db.WithContext(ctx).Delete(&models.LoginEvent{}, "user_id = ?", userID).Error
+}
+
+// DeleteBefore removes attempts made before the given time.
+func (p *postgresLoginHistory) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := p.db.WithContext(ctx).Delete(&models.LoginEvent{}, "created_at < ?", before)
+	return result.RowsAffected, result.Error
+}
+
+// memoryLoginHistory implements LoginHistory in memory, for tests and local development.
+type memoryLoginHistory struct {
+	mu     sync.Mutex
+	events map[uuid.UUID][]models.LoginEvent
+}
+
+// NewMemoryLoginHistory creates an in-memory LoginHistory.
+func NewMemoryLoginHistory() LoginHistory {
+	return &memoryLoginHistory{
+		events: make(map[uuid.UUID][]models.LoginEvent),
+	}
+}
+
+// Add records a login attempt.
+func (m *memoryLoginHistory) Add(ctx context.Context, event *models.LoginEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	// Events arrive in order, so prepending keeps the newest first
+	m.events[event.UserID] = append([]models.LoginEvent{*event}, m.events[event.UserID]...)
+	return nil
+}
+
+// List returns the user's login attempts, newest first.
+func (m *memoryLoginHistory) List(ctx context.Context, userID uuid.UUID, limit int) ([]models.LoginEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.events[userID]
+	if limit >= 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return append([]models.LoginEvent(nil), events...), nil
+}
+
+// KnownDevice reports whether the user has logged in successfully from the device before.
+func (m *memoryLoginHistory) KnownDevice(ctx context.Context, userID uuid.UUID, deviceHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range m.events[userID] {
+		if event.Success && event.DeviceHash == deviceHash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LastSuccess returns the user's most recent successful login.
+func (m *memoryLoginHistory) LastSuccess(ctx context.Context, userID uuid.UUID) (*models.LoginEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range m.events[userID] {
+		if event.Success {
+			return &event, nil
+		}
+	}
+	return nil, nil
+}
+
+// KnownCountry reports whether the user has logged in successfully from the country before.
+func (m *memoryLoginHistory) KnownCountry(ctx context.Context, userID uuid.UUID, country string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range m.events[userID] {
+		if event.Success && event.Country == country {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteAll removes the whole history of the user.
+func (m *memoryLoginHistory) DeleteAll(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.events, userID)
+	return nil
+}
+
+// DeleteBefore removes attempts made before the given time.
+func (m *memoryLoginHistory) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for userID, events := range m.events {
+		kept := events[:0]
+		for _, event := range events {
+			if event.CreatedAt.Before(before) {
+				deleted++
+				continue
+			}
+			kept = append(kept, event)
+		}
+		m.events[userID] = kept
+	}
+	return deleted, nil
+}
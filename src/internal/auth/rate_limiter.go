@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// RateLimiter counts actions per key in fixed windows, so that actions such as sending mail to an
+// address cannot be repeated without bound.
+type RateLimiter interface {
+	// Allow records an action for the key and reports whether it is within limit actions in the
+	// window that started with the first of them.
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error)
+	// Reset forgets the actions recorded for the key, starting a new window with the next one.
+	Reset(ctx context.Context, key string) error
+}
+
+// redisRateLimiter implements RateLimiter with Redis, one counter per key that expires with its window.
+type redisRateLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisRateLimiter creates a RateLimiter backed by Redis, shared by every replica.
+func NewRedisRateLimiter(client *redis.Client) RateLimiter {
+	return &redisRateLimiter{
+		client: client,
+	}
+}
+
+func rateLimitKey(key string) string {
+	return "rate_limit:" + key
+}
+
+// countActionScript increments the counter and starts its window on the first action.
+var countActionScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// Allow records an action for the key and reports whether it is within the limit.
+func (r *redisRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	count, err := countActionScript.Run(ctx, r.client, []string{rateLimitKey(key)}, window.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return count <= limit, nil
+}
+
+// Reset forgets the actions recorded for the key.
+func (r *redisRateLimiter) Reset(ctx context.Context, key string) error {
+	return r.client.Del(ctx, rateLimitKey(key)).Err()
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryRateLimitWindow struct {
+	count     int
+	expiresAt time.Time
+}
+
+// memoryRateLimiter implements RateLimiter in memory, for tests and local development.
+type memoryRateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*memoryRateLimitWindow
+}
+
+// NewMemoryRateLimiter creates an in-memory RateLimiter.
+func NewMemoryRateLimiter() RateLimiter {
+	return &memoryRateLimiter{
+		windows: make(map[string]*memoryRateLimitWindow),
+	}
+}
+
+// Allow records an action for the key and reports whether it is within the limit.
+func (m *memoryRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	current, ok := m.windows[key]
+	if !ok || now.After(current.expiresAt) {
+		current = &memoryRateLimitWindow{expiresAt: now.Add(window)}
+		m.windows[key] = current
+	}
+	current.count++
+	return current.count <= limit, nil
+}
+
+// Reset forgets the actions recorded for the key.
+func (m *memoryRateLimiter) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.windows, key)
+	return nil
+}
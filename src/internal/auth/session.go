@@ -1,27 +1,333 @@
 package auth
 
 import (
+	"authentication/src/config"
+	"authentication/src/internal/dto"
+	"authentication/src/internal/errs"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	redisstore "github.com/gofiber/storage/redis"
+	"github.com/google/uuid"
+	"log"
+	"net"
+	"strconv"
 	"time"
 )
 
-var store *session.Store
+// Session binding modes.
+const (
+	// SessionBindingOff ignores which client uses a session
+	SessionBindingOff = "off"
+	// SessionBindingWarn logs sessions used from another client
+	SessionBindingWarn = "warn"
+	// SessionBindingEnforce ends sessions used from another client
+	SessionBindingEnforce = "enforce"
+)
+
+// Strategies for logins over the concurrent session limit.
+const (
+	// SessionLimitReject refuses the new login
+	SessionLimitReject = "reject"
+	// SessionLimitEvictOldest ends the oldest sessions to make room for the new one
+	SessionLimitEvictOldest = "evict_oldest"
+)
+
+// Session keys tracking the authentication, lifetime and binding of authenticated sessions.
+const (
+	sessionKeyAuthTime      = "authTime"
+	sessionKeyAMR           = "amr"
+	sessionKeyCreatedAt     = "createdAt"
+	sessionKeyLastSeen      = "lastSeen"
+	sessionKeyRememberMe    = "rememberMe"
+	sessionKeyUserAgentHash = "userAgentHash"
+	sessionKeyIPPrefix      = "ipPrefix"
+)
+
+// sessionCookieName is the cookie holding the session ID.
+const sessionCookieName = "session_id"
+
+// sessionTouchInterval is how often the last activity of a session is written back to storage.
+const sessionTouchInterval = time.Minute
+
+// SessionPolicy holds the lifetime and binding rules of authenticated sessions.
+type SessionPolicy struct {
+	// IdleTimeout ends sessions that were not used for this long.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout ends sessions this long after login, however active they are.
+	AbsoluteTimeout time.Duration
+	// RememberMeIdleTimeout and RememberMeAbsoluteTimeout apply to logins with "remember me".
+	RememberMeIdleTimeout     time.Duration
+	RememberMeAbsoluteTimeout time.Duration
+
+	// Binding is one of the SessionBinding modes.
+	Binding          string
+	BindUserAgent    bool
+	BindIPPrefix     bool
+	IPv4PrefixLength int
+	IPv6PrefixLength int
+
+	// MaxConcurrent limits the sessions a user can have at the same time; 0 means no limit.
+	MaxConcurrent int
+	// MaxConcurrentByRole overrides MaxConcurrent for users with the role.
+	MaxConcurrentByRole map[string]int
+	// LimitStrategy is one of the SessionLimit strategies.
+	LimitStrategy string
+}
+
+// DefaultSessionPolicy returns the policy used when none is configured.
+func DefaultSessionPolicy() SessionPolicy {
+	return SessionPolicy{
+		IdleTimeout:               30 * time.Minute,
+		AbsoluteTimeout:           24 * time.Hour,
+		RememberMeIdleTimeout:     7 * 24 * time.Hour,
+		RememberMeAbsoluteTimeout: 30 * 24 * time.Hour,
+		Binding:                   SessionBindingOff,
+		BindUserAgent:             true,
+		BindIPPrefix:              true,
+		IPv4PrefixLength:          24,
+		IPv6PrefixLength:          64,
+		LimitStrategy:             SessionLimitReject,
+	}
+}
+
+// NewSessionPolicyFromConfig creates a SessionPolicy from the session configuration.
+func NewSessionPolicyFromConfig(cfg config.SessionConfig) SessionPolicy {
+	return SessionPolicy{
+		IdleTimeout:               time.Duration(cfg.IdleTimeoutMinutes) * time.Minute,
+		AbsoluteTimeout:           time.Duration(cfg.AbsoluteTimeoutHours) * time.Hour,
+		RememberMeIdleTimeout:     time.Duration(cfg.RememberMeIdleTimeoutHours) * time.Hour,
+		RememberMeAbsoluteTimeout: time.Duration(cfg.RememberMeAbsoluteTimeoutDays) * 24 * time.Hour,
+		Binding:                   cfg.Binding,
+		BindUserAgent:             cfg.BindUserAgent,
+		BindIPPrefix:              cfg.BindIPPrefix,
+		IPv4PrefixLength:          cfg.IPv4PrefixLength,
+		IPv6PrefixLength:          cfg.IPv6PrefixLength,
+		MaxConcurrent:             cfg.MaxConcurrent,
+		MaxConcurrentByRole:       cfg.MaxConcurrentByRole,
+		LimitStrategy:             cfg.LimitStrategy,
+	}
+}
+
+// withDefaultTimeouts replaces timeouts that are not positive with the default ones, which would
+// otherwise end every session as soon as it is used.
+func (p SessionPolicy) withDefaultTimeouts() SessionPolicy {
+	defaults := DefaultSessionPolicy()
+	timeouts := []struct {
+		name     string
+		value    *time.Duration
+		fallback time.Duration
+	}{
+		{"idle timeout", &p.IdleTimeout, defaults.IdleTimeout},
+		{"absolute timeout", &p.AbsoluteTimeout, defaults.AbsoluteTimeout},
+		{"remember me idle timeout", &p.RememberMeIdleTimeout, defaults.RememberMeIdleTimeout},
+		{"remember me absolute timeout", &p.RememberMeAbsoluteTimeout, defaults.RememberMeAbsoluteTimeout},
+	}
+	for _, timeout := range timeouts {
+		if *timeout.value <= 0 {
+			log.Printf("Session %s %s is not positive, using %s", timeout.name, *timeout.value, timeout.fallback)
+			*timeout.value = timeout.fallback
+		}
+	}
+	return p
+}
+
+// timeouts returns the idle and absolute timeout of a session.
+func (p SessionPolicy) timeouts(rememberMe bool) (time.Duration, time.Duration) {
+	if rememberMe {
+		return p.RememberMeIdleTimeout, p.RememberMeAbsoluteTimeout
+	}
+	return p.IdleTimeout, p.AbsoluteTimeout
+}
+
+// sessionLimit returns how many sessions a user with the role can have at the same time, or 0 for no limit.
+func (p SessionPolicy) sessionLimit(role string) int {
+	if limit, ok := p.MaxConcurrentByRole[role]; ok {
+		return limit
+	}
+	return p.MaxConcurrent
+}
 
-func InitSessionStore() {
-	redis := redisstore.New(redisstore.Config{
-		Host:     "localhost",
-		Port:     6379,
-		Password: "",
-		Database: 0,
+// ipPrefix returns the network of the configured size the IP address belongs to, or "" if it is not an address.
+func (p SessionPolicy) ipPrefix(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	mask := net.CIDRMask(p.IPv6PrefixLength, 128)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, net.CIDRMask(p.IPv4PrefixLength, 32)
+	}
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// NewRedisSessionStorage creates the Redis-backed session storage from configuration values.
+func NewRedisSessionStorage() fiber.Storage {
+	cfg := config.GetRedisConfig()
+	port, err := strconv.Atoi(cfg.Port)
+	if err != nil {
+		port = 6379 // Default Redis port if conversion fails
+	}
+	return redisstore.New(redisstore.Config{
+		Host:     cfg.Host,
+		Port:     port,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Database: cfg.Database,
 		Reset:    false,
 	})
+}
 
-	store = session.New(session.Config{
-		Storage:        redis,
-		Expiration:     24 * time.Hour,
+// SessionStore keeps the sessions of the API on top of a storage and applies the policy they follow.
+type SessionStore struct {
+	*session.Store
+	policy SessionPolicy
+}
+
+// NewSessionStore creates a session store on top of the given storage. Timeouts of the policy that
+// are not positive are replaced with the default ones.
+func NewSessionStore(storage fiber.Storage, policy SessionPolicy) *SessionStore {
+	policy = policy.withDefaultTimeouts()
+	store := session.New(session.Config{
+		Storage: storage,
+		// Authenticated sessions set their own expiry; this covers sessions before login
+		Expiration:     policy.IdleTimeout,
+		KeyLookup:      "cookie:" + sessionCookieName,
 		CookieSecure:   true,
 		CookieHTTPOnly: true,
 		CookieSameSite: "Lax",
 	})
+	store.RegisterType(uuid.UUID{})
+	store.RegisterType([]string{})
+	return &SessionStore{Store: store, policy: policy}
+}
+
+// sessionAuthentication returns when and how the session was last authenticated. The time is zero
+// for sessions that never recorded it.
+func sessionAuthentication(sess *session.Session) (time.Time, []string) {
+	authTime, ok := sess.Get(sessionKeyAuthTime).(int64)
+	if !ok {
+		return time.Time{}, nil
+	}
+	amr, _ := sess.Get(sessionKeyAMR).([]string)
+	return time.Unix(authTime, 0), amr
+}
+
+// bindSession records the start, lifetime and client of a session that is being authenticated.
+func (s *SessionStore) bindSession(sess *session.Session, client dto.ClientInfo, rememberMe bool, now time.Time) {
+	sess.Set(sessionKeyCreatedAt, now.Unix())
+	sess.Set(sessionKeyLastSeen, now.Unix())
+	sess.Set(sessionKeyRememberMe, rememberMe)
+	// Both are recorded even with binding off, so turning it on covers existing sessions
+	sess.Set(sessionKeyUserAgentHash, hashUserAgent(client.UserAgent))
+	sess.Set(sessionKeyIPPrefix, s.policy.ipPrefix(client.IP))
+	s.setSessionExpiry(sess, now)
+}
+
+// sessionCreatedAt returns when the session was authenticated by logging in.
+func sessionCreatedAt(sess *session.Session) time.Time {
+	createdAt, _ := sess.Get(sessionKeyCreatedAt).(int64)
+	return time.Unix(createdAt, 0)
+}
+
+// upgradeLegacySession records the start, last activity and client of an authenticated session
+// from before they were tracked, so it is not logged out but follows the policy from now on. The
+// session starts at its last authentication, when known. It reports whether the session changed
+// and must be saved.
+func (s *SessionStore) upgradeLegacySession(sess *session.Session, client dto.ClientInfo, now time.Time) bool {
+	_, okCreated := sess.Get(sessionKeyCreatedAt).(int64)
+	_, okLastSeen := sess.Get(sessionKeyLastSeen).(int64)
+	if okCreated && okLastSeen {
+		return false
+	}
+
+	createdAt := now
+	if authTime, _ := sessionAuthentication(sess); !authTime.IsZero() && authTime.Before(now) {
+		createdAt = authTime
+	}
+	if !okCreated {
+		sess.Set(sessionKeyCreatedAt, createdAt.Unix())
+	}
+	if !okLastSeen {
+		sess.Set(sessionKeyLastSeen, now.Unix())
+	}
+	if _, ok := sess.Get(sessionKeyUserAgentHash).(string); !ok {
+		sess.Set(sessionKeyUserAgentHash, hashUserAgent(client.UserAgent))
+	}
+	if _, ok := sess.Get(sessionKeyIPPrefix).(string); !ok {
+		sess.Set(sessionKeyIPPrefix, s.policy.ipPrefix(client.IP))
+	}
+	s.setSessionExpiry(sess, now)
+	return true
+}
+
+// checkSession verifies that an authenticated session has not timed out and is still used from the
+// client it is bound to. Sessions from before their start was recorded must be upgraded first.
+func (s *SessionStore) checkSession(sess *session.Session, client dto.ClientInfo, now time.Time) error {
+	createdAt, okCreated := sess.Get(sessionKeyCreatedAt).(int64)
+	lastSeen, okLastSeen := sess.Get(sessionKeyLastSeen).(int64)
+	rememberMe, _ := sess.Get(sessionKeyRememberMe).(bool)
+	if !okCreated || !okLastSeen {
+		return errs.ErrSessionExpired
+	}
+
+	idleTimeout, absoluteTimeout := s.policy.timeouts(rememberMe)
+	if now.Sub(time.Unix(lastSeen, 0)) > idleTimeout || now.Sub(time.Unix(createdAt, 0)) > absoluteTimeout {
+		return errs.ErrSessionExpired
+	}
+
+	if s.policy.Binding == SessionBindingOff || s.policy.Binding == "" {
+		return nil
+	}
+	mismatch := ""
+	if userAgentHash, _ := sess.Get(sessionKeyUserAgentHash).(string); s.policy.BindUserAgent && userAgentHash != hashUserAgent(client.UserAgent) {
+		mismatch = "user agent"
+	}
+	if ipPrefix, _ := sess.Get(sessionKeyIPPrefix).(string); s.policy.BindIPPrefix && ipPrefix != s.policy.ipPrefix(client.IP) {
+		mismatch = "IP address"
+	}
+	if mismatch == "" {
+		return nil
+	}
+
+	if s.policy.Binding == SessionBindingWarn {
+		log.Printf("Session used from a different %s (%s)", mismatch, client.IP)
+		return nil
+	}
+	return errs.ErrSessionBindingMismatch
+}
+
+// touchSession records activity on an authenticated session, at most once per sessionTouchInterval.
+// It reports whether it saved, and so released, the session.
+func (s *SessionStore) touchSession(sess *session.Session, now time.Time) (bool, error) {
+	lastSeen, _ := sess.Get(sessionKeyLastSeen).(int64)
+	if now.Sub(time.Unix(lastSeen, 0)) < sessionTouchInterval {
+		return false, nil
+	}
+
+	sess.Set(sessionKeyLastSeen, now.Unix())
+	s.setSessionExpiry(sess, now)
+	return true, sess.Save()
+}
+
+// setSessionExpiry keeps the session in storage until it would time out.
+func (s *SessionStore) setSessionExpiry(sess *session.Session, now time.Time) {
+	rememberMe, _ := sess.Get(sessionKeyRememberMe).(bool)
+	idleTimeout, absoluteTimeout := s.policy.timeouts(rememberMe)
+
+	expiry := idleTimeout
+	if remaining := sessionCreatedAt(sess).Add(absoluteTimeout).Sub(now); remaining < expiry {
+		expiry = remaining
+	}
+	if expiry < time.Second {
+		expiry = time.Second
+	}
+	sess.SetExpiry(expiry)
+}
+
+// hashUserAgent hashes a user agent so sessions do not store it in full
+func hashUserAgent(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:])
 }
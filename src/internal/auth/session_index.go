@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"authentication/src/internal/errs"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// SessionRecord describes a session belonging to a user.
+type SessionRecord struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SessionIndex keeps track of which sessions belong to which user, so that they
+// can be listed and revoked without scanning the session storage.
+type SessionIndex interface {
+	// Add records a session for the user.
+	Add(ctx context.Context, userID uuid.UUID, sessionID string, createdAt time.Time) error
+	// AddWithinLimit records a new session for the user unless they already have limit sessions.
+	// With evictOldest the oldest sessions are forgotten to make room and their IDs returned,
+	// otherwise errs.ErrTooManySessions is returned. Counting and adding happen atomically, and
+	// the new session is ordered after every existing one.
+	AddWithinLimit(ctx context.Context, userID uuid.UUID, sessionID string, createdAt time.Time, limit int, evictOldest bool) ([]string, error)
+	// Remove forgets a single session of the user.
+	Remove(ctx context.Context, userID uuid.UUID, sessionID string) error
+	// List returns the user's sessions, oldest first.
+	List(ctx context.Context, userID uuid.UUID) ([]SessionRecord, error)
+}
+
+// redisSessionIndex implements SessionIndex with one sorted set per user, scored by creation time
+// in milliseconds.
+type redisSessionIndex struct {
+	client *redis.Client
+}
+
+// NewRedisSessionIndex creates a SessionIndex backed by Redis.
+func NewRedisSessionIndex(client *redis.Client) SessionIndex {
+	return &redisSessionIndex{
+		client: client,
+	}
+}
+
+func sessionIndexKey(userID uuid.UUID) string {
+	return fmt.Sprintf("user_sessions:%s", userID)
+}
+
+// Add records a session for the user.
+func (r *redisSessionIndex) Add(ctx context.Context, userID uuid.UUID, sessionID string, createdAt time.Time) error {
+	return r.client.ZAdd(ctx, sessionIndexKey(userID), redis.Z{
+		Score:  float64(createdAt.UnixMilli()),
+		Member: sessionID,
+	}).Err()
+}
+
+// addWithinLimitScript adds a session to the user's sorted set if it holds fewer than ARGV[3]
+// sessions, or evicts the oldest ones to make room when ARGV[4] is 1. A session that started in
+// the same millisecond as the newest one is scored just after it. It returns the evicted IDs, or
+// false when the limit is reached.
+var addWithinLimitScript = redis.NewScript(`
+local count = redis.call('ZCARD', KEYS[1])
+local limit = tonumber(ARGV[3])
+if count >= limit and ARGV[4] ~= '1' then
+	return false
+end
+local score = tonumber(ARGV[2])
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if newest[2] and tonumber(newest[2]) >= score then
+	score = tonumber(newest[2]) + 1
+end
+local evicted = {}
+if count >= limit then
+	evicted = redis.call('ZRANGE', KEYS[1], 0, count - limit)
+	redis.call('ZREMRANGEBYRANK', KEYS[1], 0, count - limit)
+end
+redis.call('ZADD', KEYS[1], score, ARGV[1])
+return evicted
+`)
+
+// AddWithinLimit records a new session for the user if they have room for it.
+func (r *redisSessionIndex) AddWithinLimit(ctx context.Context, userID uuid.UUID, sessionID string, createdAt time.Time, limit int, evictOldest bool) ([]string, error) {
+	evict := "0"
+	if evictOldest {
+		evict = "1"
+	}
+	evicted, err := addWithinLimitScript.Run(ctx, r.client, []string{sessionIndexKey(userID)},
+		sessionID, createdAt.UnixMilli(), limit, evict).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return nil, errs.ErrTooManySessions
+	}
+	return evicted, err
+}
+
+// Remove forgets a single session of the user.
+func (r *redisSessionIndex) Remove(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	return r.client.ZRem(ctx, sessionIndexKey(userID), sessionID).Err()
+}
+
+// List returns the user's sessions, oldest first.
+func (r *redisSessionIndex) List(ctx context.Context, userID uuid.UUID) ([]SessionRecord, error) {
+	entries, err := r.client.ZRangeWithScores(ctx, sessionIndexKey(userID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]SessionRecord, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := entry.Member.(string)
+		if !ok {
+			continue
+		}
+		records = append(records, SessionRecord{
+			ID:        id,
+			CreatedAt: time.UnixMilli(int64(entry.Score)).UTC(),
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"authentication/src/internal/errs"
+	"context"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memorySessionIndex implements SessionIndex in memory, for tests and local development.
+type memorySessionIndex struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]map[string]time.Time
+}
+
+// NewMemorySessionIndex creates an in-memory SessionIndex.
+func NewMemorySessionIndex() SessionIndex {
+	return &memorySessionIndex{
+		sessions: make(map[uuid.UUID]map[string]time.Time),
+	}
+}
+
+// Add records a session for the user.
+func (m *memorySessionIndex) Add(ctx context.Context, userID uuid.UUID, sessionID string, createdAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions[userID] == nil {
+		m.sessions[userID] = make(map[string]time.Time)
+	}
+	m.sessions[userID][sessionID] = createdAt.Truncate(time.Millisecond).UTC()
+	return nil
+}
+
+// AddWithinLimit records a new session for the user if they have room for it.
+func (m *memorySessionIndex) AddWithinLimit(ctx context.Context, userID uuid.UUID, sessionID string, createdAt time.Time, limit int, evictOldest bool) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := m.sortedRecords(userID)
+	if len(records) >= limit && !evictOldest {
+		return nil, errs.ErrTooManySessions
+	}
+
+	createdAt = createdAt.Truncate(time.Millisecond).UTC()
+	if len(records) > 0 {
+		if newest := records[len(records)-1].CreatedAt; !createdAt.After(newest) {
+			createdAt = newest.Add(time.Millisecond)
+		}
+	}
+
+	var evicted []string
+	if excess := len(records) - limit + 1; excess > 0 {
+		for _, record := range records[:excess] {
+			delete(m.sessions[userID], record.ID)
+			evicted = append(evicted, record.ID)
+		}
+	}
+	if m.sessions[userID] == nil {
+		m.sessions[userID] = make(map[string]time.Time)
+	}
+	m.sessions[userID][sessionID] = createdAt
+	return evicted, nil
+}
+
+// Remove forgets a single session of the user.
+func (m *memorySessionIndex) Remove(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions[userID], sessionID)
+	return nil
+}
+
+// List returns the user's sessions, oldest first.
+func (m *memorySessionIndex) List(ctx context.Context, userID uuid.UUID) ([]SessionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sortedRecords(userID), nil
+}
+
+// sortedRecords returns the user's sessions, oldest first. The caller must hold the lock.
+func (m *memorySessionIndex) sortedRecords(userID uuid.UUID) []SessionRecord {
+	records := make([]SessionRecord, 0, len(m.sessions[userID]))
+	for id, createdAt := range m.sessions[userID] {
+		records = append(records, SessionRecord{ID: id, CreatedAt: createdAt})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].ID < records[j].ID
+		}
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+	return records
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// memoryStorage implements fiber.Storage in memory, for tests and local development.
+type memoryStorage struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemorySessionStorage creates an in-memory session storage.
+func NewMemorySessionStorage() fiber.Storage {
+	return &memoryStorage{
+		entries: make(map[string]memoryEntry),
+	}
+}
+
+// Get returns the value for the key, or nil if it does not exist or has expired.
+func (m *memoryStorage) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil, nil
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+// Set stores the value for the key, expiring after exp unless exp is 0.
+func (m *memoryStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := memoryEntry{value: append([]byte(nil), val...)}
+	if exp > 0 {
+		entry.expiresAt = time.Now().Add(exp)
+	}
+	m.entries[key] = entry
+	return nil
+}
+
+// Delete removes the key.
+func (m *memoryStorage) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// Reset removes every key.
+func (m *memoryStorage) Reset() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = make(map[string]memoryEntry)
+	return nil
+}
+
+// Close is a no-op for the in-memory storage.
+func (m *memoryStorage) Close() error {
+	return nil
+}
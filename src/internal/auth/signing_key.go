@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// minRSAKeyBits is the smallest RSA key access tokens are signed with.
+const minRSAKeyBits = 2048
+
+// SigningKey is an asymmetric key access tokens are signed with, so that other services can verify
+// them with the public key published at /.well-known/jwks.json instead of sharing the token secret.
+type SigningKey struct {
+	// KeyID identifies the key in the "kid" header of tokens and in the JWKS.
+	KeyID  string
+	signer crypto.Signer
+	method jwt.SigningMethod
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv and X are the curve and public key of Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is a set of public keys in JSON Web Key format.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewSigningKey creates a SigningKey from an RSA (RS256) or Ed25519 (EdDSA) private key. Without a
+// key ID the RFC 7638 thumbprint of the public key is used.
+func NewSigningKey(signer crypto.Signer, keyID string) (*SigningKey, error) {
+	key := &SigningKey{KeyID: keyID, signer: signer}
+	switch private := signer.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA signing key has %d bits, at least %d are required", private.N.BitLen(), minRSAKeyBits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T, use RSA or Ed25519", signer)
+	}
+
+	if key.KeyID == "" {
+		thumbprint, err := key.thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		key.KeyID = thumbprint
+	}
+	return key, nil
+}
+
+// GenerateSigningKey creates a new Ed25519 signing key identified by its thumbprint.
+func GenerateSigningKey() (*SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigningKey(private, "")
+}
+
+// LoadSigningKey reads a PEM-encoded PKCS #8 or PKCS #1 private key from path.
+func LoadSigningKey(path, keyID string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	var private interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key in %s: %w", path, err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key in %s", path)
+	}
+	return NewSigningKey(signer, keyID)
+}
+
+// LoadSigningKeys reads the private keys of entries that are a path, or a key ID and path like
+// "2024-key=/etc/auth/old.pem".
+func LoadSigningKeys(entries []string) ([]*SigningKey, error) {
+	keys := make([]*SigningKey, 0, len(entries))
+	for _, entry := range entries {
+		keyID, path, found := strings.Cut(entry, "=")
+		if !found {
+			keyID, path = "", entry
+		}
+		key, err := LoadSigningKey(path, keyID)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// JWK returns the public key in JSON Web Key format.
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{Use: "sig", Alg: k.method.Alg(), Kid: k.KeyID}
+	switch public := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the public key.
+func (k *SigningKey) thumbprint() (string, error) {
+	jwk := k.JWK()
+	// The required members in lexicographic order
+	members := map[string]string{"kty": jwk.Kty}
+	if jwk.Kty == "RSA" {
+		members["e"], members["n"] = jwk.E, jwk.N
+	} else {
+		members["crv"], members["x"] = jwk.Crv, jwk.X
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKSHandler serves the public keys access tokens can be verified with. The set is empty when
+// access tokens are signed with the shared secret.
+func JWKSHandler(ts TokenService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.Status(fiber.StatusOK).JSON(ts.JWKS())
+	}
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// StoredSigningKey is a signing key kept by a SigningKeyStore.
+type StoredSigningKey struct {
+	Key       *SigningKey
+	CreatedAt time.Time
+}
+
+// SigningKeyStore keeps generated access token signing keys while they are rotated. The newest key
+// signs access tokens; the older ones stay valid until the rotation job removes them.
+type SigningKeyStore interface {
+	// Add stores a new key, which becomes the newest one.
+	Add(ctx context.Context, key *SigningKey) error
+	// List returns the stored keys, newest first.
+	List(ctx context.Context) ([]StoredSigningKey, error)
+	// Delete removes the key with the ID.
+	Delete(ctx context.Context, keyID string) error
+}
+
+// EnsureSigningKey returns the newest key of the store, generating and adding one when the store is empty.
+func EnsureSigningKey(ctx context.Context, store SigningKeyStore) (*SigningKey, error) {
+	keys, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return keys[0].Key, nil
+	}
+	key, err := GenerateSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Add(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// postgresSigningKeyStore implements SigningKeyStore with the signing_keys table.
+type postgresSigningKeyStore struct {
+	db   *gorm.DB
+	aead cipher.AEAD
+}
+
+// NewPostgresSigningKeyStore creates a SigningKeyStore backed by Postgres. Private keys are encrypted
+// with a key derived from secret, the token secret, so read access to the database does not reveal them.
+func NewPostgresSigningKeyStore(db *gorm.DB, secret string) (SigningKeyStore, error) {
+	encryptionKey := sha256.Sum256([]byte("signing-keys\x00" + secret))
+	block, err := aes.NewCipher(encryptionKey[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresSigningKeyStore{
+		db:   db,
+		aead: aead,
+	}, nil
+}
+
+// Add encrypts and stores the key.
+func (p *postgresSigningKeyStore) Add(ctx context.Context, key *SigningKey) error {
+	private, err := x509.MarshalPKCS8PrivateKey(key.signer)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// The key ID is authenticated with the key, so a row cannot be passed off under another ID
+	record := &models.SigningKey{
+		ID:         key.KeyID,
+		PrivateKey: p.aead.Seal(nonce, nonce, private, []byte(key.KeyID)),
+		CreatedAt:  time.Now(),
+	}
+	return p.db.WithContext(ctx).Create(record).Error
+}
+
+// List decrypts the stored keys, newest first.
+func (p *postgresSigningKeyStore) List(ctx context.Context) ([]StoredSigningKey, error) {
+	var records []models.SigningKey
+	if err := p.db.WithContext(ctx).Order("created_at DESC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]StoredSigningKey, 0, len(records))
+	for _, record := range records {
+		key, err := p.decrypt(record)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", record.ID, err)
+		}
+		keys = append(keys, StoredSigningKey{Key: key, CreatedAt: record.CreatedAt})
+	}
+	return keys, nil
+}
+
+// Delete removes the key with the ID.
+func (p *postgresSigningKeyStore) Delete(ctx context.Context, keyID string) error {
+	return p.db.WithContext(ctx).Delete(&models.SigningKey{}, "id = ?", keyID).Error
+}
+
+// decrypt restores the signing key of a record.
+func (p *postgresSigningKeyStore) decrypt(record models.SigningKey) (*SigningKey, error) {
+	nonceSize := p.aead.NonceSize()
+	if len(record.PrivateKey) < nonceSize {
+		return nil, fmt.Errorf("encrypted private key is too short")
+	}
+	nonce, sealed := record.PrivateKey[:nonceSize], record.PrivateKey[nonceSize:]
+	private, err := p.aead.Open(nil, nonce, sealed, []byte(record.ID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting private key, TOKEN_SECRET may have changed: %w", err)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", parsed)
+	}
+	return NewSigningKey(signer, record.ID)
+}
+
+// memorySigningKeyStore implements SigningKeyStore in memory, for tests and local development.
+type memorySigningKeyStore struct {
+	mu   sync.Mutex
+	keys []StoredSigningKey
+}
+
+// NewMemorySigningKeyStore creates an in-memory SigningKeyStore.
+func NewMemorySigningKeyStore() SigningKeyStore {
+	return &memorySigningKeyStore{}
+}
+
+// Add stores the key.
+func (m *memorySigningKeyStore) Add(ctx context.Context, key *SigningKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.keys {
+		if stored.Key.KeyID == key.KeyID {
+			return fmt.Errorf("signing key %s already exists", key.KeyID)
+		}
+	}
+	m.keys = append(m.keys, StoredSigningKey{Key: key, CreatedAt: time.Now()})
+	return nil
+}
+
+// List returns the stored keys, newest first.
+func (m *memorySigningKeyStore) List(ctx context.Context) ([]StoredSigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Keys are added in order, so the newest is last
+	keys := make([]StoredSigningKey, 0, len(m.keys))
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		keys = append(keys, m.keys[i])
+	}
+	return keys, nil
+}
+
+// Delete removes the key with the ID.
+func (m *memorySigningKeyStore) Delete(ctx context.Context, keyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.keys[:0]
+	for _, stored := range m.keys {
+		if stored.Key.KeyID != keyID {
+			kept = append(kept, stored)
+		}
+	}
+	m.keys = kept
+	return nil
+}
@@ -1,36 +1,178 @@
 package auth
 
 import (
-	"authentication/src/internal/db"
 	"authentication/src/internal/errs"
 	"authentication/src/internal/models"
+	"authentication/src/utils"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/redis/go-redis/v9"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
 	"time"
 )
 
 type TokenService interface {
 	GenerateToken(ctx context.Context, userID uuid.UUID, purpose string, expiry time.Duration) (string, error)
 	ValidateToken(ctx context.Context, token, expectedPurpose string) (*models.CustomClaims, error)
+	// InspectToken checks a token like ValidateToken but leaves it redeemable.
+	InspectToken(ctx context.Context, token, expectedPurpose string) (*models.CustomClaims, error)
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID) error
+	// GenerateAccessToken issues a signed access token for the user with the scopes that is valid for expiry.
+	GenerateAccessToken(user *models.User, scopes []string, expiry time.Duration) (string, error)
+	// ParseAccessToken checks the signature, issuer, audience, purpose and expiry of an access token
+	// and returns its claims. Tokens signed with a previous signing key are accepted too.
+	ParseAccessToken(token string) (*models.AccessClaims, error)
+	// JWKS returns the public keys access tokens can be verified with, the signing key followed by
+	// the previous ones, which is none when they are signed with the shared secret.
+	JWKS() JWKSet
+	// GenerateCode issues a short numeric code bound to the email address, replacing any previous one.
+	GenerateCode(ctx context.Context, email, purpose string, expiry time.Duration) (string, error)
+	// ValidateCode checks and consumes a code issued for the email address.
+	ValidateCode(ctx context.Context, email, code, purpose string) error
+	// InspectCode checks a code like ValidateCode but leaves it redeemable. Wrong codes still
+	// count against the attempts allowed.
+	InspectCode(ctx context.Context, email, code, purpose string) error
+	// RevokeCode discards the code issued for the email address, if any.
+	RevokeCode(ctx context.Context, email, purpose string) error
+}
+
+// signingKeyReloadInterval is how long keys loaded from a SigningKeyStore are used before they are
+// loaded again, so every replica signs with a rotated key soon after it was added.
+const signingKeyReloadInterval = time.Minute
+
+// minSigningKeyReload is the shortest time between loads of a SigningKeyStore caused by tokens
+// signed with an unknown key, which anyone can send.
+const minSigningKeyReload = 5 * time.Second
+
+// signingKeyLoadTimeout bounds a load of a SigningKeyStore, which holds up the requests waiting for it.
+const signingKeyLoadTimeout = 5 * time.Second
+
+// MinTokenSecretLength is the length of the shortest token secret the service starts with.
+const MinTokenSecretLength = 32
+
+// ValidateTokenSecret checks the token secret, which signs one-time and access tokens and keys the
+// hashes of verification codes. A short or guessable secret lets tokens be forged and leaked code
+// hashes be brute-forced offline.
+func ValidateTokenSecret(secret string) error {
+	switch {
+	case secret == "":
+		return errors.New("the token secret is not set")
+	case len(secret) < MinTokenSecretLength:
+		return fmt.Errorf("the token secret must be at least %d characters long", MinTokenSecretLength)
+	}
+	return nil
+}
+
+// tokenHashPrefix marks stored values that are SHA-256 hashes rather than raw tokens.
+const tokenHashPrefix = "sha256:"
+
+// CodePolicy configures numeric verification codes.
+type CodePolicy struct {
+	// Length is the number of digits, between 6 and 8.
+	Length int
+	// MaxAttempts is the number of wrong guesses after which a code is discarded.
+	MaxAttempts int
 }
 
 type tokenService struct {
 	secretKey  string
-	redisStore *redis.Client
+	tokenStore TokenStore
+	codeStore  CodeStore
+	codePolicy CodePolicy
+
+	// signingKey signs access tokens instead of the secret key, when set
+	signingKey *SigningKey
+	// previousKeys were used to sign access tokens that may still be valid
+	previousKeys []*SigningKey
+	// issuer is the "iss" claim of access tokens, when set
+	issuer string
+	// audience is the "aud" claim of access tokens, when set
+	audience string
+
+	// keyStore holds rotated signing keys; its newest key replaces signingKey, when set
+	keyStore   SigningKeyStore
+	keysMu     sync.Mutex
+	storedKeys []*SigningKey
+	// lastKeyLoad is when the key store was last loaded, successfully or not
+	lastKeyLoad time.Time
+}
+
+// TokenServiceOption configures optional behaviour of the TokenService.
+type TokenServiceOption func(*tokenService)
+
+// WithSigningKey signs access tokens with an asymmetric key and publishes its public key, so other
+// services can verify them without the token secret. One-time tokens keep using the secret.
+func WithSigningKey(key *SigningKey) TokenServiceOption {
+	return func(t *tokenService) {
+		t.signingKey = key
+	}
+}
+
+// WithPreviousSigningKeys keeps accepting and publishing keys access tokens were signed with before
+// the current signing key, so tokens issued before a key rotation stay valid until they expire.
+func WithPreviousSigningKeys(keys []*SigningKey) TokenServiceOption {
+	return func(t *tokenService) {
+		t.previousKeys = keys
+	}
+}
+
+// WithSigningKeyStore signs access tokens with the newest key of the store, which the signing key
+// rotation job replaces, and keeps accepting and publishing the older keys it holds. Keys set with
+// WithSigningKey and WithPreviousSigningKeys stay valid next to them.
+func WithSigningKeyStore(store SigningKeyStore) TokenServiceOption {
+	return func(t *tokenService) {
+		t.keyStore = store
+	}
 }
 
-func NewTokenService(secretKey string) TokenService {
-	return &tokenService{
+// WithAudience sets the "aud" claim of access tokens and requires it when they are parsed.
+func WithAudience(audience string) TokenServiceOption {
+	return func(t *tokenService) {
+		t.audience = audience
+	}
+}
+
+// WithIssuer sets the "iss" claim of access tokens and requires it when they are parsed.
+func WithIssuer(issuer string) TokenServiceOption {
+	return func(t *tokenService) {
+		t.issuer = issuer
+	}
+}
+
+func NewTokenService(secretKey string, tokenStore TokenStore, codeStore CodeStore, codePolicy CodePolicy, opts ...TokenServiceOption) TokenService {
+	codePolicy.Length = min(max(codePolicy.Length, 6), 8)
+	if codePolicy.MaxAttempts <= 0 {
+		codePolicy.MaxAttempts = 5
+	}
+	t := &tokenService{
 		secretKey:  secretKey,
-		redisStore: db.GetRedisClient(),
+		tokenStore: tokenStore,
+		codeStore:  codeStore,
+		codePolicy: codePolicy,
+	}
+	for _, opt := range opts {
+		opt(t)
 	}
+	return t
 }
 
 func (t *tokenService) GenerateToken(ctx context.Context, userID uuid.UUID, purpose string, expiry time.Duration) (string, error) {
+	// A random token ID makes every token unique and unguessable, even when issued in the same second
+	tokenID, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
 	claims := models.CustomClaims{
 		UserID:  userID,
 		Purpose: purpose,
@@ -38,6 +180,7 @@ func (t *tokenService) GenerateToken(ctx context.Context, userID uuid.UUID, purp
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   purpose,
+			ID:        tokenID,
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -45,57 +188,284 @@ func (t *tokenService) GenerateToken(ctx context.Context, userID uuid.UUID, purp
 	if err != nil {
 		return "", err
 	}
-	//Delete any existing token for the user and purpose
-	existingToken := t.redisStore.Get(ctx, fmt.Sprintf("%s:%s", purpose, userID))
-	if existingToken != nil {
-		err = t.redisStore.Del(ctx, fmt.Sprintf("%s:%s", purpose, userID)).Err()
-		if err != nil && !errors.Is(err, redis.Nil) {
-			return "", err // Handle error if deletion fails
-		}
+	// Store only a hash of the token with an expiry, replacing any existing token for the user and purpose,
+	// so that read access to the store is not enough to redeem it
+	err = t.tokenStore.Store(ctx, userID, purpose, hashToken(signedToken), expiry)
+	if err != nil {
+		return "", err
 	}
-	// Store the token in Redis with an expiry
-	t.redisStore.Set(ctx, fmt.Sprintf("%s:%s", purpose, userID), signedToken, expiry)
 
 	return signedToken, nil
 }
 
 func (t *tokenService) ValidateToken(ctx context.Context, token, expectedPurpose string) (*models.CustomClaims, error) {
+	claims, storedValue, err := t.checkToken(ctx, token, expectedPurpose)
+	if err != nil {
+		return nil, err
+	}
+
+	// Atomically consume the stored token so that it cannot be redeemed twice
+	err = t.tokenStore.Consume(ctx, claims.UserID, expectedPurpose, storedValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (t *tokenService) InspectToken(ctx context.Context, token, expectedPurpose string) (*models.CustomClaims, error) {
+	claims, _, err := t.checkToken(ctx, token, expectedPurpose)
+	return claims, err
+}
+
+// checkToken verifies the token signature, purpose and stored value and returns its claims
+// together with the stored value needed to consume it.
+func (t *tokenService) checkToken(ctx context.Context, token, expectedPurpose string) (*models.CustomClaims, string, error) {
 	parsedToken, err := jwt.ParseWithClaims(token, &models.CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(t.secretKey), nil
 	})
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, errs.ErrTokenExpired
+			return nil, "", errs.ErrTokenExpired
 		}
 
-		return nil, err
+		return nil, "", fmt.Errorf("%w: %v", errs.ErrInvalidToken, err)
 	}
 
 	claims, ok := parsedToken.Claims.(*models.CustomClaims)
 	if !ok {
-		return nil, err
+		return nil, "", errs.ErrInvalidToken
 	}
 
-	expectedToken := t.redisStore.Get(ctx, fmt.Sprintf("%s:%s", expectedPurpose, claims.UserID))
+	if claims.Purpose != expectedPurpose {
+		return nil, "", errs.ErrInvalidTokenPurpose
+	}
 
-	if expectedToken == nil {
-		return nil, errs.ErrTokenNotFound
+	storedValue, err := t.tokenStore.Fetch(ctx, claims.UserID, expectedPurpose)
+	if err != nil {
+		return nil, "", err
 	}
 
-	if expectedToken.Val() != token {
-		return nil, errs.ErrInvalidToken
+	// Tokens issued before hashing was introduced are stored raw; accept them
+	// until they expire. This branch can be removed once no raw tokens remain.
+	presentedValue := hashToken(token)
+	if !strings.HasPrefix(storedValue, tokenHashPrefix) {
+		presentedValue = token
 	}
 
-	if claims.Purpose != expectedPurpose {
-		return nil, errs.ErrInvalidTokenPurpose
+	if subtle.ConstantTimeCompare([]byte(storedValue), []byte(presentedValue)) != 1 {
+		return nil, "", errs.ErrInvalidToken
+	}
+
+	return claims, storedValue, nil
+}
+
+func (t *tokenService) GenerateAccessToken(user *models.User, scopes []string, expiry time.Duration) (string, error) {
+	tokenID, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := models.AccessClaims{
+		UserID:  user.ID,
+		Purpose: PurposeAccess,
+		Email:   user.Email,
+		Roles:   []string{user.EffectiveRole()},
+		Scope:   strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Audience:  audienceClaim(t.audience),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   user.ID.String(),
+			ID:        tokenID,
+		},
 	}
 
-	// Delete the token from Redis after validation
-	err = t.redisStore.Del(ctx, fmt.Sprintf("%s:%s", expectedPurpose, claims.UserID)).Err()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return nil, errs.ErrRedisTokenDeletion
+	if signingKey, _ := t.signingKeys(false); signingKey != nil {
+		token := jwt.NewWithClaims(signingKey.method, claims)
+		token.Header["kid"] = signingKey.KeyID
+		return token.SignedString(signingKey.signer)
 	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(t.secretKey))
+}
 
+func (t *tokenService) ParseAccessToken(token string) (*models.AccessClaims, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		return []byte(t.secretKey), nil
+	}
+	options := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if signingKey, _ := t.signingKeys(false); signingKey != nil {
+		// The algorithm is checked against the key the token names
+		keyFunc = t.verificationKey
+	} else {
+		options = append(options, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	}
+	if t.issuer != "" {
+		options = append(options, jwt.WithIssuer(t.issuer))
+	}
+	if t.audience != "" {
+		options = append(options, jwt.WithAudience(t.audience))
+	}
+
+	parsedToken, err := jwt.ParseWithClaims(token, &models.AccessClaims{}, keyFunc, options...)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, errs.ErrTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %v", errs.ErrInvalidToken, err)
+	}
+
+	claims, ok := parsedToken.Claims.(*models.AccessClaims)
+	if !ok {
+		return nil, errs.ErrInvalidToken
+	}
+	// One-time tokens are signed with the same key, but must not authenticate requests
+	if claims.Purpose != PurposeAccess {
+		return nil, errs.ErrInvalidTokenPurpose
+	}
 	return claims, nil
 }
+
+// verificationKey returns the public key of the signing key or previous key named by the token's
+// "kid" header, after checking the token uses the algorithm of that key.
+func (t *tokenService) verificationKey(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	key := t.findSigningKey(keyID, false)
+	if key == nil && t.keyStore != nil {
+		// Another replica may have rotated the key since the keys were loaded
+		key = t.findSigningKey(keyID, true)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", keyID)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("token signed with %s, key %q uses %s", token.Method.Alg(), keyID, key.method.Alg())
+	}
+	return key.signer.Public(), nil
+}
+
+// findSigningKey returns the signing key or previous key with the ID, or nil if there is none.
+func (t *tokenService) findSigningKey(keyID string, reload bool) *SigningKey {
+	signingKey, previousKeys := t.signingKeys(reload)
+	if signingKey == nil {
+		return nil
+	}
+	for _, key := range append([]*SigningKey{signingKey}, previousKeys...) {
+		if key.KeyID == keyID {
+			return key
+		}
+	}
+	return nil
+}
+
+// signingKeys returns the key access tokens are signed with, nil for the secret, and the previous
+// keys that are still accepted. Keys of the key store are loaded again once they are older than
+// signingKeyReloadInterval, or on reload unless they were loaded less than minSigningKeyReload ago.
+// A failed load waits as long before the next attempt.
+func (t *tokenService) signingKeys(reload bool) (*SigningKey, []*SigningKey) {
+	if t.keyStore == nil {
+		return t.signingKey, t.previousKeys
+	}
+
+	t.keysMu.Lock()
+	defer t.keysMu.Unlock()
+
+	age := time.Since(t.lastKeyLoad)
+	if age >= signingKeyReloadInterval || (reload && age >= minSigningKeyReload) {
+		ctx, cancel := context.WithTimeout(context.Background(), signingKeyLoadTimeout)
+		stored, err := t.keyStore.List(ctx)
+		cancel()
+		// Failed loads count too, so an unreachable store is not asked on every request
+		t.lastKeyLoad = time.Now()
+		if err != nil {
+			// Keep using the keys loaded before
+			log.Printf("Error loading access token signing keys: %v", err)
+		} else {
+			keys := make([]*SigningKey, 0, len(stored))
+			for _, key := range stored {
+				keys = append(keys, key.Key)
+			}
+			t.storedKeys = keys
+		}
+	}
+
+	if len(t.storedKeys) == 0 {
+		return t.signingKey, t.previousKeys
+	}
+	previousKeys := append([]*SigningKey{}, t.storedKeys[1:]...)
+	if t.signingKey != nil {
+		previousKeys = append(previousKeys, t.signingKey)
+	}
+	return t.storedKeys[0], append(previousKeys, t.previousKeys...)
+}
+
+func (t *tokenService) JWKS() JWKSet {
+	keys := []JWK{}
+	if signingKey, previousKeys := t.signingKeys(false); signingKey != nil {
+		keys = append(keys, signingKey.JWK())
+		for _, key := range previousKeys {
+			keys = append(keys, key.JWK())
+		}
+	}
+	return JWKSet{Keys: keys}
+}
+
+// audienceClaim returns the "aud" claim for the audience, which is left out when it is empty.
+func audienceClaim(audience string) jwt.ClaimStrings {
+	if audience == "" {
+		return nil
+	}
+	return jwt.ClaimStrings{audience}
+}
+
+func (t *tokenService) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	return t.tokenStore.RevokeAll(ctx, userID)
+}
+
+func (t *tokenService) GenerateCode(ctx context.Context, email, purpose string, expiry time.Duration) (string, error) {
+	upperBound := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(t.codePolicy.Length)), nil)
+	n, err := rand.Int(rand.Reader, upperBound)
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%0*d", t.codePolicy.Length, n)
+
+	email = utils.NormalizeEmail(email)
+	err = t.codeStore.Save(ctx, purpose, email, t.hashCode(purpose, email, code), expiry)
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+func (t *tokenService) ValidateCode(ctx context.Context, email, code, purpose string) error {
+	email = utils.NormalizeEmail(email)
+	return t.codeStore.Verify(ctx, purpose, email, t.hashCode(purpose, email, code), t.codePolicy.MaxAttempts)
+}
+
+func (t *tokenService) InspectCode(ctx context.Context, email, code, purpose string) error {
+	email = utils.NormalizeEmail(email)
+	return t.codeStore.Check(ctx, purpose, email, t.hashCode(purpose, email, code), t.codePolicy.MaxAttempts)
+}
+
+func (t *tokenService) RevokeCode(ctx context.Context, email, purpose string) error {
+	return t.codeStore.Delete(ctx, purpose, utils.NormalizeEmail(email))
+}
+
+// hashCode returns the value persisted for a code. Codes have little entropy, so they are
+// keyed with the secret to prevent brute-forcing a leaked hash offline.
+func (t *tokenService) hashCode(purpose, email, code string) string {
+	mac := hmac.New(sha256.New, []byte(t.secretKey))
+	mac.Write([]byte(purpose + "\x00" + email + "\x00" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashToken returns the value persisted for a token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return tokenHashPrefix + hex.EncodeToString(sum[:])
+}
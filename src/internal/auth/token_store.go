@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"authentication/src/internal/errs"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"time"
+)
+
+// TokenStore persists issued one-time tokens, one per user and purpose, until they are used or expire.
+type TokenStore interface {
+	// Store saves the token value for the user and purpose, replacing any previous one.
+	Store(ctx context.Context, userID uuid.UUID, purpose, value string, ttl time.Duration) error
+	// Fetch returns the stored value without consuming it, or errs.ErrTokenNotFound.
+	Fetch(ctx context.Context, userID uuid.UUID, purpose string) (string, error)
+	// Consume atomically removes the stored value if it equals value, so that a token
+	// can only be redeemed once. It returns errs.ErrTokenNotFound if nothing is stored
+	// and errs.ErrInvalidToken if a different value is stored.
+	Consume(ctx context.Context, userID uuid.UUID, purpose, value string) error
+	// RevokeAll removes every token of the user.
+	RevokeAll(ctx context.Context, userID uuid.UUID) error
+}
+
+// NewTokenStore creates the TokenStore for the configured backend: "redis", "postgres" or "memory".
+func NewTokenStore(backend string, redisClient *redis.Client, database *gorm.DB) (TokenStore, error) {
+	switch backend {
+	case "redis":
+		return NewRedisTokenStore(redisClient), nil
+	case "postgres":
+		return NewPostgresTokenStore(database), nil
+	case "memory":
+		return NewMemoryTokenStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown token store backend %q", backend)
+	}
+}
+
+// redisTokenStore implements TokenStore with Redis. Each token lives under
+// "purpose:userID" and a per-user set tracks the purposes for RevokeAll.
+type redisTokenStore struct {
+	client *redis.Client
+}
+
+// NewRedisTokenStore creates a TokenStore backed by Redis.
+func NewRedisTokenStore(client *redis.Client) TokenStore {
+	return &redisTokenStore{
+		client: client,
+	}
+}
+
+func tokenKey(userID uuid.UUID, purpose string) string {
+	return fmt.Sprintf("%s:%s", purpose, userID)
+}
+
+func userTokensKey(userID uuid.UUID) string {
+	return fmt.Sprintf("user_tokens:%s", userID)
+}
+
+// storeTokenScript sets the token and records its purpose, keeping the index alive
+// for at least as long as the longest-lived token.
+var storeTokenScript = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('SADD', KEYS[2], ARGV[3])
+if redis.call('PTTL', KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call('PEXPIRE', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// consumeTokenScript deletes the token only if it holds the expected value.
+// It returns 1 when consumed, 0 when a different value is stored and -1 when missing.
+var consumeTokenScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('SREM', KEYS[2], ARGV[2])
+return 1
+`)
+
+// revokeTokensScript deletes every token recorded in the user's purpose set along with the set, so
+// that a token stored concurrently is either deleted too or stored after the revocation.
+var revokeTokensScript = redis.NewScript(`
+local purposes = redis.call('SMEMBERS', KEYS[1])
+for _, purpose in ipairs(purposes) do
+	redis.call('DEL', purpose .. ':' .. ARGV[1])
+end
+redis.call('DEL', KEYS[1])
+return #purposes
+`)
+
+// Store saves the token value for the user and purpose, replacing any previous one.
+func (r *redisTokenStore) Store(ctx context.Context, userID uuid.UUID, purpose, value string, ttl time.Duration) error {
+	keys := []string{tokenKey(userID, purpose), userTokensKey(userID)}
+	return storeTokenScript.Run(ctx, r.client, keys, value, ttl.Milliseconds(), purpose).Err()
+}
+
+// Fetch returns the stored value without consuming it, or errs.ErrTokenNotFound.
+func (r *redisTokenStore) Fetch(ctx context.Context, userID uuid.UUID, purpose string) (string, error) {
+	value, err := r.client.Get(ctx, tokenKey(userID, purpose)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", errs.ErrTokenNotFound
+	}
+	return value, err
+}
+
+// Consume atomically removes the stored value if it equals value.
+func (r *redisTokenStore) Consume(ctx context.Context, userID uuid.UUID, purpose, value string) error {
+	keys := []string{tokenKey(userID, purpose), userTokensKey(userID)}
+	result, err := consumeTokenScript.Run(ctx, r.client, keys, value, purpose).Int()
+	if err != nil {
+		return err
+	}
+	switch result {
+	case 1:
+		return nil
+	case 0:
+		return errs.ErrInvalidToken
+	default:
+		return errs.ErrTokenNotFound
+	}
+}
+
+// RevokeAll removes every token of the user.
+func (r *redisTokenStore) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	return revokeTokensScript.Run(ctx, r.client, []string{userTokensKey(userID)}, userID.String()).Err()
+}
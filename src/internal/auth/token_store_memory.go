@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"authentication/src/internal/errs"
+	"context"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+type memoryToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// memoryTokenStore implements TokenStore in memory, for tests and local development.
+type memoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]map[string]memoryToken
+}
+
+// NewMemoryTokenStore creates an in-memory TokenStore.
+func NewMemoryTokenStore() TokenStore {
+	return &memoryTokenStore{
+		tokens: make(map[uuid.UUID]map[string]memoryToken),
+	}
+}
+
+// Store saves the token value for the user and purpose, replacing any previous one.
+func (m *memoryTokenStore) Store(ctx context.Context, userID uuid.UUID, purpose, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tokens[userID] == nil {
+		m.tokens[userID] = make(map[string]memoryToken)
+	}
+	m.tokens[userID][purpose] = memoryToken{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Fetch returns the stored value without consuming it, or errs.ErrTokenNotFound.
+func (m *memoryTokenStore) Fetch(ctx context.Context, userID uuid.UUID, purpose string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.lookup(userID, purpose)
+	if !ok {
+		return "", errs.ErrTokenNotFound
+	}
+	return token.value, nil
+}
+
+// Consume atomically removes the stored value if it equals value.
+func (m *memoryTokenStore) Consume(ctx context.Context, userID uuid.UUID, purpose, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.lookup(userID, purpose)
+	if !ok {
+		return errs.ErrTokenNotFound
+	}
+	if token.value != value {
+		return errs.ErrInvalidToken
+	}
+	delete(m.tokens[userID], purpose)
+	return nil
+}
+
+// RevokeAll removes every token of the user.
+func (m *memoryTokenStore) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tokens, userID)
+	return nil
+}
+
+// lookup returns the unexpired token for the user and purpose. The caller must hold the lock.
+func (m *memoryTokenStore) lookup(userID uuid.UUID, purpose string) (memoryToken, bool) {
+	token, ok := m.tokens[userID][purpose]
+	if !ok {
+		return memoryToken{}, false
+	}
+	if time.Now().After(token.expiresAt) {
+		delete(m.tokens[userID], purpose)
+		return memoryToken{}, false
+	}
+	return token, true
+}
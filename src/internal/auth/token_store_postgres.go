@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// postgresTokenStore implements TokenStore with the one_time_tokens table.
+type postgresTokenStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresTokenStore creates a TokenStore backed by Postgres.
+func NewPostgresTokenStore(db *gorm.DB) TokenStore {
+	return &postgresTokenStore{
+		db: db,
+	}
+}
+
+// Store saves the token value for the user and purpose, replacing any previous one.
+func (p *postgresTokenStore) Store(ctx context.Context, userID uuid.UUID, purpose, value string, ttl time.Duration) error {
+	token := &models.OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Value:     value,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	return p.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "purpose"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expires_at", "created_at"}),
+	}).Create(token).Error
+}
+
+// Fetch returns the stored value without consuming it, or errs.ErrTokenNotFound.
+func (p *postgresTokenStore) Fetch(ctx context.Context, userID uuid.UUID, purpose string) (string, error) {
+	var token models.OneTimeToken
+	err := p.db.WithContext(ctx).
+		Where("user_id = ? AND purpose = ? AND expires_at > ?", userID, purpose, time.Now()).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", errs.ErrTokenNotFound
+		}
+		return "", err
+	}
+	return token.Value, nil
+}
+
+// Consume atomically removes the stored value if it equals value.
+func (p *postgresTokenStore) Consume(ctx context.Context, userID uuid.UUID, purpose, value string) error {
+	// A single conditional DELETE is atomic, so concurrent redemptions cannot both succeed
+	result := p.db.WithContext(ctx).
+		Where("user_id = ? AND purpose = ? AND value = ? AND expires_at > ?", userID, purpose, value, time.Now()).
+		Delete(&models.OneTimeToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	// Nothing was deleted: tell a missing token apart from a mismatched one
+	if _, err := p.Fetch(ctx, userID, purpose); err != nil {
+		return err
+	}
+	return errs.ErrInvalidToken
+}
+
+// RevokeAll removes every token of the user.
+func (p *postgresTokenStore) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	return p.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.OneTimeToken{}).Error
+}
@@ -2,7 +2,7 @@ package db
 
 import (
 	"authentication/src/config"
-	"authentication/src/internal/models"
+	"context"
 	"fmt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -16,27 +16,28 @@ var (
 	once sync.Once
 )
 
-// Connect initializes the database connection.
+// Connect initializes the database connection and, unless disabled, applies pending migrations.
 func Connect() error {
+	if err := Open(); err != nil {
+		return err
+	}
+
+	if !config.GetDBConfig().AutoMigrate {
+		return nil
+	}
+
+	return Migrate(context.Background())
+}
+
+// Open initializes the database connection without running migrations.
+func Open() error {
 	var err error
 	once.Do(func() {
 		dbConfig := config.GetDBConfig()
 		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s", dbConfig.Host, dbConfig.Username, dbConfig.Password, dbConfig.Database, dbConfig.Port, dbConfig.SSLMode)
 		DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	})
-	if err != nil {
-		return err
-	}
-
-	//Migrate all models
-	err = Migrate(
-		models.User{},
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return err
 }
 
 // GetDB returns the global database connection.
@@ -53,17 +54,14 @@ func Close() error {
 	return sqlDB.Close()
 }
 
-// Migrate runs the database migrations
-func Migrate(models ...interface{}) error {
-	if DB == nil {
-		return fmt.Errorf("database connection is not initialized")
-	}
-	for _, model := range models {
-		if err := DB.AutoMigrate(model); err != nil {
-			return fmt.Errorf("failed to migrate model %T: %w", model, err)
-		}
+// Migrate applies all pending versioned migrations
+func Migrate(ctx context.Context) error {
+	migrator, err := NewMigrator(DB)
+	if err != nil {
+		return err
 	}
-	return nil
+	_, err = migrator.Up(ctx)
+	return err
 }
 
 // Ping checks the database connection
@@ -2,12 +2,41 @@ package db_test
 
 import (
 	"authentication/src/internal/db"
+	"os"
 	"testing"
+	"testing/fstest"
 )
 
 func TestConnect(t *testing.T) {
+	if os.Getenv("DB_HOST") == "" {
+		t.Skip("DB_HOST is not set, skipping test against a live Postgres")
+	}
 	err := db.Connect()
 	if err != nil {
 		t.Fatalf("Database connection failed: %v", err)
 	}
 }
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := db.LoadMigrations(os.DirFS("migrations"))
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Expected at least one migration")
+	}
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Errorf("Migrations are not strictly ordered: %d after %d", migrations[i].Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestLoadMigrationsRequiresDownFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_create_things.up.sql": {Data: []byte("CREATE TABLE things ();")},
+	}
+	if _, err := db.LoadMigrations(fsys); err == nil {
+		t.Error("Expected an error for a migration without a down file")
+	}
+}
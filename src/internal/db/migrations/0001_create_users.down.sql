@@ -0,0 +1,2 @@
+-- The uuid-ossp extension is left in place as other schemas may depend on it.
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS one_time_tokens (
+    user_id    UUID NOT NULL,
+    purpose    VARCHAR(64) NOT NULL,
+    value      TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, purpose)
+);
+
+CREATE INDEX IF NOT EXISTS idx_one_time_tokens_expires_at ON one_time_tokens (expires_at);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS verification_codes (
+    purpose    VARCHAR(64) NOT NULL,
+    email      VARCHAR(255) NOT NULL,
+    code_hash  TEXT NOT NULL,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (purpose, email)
+);
+
+CREATE INDEX IF NOT EXISTS idx_verification_codes_expires_at ON verification_codes (expires_at);
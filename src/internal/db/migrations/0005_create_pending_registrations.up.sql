@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS pending_registrations (
+    id            UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    email         VARCHAR(255) NOT NULL,
+    full_name     VARCHAR(100) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    expires_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pending_registrations_email ON pending_registrations (email);
+CREATE INDEX IF NOT EXISTS idx_pending_registrations_expires_at ON pending_registrations (expires_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS job_locks;
+DROP TABLE IF EXISTS job_runs;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+    id            UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    job           VARCHAR(100) NOT NULL,
+    trigger       VARCHAR(20) NOT NULL,
+    scheduled_for TIMESTAMPTZ,
+    status        VARCHAR(20) NOT NULL,
+    result        TEXT,
+    error         TEXT,
+    instance      VARCHAR(255),
+    started_at    TIMESTAMPTZ NOT NULL,
+    finished_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_started_at ON job_runs (job, started_at DESC);
+
+CREATE TABLE IF NOT EXISTS job_locks (
+    key        VARCHAR(255) PRIMARY KEY,
+    holder     VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_locks_expires_at ON job_locks (expires_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS erasure_tombstones (
+    id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id    UUID NOT NULL,
+    email_hash VARCHAR(64) NOT NULL,
+    actor      VARCHAR(20) NOT NULL,
+    erased_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_erasure_tombstones_user_id ON erasure_tombstones (user_id);
+CREATE INDEX IF NOT EXISTS idx_erasure_tombstones_email_hash ON erasure_tombstones (email_hash);
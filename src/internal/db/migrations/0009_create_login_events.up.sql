@@ -0,0 +1,21 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS login_events (
+    id             UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id        UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    method         VARCHAR(20) NOT NULL,
+    success        BOOLEAN NOT NULL,
+    failure_reason VARCHAR(100),
+    ip             VARCHAR(45),
+    user_agent     VARCHAR(512),
+    device         VARCHAR(20),
+    browser        VARCHAR(50),
+    os             VARCHAR(50),
+    device_hash    VARCHAR(64),
+    new_device     BOOLEAN NOT NULL DEFAULT false,
+    created_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id_created_at ON login_events (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id_device_hash ON login_events (user_id, device_hash);
+CREATE INDEX IF NOT EXISTS idx_login_events_created_at ON login_events (created_at);
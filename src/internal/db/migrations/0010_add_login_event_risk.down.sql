@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_login_events_user_id_country;
+
+ALTER TABLE login_events DROP COLUMN IF EXISTS risk_reasons;
+ALTER TABLE login_events DROP COLUMN IF EXISTS risk_decision;
+ALTER TABLE login_events DROP COLUMN IF EXISTS risk_score;
+ALTER TABLE login_events DROP COLUMN IF EXISTS longitude;
+ALTER TABLE login_events DROP COLUMN IF EXISTS latitude;
+ALTER TABLE login_events DROP COLUMN IF EXISTS country;
@@ -0,0 +1,8 @@
+ALTER TABLE login_events ADD COLUMN IF NOT EXISTS country VARCHAR(2);
+ALTER TABLE login_events ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+ALTER TABLE login_events ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+ALTER TABLE login_events ADD COLUMN IF NOT EXISTS risk_score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE login_events ADD COLUMN IF NOT EXISTS risk_decision VARCHAR(20);
+ALTER TABLE login_events ADD COLUMN IF NOT EXISTS risk_reasons VARCHAR(200);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id_country ON login_events (user_id, country);
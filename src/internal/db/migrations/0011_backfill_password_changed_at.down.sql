@@ -0,0 +1,2 @@
+-- The backfilled times cannot be told apart from real password changes, so they are kept.
+SELECT 1;
@@ -0,0 +1,3 @@
+-- Accounts created before password changes were tracked start their password age now, instead of
+-- their passwords expiring all at once by the age of the account.
+UPDATE users SET password_changed_at = NOW() WHERE password_changed_at IS NULL;
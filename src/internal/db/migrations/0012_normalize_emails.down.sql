@@ -0,0 +1,2 @@
+-- The original case of normalized addresses is not kept, so only the index is removed.
+DROP INDEX IF EXISTS idx_users_email_lower;
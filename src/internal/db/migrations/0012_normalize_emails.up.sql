@@ -0,0 +1,13 @@
+-- Emails are now stored lowercased and trimmed. Of pending registrations that only differ in case,
+-- the latest is kept; they would have to be verified again anyway.
+DELETE FROM pending_registrations p
+USING pending_registrations newer
+WHERE LOWER(TRIM(p.email)) = LOWER(TRIM(newer.email))
+  AND (p.created_at, p.id) < (newer.created_at, newer.id);
+UPDATE pending_registrations SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email));
+
+-- Users are looked up case-insensitively, so addresses stored before normalization still match.
+UPDATE users SET email = LOWER(TRIM(email))
+WHERE email <> LOWER(TRIM(email))
+  AND NOT EXISTS (SELECT 1 FROM users other WHERE other.id <> users.id AND other.email = LOWER(TRIM(users.email)));
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email));
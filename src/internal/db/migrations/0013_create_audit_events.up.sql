@@ -0,0 +1,13 @@
+-- Audit events outlive the accounts they are about, so user_id does not reference users.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id    UUID NOT NULL,
+    action     VARCHAR(50) NOT NULL,
+    outcome    VARCHAR(20) NOT NULL,
+    ip         VARCHAR(45),
+    details    VARCHAR(500),
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id_created_at ON audit_events (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id           UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id      UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor        VARCHAR(20) NOT NULL,
+    format       VARCHAR(10) NOT NULL,
+    status       VARCHAR(20) NOT NULL,
+    error        VARCHAR(200),
+    archive      BYTEA,
+    created_at   TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    expires_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_expires_at ON export_jobs (expires_at);
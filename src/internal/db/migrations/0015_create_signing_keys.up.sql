@@ -0,0 +1,8 @@
+-- private_key holds the PKCS #8 private key encrypted with AES-GCM under a key derived from TOKEN_SECRET.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id          VARCHAR(100) PRIMARY KEY,
+    private_key BYTEA NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_signing_keys_created_at ON signing_keys (created_at);
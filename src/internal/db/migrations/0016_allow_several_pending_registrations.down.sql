@@ -0,0 +1,7 @@
+-- Only the latest signup of an address is kept.
+DELETE FROM pending_registrations p
+USING pending_registrations newer
+WHERE p.email = newer.email
+  AND (p.created_at, p.id) < (newer.created_at, newer.id);
+DROP INDEX IF EXISTS idx_pending_registrations_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pending_registrations_email ON pending_registrations (email);
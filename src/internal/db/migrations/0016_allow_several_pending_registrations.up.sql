@@ -0,0 +1,4 @@
+-- Every signup of an address is kept on its own, so registering again does not replace the
+-- signup of the address owner.
+DROP INDEX IF EXISTS idx_pending_registrations_email;
+CREATE INDEX IF NOT EXISTS idx_pending_registrations_email ON pending_registrations (email);
@@ -1,11 +1,38 @@
 package dto
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Delivery modes for verification and password reset emails
+const (
+	// DeliveryModeLink emails a link containing a signed token (the default)
+	DeliveryModeLink = "link"
+	// DeliveryModeCode emails a short numeric code bound to the email address, for mobile clients
+	DeliveryModeCode = "code"
+)
 
 // LoginRequest represents the request body for user login
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+	// Reactivate reactivates an account the user deactivated themselves
+	Reactivate bool `json:"reactivate"`
+	// RememberMe selects a longer-lived session
+	RememberMe bool `json:"remember_me"`
+	// StepUpMode selects how an unusual login is confirmed by email: "link" (default) or "code"
+	StepUpMode string `json:"step_up_mode" validate:"omitempty,oneof=link code"`
+	// Client is filled in by the handler
+	Client ClientInfo `json:"-"`
+}
+
+// ClientInfo describes the client making a login request
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	// DeviceID is the value of the browser's long-lived device cookie
+	DeviceID string
 }
 
 // LoginResponse represents the response body for user login
@@ -13,13 +40,33 @@ type LoginResponse struct {
 	User UserResponse `json:"user"`
 }
 
+// ----------------------------Passwordless-Login------------------------------
+
+// PasswordlessStartRequest represents the request body for requesting a sign-in link or code
+type PasswordlessStartRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Mode  string `json:"mode" validate:"omitempty,oneof=link code"`
+}
+
+// PasswordlessVerifyRequest represents the request body for redeeming a sign-in link or code
+type PasswordlessVerifyRequest struct {
+	Token string `json:"token" validate:"required_without=Code"`
+	Email string `json:"email" validate:"required_with=Code,omitempty,email"`
+	Code  string `json:"code" validate:"required_without=Token,omitempty,numeric,min=6,max=8"`
+	// RememberMe selects a longer-lived session
+	RememberMe bool `json:"remember_me"`
+	// Client is filled in by the handler
+	Client ClientInfo `json:"-"`
+}
+
 //----------------------------Register------------------------------------
 
 // RegisterRequest represents the request body for user registration
 type RegisterRequest struct {
 	FullName string `json:"name" validate:"required,min=3,max=100"`
-	Password string `json:"password" validate:"required,min=8,max=64"`
+	Password string `json:"password" validate:"required,max=1024"`
 	Email    string `json:"email" validate:"required,email"`
+	Mode     string `json:"mode" validate:"omitempty,oneof=link code"`
 }
 
 // RegisterResponse represents the response body for user registration
@@ -41,6 +88,7 @@ type LogoutResponse struct {
 // ForgotPasswordRequest represents the request body for forgot password
 type ForgotPasswordRequest struct {
 	Email string `json:"email" validate:"required,email"`
+	Mode  string `json:"mode" validate:"omitempty,oneof=link code"`
 }
 
 // ForgotPasswordResponse represents the response body for forgot password
@@ -52,7 +100,37 @@ type ForgotPasswordResponse struct {
 type ResetPasswordRequest struct {
 	UserID      uuid.UUID `json:"user_id" validate:"required"`
 	ResetToken  string    `json:"reset_token" validate:"required"`
-	NewPassword string    `json:"new_password" validate:"required,min=8,max=64"`
+	NewPassword string    `json:"new_password" validate:"required,max=1024"`
+}
+
+// ResetPasswordCodeRequest represents the request body for resetting a password with an emailed code
+type ResetPasswordCodeRequest struct {
+	Email       string `json:"email" validate:"required,email"`
+	Code        string `json:"code" validate:"required,numeric,min=6,max=8"`
+	NewPassword string `json:"new_password" validate:"required,max=1024"`
+}
+
+// -----------------------------Change-Password------------------------------
+// ChangePasswordRequest represents the request body for changing the password of a logged in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,max=1024"`
+}
+
+// ExpiredPasswordChangeRequest represents the request body for replacing an expired password after login
+type ExpiredPasswordChangeRequest struct {
+	NewPassword string `json:"new_password" validate:"required,max=1024"`
+	// RememberMe selects a longer-lived session
+	RememberMe bool `json:"remember_me"`
+	// Client is filled in by the handler
+	Client ClientInfo `json:"-"`
+}
+
+// PasswordStrengthRequest represents the request body for checking a candidate password
+type PasswordStrengthRequest struct {
+	Password string `json:"password" validate:"required,max=1024"`
+	FullName string `json:"name" validate:"max=100"`
+	Email    string `json:"email" validate:"max=254"`
 }
 
 // ResetPasswordResponse represents the response body for reset password
@@ -63,11 +141,62 @@ type ResetPasswordResponse struct {
 
 // SendEmailVerificationRequest represents the request body for email verification
 type SendEmailVerificationRequest struct {
-	ID    uuid.UUID `json:"id" validate:"required"`
+	// ID is ignored, the registration is looked up by email; it is kept for older clients.
+	ID    uuid.UUID `json:"id"`
 	Email string    `json:"email" validate:"required,email"`
+	Mode  string    `json:"mode" validate:"omitempty,oneof=link code"`
 }
 
 // VerifyEmailRequest represents the request body for verifying email
 type VerifyEmailRequest struct {
 	Token string `json:"token" validate:"required"`
 }
+
+// VerifyEmailCodeRequest represents the request body for verifying email with an emailed code
+type VerifyEmailCodeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required,numeric,min=6,max=8"`
+}
+
+// -----------------------------Reauthentication-----------------------------
+
+// ReauthenticateRequest represents the request body for confirming the identity of a logged in user,
+// with either their password or an emailed code
+type ReauthenticateRequest struct {
+	Password string `json:"password" validate:"required_without=Code,excluded_with=Code,max=1024"`
+	Code     string `json:"code" validate:"omitempty,numeric,min=6,max=8"`
+}
+
+// AuthenticationResponse describes how and when the session was last authenticated
+type AuthenticationResponse struct {
+	AuthTime time.Time `json:"auth_time"`
+	// AMR lists the authentication methods used, as in RFC 8176: "pwd" or "otp"
+	AMR []string `json:"amr"`
+}
+
+// -----------------------------CSRF------------------------------------------
+
+// CSRFTokenResponse carries the CSRF token state-changing requests of the session must send
+type CSRFTokenResponse struct {
+	Token string `json:"csrf_token"`
+	// Header is the request header the token is expected in
+	Header string `json:"header"`
+}
+
+// -----------------------------Access-Token----------------------------------
+
+// AccessTokenRequest represents the optional request body for an access token
+type AccessTokenRequest struct {
+	// Scope is a space-separated list of the scopes the token is requested for
+	Scope string `json:"scope" validate:"max=1024"`
+}
+
+// AccessTokenResponse carries an access token to send in the Authorization header as a bearer token
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds
+	ExpiresIn int `json:"expires_in"`
+	// Scope is the space-separated list of scopes the token was issued for
+	Scope string `json:"scope,omitempty"`
+}
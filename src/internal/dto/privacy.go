@@ -0,0 +1,55 @@
+package dto
+
+import (
+	"authentication/src/internal/models"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Data export formats.
+const (
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+)
+
+// DataExport is everything the service stores about a user.
+type DataExport struct {
+	GeneratedAt     time.Time       `json:"generated_at"`
+	Profile         ProfileExport   `json:"profile"`
+	Sessions        []SessionExport `json:"sessions"`
+	PasswordChanges []time.Time     `json:"password_changes"`
+	// Logins is the recorded login history, newest first.
+	Logins []models.LoginEvent `json:"logins"`
+	// AuditEvents are the security decisions recorded about the account, newest first. There are
+	// no linked identities to export; accounts only sign in with their email address.
+	AuditEvents []models.AuditEvent `json:"audit_events"`
+}
+
+// ProfileExport is the user's account record, without the password hash.
+type ProfileExport struct {
+	ID                uuid.UUID  `json:"id"`
+	FullName          string     `json:"full_name"`
+	Email             string     `json:"email"`
+	Verified          bool       `json:"verified"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	LastLoginAt       *time.Time `json:"last_login_at,omitempty"`
+}
+
+// SessionExport is an active session of the user. The session ID is a credential, so only a
+// hash of it is exported, enough to tell the sessions apart.
+type SessionExport struct {
+	IDHash    string    `json:"id_hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportRequest represents the request body for starting a data export
+type ExportRequest struct {
+	Format string `json:"format" validate:"omitempty,oneof=json zip"`
+}
+
+// ErasureRequest represents the request body for erasing the caller's account
+type ErasureRequest struct {
+	Password string `json:"password" validate:"required"`
+}
@@ -3,6 +3,7 @@ package dto
 import (
 	"authentication/src/internal/models"
 	"github.com/google/uuid"
+	"time"
 )
 
 // UserResponse represents the response structure for user-related operations.
@@ -39,3 +40,41 @@ type CreateUserDTO struct {
 type GetUserByEmailDTO struct {
 	Email string `json:"email" validate:"required,email"`
 }
+
+// ChangeAccountStatusRequest represents the request body for changing the status of an account
+type ChangeAccountStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=active suspended banned deactivated"`
+	Reason string `json:"reason" validate:"max=500"`
+	// Until ends a suspension; it is required for suspended and ignored otherwise
+	Until *time.Time `json:"until"`
+}
+
+// DeactivateAccountRequest represents the request body for deactivating the caller's account
+type DeactivateAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+	Reason   string `json:"reason" validate:"max=500"`
+}
+
+// AccountStatusResponse describes the status of an account.
+type AccountStatusResponse struct {
+	UserID         uuid.UUID  `json:"user_id"`
+	Role           string     `json:"role"`
+	Status         string     `json:"status"`
+	Reason         string     `json:"reason,omitempty"`
+	Actor          string     `json:"actor,omitempty"`
+	ChangedAt      *time.Time `json:"changed_at,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+}
+
+// ToAccountStatusResponse converts a models.User to an AccountStatusResponse DTO.
+func ToAccountStatusResponse(user *models.User) AccountStatusResponse {
+	return AccountStatusResponse{
+		UserID:         user.ID,
+		Role:           user.EffectiveRole(),
+		Status:         user.AccountStatus(time.Now()),
+		Reason:         user.StatusReason,
+		Actor:          user.StatusActor,
+		ChangedAt:      user.StatusChangedAt,
+		SuspendedUntil: user.SuspendedUntil,
+	}
+}
@@ -8,16 +8,49 @@ var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrEmailNotVerified  = errors.New("email not verified")
 
-	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrWeakPassword         = errors.New("password does not meet the password policy")
+	ErrPasswordExpired      = errors.New("password expired")
+	ErrNoPasswordChangeDue  = errors.New("no expired password change is pending")
+	ErrLoginBindingMismatch = errors.New("sign-in was requested from a different browser")
+	ErrStepUpRequired       = errors.New("login requires confirmation")
+	ErrLoginBlocked         = errors.New("login blocked")
+	ErrRecentAuthRequired   = errors.New("recent authentication required")
+	ErrTooManyRequests      = errors.New("too many requests, try again later")
+
+	// Account status errors
+	ErrAccountSuspended     = errors.New("account suspended")
+	ErrAccountBanned        = errors.New("account banned")
+	ErrAccountDeactivated   = errors.New("account deactivated")
+	ErrInvalidAccountStatus = errors.New("invalid account status change")
+	ErrForbidden            = errors.New("insufficient permissions")
 
 	// Token errors
 	ErrTokenNotFound       = errors.New("token not found")
 	ErrInvalidTokenPurpose = errors.New("invalid token purpose")
 	ErrInvalidToken        = errors.New("invalid token")
 	ErrTokenExpired        = errors.New("token expired")
+	ErrInvalidCode         = errors.New("invalid or expired code")
+	ErrTooManyAttempts     = errors.New("too many attempts")
+	ErrInvalidScope        = errors.New("scope not allowed")
 
 	ErrRedisTokenDeletion = errors.New("error deleting token from Redis")
 
+	// Session errors
+	ErrSessionNotFound        = errors.New("session not found")
+	ErrSessionExpired         = errors.New("session expired")
+	ErrSessionBindingMismatch = errors.New("session used from a different client")
+	ErrTooManySessions        = errors.New("too many active sessions")
+	ErrInvalidCSRFToken       = errors.New("missing or invalid CSRF token")
+
+	// Job errors
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobRunning  = errors.New("job is already running")
+
+	// Data export errors
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportNotReady = errors.New("export is not ready")
+
 	ErrInvalidBlockData = errors.New("invalid block data")
 
 	ErrInvalidRequestBody  = errors.New("invalid request body")
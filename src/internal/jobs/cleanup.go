@@ -0,0 +1,190 @@
+package jobs
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/auth"
+	"authentication/src/internal/privacy"
+	"authentication/src/internal/user"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Names of the built-in jobs.
+const (
+	JobPurgePendingRegistrations = "purge-pending-registrations"
+	JobPurgeDeletedUsers         = "purge-deleted-users"
+	JobPruneJobRuns              = "prune-job-runs"
+	JobPruneLoginHistory         = "prune-login-history"
+	JobPurgeDataExports          = "purge-data-exports"
+	JobPruneAuditLog             = "prune-audit-log"
+	JobRotateSigningKey          = "rotate-signing-key"
+)
+
+// CleanupStores are the stores the built-in cleanup jobs work on.
+type CleanupStores struct {
+	Users                user.UserRepository
+	PendingRegistrations user.PendingRegistrationRepository
+	History              HistoryStore
+	// LoginHistory is pruned when set.
+	LoginHistory auth.LoginHistory
+	// ExportJobs are purged when set.
+	ExportJobs privacy.ExportJobRepository
+	// AuditLog is pruned when set.
+	AuditLog auth.AuditLog
+	// SigningKeys are rotated when set.
+	SigningKeys auth.SigningKeyStore
+}
+
+// RegisterCleanupJobs registers the built-in data retention and key rotation jobs with their configured schedules.
+func RegisterCleanupJobs(s *Scheduler, cfg config.JobsConfig, stores CleanupStores) error {
+	jobs := []Job{
+		PurgePendingRegistrations(cfg.PurgePendingRegistrationsSchedule, stores.PendingRegistrations),
+		PurgeDeletedUsers(cfg.PurgeDeletedUsersSchedule, stores.Users, time.Duration(cfg.DeletedUserRetentionDays)*24*time.Hour),
+		PruneJobRuns(cfg.PruneJobRunsSchedule, stores.History, time.Duration(cfg.JobRunRetentionDays)*24*time.Hour),
+	}
+	if stores.LoginHistory != nil {
+		jobs = append(jobs, PruneLoginHistory(cfg.PruneLoginHistorySchedule, stores.LoginHistory, time.Duration(cfg.LoginHistoryRetentionDays)*24*time.Hour))
+	}
+	if stores.ExportJobs != nil {
+		jobs = append(jobs, PurgeDataExports(cfg.PurgeDataExportsSchedule, stores.ExportJobs))
+	}
+	if stores.AuditLog != nil {
+		jobs = append(jobs, PruneAuditLog(cfg.PruneAuditLogSchedule, stores.AuditLog, time.Duration(cfg.AuditLogRetentionDays)*24*time.Hour))
+	}
+	if stores.SigningKeys != nil {
+		jobs = append(jobs, RotateSigningKey(cfg.RotateSigningKeySchedule, stores.SigningKeys, time.Duration(cfg.SigningKeyRetentionDays)*24*time.Hour))
+	}
+	for _, job := range jobs {
+		if err := s.Register(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgePendingRegistrations removes pending registrations whose verification window has passed.
+func PurgePendingRegistrations(schedule string, registrations user.PendingRegistrationRepository) Job {
+	return Job{
+		Name:     JobPurgePendingRegistrations,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := registrations.DeleteExpired(ctx, time.Now())
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d expired pending registrations", deleted), nil
+		},
+	}
+}
+
+// PurgeDeletedUsers permanently removes users that were soft-deleted longer than retention ago.
+func PurgeDeletedUsers(schedule string, users user.UserRepository, retention time.Duration) Job {
+	return Job{
+		Name:     JobPurgeDeletedUsers,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (string, error) {
+			purged, err := users.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("purged %d users deleted more than %s ago", purged, retention), nil
+		},
+	}
+}
+
+// PruneJobRuns removes job run history older than retention.
+func PruneJobRuns(schedule string, history HistoryStore, retention time.Duration) Job {
+	return Job{
+		Name:     JobPruneJobRuns,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := history.DeleteBefore(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d job runs older than %s", deleted, retention), nil
+		},
+	}
+}
+
+// PruneLoginHistory removes login attempts older than retention.
+func PruneLoginHistory(schedule string, history auth.LoginHistory, retention time.Duration) Job {
+	return Job{
+		Name:     JobPruneLoginHistory,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := history.DeleteBefore(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d login attempts older than %s", deleted, retention), nil
+		},
+	}
+}
+
+// PurgeDataExports removes data export jobs, and their archives, that can no longer be downloaded.
+func PurgeDataExports(schedule string, exports privacy.ExportJobRepository) Job {
+	return Job{
+		Name:     JobPurgeDataExports,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := exports.DeleteExpired(ctx, time.Now())
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d expired data exports", deleted), nil
+		},
+	}
+}
+
+// PruneAuditLog removes audit events older than retention.
+func PruneAuditLog(schedule string, auditLog auth.AuditLog, retention time.Duration) Job {
+	return Job{
+		Name:     JobPruneAuditLog,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := auditLog.DeleteBefore(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d audit events older than %s", deleted, retention), nil
+		},
+	}
+}
+
+// RotateSigningKey adds a new access token signing key and removes the keys that were replaced
+// more than retention ago, when no token signed with them can still be valid.
+func RotateSigningKey(schedule string, keys auth.SigningKeyStore, retention time.Duration) Job {
+	return Job{
+		Name:     JobRotateSigningKey,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (string, error) {
+			key, err := auth.GenerateSigningKey()
+			if err != nil {
+				return "", err
+			}
+			if err := keys.Add(ctx, key); err != nil {
+				return "", err
+			}
+
+			stored, err := keys.List(ctx)
+			if err != nil {
+				return "", err
+			}
+			cutoff := time.Now().Add(-retention)
+			deleted := 0
+			// A key was replaced when the next newer key was added
+			for i := 1; i < len(stored); i++ {
+				if stored[i-1].CreatedAt.After(cutoff) {
+					continue
+				}
+				if err := keys.Delete(ctx, stored[i].Key.KeyID); err != nil {
+					return "", err
+				}
+				deleted++
+			}
+			return fmt.Sprintf("added signing key %s, deleted %d keys replaced more than %s ago", key.KeyID, deleted, retention), nil
+		},
+	}
+}
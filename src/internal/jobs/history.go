@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HistoryStore records job runs.
+type HistoryStore interface {
+	// Save creates or updates the run.
+	Save(ctx context.Context, run *models.JobRun) error
+	// List returns the most recent runs of the job, newest first. An empty job name lists every job.
+	List(ctx context.Context, job string, limit int) ([]models.JobRun, error)
+	// DeleteBefore removes runs started before the given time and returns how many were removed.
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// postgresHistoryStore implements HistoryStore with the job_runs table.
+type postgresHistoryStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresHistoryStore creates a HistoryStore backed by Postgres.
+func NewPostgresHistoryStore(db *gorm.DB) HistoryStore {
+	return &postgresHistoryStore{
+		db: db,
+	}
+}
+
+// Save creates or updates the run.
+func (p *postgresHistoryStore) Save(ctx context.Context, run *models.JobRun) error {
+	return p.db.WithContext(ctx).Save(run).Error
+}
+
+// List returns the most recent runs, newest first.
+func (p *postgresHistoryStore) List(ctx context.Context, job string, limit int) ([]models.JobRun, error) {
+	query := p.db.WithContext(ctx).Order("started_at DESC").Limit(limit)
+	if job != "" {
+		query = query.Where("job = ?", job)
+	}
+
+	var runs []models.JobRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// DeleteBefore removes runs started before the given time.
+func (p *postgresHistoryStore) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := p.db.WithContext(ctx).Delete(&models.JobRun{}, "started_at < ?", before)
+	return result.RowsAffected, result.Error
+}
+
+// memoryHistoryStore implements HistoryStore in memory, for tests and local development.
+type memoryHistoryStore struct {
+	mu   sync.Mutex
+	runs []models.JobRun
+}
+
+// NewMemoryHistoryStore creates an in-memory HistoryStore.
+func NewMemoryHistoryStore() HistoryStore {
+	return &memoryHistoryStore{}
+}
+
+// Save creates or updates the run.
+func (m *memoryHistoryStore) Save(ctx context.Context, run *models.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.runs {
+		if m.runs[i].ID == run.ID {
+			m.runs[i] = *run
+			return nil
+		}
+	}
+	m.runs = append(m.runs, *run)
+	return nil
+}
+
+// List returns the most recent runs, newest first.
+func (m *memoryHistoryStore) List(ctx context.Context, job string, limit int) ([]models.JobRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := make([]models.JobRun, 0, len(m.runs))
+	for _, run := range m.runs {
+		if job == "" || run.Job == job {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if limit >= 0 && limit < len(runs) {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+// DeleteBefore removes runs started before the given time.
+func (m *memoryHistoryStore) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.runs[:0]
+	for _, run := range m.runs {
+		if !run.StartedAt.Before(before) {
+			kept = append(kept, run)
+		}
+	}
+	deleted := int64(len(m.runs) - len(kept))
+	m.runs = kept
+	return deleted, nil
+}
@@ -0,0 +1,290 @@
+// Package jobs runs periodic background jobs. Every replica runs the scheduler; a shared
+// Locker makes sure each scheduled run happens on exactly one of them.
+package jobs
+
+import (
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultTimeout bounds a run when the job does not set its own timeout.
+const defaultTimeout = 10 * time.Minute
+
+// minTickLease is the shortest time a schedule tick stays claimed, covering clock skew between replicas.
+const minTickLease = time.Minute
+
+// Func performs the work of a job and returns a short summary of what it did.
+type Func func(ctx context.Context) (string, error)
+
+// Job is a unit of periodic work.
+type Job struct {
+	// Name identifies the job in locks, run history and the admin CLI.
+	Name string
+	// Schedule is a cron expression or descriptor accepted by ParseSchedule.
+	Schedule string
+	// Timeout bounds a single run; defaultTimeout is used when zero.
+	Timeout time.Duration
+	Run     Func
+}
+
+// JobInfo describes a registered job.
+type JobInfo struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	NextRun  time.Time `json:"next_run"`
+}
+
+type entry struct {
+	job      Job
+	schedule Schedule
+}
+
+// Scheduler runs registered jobs on their schedules and on demand.
+type Scheduler struct {
+	locker   Locker
+	history  HistoryStore
+	instance string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// SchedulerOption configures optional behaviour of the Scheduler.
+type SchedulerOption func(*Scheduler)
+
+// WithInstanceName sets the name recorded as lock holder and in run history instead of the host name.
+func WithInstanceName(name string) SchedulerOption {
+	return func(s *Scheduler) {
+		s.instance = name
+	}
+}
+
+// NewScheduler creates a Scheduler coordinating through locker and recording runs in history.
+func NewScheduler(locker Locker, history HistoryStore, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		locker:  locker,
+		history: history,
+		entries: make(map[string]*entry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.instance == "" {
+		host, _ := os.Hostname()
+		s.instance = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+	}
+	return s
+}
+
+// Register adds a job. It must be called before Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job needs a name and a run function")
+	}
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[job.Name]; ok {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.entries[job.Name] = &entry{job: job, schedule: schedule}
+	return nil
+}
+
+// Jobs lists the registered jobs with their next scheduled run, sorted by name.
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	infos := make([]JobInfo, 0, len(s.entries))
+	for _, e := range s.entries {
+		infos = append(infos, JobInfo{Name: e.job.Name, Schedule: e.job.Schedule, NextRun: e.schedule.Next(now)})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Start runs every registered job on its schedule until ctx is cancelled or Stop is called.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go func(e *entry) {
+			defer s.wg.Done()
+			s.loop(ctx, e)
+		}(e)
+	}
+	log.Printf("Job scheduler started as %s with %d jobs", s.instance, len(s.entries))
+}
+
+// Stop stops scheduling and waits for running jobs to finish.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Trigger runs the job immediately and returns the recorded run. It fails with
+// errs.ErrJobRunning if the job is currently running on any replica.
+func (s *Scheduler) Trigger(ctx context.Context, name string) (*models.JobRun, error) {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errs.ErrJobNotFound
+	}
+	return s.run(ctx, e, models.JobTriggerManual, nil)
+}
+
+// History returns the most recent runs of the job, or of every job when name is empty.
+func (s *Scheduler) History(ctx context.Context, name string, limit int) ([]models.JobRun, error) {
+	if name != "" {
+		s.mu.Lock()
+		_, ok := s.entries[name]
+		s.mu.Unlock()
+		if !ok {
+			return nil, errs.ErrJobNotFound
+		}
+	}
+	return s.history.List(ctx, name, limit)
+}
+
+// loop waits for each schedule tick of the job and runs it.
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	for {
+		tick := e.schedule.Next(time.Now())
+		if tick.IsZero() {
+			log.Printf("Job %s has no upcoming runs", e.job.Name)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(tick))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if _, err := s.RunScheduled(ctx, e.job.Name, tick); err != nil && ctx.Err() == nil {
+			log.Printf("Scheduled run of job %s did not complete: %v", e.job.Name, err)
+		}
+	}
+}
+
+// RunScheduled runs the job for a tick of its schedule, unless another replica has claimed that
+// tick, in which case it returns no run. The scheduler calls it when a tick is due.
+func (s *Scheduler) RunScheduled(ctx context.Context, name string, tick time.Time) (*models.JobRun, error) {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errs.ErrJobNotFound
+	}
+
+	// Claim the tick so that no other replica runs it, even after this run has finished
+	lease := e.schedule.Next(tick).Sub(tick)
+	if lease < minTickLease {
+		lease = minTickLease
+	}
+	tickKey := fmt.Sprintf("%s@%d", e.job.Name, tick.Unix())
+	claimed, err := s.locker.Acquire(ctx, tickKey, s.instance, lease)
+	if err != nil {
+		return nil, fmt.Errorf("claiming run: %w", err)
+	}
+	if !claimed {
+		return nil, nil
+	}
+	return s.run(ctx, e, models.JobTriggerSchedule, &tick)
+}
+
+// run executes the job while holding its run lease and records the outcome.
+func (s *Scheduler) run(ctx context.Context, e *entry, trigger string, scheduledFor *time.Time) (*models.JobRun, error) {
+	// The lease outlives the timeout slightly, so it only expires if this replica died
+	acquired, err := s.locker.Acquire(ctx, e.job.Name, s.instance, e.job.Timeout+time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, errs.ErrJobRunning
+	}
+	defer func() {
+		// Use a fresh context so the lease is released even if ctx was cancelled
+		if err := s.locker.Release(context.Background(), e.job.Name, s.instance); err != nil {
+			log.Printf("Error releasing lock of job %s: %v", e.job.Name, err)
+		}
+	}()
+
+	run := &models.JobRun{
+		ID:           uuid.New(),
+		Job:          e.job.Name,
+		Trigger:      trigger,
+		ScheduledFor: scheduledFor,
+		Status:       models.JobRunRunning,
+		Instance:     s.instance,
+		StartedAt:    time.Now(),
+	}
+	if err := s.history.Save(ctx, run); err != nil {
+		log.Printf("Error recording start of job %s: %v", e.job.Name, err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, e.job.Timeout)
+	result, runErr := safeRun(runCtx, e.job.Run)
+	cancel()
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Result = result
+	run.Status = models.JobRunSucceeded
+	if runErr != nil {
+		run.Status = models.JobRunFailed
+		run.Error = runErr.Error()
+		log.Printf("Job %s failed after %s: %v", e.job.Name, finishedAt.Sub(run.StartedAt), runErr)
+	} else {
+		log.Printf("Job %s finished in %s: %s", e.job.Name, finishedAt.Sub(run.StartedAt), result)
+	}
+
+	if err := s.history.Save(context.Background(), run); err != nil {
+		log.Printf("Error recording result of job %s: %v", e.job.Name, err)
+	}
+	return run, nil
+}
+
+// safeRun calls fn, turning a panic into an error so one broken job cannot take down the server.
+func safeRun(ctx context.Context, fn Func) (result string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,312 @@
+package jobs_test
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/auth"
+	"authentication/src/internal/errs"
+	"authentication/src/internal/jobs"
+	"authentication/src/internal/models"
+	"authentication/src/internal/user"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2025, time.January, 30, 10, 17, 42, 0, time.UTC) // a Thursday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.January, 30, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, time.January, 30, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2025, time.January, 31, 3, 0, 0, 0, time.UTC)},
+		{"30 9-17/4 * * 1-5", time.Date(2025, time.January, 30, 13, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 1", time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, time.January, 30, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 10m", time.Date(2025, time.January, 30, 10, 20, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := jobs.ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("ParseSchedule(%q).Next = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "@every 1ms", "@sometimes"} {
+		if _, err := jobs.ParseSchedule(expr); err == nil {
+			t.Errorf("Expected ParseSchedule(%q) to fail", expr)
+		}
+	}
+}
+
+func TestTriggerRecordsHistory(t *testing.T) {
+	ctx := context.Background()
+	scheduler := jobs.NewScheduler(jobs.NewMemoryLocker(), jobs.NewMemoryHistoryStore())
+	jobList := []jobs.Job{
+		{Name: "succeeds", Schedule: "@daily", Run: func(ctx context.Context) (string, error) { return "did things", nil }},
+		{Name: "fails", Schedule: "@daily", Run: func(ctx context.Context) (string, error) { return "", errors.New("boom") }},
+		{Name: "panics", Schedule: "@daily", Run: func(ctx context.Context) (string, error) { panic("oops") }},
+	}
+	for _, job := range jobList {
+		if err := scheduler.Register(job); err != nil {
+			t.Fatalf("Failed to register job: %v", err)
+		}
+	}
+	if err := scheduler.Register(jobList[0]); err == nil {
+		t.Error("Expected registering a job twice to fail")
+	}
+
+	wantStatus := map[string]string{"succeeds": models.JobRunSucceeded, "fails": models.JobRunFailed, "panics": models.JobRunFailed}
+	for name, status := range wantStatus {
+		run, err := scheduler.Trigger(ctx, name)
+		if err != nil {
+			t.Fatalf("Failed to trigger %s: %v", name, err)
+		}
+		if run.Status != status || run.Trigger != models.JobTriggerManual || run.FinishedAt == nil {
+			t.Errorf("Unexpected run of %s: %+v", name, run)
+		}
+	}
+
+	runs, err := scheduler.History(ctx, "succeeds", 10)
+	if err != nil || len(runs) != 1 || runs[0].Result != "did things" {
+		t.Errorf("Unexpected history: %+v (%v)", runs, err)
+	}
+	if _, err := scheduler.Trigger(ctx, "missing"); !errors.Is(err, errs.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestTriggerRejectsConcurrentRun(t *testing.T) {
+	ctx := context.Background()
+	locker := jobs.NewMemoryLocker()
+	history := jobs.NewMemoryHistoryStore()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	job := jobs.Job{Name: "slow", Schedule: "@daily", Run: func(ctx context.Context) (string, error) {
+		close(started)
+		<-release
+		return "", nil
+	}}
+
+	// Two replicas sharing the lock backend
+	first := jobs.NewScheduler(locker, history, jobs.WithInstanceName("first"))
+	second := jobs.NewScheduler(locker, history, jobs.WithInstanceName("second"))
+	for _, s := range []*jobs.Scheduler{first, second} {
+		if err := s.Register(job); err != nil {
+			t.Fatalf("Failed to register job: %v", err)
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := first.Trigger(ctx, "slow")
+		done <- err
+	}()
+	<-started
+
+	if _, err := second.Trigger(ctx, "slow"); !errors.Is(err, errs.ErrJobRunning) {
+		t.Errorf("Expected ErrJobRunning, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("First run failed: %v", err)
+	}
+}
+
+func TestScheduledRunsHappenOnceAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	locker := jobs.NewMemoryLocker()
+	history := jobs.NewMemoryHistoryStore()
+	var runs atomic.Int32
+	job := jobs.Job{Name: "tick", Schedule: "@every 1m", Run: func(ctx context.Context) (string, error) {
+		runs.Add(1)
+		return "", nil
+	}}
+
+	var schedulers []*jobs.Scheduler
+	for _, name := range []string{"first", "second", "third"} {
+		s := jobs.NewScheduler(locker, history, jobs.WithInstanceName(name))
+		if err := s.Register(job); err != nil {
+			t.Fatalf("Failed to register job: %v", err)
+		}
+		schedulers = append(schedulers, s)
+	}
+
+	// Every replica wakes up for each tick at the same time
+	start := time.Now().Truncate(time.Minute)
+	ticks := []time.Time{start, start.Add(time.Minute)}
+	for _, tick := range ticks {
+		var wg sync.WaitGroup
+		for _, s := range schedulers {
+			wg.Add(1)
+			go func(s *jobs.Scheduler) {
+				defer wg.Done()
+				if _, err := s.RunScheduled(ctx, "tick", tick); err != nil {
+					t.Errorf("Scheduled run failed: %v", err)
+				}
+			}(s)
+		}
+		wg.Wait()
+	}
+
+	recorded, err := history.List(ctx, "tick", -1)
+	if err != nil {
+		t.Fatalf("Failed to list history: %v", err)
+	}
+	if len(recorded) != len(ticks) || int(runs.Load()) != len(ticks) {
+		t.Fatalf("Expected one run per tick, got %d runs and %d records", runs.Load(), len(recorded))
+	}
+	seen := make(map[time.Time]bool)
+	for _, run := range recorded {
+		if run.ScheduledFor == nil || run.Trigger != models.JobTriggerSchedule {
+			t.Fatalf("Unexpected scheduled run: %+v", run)
+		}
+		if seen[*run.ScheduledFor] {
+			t.Errorf("Tick %s ran more than once", run.ScheduledFor)
+		}
+		seen[*run.ScheduledFor] = true
+	}
+
+	if run, err := schedulers[0].RunScheduled(ctx, "tick", ticks[0]); run != nil || err != nil {
+		t.Errorf("Expected a claimed tick not to run again, got %+v (%v)", run, err)
+	}
+	if _, err := schedulers[0].RunScheduled(ctx, "missing", start); !errors.Is(err, errs.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestCleanupJobs(t *testing.T) {
+	ctx := context.Background()
+	users := user.NewMemoryUserRepository()
+	registrations := user.NewMemoryPendingRegistrationRepository()
+	history := jobs.NewMemoryHistoryStore()
+	scheduler := jobs.NewScheduler(jobs.NewMemoryLocker(), history)
+	cfg := config.JobsConfig{
+		PurgePendingRegistrationsSchedule: "@hourly",
+		PurgeDeletedUsersSchedule:         "@daily",
+		DeletedUserRetentionDays:          0,
+		PruneJobRunsSchedule:              "@daily",
+		JobRunRetentionDays:               30,
+	}
+	err := jobs.RegisterCleanupJobs(scheduler, cfg, jobs.CleanupStores{Users: users, PendingRegistrations: registrations, History: history})
+	if err != nil {
+		t.Fatalf("Failed to register cleanup jobs: %v", err)
+	}
+
+	expired := &models.PendingRegistration{Email: "old@example.com", FullName: "Old", PasswordHash: "hash", ExpiresAt: time.Now().Add(-time.Hour)}
+	current := &models.PendingRegistration{Email: "new@example.com", FullName: "New", PasswordHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	for _, registration := range []*models.PendingRegistration{expired, current} {
+		if err := registrations.Save(ctx, registration); err != nil {
+			t.Fatalf("Failed to save registration: %v", err)
+		}
+	}
+	deleted := &models.User{Email: "gone@example.com", FullName: "Gone", PasswordHash: "hash"}
+	if err := users.CreateUser(ctx, deleted); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := users.DeleteUser(ctx, deleted.ID, false); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	for _, name := range []string{jobs.JobPurgePendingRegistrations, jobs.JobPurgeDeletedUsers} {
+		run, err := scheduler.Trigger(ctx, name)
+		if err != nil || run.Status != models.JobRunSucceeded {
+			t.Fatalf("Job %s did not succeed: %+v (%v)", name, run, err)
+		}
+	}
+
+	if _, err := registrations.GetByID(ctx, current.ID); err != nil {
+		t.Error("Expected the unexpired registration to be kept")
+	}
+	if purged, _ := registrations.DeleteExpired(ctx, time.Now()); purged != 0 {
+		t.Error("Expected the expired registration to be purged already")
+	}
+	if purged, _ := users.PurgeDeletedUsers(ctx, time.Now()); purged != 0 {
+		t.Error("Expected the soft-deleted user to be purged already")
+	}
+}
+
+func TestAuditLogAndSigningKeyJobs(t *testing.T) {
+	ctx := context.Background()
+	auditLog := auth.NewMemoryAuditLog()
+	signingKeys := auth.NewMemorySigningKeyStore()
+	history := jobs.NewMemoryHistoryStore()
+	scheduler := jobs.NewScheduler(jobs.NewMemoryLocker(), history)
+	cfg := config.JobsConfig{
+		PurgePendingRegistrationsSchedule: "@hourly",
+		PurgeDeletedUsersSchedule:         "@daily",
+		PruneJobRunsSchedule:              "@daily",
+		PruneAuditLogSchedule:             "@daily",
+		AuditLogRetentionDays:             30,
+		RotateSigningKeySchedule:          "@monthly",
+		SigningKeyRetentionDays:           0,
+	}
+	err := jobs.RegisterCleanupJobs(scheduler, cfg, jobs.CleanupStores{
+		Users:                user.NewMemoryUserRepository(),
+		PendingRegistrations: user.NewMemoryPendingRegistrationRepository(),
+		History:              history,
+		AuditLog:             auditLog,
+		SigningKeys:          signingKeys,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register cleanup jobs: %v", err)
+	}
+
+	userID := uuid.New()
+	for _, age := range []time.Duration{31 * 24 * time.Hour, time.Hour} {
+		event := &models.AuditEvent{UserID: userID, Action: models.AuditActionLoginRisk, Outcome: "allow", CreatedAt: time.Now().Add(-age)}
+		if err := auditLog.Add(ctx, event); err != nil {
+			t.Fatalf("Failed to add audit event: %v", err)
+		}
+	}
+	run, err := scheduler.Trigger(ctx, jobs.JobPruneAuditLog)
+	if err != nil || run.Status != models.JobRunSucceeded {
+		t.Fatalf("Job %s did not succeed: %+v (%v)", jobs.JobPruneAuditLog, run, err)
+	}
+	if events, _ := auditLog.List(ctx, userID, -1); len(events) != 1 {
+		t.Errorf("Expected only the recent audit event to be kept, got %d", len(events))
+	}
+
+	firstKey, err := auth.EnsureSigningKey(ctx, signingKeys)
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		run, err := scheduler.Trigger(ctx, jobs.JobRotateSigningKey)
+		if err != nil || run.Status != models.JobRunSucceeded {
+			t.Fatalf("Job %s did not succeed: %+v (%v)", jobs.JobRotateSigningKey, run, err)
+		}
+	}
+	// Without retention only the key added last is left
+	keys, err := signingKeys.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list signing keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Key.KeyID == firstKey.KeyID {
+		t.Errorf("Expected the replaced keys to be deleted, got %d keys", len(keys))
+	}
+
+	// With retention the replaced key is kept to verify tokens signed with it
+	kept := auth.NewMemorySigningKeyStore()
+	if _, err := auth.EnsureSigningKey(ctx, kept); err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+	if _, err := jobs.RotateSigningKey("@monthly", kept, time.Hour).Run(ctx); err != nil {
+		t.Fatalf("Failed to rotate signing key: %v", err)
+	}
+	if keys, _ := kept.List(ctx); len(keys) != 2 {
+		t.Errorf("Expected the replaced key to be kept within the retention, got %d keys", len(keys))
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	// AuditActionLoginRisk records the risk decision about a login with valid credentials.
+	AuditActionLoginRisk = "login_risk"
+)
+
+// AuditEvent records a security decision about an account. Unlike the login history it is not
+// shown to users or removed with their account; it is pruned after its retention period.
+type AuditEvent struct {
+	ID     uuid.UUID `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Action string    `gorm:"type:varchar(50);not null" json:"action"`
+	// Outcome is the decision taken, like a risk decision.
+	Outcome string `gorm:"type:varchar(20);not null" json:"outcome"`
+	IP      string `gorm:"type:varchar(45)" json:"ip"`
+	// Details holds what the decision was based on, like the risk score and reasons.
+	Details   string    `gorm:"type:varchar(500)" json:"details"`
+	CreatedAt time.Time `gorm:"not null;index" json:"created_at"`
+}
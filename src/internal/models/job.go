@@ -0,0 +1,43 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Job run statuses.
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+// Job run triggers.
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// JobRun records one execution of a background job.
+type JobRun struct {
+	ID      uuid.UUID `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	Job     string    `gorm:"type:varchar(100);not null;index" json:"job"`
+	Trigger string    `gorm:"type:varchar(20);not null" json:"trigger"`
+	// ScheduledFor is the schedule tick the run belongs to; it is nil for manual runs.
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+	Status       string     `gorm:"type:varchar(20);not null" json:"status"`
+	// Result is a short summary reported by the job, such as the number of rows removed.
+	Result string `gorm:"type:text" json:"result,omitempty"`
+	Error  string `gorm:"type:text" json:"error,omitempty"`
+	// Instance identifies the replica that ran the job.
+	Instance   string     `gorm:"type:varchar(255)" json:"instance"`
+	StartedAt  time.Time  `gorm:"not null" json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobLock is a lease held by one replica so that a job runs only once across the cluster.
+type JobLock struct {
+	Key       string    `gorm:"primaryKey;type:varchar(255)"`
+	Holder    string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
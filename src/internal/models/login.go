@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Login methods recorded in the login history.
+const (
+	LoginMethodPassword     = "password"
+	LoginMethodPasswordless = "passwordless"
+)
+
+// LoginEvent records a successful or failed login to an account.
+type LoginEvent struct {
+	ID      uuid.UUID `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	Method  string    `gorm:"type:varchar(20);not null" json:"method"`
+	Success bool      `gorm:"not null" json:"success"`
+	// FailureReason is the error that refused a failed login.
+	FailureReason string `gorm:"type:varchar(100)" json:"failure_reason,omitempty"`
+	IP            string `gorm:"type:varchar(45)" json:"ip"`
+	UserAgent     string `gorm:"type:varchar(512)" json:"user_agent"`
+	// Device, Browser and OS are parsed from the user agent.
+	Device  string `gorm:"type:varchar(20)" json:"device"`
+	Browser string `gorm:"type:varchar(50)" json:"browser"`
+	OS      string `gorm:"type:varchar(50)" json:"os"`
+	// DeviceHash identifies the browser by a hash of its device cookie.
+	DeviceHash string `gorm:"type:varchar(64);index" json:"-"`
+	// NewDevice is set on successful logins from a browser the account never logged in from before.
+	NewDevice bool `gorm:"not null;default:false" json:"new_device"`
+	// Country, Latitude and Longitude are looked up in the GeoIP database when risk scoring is enabled.
+	Country   string   `gorm:"type:varchar(2)" json:"country,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// RiskScore, RiskDecision and RiskReasons record how the login was assessed.
+	RiskScore    int       `gorm:"not null;default:0" json:"risk_score"`
+	RiskDecision string    `gorm:"type:varchar(20)" json:"risk_decision,omitempty"`
+	RiskReasons  string    `gorm:"type:varchar(200)" json:"risk_reasons,omitempty"`
+	CreatedAt    time.Time `gorm:"not null;index" json:"created_at"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"time"
 )
 
 type CustomClaims struct {
@@ -10,3 +11,42 @@ type CustomClaims struct {
 	Purpose string    `json:"purpose"` // <- Custom claim: "email_verification", "reset_password", etc.
 	jwt.RegisteredClaims
 }
+
+// AccessClaims are the claims of access tokens, which authenticate requests as bearer tokens. They
+// are not stored, so they stay valid until they expire.
+type AccessClaims struct {
+	UserID  uuid.UUID `json:"userId"`
+	Purpose string    `json:"purpose"`
+	Email   string    `json:"email"`
+	Roles   []string  `json:"roles"`
+	// Scope is the space-separated list of scopes the token was issued for, as in RFC 8693
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// OneTimeToken is a pending one-time token persisted by the Postgres token store.
+type OneTimeToken struct {
+	UserID    uuid.UUID `gorm:"primaryKey;type:uuid"`
+	Purpose   string    `gorm:"primaryKey;type:varchar(64)"`
+	Value     string    `gorm:"type:text;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// VerificationCode is a pending numeric verification code persisted by the Postgres code store.
+type VerificationCode struct {
+	Purpose   string    `gorm:"primaryKey;type:varchar(64)"`
+	Email     string    `gorm:"primaryKey;type:varchar(255)"`
+	CodeHash  string    `gorm:"type:text;not null"`
+	Attempts  int       `gorm:"not null;default:0"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// SigningKey is an access token signing key persisted by the Postgres signing key store, which
+// rotates them. The private key is stored encrypted with a key derived from the token secret.
+type SigningKey struct {
+	ID         string    `gorm:"primaryKey;type:varchar(100)"`
+	PrivateKey []byte    `gorm:"type:bytea;not null"`
+	CreatedAt  time.Time `gorm:"not null;index"`
+}
@@ -16,4 +16,124 @@ type User struct {
 	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	// PasswordChangedAt is when the current password was set; nil for accounts created before it was
+	// tracked and not yet backfilled.
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	Role              string     `gorm:"type:varchar(20);not null;default:user" json:"role"`
+	// Status is one of the AccountStatus values; empty is treated as active.
+	Status string `gorm:"type:varchar(20);not null;default:active;index" json:"status"`
+	// StatusReason and StatusActor explain the last status change and who made it.
+	StatusReason    string     `gorm:"type:varchar(500)" json:"status_reason,omitempty"`
+	StatusActor     string     `gorm:"type:varchar(100)" json:"status_actor,omitempty"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	// SuspendedUntil is when a suspension ends by itself.
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	// LastLoginAt is when the user last logged in successfully.
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// User roles.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account statuses. A suspended account becomes active again once SuspendedUntil has passed.
+const (
+	AccountStatusActive      = "active"
+	AccountStatusSuspended   = "suspended"
+	AccountStatusBanned      = "banned"
+	AccountStatusDeactivated = "deactivated"
+)
+
+// EffectiveRole returns the user's role, defaulting to RoleUser.
+func (u *User) EffectiveRole() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+// AccountStatus returns the status in effect at now, taking the end of a suspension into account.
+func (u *User) AccountStatus(now time.Time) string {
+	switch u.Status {
+	case "":
+		return AccountStatusActive
+	case AccountStatusSuspended:
+		if u.SuspendedUntil != nil && !now.Before(*u.SuspendedUntil) {
+			return AccountStatusActive
+		}
+	}
+	return u.Status
+}
+
+// PasswordAge returns how long the current password has been in use. Passwords of accounts that
+// never recorded a change have age 0, so they do not expire by the age of the account.
+func (u *User) PasswordAge(now time.Time) time.Duration {
+	if u.PasswordChangedAt == nil {
+		return 0
+	}
+	return now.Sub(*u.PasswordChangedAt)
+}
+
+// PasswordHistory is a previous password hash of a user, kept to prevent reuse.
+type PasswordHistory struct {
+	ID           uuid.UUID `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index"`
+	PasswordHash string    `gorm:"type:varchar(255);not null"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName keeps the table name singular to match the migration.
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
+
+// PendingRegistration is a signup whose email address has not been verified yet. The user
+// row is only created, with the same ID, once the address is verified.
+type PendingRegistration struct {
+	ID           uuid.UUID `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
+	Email        string    `gorm:"type:varchar(255);index;not null"`
+	FullName     string    `gorm:"type:varchar(100);not null"`
+	PasswordHash string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+// ErasureTombstone records that a user's personal data was erased, without keeping any of it.
+type ErasureTombstone struct {
+	ID     uuid.UUID `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	// EmailHash is a keyed hash of the erased email address, so a later request about the same
+	// address can be matched to the erasure without storing the address itself.
+	EmailHash string `gorm:"type:varchar(64);not null;index" json:"email_hash"`
+	// Actor is who requested the erasure: "self" or "admin".
+	Actor    string    `gorm:"type:varchar(20);not null" json:"actor"`
+	ErasedAt time.Time `gorm:"not null" json:"erased_at"`
+}
+
+// Data export job states.
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// ExportJob is a request for a copy of a user's personal data. The archive is built in the
+// background and can be downloaded until the job expires.
+type ExportJob struct {
+	ID     uuid.UUID `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	// Actor is who requested the export: "self" or "admin".
+	Actor  string `gorm:"type:varchar(20);not null" json:"actor"`
+	Format string `gorm:"type:varchar(10);not null" json:"format"`
+	Status string `gorm:"type:varchar(20);not null" json:"status"`
+	// Error is why a failed export failed.
+	Error string `gorm:"type:varchar(200)" json:"error,omitempty"`
+	// Archive is the finished export in Format.
+	Archive     []byte     `gorm:"type:bytea" json:"-"`
+	CreatedAt   time.Time  `gorm:"not null" json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expires_at"`
 }
@@ -0,0 +1,87 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strconv"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type argon2id struct {
+	memory      uint32
+	time        uint32
+	parallelism uint8
+}
+
+func newArgon2id(memory, time uint32, parallelism uint8) algorithm {
+	return &argon2id{memory: memory, time: time, parallelism: parallelism}
+}
+
+func (a *argon2id) hash(input []byte, peppered bool) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(input, salt, a.time, a.memory, a.parallelism, argon2KeyLength)
+
+	params := formatParams(peppered,
+		"m", strconv.FormatUint(uint64(a.memory), 10),
+		"t", strconv.FormatUint(uint64(a.time), 10),
+		"p", strconv.FormatUint(uint64(a.parallelism), 10),
+	)
+	return fmt.Sprintf("$%s$v=%d$%s$%s$%s", AlgorithmArgon2id, argon2.Version, params,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *argon2id) verify(input []byte, h *phcHash) (bool, error) {
+	if h.version != strconv.Itoa(argon2.Version) {
+		return false, fmt.Errorf("unsupported argon2 version %q", h.version)
+	}
+	memory, time, parallelism, err := argon2Params(h)
+	if err != nil {
+		return false, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(h.salt)
+	if err != nil {
+		return false, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(h.hash)
+	if err != nil {
+		return false, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+
+	key := argon2.IDKey(input, salt, time, memory, parallelism, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+func (a *argon2id) outdated(h *phcHash) bool {
+	memory, time, parallelism, err := argon2Params(h)
+	if err != nil {
+		return true
+	}
+	return memory != a.memory || time != a.time || parallelism != a.parallelism
+}
+
+// argon2Params reads the cost parameters of a parsed argon2id hash.
+func argon2Params(h *phcHash) (memory, time uint32, parallelism uint8, err error) {
+	m, err := strconv.ParseUint(h.params["m"], 10, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed argon2id memory parameter: %w", err)
+	}
+	t, err := strconv.ParseUint(h.params["t"], 10, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed argon2id time parameter: %w", err)
+	}
+	p, err := strconv.ParseUint(h.params["p"], 10, 8)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed argon2id parallelism parameter: %w", err)
+	}
+	return uint32(m), uint32(t), uint8(p), nil
+}
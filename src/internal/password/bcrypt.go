@@ -0,0 +1,64 @@
+package password
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"strings"
+)
+
+type bcryptAlgorithm struct {
+	cost int
+}
+
+func newBcrypt(cost int) (algorithm, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &bcryptAlgorithm{cost: cost}, nil
+}
+
+func (b *bcryptAlgorithm) hash(input []byte, peppered bool) (string, error) {
+	native, err := bcrypt.GenerateFromPassword(prehash(input), b.cost)
+	if err != nil {
+		return "", err
+	}
+	// Native format is $2a$<cost>$<salt and hash>
+	fields := strings.Split(string(native), "$")
+	params := formatParams(peppered, "r", strconv.Itoa(b.cost))
+	return fmt.Sprintf("$%s$%s$%s", AlgorithmBcrypt, params, fields[3]), nil
+}
+
+func (b *bcryptAlgorithm) verify(input []byte, h *phcHash) (bool, error) {
+	native := h.hash
+	if !h.legacy {
+		cost, err := strconv.Atoi(h.params["r"])
+		if err != nil {
+			return false, fmt.Errorf("malformed bcrypt cost parameter: %w", err)
+		}
+		native = fmt.Sprintf("$2a$%02d$%s", cost, h.hash)
+		input = prehash(input)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(native), input)
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *bcryptAlgorithm) outdated(h *phcHash) bool {
+	cost, err := strconv.Atoi(h.params["r"])
+	return err != nil || cost != b.cost
+}
+
+// prehash condenses the input so that bcrypt never truncates passwords longer than 72 bytes.
+func prehash(input []byte) []byte {
+	sum := sha256.Sum256(input)
+	return []byte(base64.RawStdEncoding.EncodeToString(sum[:]))
+}
@@ -0,0 +1,223 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BreachChecker reports whether a password is known from a data breach.
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// The breach index is a binary file holding the SHA-1 hashes of breached passwords:
+//
+//	magic     8 bytes  "PWNIDX01"
+//	count     uint64   number of hashes
+//	fanout    65536 x uint64, entry p is the number of hashes whose first two bytes are <= p
+//	hashes    count x 20 bytes, sorted
+//
+// The fanout table narrows every lookup to a small bucket that is binary searched on disk,
+// so only the 512 KiB table is held in memory regardless of the corpus size.
+const (
+	breachIndexMagic = "PWNIDX01"
+	breachFanoutSize = 1 << 16
+	breachHashSize   = sha1.Size
+	breachHeaderSize = len(breachIndexMagic) + 8 + breachFanoutSize*8
+)
+
+// BreachIndex is a BreachChecker backed by an index file built with BuildBreachIndex.
+type BreachIndex struct {
+	file   *os.File
+	count  uint64
+	fanout []uint64
+}
+
+// OpenBreachIndex opens an index file built with BuildBreachIndex.
+func OpenBreachIndex(path string) (*BreachIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, breachHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read breach index header: %w", err)
+	}
+	if string(header[:len(breachIndexMagic)]) != breachIndexMagic {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a breach index", path)
+	}
+
+	index := &BreachIndex{
+		file:   file,
+		count:  binary.BigEndian.Uint64(header[len(breachIndexMagic):]),
+		fanout: make([]uint64, breachFanoutSize),
+	}
+	table := header[len(breachIndexMagic)+8:]
+	for i := range index.fanout {
+		index.fanout[i] = binary.BigEndian.Uint64(table[i*8:])
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if expected := int64(breachHeaderSize) + int64(index.count)*breachHashSize; info.Size() != expected {
+		file.Close()
+		return nil, fmt.Errorf("breach index %s is truncated: expected %d bytes, got %d", path, expected, info.Size())
+	}
+	return index, nil
+}
+
+// Count returns the number of hashes in the index.
+func (b *BreachIndex) Count() uint64 {
+	return b.count
+}
+
+// Close closes the index file.
+func (b *BreachIndex) Close() error {
+	return b.file.Close()
+}
+
+// IsBreached reports whether the SHA-1 hash of the password is in the index.
+func (b *BreachIndex) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	prefix := binary.BigEndian.Uint16(sum[:2])
+
+	low := uint64(0)
+	if prefix > 0 {
+		low = b.fanout[prefix-1]
+	}
+	high := b.fanout[prefix]
+
+	record := make([]byte, breachHashSize)
+	for low < high {
+		mid := low + (high-low)/2
+		if _, err := b.file.ReadAt(record, int64(breachHeaderSize)+int64(mid)*breachHashSize); err != nil {
+			return false, fmt.Errorf("failed to read breach index: %w", err)
+		}
+		switch cmp := bytes.Compare(record, sum[:]); {
+		case cmp == 0:
+			return true, nil
+		case cmp < 0:
+			low = mid + 1
+		default:
+			high = mid
+		}
+	}
+	return false, nil
+}
+
+// BuildBreachIndex converts a Have I Been Pwned SHA-1 dump ("ordered by hash", one
+// HASH:COUNT line per password) into an index file. Hashes seen fewer than minCount times
+// are skipped to shrink the index. It returns the number of hashes written.
+func BuildBreachIndex(dump io.Reader, out io.WriteSeeker, minCount int) (uint64, error) {
+	// Reserve space for the header, which is only known once every hash has been written
+	if _, err := out.Write(make([]byte, breachHeaderSize)); err != nil {
+		return 0, err
+	}
+
+	writer := bufio.NewWriterSize(out, 1<<20)
+	scanner := bufio.NewScanner(dump)
+	fanout := make([]uint64, breachFanoutSize)
+	var count uint64
+	var previous []byte
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		hashText, countText, _ := strings.Cut(text, ":")
+		if minCount > 1 {
+			seen, err := strconv.Atoi(countText)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: invalid count %q", line, countText)
+			}
+			if seen < minCount {
+				continue
+			}
+		}
+
+		hash, err := hex.DecodeString(hashText)
+		if err != nil || len(hash) != breachHashSize {
+			return 0, fmt.Errorf("line %d: invalid SHA-1 hash %q", line, hashText)
+		}
+		if previous != nil {
+			switch cmp := bytes.Compare(previous, hash); {
+			case cmp == 0:
+				continue
+			case cmp > 0:
+				return 0, fmt.Errorf("line %d: dump is not ordered by hash", line)
+			}
+		}
+
+		if _, err := writer.Write(hash); err != nil {
+			return 0, err
+		}
+		fanout[binary.BigEndian.Uint16(hash[:2])]++
+		count++
+		previous = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, 0, breachHeaderSize)
+	header = append(header, breachIndexMagic...)
+	header = binary.BigEndian.AppendUint64(header, count)
+	var cumulative uint64
+	for _, n := range fanout {
+		cumulative += n
+		header = binary.BigEndian.AppendUint64(header, cumulative)
+	}
+
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := out.Write(header); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// checkBreached returns a violation if the checker knows the password from a breach.
+// Lookup failures are treated as not breached so an unreadable index cannot lock users out.
+func checkBreached(checker BreachChecker, password string) *Violation {
+	if checker == nil {
+		return nil
+	}
+	breached, err := checker.IsBreached(password)
+	if err != nil {
+		log.Printf("Error checking password against the breach index: %v", err)
+		return nil
+	}
+	if !breached {
+		return nil
+	}
+	return &Violation{Rule: RuleBreached, Message: "Password has appeared in a data breach, please choose another one"}
+}
+
+// CheckBreached returns a *PolicyError if the checker knows the password from a breach.
+func CheckBreached(checker BreachChecker, password string) error {
+	if violation := checkBreached(checker, password); violation != nil {
+		return &PolicyError{Violations: []Violation{*violation}}
+	}
+	return nil
+}
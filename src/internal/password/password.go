@@ -0,0 +1,241 @@
+// Package password hashes and verifies user passwords using PHC-formatted hashes.
+package password
+
+import (
+	"authentication/src/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// Hasher hashes passwords and verifies them against stored hashes.
+type Hasher interface {
+	// Hash returns the PHC-formatted hash of the password using the current parameters.
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash.
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether the encoded hash was made with an algorithm, parameters
+	// or pepper setting other than the current ones and should be replaced.
+	NeedsRehash(encoded string) bool
+}
+
+// Params configures a Hasher.
+type Params struct {
+	// Algorithm used for new hashes, AlgorithmArgon2id or AlgorithmBcrypt.
+	Algorithm string
+	// Argon2Memory is the argon2id memory cost in KiB.
+	Argon2Memory uint32
+	// Argon2Time is the argon2id number of passes over the memory.
+	Argon2Time uint32
+	// Argon2Parallelism is the argon2id number of lanes.
+	Argon2Parallelism uint8
+	// BcryptCost is the bcrypt work factor.
+	BcryptCost int
+	// Pepper is an optional server-side secret mixed into every new hash. It is not
+	// stored with the hash, so a leaked database alone is not enough to crack passwords.
+	Pepper string
+}
+
+// DefaultParams returns the recommended parameters for new hashes.
+func DefaultParams() Params {
+	return Params{
+		Algorithm:         AlgorithmArgon2id,
+		Argon2Memory:      64 * 1024,
+		Argon2Time:        3,
+		Argon2Parallelism: 2,
+		BcryptCost:        12,
+	}
+}
+
+// algorithm implements one hashing scheme.
+type algorithm interface {
+	// hash returns the encoded hash of input.
+	hash(input []byte, peppered bool) (string, error)
+	// verify reports whether input matches the parsed hash.
+	verify(input []byte, h *phcHash) (bool, error)
+	// outdated reports whether the parsed hash uses other parameters than the current ones.
+	outdated(h *phcHash) bool
+}
+
+type hasher struct {
+	params     Params
+	current    algorithm
+	algorithms map[string]algorithm
+}
+
+// NewHasher creates a Hasher producing hashes with the given parameters. Hashes made by
+// any supported algorithm, including legacy raw bcrypt hashes, can always be verified.
+func NewHasher(params Params) (Hasher, error) {
+	defaults := DefaultParams()
+	if params.Algorithm == "" {
+		params.Algorithm = defaults.Algorithm
+	}
+	if params.Argon2Memory == 0 {
+		params.Argon2Memory = defaults.Argon2Memory
+	}
+	if params.Argon2Time == 0 {
+		params.Argon2Time = defaults.Argon2Time
+	}
+	if params.Argon2Parallelism == 0 {
+		params.Argon2Parallelism = defaults.Argon2Parallelism
+	}
+	if params.BcryptCost == 0 {
+		params.BcryptCost = defaults.BcryptCost
+	}
+
+	bcryptAlgorithm, err := newBcrypt(params.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	h := &hasher{
+		params: params,
+		algorithms: map[string]algorithm{
+			AlgorithmArgon2id: newArgon2id(params.Argon2Memory, params.Argon2Time, params.Argon2Parallelism),
+			AlgorithmBcrypt:   bcryptAlgorithm,
+		},
+	}
+
+	current, ok := h.algorithms[params.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", params.Algorithm)
+	}
+	h.current = current
+	return h, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	peppered := h.params.Pepper != ""
+	return h.current.hash(h.input(password, peppered), peppered)
+}
+
+func (h *hasher) Verify(password, encoded string) (bool, error) {
+	parsed, err := parsePHC(encoded)
+	if err != nil {
+		return false, err
+	}
+	alg, ok := h.algorithms[parsed.id]
+	if !ok {
+		return false, fmt.Errorf("unsupported password hash algorithm %q", parsed.id)
+	}
+
+	peppered := parsed.peppered()
+	if peppered && h.params.Pepper == "" {
+		return false, fmt.Errorf("password hash requires a pepper but none is configured")
+	}
+	if parsed.legacy {
+		// Legacy bcrypt hashes were made from the raw password
+		return alg.verify([]byte(password), parsed)
+	}
+	return alg.verify(h.input(password, peppered), parsed)
+}
+
+func (h *hasher) NeedsRehash(encoded string) bool {
+	parsed, err := parsePHC(encoded)
+	if err != nil {
+		return true
+	}
+	if parsed.legacy || parsed.id != h.params.Algorithm {
+		return true
+	}
+	if parsed.peppered() != (h.params.Pepper != "") {
+		return true
+	}
+	return h.current.outdated(parsed)
+}
+
+// input derives the bytes that are actually hashed. With a pepper the password is keyed with HMAC-SHA256.
+func (h *hasher) input(password string, peppered bool) []byte {
+	if !peppered {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, []byte(h.params.Pepper))
+	mac.Write([]byte(password))
+	return []byte(base64.RawStdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// phcHash is a parsed hash string of the form $id$param=value,...$salt$hash.
+type phcHash struct {
+	id      string
+	version string
+	params  map[string]string
+	salt    string
+	hash    string
+	// legacy marks a bcrypt hash in its native $2a$ format
+	legacy bool
+}
+
+func (p *phcHash) peppered() bool {
+	return p.params["pepper"] == "1"
+}
+
+func parsePHC(encoded string) (*phcHash, error) {
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		return &phcHash{id: AlgorithmBcrypt, hash: encoded, legacy: true, params: map[string]string{}}, nil
+	}
+
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 4 || fields[0] != "" {
+		return nil, fmt.Errorf("malformed password hash")
+	}
+
+	parsed := &phcHash{id: fields[1], params: map[string]string{}}
+	fields = fields[2:]
+	if strings.HasPrefix(fields[0], "v=") {
+		parsed.version = strings.TrimPrefix(fields[0], "v=")
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("malformed password hash")
+	}
+	if strings.Contains(fields[0], "=") {
+		for _, pair := range strings.Split(fields[0], ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("malformed password hash parameter %q", pair)
+			}
+			parsed.params[key] = value
+		}
+		fields = fields[1:]
+	}
+
+	switch len(fields) {
+	case 1:
+		parsed.hash = fields[0]
+	case 2:
+		parsed.salt, parsed.hash = fields[0], fields[1]
+	default:
+		return nil, fmt.Errorf("malformed password hash")
+	}
+	return parsed, nil
+}
+
+// formatParams encodes parameters in the given order, appending the pepper marker when used.
+func formatParams(peppered bool, pairs ...string) string {
+	params := make([]string, 0, len(pairs)/2+1)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		params = append(params, pairs[i]+"="+pairs[i+1])
+	}
+	if peppered {
+		params = append(params, "pepper=1")
+	}
+	return strings.Join(params, ",")
+}
+
+// NewHasherFromConfig creates a Hasher from the application configuration.
+func NewHasherFromConfig(cfg config.PasswordConfig) (Hasher, error) {
+	return NewHasher(Params{
+		Algorithm:         cfg.Algorithm,
+		Argon2Memory:      uint32(cfg.Argon2Memory),
+		Argon2Time:        uint32(cfg.Argon2Time),
+		Argon2Parallelism: uint8(cfg.Argon2Parallelism),
+		BcryptCost:        cfg.BcryptCost,
+		Pepper:            cfg.Pepper,
+	})
+}
@@ -0,0 +1,316 @@
+package password_test
+
+import (
+	"authentication/src/internal/errs"
+	"authentication/src/internal/password"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// cheapParams keeps the tests fast while still exercising every code path.
+func cheapParams(algorithm string) password.Params {
+	return password.Params{
+		Algorithm:         algorithm,
+		Argon2Memory:      1024,
+		Argon2Time:        1,
+		Argon2Parallelism: 1,
+		BcryptCost:        bcrypt.MinCost,
+	}
+}
+
+func newHasher(t *testing.T, params password.Params) password.Hasher {
+	t.Helper()
+	hasher, err := password.NewHasher(params)
+	if err != nil {
+		t.Fatalf("Failed to create hasher: %v", err)
+	}
+	return hasher
+}
+
+func TestHashAndVerify(t *testing.T) {
+	for _, algorithm := range []string{password.AlgorithmArgon2id, password.AlgorithmBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			hasher := newHasher(t, cheapParams(algorithm))
+
+			hash, err := hasher.Hash("securePassword123")
+			if err != nil {
+				t.Fatalf("Error hashing password: %v", err)
+			}
+			if !strings.HasPrefix(hash, "$"+algorithm+"$") {
+				t.Errorf("Expected a PHC hash for %s, got %q", algorithm, hash)
+			}
+
+			if ok, err := hasher.Verify("securePassword123", hash); err != nil || !ok {
+				t.Errorf("Expected the password to match, got %v (%v)", ok, err)
+			}
+			if ok, _ := hasher.Verify("wrongPassword123", hash); ok {
+				t.Error("Expected a wrong password not to match")
+			}
+			if hasher.NeedsRehash(hash) {
+				t.Error("Expected a fresh hash not to need rehashing")
+			}
+		})
+	}
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	hasher := newHasher(t, cheapParams(password.AlgorithmArgon2id))
+
+	hash, err := hasher.Hash("securePassword123")
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Unexpected argon2id hash format %q", hash)
+	}
+}
+
+func TestBcryptDoesNotTruncateLongPasswords(t *testing.T) {
+	hasher := newHasher(t, cheapParams(password.AlgorithmBcrypt))
+	long := strings.Repeat("a", 100)
+
+	hash, err := hasher.Hash(long + "1")
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+	if ok, _ := hasher.Verify(long+"2", hash); ok {
+		t.Error("Expected passwords differing after 72 bytes not to match")
+	}
+}
+
+func TestLegacyBcryptHash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("securePassword123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error creating legacy hash: %v", err)
+	}
+	hasher := newHasher(t, cheapParams(password.AlgorithmArgon2id))
+
+	if ok, err := hasher.Verify("securePassword123", string(legacy)); err != nil || !ok {
+		t.Errorf("Expected the legacy hash to verify, got %v (%v)", ok, err)
+	}
+	if !hasher.NeedsRehash(string(legacy)) {
+		t.Error("Expected a legacy hash to need rehashing")
+	}
+}
+
+func TestNeedsRehashOnParameterChange(t *testing.T) {
+	hash, err := newHasher(t, cheapParams(password.AlgorithmArgon2id)).Hash("securePassword123")
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+
+	stronger := cheapParams(password.AlgorithmArgon2id)
+	stronger.Argon2Time = 2
+	if !newHasher(t, stronger).NeedsRehash(hash) {
+		t.Error("Expected a hash with weaker parameters to need rehashing")
+	}
+	if !newHasher(t, cheapParams(password.AlgorithmBcrypt)).NeedsRehash(hash) {
+		t.Error("Expected a hash of another algorithm to need rehashing")
+	}
+}
+
+func TestPepper(t *testing.T) {
+	params := cheapParams(password.AlgorithmArgon2id)
+	params.Pepper = "server-side-pepper"
+	peppered := newHasher(t, params)
+
+	hash, err := peppered.Hash("securePassword123")
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+	if ok, err := peppered.Verify("securePassword123", hash); err != nil || !ok {
+		t.Errorf("Expected the peppered hash to verify, got %v (%v)", ok, err)
+	}
+
+	params.Pepper = "another-pepper"
+	if ok, _ := newHasher(t, params).Verify("securePassword123", hash); ok {
+		t.Error("Expected verification with a different pepper to fail")
+	}
+
+	unpeppered := newHasher(t, cheapParams(password.AlgorithmArgon2id))
+	if _, err := unpeppered.Verify("securePassword123", hash); err == nil {
+		t.Error("Expected verification without the pepper to fail with an error")
+	}
+
+	plain, err := unpeppered.Hash("securePassword123")
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+	if !peppered.NeedsRehash(plain) {
+		t.Error("Expected an unpeppered hash to need rehashing once a pepper is configured")
+	}
+}
+
+func TestUnsupportedAlgorithm(t *testing.T) {
+	if _, err := password.NewHasher(password.Params{Algorithm: "md5"}); err == nil {
+		t.Error("Expected an unsupported algorithm to be rejected")
+	}
+}
+
+func TestPolicyRejectsCommonPasswords(t *testing.T) {
+	policy := password.DefaultPolicy()
+	for _, candidate := range []string{"password", "P@ssw0rd", "qwertyuiop", "abcdefgh", "123456789"} {
+		if err := policy.Check(candidate); err == nil {
+			t.Errorf("Expected %q to be rejected", candidate)
+		}
+	}
+	for _, candidate := range []string{"securePassword123", "correct horse battery staple", "xK9#mQ2$vL"} {
+		if err := policy.Check(candidate); err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", candidate, err)
+		}
+	}
+}
+
+func TestPolicyReportsEveryViolation(t *testing.T) {
+	policy := password.Policy{
+		MinLength:        12,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		MaxRepeats:       2,
+	}
+
+	err := policy.Check("jaaane")
+	var policyErr *password.PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Expected a policy error, got %v", err)
+	}
+	if !errors.Is(err, errs.ErrWeakPassword) {
+		t.Error("Expected the policy error to match errs.ErrWeakPassword")
+	}
+
+	rules := make(map[string]bool)
+	for _, v := range policyErr.Violations {
+		rules[v.Rule] = true
+	}
+	for _, rule := range []string{password.RuleMinLength, password.RuleUppercase, password.RuleDigit, password.RuleSymbol, password.RuleMaxRepeats} {
+		if !rules[rule] {
+			t.Errorf("Expected a %s violation, got %v", rule, policyErr.Violations)
+		}
+	}
+}
+
+func TestPolicyBansUserInputs(t *testing.T) {
+	policy := password.DefaultPolicy()
+	policy.BannedWords = []string{"acme"}
+
+	for _, candidate := range []string{"Jane-is-great-2024", "my-d0e-family-rocks", "ACME-rocket-launcher"} {
+		evaluation := policy.Evaluate(candidate, "Jane Doe", "jane.doe@example.com")
+		if evaluation.Valid {
+			t.Errorf("Expected %q to be rejected", candidate)
+		}
+	}
+}
+
+func TestStrengthScoresIncrease(t *testing.T) {
+	policy := password.Policy{}
+	weak := policy.Evaluate("password1")
+	strong := policy.Evaluate("correct horse battery staple")
+
+	if weak.Score >= strong.Score {
+		t.Errorf("Expected a higher score for the stronger password, got %d and %d", weak.Score, strong.Score)
+	}
+	if weak.Feedback.Warning == "" {
+		t.Error("Expected feedback for a weak password")
+	}
+	if strong.Score != 4 {
+		t.Errorf("Expected the strongest score, got %d", strong.Score)
+	}
+}
+
+// sha1Dump returns a dump in the Have I Been Pwned format for the passwords, ordered by hash.
+func sha1Dump(counts map[string]int) string {
+	lines := make([]string, 0, len(counts))
+	for pw, count := range counts {
+		sum := sha1.Sum([]byte(pw))
+		lines = append(lines, fmt.Sprintf("%X:%d", sum, count))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func buildIndex(t *testing.T, dump string, minCount int) *password.BreachIndex {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pwned.idx")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create index file: %v", err)
+	}
+	if _, err := password.BuildBreachIndex(strings.NewReader(dump), file, minCount); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+	file.Close()
+
+	index, err := password.OpenBreachIndex(path)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	t.Cleanup(func() { index.Close() })
+	return index
+}
+
+func TestBreachIndex(t *testing.T) {
+	counts := map[string]int{"password": 9000000, "letmein": 500, "rarely-used-secret": 1}
+	for i := 0; i < 1000; i++ {
+		counts[fmt.Sprintf("filler-%d", i)] = 2
+	}
+	index := buildIndex(t, sha1Dump(counts), 1)
+
+	if index.Count() != uint64(len(counts)) {
+		t.Errorf("Expected %d hashes, got %d", len(counts), index.Count())
+	}
+	for pw := range counts {
+		if breached, err := index.IsBreached(pw); err != nil || !breached {
+			t.Fatalf("Expected %q to be breached, got %v (%v)", pw, breached, err)
+		}
+	}
+	if breached, _ := index.IsBreached("securePassword123"); breached {
+		t.Error("Expected an unknown password not to be breached")
+	}
+
+	err := password.CheckBreached(index, "letmein")
+	if !errors.Is(err, errs.ErrWeakPassword) {
+		t.Errorf("Expected a breached password to violate the policy, got %v", err)
+	}
+}
+
+func TestBreachIndexMinCount(t *testing.T) {
+	index := buildIndex(t, sha1Dump(map[string]int{"password": 9000000, "rarely-used-secret": 1}), 10)
+
+	if breached, _ := index.IsBreached("rarely-used-secret"); breached {
+		t.Error("Expected hashes below the minimum count to be skipped")
+	}
+	if breached, _ := index.IsBreached("password"); !breached {
+		t.Error("Expected frequent hashes to be kept")
+	}
+}
+
+func TestBuildBreachIndexRequiresOrderedDump(t *testing.T) {
+	dump := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1\n0000000000000000000000000000000000000000:1\n"
+	file, err := os.Create(filepath.Join(t.TempDir(), "pwned.idx"))
+	if err != nil {
+		t.Fatalf("Failed to create index file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := password.BuildBreachIndex(strings.NewReader(dump), file, 1); err == nil {
+		t.Error("Expected an unordered dump to be rejected")
+	}
+}
+
+func TestPolicyRejectsBreachedPasswords(t *testing.T) {
+	policy := password.DefaultPolicy()
+	policy.BreachChecker = buildIndex(t, sha1Dump(map[string]int{"correct horse battery staple": 30}), 1)
+
+	evaluation := policy.Evaluate("correct horse battery staple")
+	if evaluation.Valid || evaluation.Violations[0].Rule != password.RuleBreached {
+		t.Errorf("Expected a breached violation, got %v", evaluation.Violations)
+	}
+}
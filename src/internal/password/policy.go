@@ -0,0 +1,240 @@
+package password
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/errs"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Rules reported in policy violations.
+const (
+	RuleMinLength  = "min_length"
+	RuleMaxLength  = "max_length"
+	RuleUppercase  = "uppercase"
+	RuleLowercase  = "lowercase"
+	RuleDigit      = "digit"
+	RuleSymbol     = "symbol"
+	RuleMaxRepeats = "max_repeats"
+	RuleBannedWord = "banned_word"
+	RuleTooWeak    = "too_weak"
+	RuleBreached   = "breached"
+	RuleReused     = "reused"
+)
+
+// minBannedWordLength keeps very short name parts from rejecting unrelated passwords.
+const minBannedWordLength = 3
+
+// Policy describes the requirements a new password has to meet.
+type Policy struct {
+	MinLength int
+	MaxLength int
+
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+
+	// MaxRepeats is the longest allowed run of one character, 0 disables the rule.
+	MaxRepeats int
+	// BannedWords may not appear anywhere in the password, ignoring case and common substitutions.
+	BannedWords []string
+	// MinScore is the minimum strength score from 0 (trivial) to 4 (very strong).
+	MinScore int
+	// BreachChecker rejects passwords known from data breaches when set.
+	BreachChecker BreachChecker
+
+	// HistorySize is the number of most recent passwords, including the current one, that
+	// may not be reused. 0 disables the rule.
+	HistorySize int
+	// MaxAge is how long a password may be used before it has to be changed. 0 disables expiry.
+	MaxAge time.Duration
+}
+
+// Violation describes one policy rule a password does not meet.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError is returned when a password does not meet the policy. It matches errs.ErrWeakPassword.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return fmt.Sprintf("%v: %s", errs.ErrWeakPassword, strings.Join(messages, "; "))
+}
+
+func (e *PolicyError) Unwrap() error {
+	return errs.ErrWeakPassword
+}
+
+// Evaluation is the result of checking a password against a policy.
+type Evaluation struct {
+	Strength
+	Valid      bool        `json:"valid"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// DefaultPolicy returns the policy used when none is configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:   8,
+		MaxLength:   128,
+		MaxRepeats:  3,
+		MinScore:    2,
+		HistorySize: 5,
+	}
+}
+
+// NewPolicyFromConfig creates a Policy from the application configuration.
+func NewPolicyFromConfig(cfg config.PasswordConfig) Policy {
+	return Policy{
+		MinLength:        cfg.MinLength,
+		MaxLength:        cfg.MaxLength,
+		RequireUppercase: cfg.RequireUppercase,
+		RequireLowercase: cfg.RequireLowercase,
+		RequireDigit:     cfg.RequireDigit,
+		RequireSymbol:    cfg.RequireSymbol,
+		MaxRepeats:       cfg.MaxRepeats,
+		BannedWords:      cfg.BannedWords,
+		MinScore:         cfg.MinScore,
+		HistorySize:      cfg.HistorySize,
+		MaxAge:           time.Duration(cfg.MaxAgeDays) * 24 * time.Hour,
+	}
+}
+
+// Check returns a *PolicyError listing every violated rule, or nil if the password is acceptable.
+// userInputs, such as the user's name and email address, are treated as banned words.
+func (p Policy) Check(password string, userInputs ...string) error {
+	evaluation := p.Evaluate(password, userInputs...)
+	if evaluation.Valid {
+		return nil
+	}
+	return &PolicyError{Violations: evaluation.Violations}
+}
+
+// ReusedError returns the *PolicyError reported when a password matches a recent one.
+func (p Policy) ReusedError() error {
+	return &PolicyError{Violations: []Violation{{
+		Rule:    RuleReused,
+		Message: fmt.Sprintf("Password must not match any of your last %d passwords", p.HistorySize),
+	}}}
+}
+
+// Expired reports whether a password that has been in use for age must be changed.
+func (p Policy) Expired(age time.Duration) bool {
+	return p.MaxAge > 0 && age > p.MaxAge
+}
+
+// Evaluate estimates the strength of the password and lists the violated rules.
+func (p Policy) Evaluate(password string, userInputs ...string) Evaluation {
+	banned := bannedTokens(p.BannedWords, userInputs)
+	evaluation := Evaluation{Strength: estimateStrength(password, banned)}
+
+	length := len([]rune(password))
+	if p.MinLength > 0 && length < p.MinLength {
+		evaluation.add(RuleMinLength, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		evaluation.add(RuleMaxLength, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		evaluation.add(RuleUppercase, "must contain an uppercase letter")
+	}
+	if p.RequireLowercase && !hasLower {
+		evaluation.add(RuleLowercase, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		evaluation.add(RuleDigit, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		evaluation.add(RuleSymbol, "must contain a symbol")
+	}
+
+	if p.MaxRepeats > 0 && longestRun(password) > p.MaxRepeats {
+		evaluation.add(RuleMaxRepeats, fmt.Sprintf("must not repeat a character more than %d times in a row", p.MaxRepeats))
+	}
+
+	normalized := unleet(strings.ToLower(password))
+	for _, word := range banned {
+		if strings.Contains(normalized, word) {
+			evaluation.add(RuleBannedWord, "must not contain your name, email address or other easily guessed words")
+			break
+		}
+	}
+
+	if evaluation.Score < p.MinScore {
+		evaluation.add(RuleTooWeak, "is too easy to guess")
+	}
+
+	if violation := checkBreached(p.BreachChecker, password); violation != nil {
+		evaluation.Violations = append(evaluation.Violations, *violation)
+	}
+
+	evaluation.Valid = len(evaluation.Violations) == 0
+	return evaluation
+}
+
+func (e *Evaluation) add(rule, message string) {
+	e.Violations = append(e.Violations, Violation{Rule: rule, Message: "Password " + message})
+}
+
+// bannedTokens normalizes the configured banned words and splits user inputs such as
+// "Jane Doe" or "jane.doe@example.com" into the words they consist of.
+func bannedTokens(bannedWords, userInputs []string) []string {
+	var tokens []string
+	for _, word := range bannedWords {
+		if word = strings.ToLower(strings.TrimSpace(word)); len(word) >= minBannedWordLength {
+			tokens = append(tokens, word)
+		}
+	}
+	for _, input := range userInputs {
+		words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if len(word) >= minBannedWordLength {
+				tokens = append(tokens, word)
+			}
+		}
+	}
+	return tokens
+}
+
+// longestRun returns the length of the longest run of one repeated character.
+func longestRun(password string) int {
+	longest, current := 0, 0
+	var previous rune
+	for i, r := range []rune(password) {
+		if i > 0 && r == previous {
+			current++
+		} else {
+			current = 1
+		}
+		previous = r
+		longest = max(longest, current)
+	}
+	return longest
+}
@@ -0,0 +1,283 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Strength is an estimate of how hard a password is to guess, modelled on zxcvbn:
+// the password is split into the cheapest sequence of guessable patterns and the
+// guesses needed for each pattern are multiplied.
+type Strength struct {
+	// Score ranges from 0 (trivial) to 4 (very strong).
+	Score int `json:"score"`
+	// GuessesLog10 is the estimated number of guesses as a power of ten.
+	GuessesLog10 float64  `json:"guesses_log10"`
+	Feedback     Feedback `json:"feedback"`
+}
+
+// Feedback explains a weak score to the user.
+type Feedback struct {
+	Warning     string   `json:"warning,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Score thresholds in log10 guesses, as used by zxcvbn.
+var scoreThresholds = []float64{3, 6, 8, 10}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords maps frequently used passwords and words to their popularity rank.
+var commonPasswords = func() map[string]int {
+	ranks := make(map[string]int)
+	for i, word := range strings.Fields(commonPasswordsFile) {
+		ranks[word] = i + 1
+	}
+	return ranks
+}()
+
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "azertyuiop", "qwertzuiop"}
+
+var leetSubstitutions = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+// unleet reverses common character substitutions such as "p@ssw0rd".
+func unleet(s string) string {
+	return leetSubstitutions.Replace(s)
+}
+
+const (
+	patternBruteforce = iota
+	patternCommon
+	patternUserInput
+	patternRepeat
+	patternSequence
+	patternKeyboard
+	patternYear
+)
+
+// match is a guessable pattern covering part of the password.
+type match struct {
+	pattern int
+	length  int
+	bits    float64
+}
+
+// estimateStrength scores the password. banned words and user inputs are treated as
+// the most likely dictionary words.
+func estimateStrength(password string, banned []string) Strength {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Strength{Feedback: Feedback{Warning: "Enter a password"}}
+	}
+
+	charBits := math.Log2(float64(charsetSize(runes)))
+	lower := []rune(strings.ToLower(password))
+	normalized := []rune(unleet(strings.ToLower(password)))
+	if len(lower) != len(runes) || len(normalized) != len(runes) {
+		// A few non-ASCII characters change length when lowercased; match them as typed
+		lower, normalized = runes, runes
+	}
+
+	dictionary := make(map[string]int, len(banned))
+	for _, word := range banned {
+		dictionary[word] = 1
+	}
+
+	// Walk the password greedily, at each position taking the pattern that saves the most bits
+	// compared to guessing the characters one by one.
+	var bits float64
+	var matches []match
+	for i := 0; i < len(runes); {
+		best := match{pattern: patternBruteforce, length: 1, bits: charBits}
+		bestSaving := 0.0
+		for _, m := range candidateMatches(runes, lower, normalized, i, dictionary) {
+			if saving := float64(m.length)*charBits - m.bits; saving > bestSaving {
+				best, bestSaving = m, saving
+			}
+		}
+		bits += best.bits
+		matches = append(matches, best)
+		i += best.length
+	}
+
+	guessesLog10 := bits * math.Log10(2)
+	score := 0
+	for _, threshold := range scoreThresholds {
+		if guessesLog10 >= threshold {
+			score++
+		}
+	}
+
+	return Strength{
+		Score:        score,
+		GuessesLog10: math.Round(guessesLog10*100) / 100,
+		Feedback:     feedback(score, len(runes), matches),
+	}
+}
+
+// candidateMatches lists the patterns starting at position i.
+func candidateMatches(runes, lower, normalized []rune, i int, dictionary map[string]int) []match {
+	var matches []match
+
+	// Dictionary words, also reversed and with substitutions undone
+	for j := len(runes); j >= i+3; j-- {
+		word := string(normalized[i:j])
+		pattern := patternCommon
+		rank, ok := dictionary[word]
+		if ok {
+			pattern = patternUserInput
+		} else {
+			rank, ok = commonPasswords[word]
+		}
+		if !ok {
+			rank, ok = commonPasswords[reverse(word)]
+			rank *= 2
+		}
+		if !ok {
+			continue
+		}
+		bits := math.Log2(float64(rank) + 1)
+		if string(lower[i:j]) != string(runes[i:j]) {
+			bits++ // capitalization
+		}
+		if string(lower[i:j]) != word {
+			bits++ // substitutions
+		}
+		matches = append(matches, match{pattern: pattern, length: j - i, bits: bits})
+		break
+	}
+
+	// Repeated characters
+	if n := runLength(runes, i, func(a, b rune) bool { return a == b }); n >= 3 {
+		matches = append(matches, match{pattern: patternRepeat, length: n, bits: math.Log2(float64(charsetSize(runes[i:i+1]))) + math.Log2(float64(n))})
+	}
+
+	// Alphabetical or numerical sequences in either direction
+	ascending := runLength(lower, i, func(a, b rune) bool { return b == a+1 })
+	descending := runLength(lower, i, func(a, b rune) bool { return b == a-1 })
+	if n := max(ascending, descending); n >= 3 {
+		bits := math.Log2(float64(charsetSize(runes[i:i+1]))) + math.Log2(float64(n))
+		if descending > ascending {
+			bits++
+		}
+		matches = append(matches, match{pattern: patternSequence, length: n, bits: bits})
+	}
+
+	// Adjacent keys on a keyboard row
+	if n := runLength(lower, i, keyboardAdjacent); n >= 4 {
+		matches = append(matches, match{pattern: patternKeyboard, length: n, bits: math.Log2(float64(len(keyboardRows)*2*10)) + math.Log2(float64(n))})
+	}
+
+	// Recent years
+	if i+4 <= len(runes) {
+		if year, err := strconv.Atoi(string(runes[i : i+4])); err == nil && year >= 1900 && year <= 2099 {
+			matches = append(matches, match{pattern: patternYear, length: 4, bits: math.Log2(200)})
+		}
+	}
+
+	return matches
+}
+
+// runLength returns how many characters starting at i form a chain where every pair satisfies next.
+func runLength(runes []rune, i int, next func(a, b rune) bool) int {
+	n := 1
+	for i+n < len(runes) && next(runes[i+n-1], runes[i+n]) {
+		n++
+	}
+	return n
+}
+
+func keyboardAdjacent(a, b rune) bool {
+	for _, row := range keyboardRows {
+		ia, ib := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if ia >= 0 && ib >= 0 && (ia-ib == 1 || ib-ia == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// charsetSize returns the size of the smallest character set containing every rune.
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	for _, set := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if set.used {
+			size += set.size
+		}
+	}
+	return size
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// feedback explains the weakest pattern found in the password.
+func feedback(score, length int, matches []match) Feedback {
+	if score >= 3 {
+		return Feedback{}
+	}
+
+	var f Feedback
+	for _, m := range matches {
+		switch m.pattern {
+		case patternUserInput:
+			f.Warning = "Passwords containing your name or email address are easy to guess"
+		case patternCommon:
+			if len(matches) == 1 {
+				f.Warning = "This is a very common password"
+			} else if f.Warning == "" {
+				f.Warning = "Common words and passwords are easy to guess"
+			}
+		case patternRepeat:
+			if f.Warning == "" {
+				f.Warning = `Repeated characters like "aaa" are easy to guess`
+			}
+		case patternSequence:
+			if f.Warning == "" {
+				f.Warning = `Sequences like "abc" or "123" are easy to guess`
+			}
+		case patternKeyboard:
+			if f.Warning == "" {
+				f.Warning = "Straight rows of keys are easy to guess"
+			}
+		case patternYear:
+			if f.Warning == "" {
+				f.Warning = "Years are easy to guess"
+			}
+		}
+	}
+
+	f.Suggestions = append(f.Suggestions, "Add another word or two, uncommon words are better")
+	if length < 12 {
+		f.Suggestions = append(f.Suggestions, "Use a longer password")
+	}
+	return f
+}
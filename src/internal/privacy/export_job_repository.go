@@ -0,0 +1,151 @@
+package privacy
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// ExportJobRepository stores data export jobs and their archives.
+type ExportJobRepository interface {
+	// Create stores a new job.
+	Create(ctx context.Context, job *models.ExportJob) error
+	// Get returns the job or gorm.ErrRecordNotFound.
+	Get(ctx context.Context, id uuid.UUID) (*models.ExportJob, error)
+	// Update saves the state and archive of the job.
+	Update(ctx context.Context, job *models.ExportJob) error
+	// DeleteAll removes every job of the user.
+	DeleteAll(ctx context.Context, userID uuid.UUID) error
+	// DeleteExpired removes jobs that expired before now and returns how many were removed.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// exportJobRepository implements ExportJobRepository with the export_jobs table.
+type exportJobRepository struct {
+	db *gorm.DB
+}
+
+// NewExportJobRepository creates an ExportJobRepository backed by Postgres.
+func NewExportJobRepository(db *gorm.DB) ExportJobRepository {
+	return &exportJobRepository{
+		db: db,
+	}
+}
+
+// Create stores a new job.
+func (r *exportJobRepository) Create(ctx context.Context, job *models.ExportJob) error {
+	return r.db.WithContext(ctx).Create(job).Error
+}
+
+// Get returns the job.
+func (r *exportJobRepository) Get(ctx context.Context, id uuid.UUID) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := r.db.WithContext(ctx).First(&job, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Update saves the state and archive of the job.
+func (r *exportJobRepository) Update(ctx context.Context, job *models.ExportJob) error {
+	return r.db.WithContext(ctx).Model(job).Select("status", "error", "archive", "completed_at", "expires_at").Updates(job).Error
+}
+
+// DeleteAll removes every job of the user.
+func (r *exportJobRepository) DeleteAll(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&models.ExportJob{}, "user_id = ?", userID).Error
+}
+
+// DeleteExpired removes expired jobs.
+func (r *exportJobRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Delete(&models.ExportJob{}, "expires_at <= ?", now)
+	return result.RowsAffected, result.Error
+}
+
+// memoryExportJobRepository implements ExportJobRepository in memory, for tests and local development.
+type memoryExportJobRepository struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]models.ExportJob
+}
+
+// NewMemoryExportJobRepository creates an in-memory ExportJobRepository.
+func NewMemoryExportJobRepository() ExportJobRepository {
+	return &memoryExportJobRepository{
+		jobs: make(map[uuid.UUID]models.ExportJob),
+	}
+}
+
+// Create stores a new job.
+func (r *memoryExportJobRepository) Create(ctx context.Context, job *models.ExportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job.ID == uuid.Nil {
+		job.ID = uuid.New()
+	}
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+// Get returns the job.
+func (r *memoryExportJobRepository) Get(ctx context.Context, id uuid.UUID) (*models.ExportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &job, nil
+}
+
+// Update saves the state and archive of the job.
+func (r *memoryExportJobRepository) Update(ctx context.Context, job *models.ExportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.jobs[job.ID]
+	if !ok {
+		// Like an UPDATE of a row deleted in the meantime, e.g. by an erasure
+		return nil
+	}
+	existing.Status = job.Status
+	existing.Error = job.Error
+	existing.Archive = job.Archive
+	existing.CompletedAt = job.CompletedAt
+	existing.ExpiresAt = job.ExpiresAt
+	r.jobs[job.ID] = existing
+	return nil
+}
+
+// DeleteAll removes every job of the user.
+func (r *memoryExportJobRepository) DeleteAll(ctx context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, job := range r.jobs {
+		if job.UserID == userID {
+			delete(r.jobs, id)
+		}
+	}
+	return nil
+}
+
+// DeleteExpired removes expired jobs.
+func (r *memoryExportJobRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, job := range r.jobs {
+		if !job.ExpiresAt.After(now) {
+			delete(r.jobs, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,196 @@
+package privacy
+
+import (
+	"authentication/src/internal/dto"
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"authentication/src/utils"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"log"
+)
+
+// Handler handles data export and erasure requests of the logged in user.
+type Handler struct {
+	Service Service
+}
+
+// NewHandler creates a new Handler with the provided Service.
+func NewHandler(s Service) *Handler {
+	return &Handler{
+		Service: s,
+	}
+}
+
+// RequestExport starts an export of everything stored about the logged in user, as JSON or, with
+// {"format": "zip"}, as a ZIP archive. The export is built in the background; its status is polled at
+// /users/me/exports/:id and the finished archive is downloaded from /users/me/exports/:id/download.
+func (h *Handler) RequestExport(c *fiber.Ctx) error {
+	return h.requestExport(c, c.Locals("userID").(uuid.UUID), ActorSelf)
+}
+
+// RequestUserExport starts an export of the data of the user in the route for an administrator.
+func (h *Handler) RequestUserExport(c *fiber.Ctx) error {
+	targetID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Invalid user ID"))
+	}
+	return h.requestExport(c, targetID, ActorAdmin)
+}
+
+func (h *Handler) requestExport(c *fiber.Ctx, userID uuid.UUID, actor string) error {
+	ctx := c.Context()
+	var req dto.ExportRequest
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			log.Printf("Error parsing request body: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+				err, "Failed to parse request body"))
+		}
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Format must be json or zip"))
+	}
+	if req.Format == "" {
+		req.Format = dto.ExportFormatJSON
+	}
+
+	job, err := h.Service.RequestExport(ctx, userID, req.Format, actor)
+	if err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(utils.ErrorResponse(
+				err, "User not found"))
+		}
+		log.Printf("Error requesting data export of user %s: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Data export failed"))
+	}
+	return c.Status(fiber.StatusAccepted).JSON(utils.SuccessResponse(job, "The data export is being prepared"))
+}
+
+// ExportStatus returns the state of an export job of the logged in user.
+func (h *Handler) ExportStatus(c *fiber.Ctx) error {
+	job, err := h.loadExport(c, true)
+	if job == nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(job, "Data export status"))
+}
+
+// UserExportStatus returns the state of any export job for an administrator.
+func (h *Handler) UserExportStatus(c *fiber.Ctx) error {
+	job, err := h.loadExport(c, false)
+	if job == nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(job, "Data export status"))
+}
+
+// DownloadExport downloads the finished archive of an export job of the logged in user.
+func (h *Handler) DownloadExport(c *fiber.Ctx) error {
+	job, err := h.loadExport(c, true)
+	if job == nil {
+		return err
+	}
+	return sendArchive(c, job)
+}
+
+// DownloadUserExport downloads the finished archive of any export job for an administrator.
+func (h *Handler) DownloadUserExport(c *fiber.Ctx) error {
+	job, err := h.loadExport(c, false)
+	if job == nil {
+		return err
+	}
+	return sendArchive(c, job)
+}
+
+// loadExport looks up the export job in the route. It returns a nil job once it has answered the
+// request, for example because the job does not exist or, with ownOnly, belongs to another user.
+func (h *Handler) loadExport(c *fiber.Ctx, ownOnly bool) (*models.ExportJob, error) {
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Invalid export ID"))
+	}
+
+	job, err := h.Service.GetExport(c.Context(), jobID)
+	if err == nil && ownOnly && job.UserID != c.Locals("userID").(uuid.UUID) {
+		// Someone else's export is indistinguishable from a missing one
+		err = errs.ErrExportNotFound
+	}
+	if err != nil {
+		if errors.Is(err, errs.ErrExportNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(utils.ErrorResponse(
+				err, "Data export not found or expired"))
+		}
+		log.Printf("Error loading data export %s: %v", jobID, err)
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Data export failed"))
+	}
+	return job, nil
+}
+
+// sendArchive sends the archive of a finished export job as a download.
+func sendArchive(c *fiber.Ctx, job *models.ExportJob) error {
+	if job.Status != models.ExportStatusCompleted {
+		return c.Status(fiber.StatusConflict).JSON(utils.ErrorResponse(
+			errs.ErrExportNotReady, "The data export is "+job.Status))
+	}
+
+	filename := fmt.Sprintf("data-export-%s.%s", job.CompletedAt.Format("20060102-150405"), job.Format)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if job.Format == dto.ExportFormatZIP {
+		c.Set(fiber.HeaderContentType, "application/zip")
+	} else {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	}
+	return c.Status(fiber.StatusOK).Send(job.Archive)
+}
+
+// Erase permanently anonymizes the logged in user's account after confirming their password.
+func (h *Handler) Erase(c *fiber.Ctx) error {
+	ctx := c.Context()
+	var req dto.ErasureRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			err, "Failed to parse request body"))
+	}
+
+	// Validate the request
+	if validationErr := utils.ValidateStruct(req); validationErr != nil {
+		log.Printf("Validation error: %v", validationErr)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.ErrorResponse(
+			validationErr, "Validation failed"))
+	}
+
+	userID := c.Locals("userID").(uuid.UUID)
+	if err := h.Service.ConfirmPassword(ctx, userID, req.Password); err != nil {
+		if errors.Is(err, errs.ErrInvalidCredentials) {
+			return c.Status(fiber.StatusUnauthorized).JSON(utils.ErrorResponse(
+				err, "Password is incorrect"))
+		}
+		log.Printf("Error confirming password: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Account erasure failed"))
+	}
+
+	if _, err := h.Service.Erase(ctx, userID, ActorSelf); err != nil {
+		log.Printf("Error erasing user %s: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.ErrorResponse(
+			err, "Account erasure failed"))
+	}
+
+	c.ClearCookie("session_id")
+	return c.Status(fiber.StatusOK).JSON(utils.SuccessResponse(nil, "Your account and personal data have been erased"))
+}
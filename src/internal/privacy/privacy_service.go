@@ -0,0 +1,427 @@
+// Package privacy implements data subject requests: exporting and erasing a user's personal data.
+package privacy
+
+import (
+	"archive/zip"
+	"authentication/src/internal/auth"
+	"authentication/src/internal/dto"
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"authentication/src/internal/password"
+	"authentication/src/internal/user"
+	"authentication/src/utils"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"time"
+)
+
+// Who requested an erasure.
+const (
+	ActorSelf  = "self"
+	ActorAdmin = "admin"
+)
+
+// erasedName replaces the name of an erased user.
+const erasedName = "Erased user"
+
+// DefaultExportTTL is how long a finished data export can be downloaded.
+const DefaultExportTTL = 24 * time.Hour
+
+// exportTimeout bounds the work of building one export in the background.
+const exportTimeout = 5 * time.Minute
+
+// minEmailHashKeyLength is the shortest accepted key for tombstone email hashes.
+const minEmailHashKeyLength = 32
+
+// Service exports and erases the personal data of users.
+type Service interface {
+	// Export collects everything stored about the user.
+	Export(ctx context.Context, userID uuid.UUID) (*dto.DataExport, error)
+	// RequestExport starts building an export of the user's data in the format in the background
+	// and returns the pending job.
+	RequestExport(ctx context.Context, userID uuid.UUID, format, actor string) (*models.ExportJob, error)
+	// GetExport returns an export job, or errs.ErrExportNotFound when it does not exist or expired.
+	GetExport(ctx context.Context, jobID uuid.UUID) (*models.ExportJob, error)
+	// ConfirmPassword checks the user's password before a self-service erasure.
+	ConfirmPassword(ctx context.Context, userID uuid.UUID, plainPassword string) error
+	// Erase anonymizes the user in place, ends their sessions, revokes their tokens and
+	// records a tombstone.
+	Erase(ctx context.Context, userID uuid.UUID, actor string) (*models.ErasureTombstone, error)
+	// EmailHash returns the keyed hash under which erasures of the email address are recorded.
+	EmailHash(email string) string
+}
+
+// service implements Service.
+type service struct {
+	UserService     user.UserService
+	AuthService     auth.AuthService
+	TokenService    auth.TokenService
+	Hasher          password.Hasher
+	tombstones      TombstoneRepository
+	passwordHistory user.PasswordHistoryRepository
+	loginHistory    auth.LoginHistory
+	auditLog        auth.AuditLog
+	exportJobs      ExportJobRepository
+	exportTTL       time.Duration
+	emailHashKey    []byte
+}
+
+// ServiceOption configures optional behaviour of the Service.
+type ServiceOption func(*service)
+
+// WithPasswordHistory includes password change dates in exports and deletes the history on erasure.
+func WithPasswordHistory(repo user.PasswordHistoryRepository) ServiceOption {
+	return func(s *service) {
+		s.passwordHistory = repo
+	}
+}
+
+// WithLoginHistory includes the login history in exports and deletes it on erasure.
+func WithLoginHistory(history auth.LoginHistory) ServiceOption {
+	return func(s *service) {
+		s.loginHistory = history
+	}
+}
+
+// WithAuditLog includes the audit events about the user in exports. They are kept on erasure.
+func WithAuditLog(log auth.AuditLog) ServiceOption {
+	return func(s *service) {
+		s.auditLog = log
+	}
+}
+
+// WithExportJobs stores export jobs and their archives, which can be downloaded for ttl after they
+// are finished, or DefaultExportTTL when ttl is not positive. Without it exports cannot be requested.
+func WithExportJobs(repo ExportJobRepository, ttl time.Duration) ServiceOption {
+	return func(s *service) {
+		s.exportJobs = repo
+		if ttl > 0 {
+			s.exportTTL = ttl
+		}
+	}
+}
+
+// ValidateEmailHashKey checks the key for tombstone email hashes. It must be a long secret of its
+// own: a hash keyed with a leaked or shared secret lets erased addresses be confirmed by guessing.
+func ValidateEmailHashKey(key, tokenSecret string) error {
+	switch {
+	case key == "":
+		return errors.New("the email hash key is not set")
+	case len(key) < minEmailHashKeyLength:
+		return fmt.Errorf("the email hash key must be at least %d characters long", minEmailHashKeyLength)
+	case key == tokenSecret:
+		return errors.New("the email hash key must differ from the token secret")
+	}
+	return nil
+}
+
+// NewService creates a new Service. emailHashKey keys the email hashes stored in tombstones; see
+// ValidateEmailHashKey.
+func NewService(us user.UserService, as auth.AuthService, ts auth.TokenService, hasher password.Hasher, tombstones TombstoneRepository, emailHashKey string, opts ...ServiceOption) Service {
+	s := &service{
+		UserService:  us,
+		AuthService:  as,
+		TokenService: ts,
+		Hasher:       hasher,
+		tombstones:   tombstones,
+		exportTTL:    DefaultExportTTL,
+		emailHashKey: []byte(emailHashKey),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Export collects everything stored about the user.
+func (s *service) Export(ctx context.Context, userID uuid.UUID) (*dto.DataExport, error) {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &dto.DataExport{
+		GeneratedAt: time.Now().UTC(),
+		Profile: dto.ProfileExport{
+			ID:                existingUser.ID,
+			FullName:          existingUser.FullName,
+			Email:             existingUser.Email,
+			Verified:          existingUser.Verified,
+			CreatedAt:         existingUser.CreatedAt,
+			UpdatedAt:         existingUser.UpdatedAt,
+			PasswordChangedAt: existingUser.PasswordChangedAt,
+			LastLoginAt:       existingUser.LastLoginAt,
+		},
+		Sessions:        []dto.SessionExport{},
+		PasswordChanges: []time.Time{},
+		Logins:          []models.LoginEvent{},
+		AuditEvents:     []models.AuditEvent{},
+	}
+
+	sessions, err := s.AuthService.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range sessions {
+		export.Sessions = append(export.Sessions, dto.SessionExport{IDHash: sessionIDHash(record.ID), CreatedAt: record.CreatedAt})
+	}
+
+	if s.passwordHistory != nil {
+		// Only the dates; old password hashes are never handed out
+		history, err := s.passwordHistory.List(ctx, userID, -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range history {
+			export.PasswordChanges = append(export.PasswordChanges, entry.CreatedAt)
+		}
+	}
+
+	if s.loginHistory != nil {
+		export.Logins, err = s.loginHistory.List(ctx, userID, -1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.auditLog != nil {
+		events, err := s.auditLog.List(ctx, userID, -1)
+		if err != nil {
+			return nil, err
+		}
+		export.AuditEvents = append(export.AuditEvents, events...)
+	}
+
+	return export, nil
+}
+
+// sessionIDHash identifies a session in exports without handing out its ID.
+func sessionIDHash(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RequestExport creates a pending export job and builds the archive in the background.
+func (s *service) RequestExport(ctx context.Context, userID uuid.UUID, format, actor string) (*models.ExportJob, error) {
+	if s.exportJobs == nil {
+		return nil, errors.New("data export jobs are not configured")
+	}
+	if _, err := s.UserService.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job := &models.ExportJob{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Actor:     actor,
+		Format:    format,
+		Status:    models.ExportStatusPending,
+		CreatedAt: now,
+		// Replaced when the export is finished; a job that never finishes is cleaned up after this
+		ExpiresAt: now.Add(exportTimeout + s.exportTTL),
+	}
+	if err := s.exportJobs.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	queued := *job
+	go s.runExport(&queued)
+	return job, nil
+}
+
+// runExport builds the archive of a pending job and stores the outcome.
+func (s *service) runExport(job *models.ExportJob) {
+	// Detached from the request that started it, which is answered right away
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	archive, err := s.buildArchive(ctx, job.UserID, job.Format)
+	completedAt := time.Now().UTC()
+	job.CompletedAt = &completedAt
+	job.ExpiresAt = completedAt.Add(s.exportTTL)
+	if err != nil {
+		log.Printf("Error exporting data of user %s: %v", job.UserID, err)
+		job.Status = models.ExportStatusFailed
+		job.Error = "the export could not be built, please request a new one"
+	} else {
+		job.Status = models.ExportStatusCompleted
+		job.Archive = archive
+	}
+	if err := s.exportJobs.Update(ctx, job); err != nil {
+		log.Printf("Error storing data export %s: %v", job.ID, err)
+	}
+}
+
+// buildArchive encodes the export of the user in the format.
+func (s *service) buildArchive(ctx context.Context, userID uuid.UUID, format string) ([]byte, error) {
+	export, err := s.Export(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if format == dto.ExportFormatZIP {
+		err = WriteArchive(&buf, export)
+	} else {
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(export)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetExport returns an unexpired export job.
+func (s *service) GetExport(ctx context.Context, jobID uuid.UUID) (*models.ExportJob, error) {
+	if s.exportJobs == nil {
+		return nil, errs.ErrExportNotFound
+	}
+	job, err := s.exportJobs.Get(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.ErrExportNotFound
+		}
+		return nil, err
+	}
+	if !job.ExpiresAt.After(time.Now()) {
+		return nil, errs.ErrExportNotFound
+	}
+	return job, nil
+}
+
+// ConfirmPassword checks the user's password.
+func (s *service) ConfirmPassword(ctx context.Context, userID uuid.UUID, plainPassword string) error {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	valid, err := s.Hasher.Verify(plainPassword, existingUser.PasswordHash)
+	if err != nil {
+		log.Printf("Error verifying password hash of user %s: %v", existingUser.ID, err)
+	}
+	if !valid {
+		return errs.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// Erase anonymizes the user in place and records a tombstone.
+func (s *service) Erase(ctx context.Context, userID uuid.UUID, actor string) (*models.ErasureTombstone, error) {
+	existingUser, err := s.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	emailHash := s.EmailHash(existingUser.Email)
+
+	// Cut off every way back into the account before touching the record
+	if _, err := s.AuthService.RevokeAllSessions(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.TokenService.RevokeUserTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+	if s.passwordHistory != nil {
+		if err := s.passwordHistory.DeleteAll(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	if s.loginHistory != nil {
+		if err := s.loginHistory.DeleteAll(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	if s.exportJobs != nil {
+		if err := s.exportJobs.DeleteAll(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	// Audit events stay for security review, without the IP and details tying them to the person
+	if s.auditLog != nil {
+		if err := s.auditLog.Anonymize(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The row is kept, anonymized and soft-deleted, so references to the ID stay valid until
+	// the deleted-user retention job removes it
+	existingUser.FullName = erasedName
+	existingUser.Email = fmt.Sprintf("erased-%s@erased.invalid", existingUser.ID)
+	existingUser.PasswordHash = ""
+	existingUser.PasswordChangedAt = nil
+	existingUser.Verified = false
+	existingUser.LastLoginAt = nil
+	if _, err := s.UserService.UpdateUser(ctx, existingUser); err != nil {
+		return nil, err
+	}
+	if err := s.UserService.DeleteUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	tombstone := &models.ErasureTombstone{
+		ID:        uuid.New(),
+		UserID:    userID,
+		EmailHash: emailHash,
+		Actor:     actor,
+		ErasedAt:  time.Now().UTC(),
+	}
+	if err := s.tombstones.Create(ctx, tombstone); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Erased personal data of user %s at the request of %s", userID, actor)
+	return tombstone, nil
+}
+
+// EmailHash returns the HMAC-SHA256 of the normalized email address.
+func (s *service) EmailHash(email string) string {
+	mac := hmac.New(sha256.New, s.emailHashKey)
+	mac.Write([]byte(utils.NormalizeEmail(email)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WriteArchive writes the export as a ZIP archive with one JSON file per section.
+func WriteArchive(w io.Writer, export *dto.DataExport) error {
+	archive := zip.NewWriter(w)
+	sections := []struct {
+		name string
+		data interface{}
+	}{
+		{"export.json", export},
+		{"profile.json", export.Profile},
+		{"sessions.json", export.Sessions},
+		{"password_changes.json", export.PasswordChanges},
+		{"logins.json", export.Logins},
+		{"audit_events.json", export.AuditEvents},
+	}
+
+	for _, section := range sections {
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     section.name,
+			Method:   zip.Deflate,
+			Modified: export.GeneratedAt,
+		})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(section.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,244 @@
+package privacy_test
+
+import (
+	"archive/zip"
+	"authentication/src/internal/dto"
+	"authentication/src/internal/models"
+	"authentication/src/internal/testutil"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// emailHash computes the tombstone hash of email under the harness key.
+func emailHash(email string) string {
+	mac := hmac.New(sha256.New, []byte(testutil.EmailHashKey))
+	mac.Write([]byte(email))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestExport starts an export through the API and waits for it to be built in the background.
+func requestExport(t *testing.T, h *testutil.Harness, path string, body map[string]string) models.ExportJob {
+	t.Helper()
+
+	res := h.Do(http.MethodPost, path, body)
+	if res.Status != http.StatusAccepted {
+		t.Fatalf("Expected the export to be accepted, got %d: %s", res.Status, res.RawBody)
+	}
+	job := decodeExportJob(t, res)
+	if job.Status != models.ExportStatusPending {
+		t.Errorf("Expected a pending export, got %+v", job)
+	}
+
+	statusPath := "/users/me/exports/" + job.ID.String()
+	if strings.HasPrefix(path, "/admin") {
+		statusPath = "/admin/exports/" + job.ID.String()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == models.ExportStatusPending {
+		if time.Now().After(deadline) {
+			t.Fatalf("Export %s was not built in time", job.ID)
+		}
+		time.Sleep(5 * time.Millisecond)
+		res = h.Do(http.MethodGet, statusPath, nil)
+		if res.Status != http.StatusOK {
+			t.Fatalf("Expected the export status, got %d: %s", res.Status, res.RawBody)
+		}
+		job = decodeExportJob(t, res)
+	}
+	if job.Status != models.ExportStatusCompleted {
+		t.Fatalf("Expected the export to complete, got %+v", job)
+	}
+	return job
+}
+
+func decodeExportJob(t *testing.T, res *testutil.Response) models.ExportJob {
+	t.Helper()
+
+	var job models.ExportJob
+	data, _ := json.Marshal(res.Body.Data)
+	if err := json.Unmarshal(data, &job); err != nil {
+		t.Fatalf("Failed to decode export job: %v", err)
+	}
+	return job
+}
+
+func TestExportJSON(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+
+	job := requestExport(t, h, "/users/me/exports", nil)
+	res := h.Do(http.MethodGet, "/users/me/exports/"+job.ID.String()+"/download", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the download to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	if !strings.HasPrefix(res.Header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("Expected the export to be a download, got %q", res.Header.Get("Content-Disposition"))
+	}
+
+	var export dto.DataExport
+	if err := json.Unmarshal(res.RawBody, &export); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+	if export.Profile.Email != "jane@example.com" || export.Profile.FullName != "Jane Doe" || !export.Profile.Verified {
+		t.Errorf("Unexpected profile: %+v", export.Profile)
+	}
+	if len(export.Sessions) != 1 || len(export.Sessions[0].IDHash) != 16 {
+		t.Errorf("Expected one session, identified by a hash, got %+v", export.Sessions)
+	}
+	if strings.Contains(string(res.RawBody), h.Cookie("session_id")) {
+		t.Error("Expected the export not to contain the session ID")
+	}
+	if len(export.Logins) != 1 || !export.Logins[0].Success {
+		t.Errorf("Expected one successful login, got %+v", export.Logins)
+	}
+	if export.AuditEvents == nil {
+		t.Error("Expected the audit events section")
+	}
+	if strings.Contains(string(res.RawBody), "password_hash") {
+		t.Error("Expected the export not to contain password hashes")
+	}
+
+	if res := h.Do(http.MethodPost, "/users/me/exports", map[string]string{"format": "xml"}); res.Status != http.StatusBadRequest {
+		t.Errorf("Expected an unknown format to be rejected, got %d", res.Status)
+	}
+
+	// Another user cannot see the export
+	h.ClearCookies()
+	h.RegisterVerifiedUser("John Doe", "john@example.com", "securePassword456")
+	h.Login("john@example.com", "securePassword456")
+	if res := h.Do(http.MethodGet, "/users/me/exports/"+job.ID.String()+"/download", nil); res.Status != http.StatusNotFound {
+		t.Errorf("Expected the export of another user to be not found, got %d", res.Status)
+	}
+
+	h.ClearCookies()
+	if res := h.Do(http.MethodPost, "/users/me/exports", nil); res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the export to require a session, got %d", res.Status)
+	}
+}
+
+func TestExportZIP(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+
+	job := requestExport(t, h, "/users/me/exports", map[string]string{"format": dto.ExportFormatZIP})
+	res := h.Do(http.MethodGet, "/users/me/exports/"+job.ID.String()+"/download", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the download to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	if res.Header.Get("Content-Type") != "application/zip" {
+		t.Errorf("Expected a ZIP archive, got %q", res.Header.Get("Content-Type"))
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(res.RawBody), int64(len(res.RawBody)))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	files := make(map[string]bool)
+	for _, file := range archive.File {
+		files[file.Name] = true
+	}
+	for _, name := range []string{"export.json", "profile.json", "sessions.json", "password_changes.json", "logins.json", "audit_events.json"} {
+		if !files[name] {
+			t.Errorf("Expected %s in the archive", name)
+		}
+	}
+}
+
+func TestAdminExport(t *testing.T) {
+	ctx := context.Background()
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	jane, _ := h.Users.GetUserByEmail(ctx, "jane@example.com")
+	h.RegisterVerifiedUser("Ada Admin", "ada@example.com", "correctHorse42battery")
+	admin, _ := h.Users.GetUserByEmail(ctx, "ada@example.com")
+	admin.Role = models.RoleAdmin
+	if err := h.Users.UpdateUser(ctx, admin); err != nil {
+		t.Fatalf("Failed to grant admin role: %v", err)
+	}
+	h.Login("ada@example.com", "correctHorse42battery")
+
+	job := requestExport(t, h, "/admin/users/"+jane.ID.String()+"/exports", nil)
+	if job.UserID != jane.ID || job.Actor != "admin" {
+		t.Errorf("Unexpected export job: %+v", job)
+	}
+	res := h.Do(http.MethodGet, "/admin/exports/"+job.ID.String()+"/download", nil)
+	if res.Status != http.StatusOK || !strings.Contains(string(res.RawBody), "jane@example.com") {
+		t.Errorf("Expected the admin to download the export, got %d: %s", res.Status, res.RawBody)
+	}
+}
+
+func TestEraseAccount(t *testing.T) {
+	ctx := context.Background()
+	h := testutil.NewHarness(t)
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "securePassword123")
+	h.Login("jane@example.com", "securePassword123")
+	existingUser, err := h.Users.GetUserByEmail(ctx, "jane@example.com")
+	if err != nil {
+		t.Fatalf("Failed to look up user: %v", err)
+	}
+
+	job := requestExport(t, h, "/users/me/exports", nil)
+	event := &models.AuditEvent{UserID: existingUser.ID, Action: models.AuditActionLoginRisk, Outcome: "allow", IP: "203.0.113.7", Details: "score=0", CreatedAt: time.Now()}
+	if err := h.AuditLog.Add(ctx, event); err != nil {
+		t.Fatalf("Failed to add audit event: %v", err)
+	}
+
+	res := h.Do(http.MethodDelete, "/users/me", map[string]string{"password": "wrongPassword123"})
+	if res.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to be rejected, got %d", res.Status)
+	}
+
+	res = h.Do(http.MethodDelete, "/users/me", map[string]string{"password": "securePassword123"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("Expected the erasure to succeed, got %d: %s", res.Status, res.RawBody)
+	}
+	if h.Cookie("session_id") != "" {
+		t.Error("Expected the session cookie to be cleared")
+	}
+
+	res = h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    "jane@example.com",
+		"password": "securePassword123",
+	})
+	if res.Status == http.StatusOK {
+		t.Error("Expected login to an erased account to fail")
+	}
+
+	if _, err := h.Users.GetUserByEmail(ctx, "jane@example.com"); err == nil {
+		t.Error("Expected the email address to be gone")
+	}
+	if _, err := h.ExportJobs.Get(ctx, job.ID); err == nil {
+		t.Error("Expected the data exports to be deleted")
+	}
+	if logins, _ := h.LoginHistory.List(ctx, existingUser.ID, -1); len(logins) != 0 {
+		t.Errorf("Expected the login history to be deleted, got %d entries", len(logins))
+	}
+	// Audit events are kept, but only with what was decided and when
+	events, err := h.AuditLog.List(ctx, existingUser.ID, -1)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected the audit event to be kept, got %d (%v)", len(events), err)
+	}
+	if events[0].IP != "" || events[0].Details != "" || events[0].Action != models.AuditActionLoginRisk || events[0].Outcome != "allow" {
+		t.Errorf("Expected the audit event to be anonymized, got %+v", events[0])
+	}
+	tombstones, err := h.Tombstones.FindByEmailHash(ctx, emailHash("jane@example.com"))
+	if err != nil || len(tombstones) != 1 {
+		t.Fatalf("Expected one tombstone, got %d (%v)", len(tombstones), err)
+	}
+	if tombstones[0].UserID != existingUser.ID || tombstones[0].Actor != "self" {
+		t.Errorf("Unexpected tombstone: %+v", tombstones[0])
+	}
+
+	// The address can be used for a new account afterwards
+	h.RegisterVerifiedUser("Jane Doe", "jane@example.com", "anotherPassword456")
+}
@@ -0,0 +1,74 @@
+package privacy
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"gorm.io/gorm"
+	"sync"
+)
+
+// TombstoneRepository stores erasure tombstones.
+type TombstoneRepository interface {
+	// Create records an erasure.
+	Create(ctx context.Context, tombstone *models.ErasureTombstone) error
+	// FindByEmailHash returns the erasures of an email address, identified by its keyed hash.
+	FindByEmailHash(ctx context.Context, emailHash string) ([]models.ErasureTombstone, error)
+}
+
+// tombstoneRepository implements TombstoneRepository with the erasure_tombstones table.
+type tombstoneRepository struct {
+	db *gorm.DB
+}
+
+// NewTombstoneRepository creates a TombstoneRepository backed by Postgres.
+func NewTombstoneRepository(db *gorm.DB) TombstoneRepository {
+	return &tombstoneRepository{
+		db: db,
+	}
+}
+
+// Create records an erasure.
+func (r *tombstoneRepository) Create(ctx context.Context, tombstone *models.ErasureTombstone) error {
+	return r.db.WithContext(ctx).Create(tombstone).Error
+}
+
+// FindByEmailHash returns the erasures of an email address.
+func (r *tombstoneRepository) FindByEmailHash(ctx context.Context, emailHash string) ([]models.ErasureTombstone, error) {
+	var tombstones []models.ErasureTombstone
+	err := r.db.WithContext(ctx).Where("email_hash = ?", emailHash).Order("erased_at DESC").Find(&tombstones).Error
+	return tombstones, err
+}
+
+// memoryTombstoneRepository implements TombstoneRepository in memory, for tests and local development.
+type memoryTombstoneRepository struct {
+	mu         sync.Mutex
+	tombstones []models.ErasureTombstone
+}
+
+// NewMemoryTombstoneRepository creates an in-memory TombstoneRepository.
+func NewMemoryTombstoneRepository() TombstoneRepository {
+	return &memoryTombstoneRepository{}
+}
+
+// Create records an erasure.
+func (r *memoryTombstoneRepository) Create(ctx context.Context, tombstone *models.ErasureTombstone) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tombstones = append(r.tombstones, *tombstone)
+	return nil
+}
+
+// FindByEmailHash returns the erasures of an email address, newest first.
+func (r *memoryTombstoneRepository) FindByEmailHash(ctx context.Context, emailHash string) ([]models.ErasureTombstone, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tombstones []models.ErasureTombstone
+	for i := len(r.tombstones) - 1; i >= 0; i-- {
+		if r.tombstones[i].EmailHash == emailHash {
+			tombstones = append(tombstones, r.tombstones[i])
+		}
+	}
+	return tombstones, nil
+}
@@ -0,0 +1,78 @@
+package risk
+
+import (
+	"fmt"
+	"github.com/oschwald/maxminddb-golang"
+	"net"
+)
+
+// Location is where an IP address is located.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country.
+	Country string
+	// HasCoordinates is false for databases without coordinates, such as GeoLite2-Country.
+	HasCoordinates bool
+	Latitude       float64
+	Longitude      float64
+}
+
+// Locator resolves IP addresses to locations. It returns nil for addresses it does not know.
+type Locator interface {
+	Locate(ip net.IP) (*Location, error)
+}
+
+// GeoIPDatabase is a Locator backed by a local MaxMind-format (.mmdb) City or Country database.
+type GeoIPDatabase struct {
+	reader *maxminddb.Reader
+}
+
+// geoIPRecord is the part of a GeoIP2 or GeoLite2 record that is used.
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// OpenGeoIPDatabase opens a MaxMind-format database file. The file is memory-mapped, so it must not
+// be replaced in place while open; write a new file and rename it over the old one instead.
+func OpenGeoIPDatabase(path string) (*GeoIPDatabase, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open GeoIP database: %w", err)
+	}
+	return &GeoIPDatabase{reader: reader}, nil
+}
+
+// Locate looks up the location of ip.
+func (d *GeoIPDatabase) Locate(ip net.IP) (*Location, error) {
+	var record geoIPRecord
+	network, found, err := d.reader.LookupNetwork(ip, &record)
+	if err != nil {
+		return nil, err
+	}
+	if !found || network == nil || record.Country.ISOCode == "" {
+		return nil, nil
+	}
+
+	location := &Location{Country: record.Country.ISOCode}
+	if record.Location.Latitude != nil && record.Location.Longitude != nil {
+		location.HasCoordinates = true
+		location.Latitude = *record.Location.Latitude
+		location.Longitude = *record.Location.Longitude
+	}
+	return location, nil
+}
+
+// Type returns the database type recorded in its metadata, such as "GeoLite2-City".
+func (d *GeoIPDatabase) Type() string {
+	return d.reader.Metadata.DatabaseType
+}
+
+// Close releases the database file.
+func (d *GeoIPDatabase) Close() error {
+	return d.reader.Close()
+}
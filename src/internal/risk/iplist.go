@@ -0,0 +1,68 @@
+package risk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// IPList is a set of IP addresses and networks, such as known-bad addresses.
+type IPList struct {
+	networks []*net.IPNet
+}
+
+// LoadIPList reads a list file with one IP address or CIDR network per line. Empty lines and
+// lines starting with # are ignored.
+func LoadIPList(path string) (*IPList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseIPList(file)
+}
+
+// ParseIPList reads a list in the format described at LoadIPList.
+func ParseIPList(r io.Reader) (*IPList, error) {
+	list := &IPList{}
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !strings.Contains(line, "/") {
+			if strings.Contains(line, ":") {
+				line += "/128"
+			} else {
+				line += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid IP address or network %q", lineNumber, line)
+		}
+		list.networks = append(list.networks, network)
+	}
+	return list, scanner.Err()
+}
+
+// Contains reports whether ip is in one of the listed networks.
+func (l *IPList) Contains(ip net.IP) bool {
+	for _, network := range l.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of listed networks.
+func (l *IPList) Len() int {
+	return len(l.networks)
+}
@@ -0,0 +1,230 @@
+// Package risk scores login attempts by where and from what they come, so that unusual logins
+// can be confirmed by email or blocked.
+package risk
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"log"
+	"math"
+	"net"
+	"time"
+)
+
+// Decisions about a login attempt.
+const (
+	DecisionAllow  = "allow"
+	DecisionStepUp = "step_up"
+	DecisionBlock  = "block"
+)
+
+// Reasons contributing to the score of a login attempt.
+const (
+	ReasonBadIP            = "bad_ip"
+	ReasonImpossibleTravel = "impossible_travel"
+	ReasonNewCountry       = "new_country"
+	ReasonNewDevice        = "new_device"
+)
+
+// minTravelDistanceKm is the distance below which travel is never impossible; GeoIP coordinates
+// are often off by tens of kilometres.
+const minTravelDistanceKm = 300
+
+// History is the login history attempts are compared with.
+type History interface {
+	// LastSuccess returns the user's most recent successful login, or nil if there is none.
+	LastSuccess(ctx context.Context, userID uuid.UUID) (*models.LoginEvent, error)
+	// KnownCountry reports whether the user has logged in successfully from the country before.
+	KnownCountry(ctx context.Context, userID uuid.UUID, country string) (bool, error)
+}
+
+// Policy holds the weights of the risk signals and the thresholds of the decisions.
+type Policy struct {
+	WeightBadIP            int
+	WeightImpossibleTravel int
+	WeightNewCountry       int
+	WeightNewDevice        int
+	// MaxTravelSpeedKmh is the fastest plausible travel between two logins.
+	MaxTravelSpeedKmh float64
+	// StepUpThreshold is the score from which the login must be confirmed by email.
+	StepUpThreshold int
+	// BlockThreshold is the score from which the login is refused.
+	BlockThreshold int
+}
+
+// DefaultPolicy returns a policy that blocks known-bad addresses and asks for confirmation when an
+// account is used from a new country or with impossible travel.
+func DefaultPolicy() Policy {
+	return Policy{
+		WeightBadIP:            100,
+		WeightImpossibleTravel: 60,
+		WeightNewCountry:       30,
+		WeightNewDevice:        20,
+		MaxTravelSpeedKmh:      1000,
+		StepUpThreshold:        50,
+		BlockThreshold:         100,
+	}
+}
+
+// NewPolicyFromConfig creates a Policy from the risk configuration.
+func NewPolicyFromConfig(cfg config.RiskConfig) Policy {
+	return Policy{
+		WeightBadIP:            cfg.WeightBadIP,
+		WeightImpossibleTravel: cfg.WeightImpossibleTravel,
+		WeightNewCountry:       cfg.WeightNewCountry,
+		WeightNewDevice:        cfg.WeightNewDevice,
+		MaxTravelSpeedKmh:      float64(cfg.MaxTravelSpeedKmh),
+		StepUpThreshold:        cfg.StepUpThreshold,
+		BlockThreshold:         cfg.BlockThreshold,
+	}
+}
+
+// Attempt is a login attempt with valid credentials.
+type Attempt struct {
+	UserID uuid.UUID
+	IP     string
+	// NewDevice is set when the browser was never used to log into the account.
+	NewDevice bool
+	At        time.Time
+}
+
+// Assessment is the outcome of scoring an attempt.
+type Assessment struct {
+	Score    int
+	Decision string
+	Reasons  []string
+	// Location is where the attempt came from, or nil if it is unknown.
+	Location *Location
+}
+
+// Engine scores login attempts.
+type Engine struct {
+	history History
+	policy  Policy
+	locator Locator
+	badIPs  *IPList
+}
+
+// EngineOption configures optional signals of the Engine.
+type EngineOption func(*Engine)
+
+// WithLocator enables the new country and impossible travel signals.
+func WithLocator(locator Locator) EngineOption {
+	return func(e *Engine) {
+		e.locator = locator
+	}
+}
+
+// WithBadIPs enables the known-bad address signal.
+func WithBadIPs(list *IPList) EngineOption {
+	return func(e *Engine) {
+		e.badIPs = list
+	}
+}
+
+// NewEngine creates an Engine comparing attempts with history.
+func NewEngine(history History, policy Policy, opts ...EngineOption) *Engine {
+	e := &Engine{
+		history: history,
+		policy:  policy,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Assess scores the attempt and decides whether it is allowed, must be confirmed or is blocked.
+func (e *Engine) Assess(ctx context.Context, attempt Attempt) (*Assessment, error) {
+	assessment := &Assessment{}
+	ip := net.ParseIP(attempt.IP)
+
+	if ip != nil && e.badIPs != nil && e.badIPs.Contains(ip) {
+		assessment.add(ReasonBadIP, e.policy.WeightBadIP)
+	}
+
+	if ip != nil && e.locator != nil {
+		location, err := e.locator.Locate(ip)
+		if err != nil {
+			// An unreadable record only loses the location signals
+			log.Printf("Error locating IP address %s: %v", attempt.IP, err)
+		}
+		assessment.Location = location
+	}
+
+	last, err := e.history.LastSuccess(ctx, attempt.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without an earlier login there is nothing to compare with
+	if last != nil {
+		if attempt.NewDevice {
+			assessment.add(ReasonNewDevice, e.policy.WeightNewDevice)
+		}
+
+		if location := assessment.Location; location != nil {
+			known, err := e.history.KnownCountry(ctx, attempt.UserID, location.Country)
+			if err != nil {
+				return nil, err
+			}
+			if !known {
+				assessment.add(ReasonNewCountry, e.policy.WeightNewCountry)
+			}
+
+			if e.impossibleTravel(last, location, attempt.At) {
+				assessment.add(ReasonImpossibleTravel, e.policy.WeightImpossibleTravel)
+			}
+		}
+	}
+
+	assessment.Decision = DecisionAllow
+	switch {
+	case assessment.Score >= e.policy.BlockThreshold:
+		assessment.Decision = DecisionBlock
+	case assessment.Score >= e.policy.StepUpThreshold:
+		assessment.Decision = DecisionStepUp
+	}
+	return assessment, nil
+}
+
+// impossibleTravel reports whether getting from the last login to location by at would have
+// required travelling faster than the policy allows.
+func (e *Engine) impossibleTravel(last *models.LoginEvent, location *Location, at time.Time) bool {
+	if !location.HasCoordinates || last.Latitude == nil || last.Longitude == nil {
+		return false
+	}
+
+	distance := distanceKm(*last.Latitude, *last.Longitude, location.Latitude, location.Longitude)
+	if distance < minTravelDistanceKm {
+		return false
+	}
+	hours := at.Sub(last.CreatedAt).Hours()
+	if hours <= 0 {
+		return true
+	}
+	return distance/hours > e.policy.MaxTravelSpeedKmh
+}
+
+// add counts a signal towards the score.
+func (a *Assessment) add(reason string, weight int) {
+	if weight <= 0 {
+		return
+	}
+	a.Score += weight
+	a.Reasons = append(a.Reasons, reason)
+}
+
+// distanceKm returns the great-circle distance between two coordinates.
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,145 @@
+package risk_test
+
+import (
+	"authentication/src/internal/auth"
+	"authentication/src/internal/models"
+	"authentication/src/internal/risk"
+	"context"
+	"github.com/google/uuid"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	berlin = &risk.Location{Country: "DE", HasCoordinates: true, Latitude: 52.52, Longitude: 13.40}
+	paris  = &risk.Location{Country: "FR", HasCoordinates: true, Latitude: 48.86, Longitude: 2.35}
+	sydney = &risk.Location{Country: "AU", HasCoordinates: true, Latitude: -33.87, Longitude: 151.21}
+)
+
+// mapLocator locates addresses from a fixed table.
+type mapLocator map[string]*risk.Location
+
+func (m mapLocator) Locate(ip net.IP) (*risk.Location, error) {
+	return m[ip.String()], nil
+}
+
+var locator = mapLocator{
+	"198.51.100.1": berlin,
+	"198.51.100.2": paris,
+	"203.0.113.1":  sydney,
+}
+
+// addLogin records a successful login from location.
+func addLogin(t *testing.T, history auth.LoginHistory, userID uuid.UUID, location *risk.Location, at time.Time) {
+	t.Helper()
+
+	event := &models.LoginEvent{
+		UserID:    userID,
+		Success:   true,
+		Country:   location.Country,
+		Latitude:  &location.Latitude,
+		Longitude: &location.Longitude,
+		CreatedAt: at,
+	}
+	if err := history.Add(context.Background(), event); err != nil {
+		t.Fatalf("Failed to record login: %v", err)
+	}
+}
+
+func TestAssess(t *testing.T) {
+	now := time.Now()
+	badIPs, err := risk.ParseIPList(strings.NewReader("203.0.113.0/24\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse IP list: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		previous  *risk.Location
+		ago       time.Duration
+		ip        string
+		newDevice bool
+		want      []string
+		decision  string
+	}{
+		{"first login", nil, 0, "198.51.100.1", true, nil, risk.DecisionAllow},
+		{"usual place", berlin, 24 * time.Hour, "198.51.100.1", false, nil, risk.DecisionAllow},
+		{"new device", berlin, 24 * time.Hour, "198.51.100.1", true, []string{risk.ReasonNewDevice}, risk.DecisionAllow},
+		{"new country by train", berlin, 12 * time.Hour, "198.51.100.2", false, []string{risk.ReasonNewCountry}, risk.DecisionAllow},
+		{"new country and device", berlin, 12 * time.Hour, "198.51.100.2", true, []string{risk.ReasonNewDevice, risk.ReasonNewCountry}, risk.DecisionStepUp},
+		{"impossible travel", berlin, 30 * time.Minute, "198.51.100.2", false, []string{risk.ReasonNewCountry, risk.ReasonImpossibleTravel}, risk.DecisionStepUp},
+		{"bad address", berlin, time.Hour, "203.0.113.1", false, []string{risk.ReasonBadIP, risk.ReasonNewCountry, risk.ReasonImpossibleTravel}, risk.DecisionBlock},
+		{"bad address on first login", nil, 0, "203.0.113.1", false, []string{risk.ReasonBadIP}, risk.DecisionBlock},
+		{"unknown address", berlin, time.Hour, "192.0.2.1", true, []string{risk.ReasonNewDevice}, risk.DecisionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := auth.NewMemoryLoginHistory()
+			engine := risk.NewEngine(history, risk.DefaultPolicy(), risk.WithLocator(locator), risk.WithBadIPs(badIPs))
+			userID := uuid.New()
+			if tt.previous != nil {
+				addLogin(t, history, userID, tt.previous, now.Add(-tt.ago))
+			}
+
+			assessment, err := engine.Assess(context.Background(), risk.Attempt{
+				UserID:    userID,
+				IP:        tt.ip,
+				NewDevice: tt.newDevice,
+				At:        now,
+			})
+			if err != nil {
+				t.Fatalf("Assess failed: %v", err)
+			}
+			if !reflect.DeepEqual(assessment.Reasons, tt.want) {
+				t.Errorf("Expected reasons %v, got %v", tt.want, assessment.Reasons)
+			}
+			if assessment.Decision != tt.decision {
+				t.Errorf("Expected decision %q, got %q with score %d", tt.decision, assessment.Decision, assessment.Score)
+			}
+		})
+	}
+}
+
+func TestAssessWithoutLocator(t *testing.T) {
+	history := auth.NewMemoryLoginHistory()
+	engine := risk.NewEngine(history, risk.DefaultPolicy())
+	userID := uuid.New()
+	addLogin(t, history, userID, berlin, time.Now().Add(-time.Minute))
+
+	assessment, err := engine.Assess(context.Background(), risk.Attempt{UserID: userID, IP: "203.0.113.1", At: time.Now()})
+	if err != nil {
+		t.Fatalf("Assess failed: %v", err)
+	}
+	if assessment.Score != 0 || assessment.Location != nil {
+		t.Errorf("Expected no location signals without a GeoIP database, got %+v", assessment)
+	}
+}
+
+func TestParseIPList(t *testing.T) {
+	list, err := risk.ParseIPList(strings.NewReader("# Tor exits\n192.0.2.7\n\n198.51.100.0/24\n2001:db8::1\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse IP list: %v", err)
+	}
+	if list.Len() != 3 {
+		t.Errorf("Expected 3 entries, got %d", list.Len())
+	}
+
+	for ip, want := range map[string]bool{
+		"192.0.2.7":     true,
+		"192.0.2.8":     false,
+		"198.51.100.99": true,
+		"2001:db8::1":   true,
+		"2001:db8::2":   false,
+	} {
+		if got := list.Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if _, err := risk.ParseIPList(strings.NewReader("not-an-address\n")); err == nil {
+		t.Error("Expected an invalid line to be rejected")
+	}
+}
@@ -0,0 +1,84 @@
+// Package security provides the cross-origin and browser security policies of the HTTP API.
+package security
+
+import (
+	"authentication/src/config"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CORSPolicy decides which browser origins may call the API.
+type CORSPolicy struct {
+	// AllowedOrigins lists origins like https://app.example.com; "*" allows any origin.
+	AllowedOrigins []string
+	// AllowCredentials lets the allowed origins send the session cookie. It cannot be combined with "*".
+	AllowCredentials bool
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	// ExposedHeaders lists the response headers scripts of the allowed origins can read.
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// NewCORSPolicyFromConfig creates a CORSPolicy from the CORS configuration, or returns nil when no
+// origins are allowed. It rejects malformed origins and credentials for any origin.
+func NewCORSPolicyFromConfig(cfg config.CORSConfig) (*CORSPolicy, error) {
+	if len(cfg.AllowedOrigins) == 0 {
+		return nil, nil
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				return nil, fmt.Errorf("credentials cannot be allowed for any origin, list the origins instead")
+			}
+			continue
+		}
+		if err := validateOrigin(origin); err != nil {
+			return nil, err
+		}
+	}
+
+	return &CORSPolicy{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowCredentials: cfg.AllowCredentials,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		MaxAge:           time.Duration(cfg.MaxAgeSeconds) * time.Second,
+	}, nil
+}
+
+// validateOrigin checks that an origin is a scheme and host, with an optional port and nothing else.
+func validateOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("invalid CORS origin %q, expected scheme://host[:port]", origin)
+	}
+	return nil
+}
+
+// CORS is a middleware that answers preflight requests and adds the CORS headers of the policy.
+// Requests from other origins are served without them, so browsers keep their responses from scripts.
+func CORS(policy CORSPolicy) fiber.Handler {
+	maxAge := int(policy.MaxAge / time.Second)
+	if maxAge == 0 {
+		// Fiber omits the header for 0, letting browsers cache for 5 seconds
+		maxAge = -1
+	}
+
+	return cors.New(cors.Config{
+		AllowOrigins:     strings.Join(policy.AllowedOrigins, ","),
+		AllowCredentials: policy.AllowCredentials,
+		AllowMethods:     strings.Join(policy.AllowedMethods, ","),
+		AllowHeaders:     strings.Join(policy.AllowedHeaders, ","),
+		ExposeHeaders:    strings.Join(policy.ExposedHeaders, ","),
+		MaxAge:           maxAge,
+	})
+}
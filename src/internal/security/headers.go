@@ -0,0 +1,117 @@
+package security
+
+import (
+	"authentication/src/config"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+// headerPolicyLocalsKey holds the HeaderPolicy applied to the current request.
+const headerPolicyLocalsKey = "securityHeaders"
+
+// headerOff disables a header in the configuration.
+const headerOff = "off"
+
+// HeaderPolicy holds the security headers sent with responses. Empty values omit a header.
+type HeaderPolicy struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security; 0 omits the header.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+}
+
+// DefaultHeaderPolicy returns headers suited to a JSON API that is never framed or rendered as a page.
+func DefaultHeaderPolicy() HeaderPolicy {
+	return HeaderPolicy{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		PermissionsPolicy:     "camera=(), microphone=(), geolocation=(), payment=()",
+	}
+}
+
+// NewHeaderPolicyFromConfig creates a HeaderPolicy from the security header configuration.
+func NewHeaderPolicyFromConfig(cfg config.SecurityHeadersConfig) HeaderPolicy {
+	return HeaderPolicy{
+		HSTSMaxAge:            time.Duration(cfg.HSTSMaxAgeSeconds) * time.Second,
+		HSTSIncludeSubdomains: cfg.HSTSIncludeSubdomains,
+		HSTSPreload:           cfg.HSTSPreload,
+		ContentSecurityPolicy: configuredHeader(cfg.ContentSecurityPolicy),
+		FrameOptions:          configuredHeader(cfg.FrameOptions),
+		ReferrerPolicy:        configuredHeader(cfg.ReferrerPolicy),
+		PermissionsPolicy:     configuredHeader(cfg.PermissionsPolicy),
+	}
+}
+
+// configuredHeader returns the configured value of a header, or "" when it is turned off.
+func configuredHeader(value string) string {
+	if value == headerOff {
+		return ""
+	}
+	return value
+}
+
+// strictTransportSecurity returns the Strict-Transport-Security value, or "" to omit it.
+func (p HeaderPolicy) strictTransportSecurity() string {
+	if p.HSTSMaxAge <= 0 {
+		return ""
+	}
+	value := "max-age=" + strconv.FormatInt(int64(p.HSTSMaxAge/time.Second), 10)
+	if p.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if p.HSTSPreload {
+		value += "; preload"
+	}
+	return value
+}
+
+// apply sets the headers of the policy on the response, removing those it omits.
+func (p HeaderPolicy) apply(c *fiber.Ctx) {
+	headers := map[string]string{
+		fiber.HeaderStrictTransportSecurity: p.strictTransportSecurity(),
+		fiber.HeaderContentSecurityPolicy:   p.ContentSecurityPolicy,
+		fiber.HeaderXFrameOptions:           p.FrameOptions,
+		fiber.HeaderReferrerPolicy:          p.ReferrerPolicy,
+		fiber.HeaderPermissionsPolicy:       p.PermissionsPolicy,
+	}
+	for name, value := range headers {
+		if value == "" {
+			c.Response().Header.Del(name)
+			continue
+		}
+		c.Set(name, value)
+	}
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+}
+
+// SecurityHeaders is a middleware that sends the headers of the policy with every response.
+func SecurityHeaders(policy HeaderPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(headerPolicyLocalsKey, policy)
+		policy.apply(c)
+		return c.Next()
+	}
+}
+
+// OverrideHeaders is a route middleware that changes the security headers of the routes it is
+// registered on, for example to allow framing a single page. It has no effect without SecurityHeaders.
+func OverrideHeaders(override func(*HeaderPolicy)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		policy, ok := c.Locals(headerPolicyLocalsKey).(HeaderPolicy)
+		if !ok {
+			return c.Next()
+		}
+		override(&policy)
+		c.Locals(headerPolicyLocalsKey, policy)
+		policy.apply(c)
+		return c.Next()
+	}
+}
@@ -0,0 +1,156 @@
+package security_test
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/app"
+	"authentication/src/internal/security"
+	"authentication/src/internal/testutil"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withCORS allows browser apps on origin to call the API with the session cookie.
+func withCORS(origin string) testutil.HarnessOption {
+	return func(deps *app.Dependencies) {
+		deps.CORSPolicy = &security.CORSPolicy{
+			AllowedOrigins:   []string{origin},
+			AllowCredentials: true,
+			AllowedMethods:   []string{"GET", "POST"},
+			AllowedHeaders:   []string{"Content-Type", "X-CSRF-Token"},
+			ExposedHeaders:   []string{"X-CSRF-Token"},
+			MaxAge:           10 * time.Minute,
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	res := h.Do(http.MethodGet, "/auth/csrf", nil)
+	for name, want := range map[string]string{
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"X-Content-Type-Options":    "nosniff",
+	} {
+		if got := res.Header.Get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+	if res.Header.Get("Permissions-Policy") == "" {
+		t.Error("Expected a Permissions-Policy header")
+	}
+
+	// Error responses carry them as well
+	if res := h.Do(http.MethodPost, "/auth/login", map[string]string{}); res.Header.Get("X-Frame-Options") != "DENY" {
+		t.Errorf("Expected security headers on error responses, got status %d without them", res.Status)
+	}
+}
+
+func TestOverrideHeaders(t *testing.T) {
+	policy := security.DefaultHeaderPolicy()
+	policy.HSTSPreload = true
+
+	a := fiber.New()
+	a.Use(security.SecurityHeaders(policy))
+	a.Get("/api", func(c *fiber.Ctx) error { return c.SendString("api") })
+	a.Get("/embed", security.OverrideHeaders(func(p *security.HeaderPolicy) {
+		p.FrameOptions = ""
+		p.ContentSecurityPolicy = "frame-ancestors https://partner.example.com"
+	}), func(c *fiber.Ctx) error { return c.SendString("embed") })
+
+	res, err := a.Test(httptest.NewRequest(http.MethodGet, "/api", nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if got := res.Header.Get("X-Frame-Options"); got != "DENY" {
+		t.Errorf("Expected X-Frame-Options DENY, got %q", got)
+	}
+	if got := res.Header.Get("Strict-Transport-Security"); !strings.HasSuffix(got, "; preload") {
+		t.Errorf("Expected HSTS preload, got %q", got)
+	}
+
+	res, err = a.Test(httptest.NewRequest(http.MethodGet, "/embed", nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if got := res.Header.Get("X-Frame-Options"); got != "" {
+		t.Errorf("Expected no X-Frame-Options on the overridden route, got %q", got)
+	}
+	if got := res.Header.Get("Content-Security-Policy"); got != "frame-ancestors https://partner.example.com" {
+		t.Errorf("Expected the overridden policy, got %q", got)
+	}
+	if got := res.Header.Get("Referrer-Policy"); got != "no-referrer" {
+		t.Errorf("Expected headers without an override to stay, got %q", got)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	h := testutil.NewHarness(t, withCORS("https://app.example.com"))
+
+	req := httptest.NewRequest(http.MethodOptions, "/auth/logout", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-csrf-token")
+	res := h.DoRequest(req)
+	if res.Status != http.StatusNoContent {
+		t.Fatalf("Expected the preflight to be answered, got %d: %s", res.Status, res.RawBody)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET,POST",
+		"Access-Control-Allow-Headers":     "Content-Type,X-CSRF-Token",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := res.Header.Get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/csrf", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	res = h.DoRequest(req)
+	if got := res.Header.Get("Access-Control-Expose-Headers"); got != "X-CSRF-Token" {
+		t.Errorf("Expected the CSRF header to be exposed, got %q", got)
+	}
+}
+
+func TestCORSRejectsOtherOrigins(t *testing.T) {
+	h := testutil.NewHarness(t, withCORS("https://app.example.com"))
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/csrf", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	res := h.DoRequest(req)
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no CORS headers for another origin, got %q", got)
+	}
+}
+
+func TestNewCORSPolicyFromConfig(t *testing.T) {
+	cfg := config.CORSConfig{AllowCredentials: true, MaxAgeSeconds: 60}
+	if policy, err := security.NewCORSPolicyFromConfig(cfg); policy != nil || err != nil {
+		t.Errorf("Expected CORS to be off without origins, got %+v, %v", policy, err)
+	}
+
+	for _, origin := range []string{"*", "app.example.com", "https://app.example.com/login", "ftp://app.example.com"} {
+		cfg.AllowedOrigins = []string{origin}
+		if _, err := security.NewCORSPolicyFromConfig(cfg); err == nil {
+			t.Errorf("Expected origin %q with credentials to be rejected", origin)
+		}
+	}
+
+	cfg.AllowedOrigins = []string{"https://app.example.com", "http://localhost:5173"}
+	policy, err := security.NewCORSPolicyFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("Expected valid origins to be accepted: %v", err)
+	}
+	if policy.MaxAge != time.Minute {
+		t.Errorf("Expected a max age of a minute, got %v", policy.MaxAge)
+	}
+}
@@ -0,0 +1,298 @@
+// Package testutil boots the full application in-process on in-memory storage for end-to-end tests.
+package testutil
+
+import (
+	"authentication/src/config"
+	"authentication/src/internal/app"
+	"authentication/src/internal/auth"
+	"authentication/src/internal/password"
+	"authentication/src/internal/privacy"
+	"authentication/src/internal/user"
+	"authentication/src/utils"
+	"bytes"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// EmailHashKey keys the email hashes of erasure tombstones in the harness.
+const EmailHashKey = "test-email-hash-key-0123456789abcdef"
+
+// Harness is a running application backed entirely by in-memory storage.
+// It keeps a cookie jar, so consecutive requests behave like a single browser.
+type Harness struct {
+	t testing.TB
+
+	App              *fiber.App
+	Users            user.UserRepository
+	Registrations    user.PendingRegistrationRepository
+	PasswordHistory  user.PasswordHistoryRepository
+	Tombstones       privacy.TombstoneRepository
+	ExportJobs       privacy.ExportJobRepository
+	LoginHistory     auth.LoginHistory
+	AuditLog         auth.AuditLog
+	Tokens           auth.TokenStore
+	Codes            auth.CodeStore
+	SessionStorage   fiber.Storage
+	SessionIndex     auth.SessionIndex
+	RateLimiter      auth.RateLimiter
+	ForwardAuthCache auth.ForwardAuthCache
+	Mailer           *utils.CaptureMailer
+	PasswordHasher   password.Hasher
+
+	// AutoCSRF sends the session's CSRF token with state-changing requests that do not set one, like
+	// a single-page app would, starting a session for it when there is none. It is on by default.
+	AutoCSRF bool
+
+	cookies map[string]*http.Cookie
+	// csrfTokens caches the CSRF token of each session ID
+	csrfTokens map[string]string
+}
+
+// Response is a decoded API response.
+type Response struct {
+	Status  int
+	Header  http.Header
+	Body    utils.Response
+	RawBody []byte
+}
+
+// HarnessOption adjusts the dependencies the application is built from.
+type HarnessOption func(*app.Dependencies)
+
+// NewHarness creates a Harness with fresh in-memory storage.
+func NewHarness(t testing.TB, opts ...HarnessOption) *Harness {
+	t.Helper()
+
+	// Cheap parameters keep the suite fast; production costs are exercised by the password package tests
+	passwordHasher, err := password.NewHasher(password.Params{
+		Algorithm:         password.AlgorithmArgon2id,
+		Argon2Memory:      1024,
+		Argon2Time:        1,
+		Argon2Parallelism: 1,
+		BcryptCost:        4,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create password hasher: %v", err)
+	}
+
+	h := &Harness{
+		t:                t,
+		Users:            user.NewMemoryUserRepository(),
+		Registrations:    user.NewMemoryPendingRegistrationRepository(),
+		PasswordHistory:  user.NewMemoryPasswordHistoryRepository(),
+		Tombstones:       privacy.NewMemoryTombstoneRepository(),
+		ExportJobs:       privacy.NewMemoryExportJobRepository(),
+		LoginHistory:     auth.NewMemoryLoginHistory(),
+		AuditLog:         auth.NewMemoryAuditLog(),
+		Tokens:           auth.NewMemoryTokenStore(),
+		Codes:            auth.NewMemoryCodeStore(),
+		SessionStorage:   auth.NewMemorySessionStorage(),
+		SessionIndex:     auth.NewMemorySessionIndex(),
+		RateLimiter:      auth.NewMemoryRateLimiter(),
+		ForwardAuthCache: auth.NewMemoryForwardAuthCache(),
+		Mailer:           utils.NewCaptureMailer(),
+		PasswordHasher:   passwordHasher,
+		AutoCSRF:         true,
+		cookies:          make(map[string]*http.Cookie),
+		csrfTokens:       make(map[string]string),
+	}
+	deps := app.Dependencies{
+		UserRepository:       h.Users,
+		PendingRegistrations: h.Registrations,
+		PasswordHistory:      h.PasswordHistory,
+		Tombstones:           h.Tombstones,
+		ExportJobs:           h.ExportJobs,
+		LoginHistory:         h.LoginHistory,
+		AuditLog:             h.AuditLog,
+		TokenStore:           h.Tokens,
+		CodeStore:            h.Codes,
+		SessionStorage:       h.SessionStorage,
+		SessionIndex:         h.SessionIndex,
+		RateLimiter:          h.RateLimiter,
+		ForwardAuthCache:     h.ForwardAuthCache,
+		Mailer:               h.Mailer,
+		PasswordHasher:       h.PasswordHasher,
+		TokenConfig: config.TokenConfig{
+			Secret:          "test-secret-key",
+			CodeLength:      6,
+			CodeMaxAttempts: 5,
+		},
+		AuthConfig: config.AuthConfig{
+			NewDeviceAlerts:                true,
+			MailRateLimit:                  5,
+			MailRateLimitWindowMinutes:     60,
+			ReauthenticationMaxFailures:    5,
+			ReauthenticationLockoutMinutes: 15,
+		},
+		ForwardAuthConfig: config.ForwardAuthConfig{
+			CacheTTLSeconds: 5,
+		},
+		PrivacyConfig: config.PrivacyConfig{
+			EmailHashKey:   EmailHashKey,
+			ExportTTLHours: 24,
+		},
+	}
+	for _, opt := range opts {
+		opt(&deps)
+	}
+
+	h.App = app.New(deps)
+	return h
+}
+
+// Do sends a request with body encoded as JSON (unless nil) and returns the decoded response.
+func (h *Harness) Do(method, path string, body interface{}) *Response {
+	h.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			h.t.Fatalf("Failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	return h.DoRequest(req)
+}
+
+// DoRequest sends a prepared request, adding and updating the cookie jar.
+func (h *Harness) DoRequest(req *http.Request) *Response {
+	h.t.Helper()
+
+	if h.AutoCSRF && req.Header.Get(auth.CSRFHeader) == "" && !isSafeMethod(req.Method) {
+		if token := h.CSRFToken(); token != "" {
+			req.Header.Set(auth.CSRFHeader, token)
+		}
+	}
+	for _, cookie := range h.cookies {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	res, err := h.App.Test(req, -1)
+	if err != nil {
+		h.t.Fatalf("Request %s %s failed: %v", req.Method, req.URL.Path, err)
+	}
+	defer res.Body.Close()
+
+	for _, cookie := range res.Cookies() {
+		if cookie.MaxAge < 0 || cookie.Value == "" || (!cookie.Expires.IsZero() && cookie.Expires.Before(time.Now())) {
+			delete(h.cookies, cookie.Name)
+			continue
+		}
+		h.cookies[cookie.Name] = cookie
+	}
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		h.t.Fatalf("Failed to read response body: %v", err)
+	}
+
+	response := &Response{Status: res.StatusCode, Header: res.Header, RawBody: raw}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &response.Body)
+	}
+	return response
+}
+
+// CSRFToken returns the CSRF token of the current session, fetching it from /auth/csrf the first
+// time. Without a session, fetching it starts one, as logging in needs a token too.
+func (h *Harness) CSRFToken() string {
+	h.t.Helper()
+
+	sessionID := h.Cookie("session_id")
+	if token, ok := h.csrfTokens[sessionID]; ok && sessionID != "" {
+		return token
+	}
+
+	res := h.Do(http.MethodGet, "/auth/csrf", nil)
+	if res.Status != http.StatusOK {
+		h.t.Fatalf("Fetching the CSRF token failed with status %d: %s", res.Status, res.RawBody)
+	}
+	token := res.Header.Get(auth.CSRFHeader)
+	// The request may have started a session or replaced one that had expired
+	h.csrfTokens[h.Cookie("session_id")] = token
+	return token
+}
+
+// isSafeMethod reports whether requests with the method are exempt from CSRF checks.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// Cookie returns the current value of a cookie in the jar.
+func (h *Harness) Cookie(name string) string {
+	if cookie, ok := h.cookies[name]; ok {
+		return cookie.Value
+	}
+	return ""
+}
+
+// SetCookie puts a cookie into the jar, for example to switch back to an earlier session.
+func (h *Harness) SetCookie(name, value string) {
+	h.cookies[name] = &http.Cookie{Name: name, Value: value}
+}
+
+// ClearCookies empties the cookie jar, like switching to a new browser.
+func (h *Harness) ClearCookies() {
+	h.cookies = make(map[string]*http.Cookie)
+}
+
+// LastMail returns the content of the most recent mail of the given kind sent to the address.
+func (h *Harness) LastMail(kind, to string) string {
+	h.t.Helper()
+
+	mail, ok := h.Mailer.Last(kind, to)
+	if !ok {
+		h.t.Fatalf("No %s mail was sent to %s", kind, to)
+	}
+	return mail.Content
+}
+
+// RegisterVerifiedUser registers a user through the API and verifies their email address.
+func (h *Harness) RegisterVerifiedUser(name, email, password string) {
+	h.t.Helper()
+
+	res := h.Do(http.MethodPost, "/auth/register", map[string]string{
+		"name":     name,
+		"email":    email,
+		"password": password,
+	})
+	if res.Status != http.StatusOK {
+		h.t.Fatalf("Registration failed with status %d: %s", res.Status, res.RawBody)
+	}
+
+	res = h.Do(http.MethodPost, "/auth/verify-email/", map[string]string{
+		"token": h.LastMail(utils.MailKindVerification, email),
+	})
+	if res.Status != http.StatusOK {
+		h.t.Fatalf("Email verification failed with status %d: %s", res.Status, res.RawBody)
+	}
+}
+
+// Login logs in through the API and fails the test if it does not succeed.
+func (h *Harness) Login(email, password string) *Response {
+	h.t.Helper()
+
+	res := h.Do(http.MethodPost, "/auth/login", map[string]string{
+		"email":    email,
+		"password": password,
+	})
+	if res.Status != http.StatusOK {
+		h.t.Fatalf("Login failed with status %d: %s", res.Status, res.RawBody)
+	}
+	return res
+}
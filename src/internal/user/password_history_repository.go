@@ -0,0 +1,110 @@
+package user
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PasswordHistoryRepository stores the previous password hashes of users.
+type PasswordHistoryRepository interface {
+	// Add records a previous password hash and keeps only the newest keep entries of the user.
+	Add(ctx context.Context, entry *models.PasswordHistory, keep int) error
+	// List returns up to limit of the user's previous password hashes, newest first.
+	List(ctx context.Context, userID uuid.UUID, limit int) ([]models.PasswordHistory, error)
+	// DeleteAll removes the whole history of the user.
+	DeleteAll(ctx context.Context, userID uuid.UUID) error
+}
+
+// passwordHistoryRepository implements PasswordHistoryRepository with the password_history table.
+type passwordHistoryRepository struct {
+	db *gorm.DB
+}
+
+// NewPasswordHistoryRepository creates a PasswordHistoryRepository backed by Postgres.
+func NewPasswordHistoryRepository(db *gorm.DB) PasswordHistoryRepository {
+	return &passwordHistoryRepository{
+		db: db,
+	}
+}
+
+// Add records a previous password hash and trims the user's history.
+func (r *passwordHistoryRepository) Add(ctx context.Context, entry *models.PasswordHistory, keep int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		newest := tx.Model(&models.PasswordHistory{}).Select("id").
+			Where("user_id = ?", entry.UserID).Order("created_at DESC").Limit(keep)
+		return tx.Where("user_id = ? AND id NOT IN (?)", entry.UserID, newest).Delete(&models.PasswordHistory{}).Error
+	})
+}
+
+// List returns the user's previous password hashes, newest first.
+func (r *passwordHistoryRepository) List(ctx context.Context, userID uuid.UUID, limit int) ([]models.PasswordHistory, error) {
+	var entries []models.PasswordHistory
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// DeleteAll removes the whole history of the user.
+func (r *passwordHistoryRepository) DeleteAll(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&models.PasswordHistory{}, "user_id = ?", userID).Error
+}
+
+// memoryPasswordHistoryRepository implements PasswordHistoryRepository in memory, for tests and local development.
+type memoryPasswordHistoryRepository struct {
+	mu      sync.Mutex
+	entries map[uuid.UUID][]models.PasswordHistory
+}
+
+// NewMemoryPasswordHistoryRepository creates an in-memory PasswordHistoryRepository.
+func NewMemoryPasswordHistoryRepository() PasswordHistoryRepository {
+	return &memoryPasswordHistoryRepository{
+		entries: make(map[uuid.UUID][]models.PasswordHistory),
+	}
+}
+
+// Add records a previous password hash and trims the user's history.
+func (r *memoryPasswordHistoryRepository) Add(ctx context.Context, entry *models.PasswordHistory, keep int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	entry.CreatedAt = time.Now()
+
+	entries := append([]models.PasswordHistory{*entry}, r.entries[entry.UserID]...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.After(entries[j].CreatedAt) })
+	if len(entries) > keep {
+		entries = entries[:keep]
+	}
+	r.entries[entry.UserID] = entries
+	return nil
+}
+
+// List returns the user's previous password hashes, newest first.
+func (r *memoryPasswordHistoryRepository) List(ctx context.Context, userID uuid.UUID, limit int) ([]models.PasswordHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := r.entries[userID]
+	if limit >= 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return append([]models.PasswordHistory(nil), entries...), nil
+}
+
+// DeleteAll removes the whole history of the user.
+func (r *memoryPasswordHistoryRepository) DeleteAll(ctx context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, userID)
+	return nil
+}
@@ -0,0 +1,178 @@
+package user
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PendingRegistrationRepository stores signups until their email address is verified. An address
+// can have several signups, each verified on its own. Expired registrations are never returned.
+type PendingRegistrationRepository interface {
+	// Save stores the registration under a new ID, next to the other registrations for the same
+	// email. Emails are expected in the form of utils.NormalizeEmail.
+	Save(ctx context.Context, registration *models.PendingRegistration) error
+	// GetByID returns the registration or gorm.ErrRecordNotFound.
+	GetByID(ctx context.Context, id uuid.UUID) (*models.PendingRegistration, error)
+	// ListByEmail returns the registrations for the email, newest first.
+	ListByEmail(ctx context.Context, email string) ([]models.PendingRegistration, error)
+	// Delete removes the registration.
+	Delete(ctx context.Context, id uuid.UUID) error
+	// DeleteByEmail removes all registrations for the email.
+	DeleteByEmail(ctx context.Context, email string) error
+	// DeleteExpired removes registrations that expired before now and returns how many were removed.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// pendingRegistrationRepository implements PendingRegistrationRepository with the pending_registrations table.
+type pendingRegistrationRepository struct {
+	db *gorm.DB
+}
+
+// NewPendingRegistrationRepository creates a PendingRegistrationRepository backed by Postgres.
+func NewPendingRegistrationRepository(db *gorm.DB) PendingRegistrationRepository {
+	return &pendingRegistrationRepository{
+		db: db,
+	}
+}
+
+// Save stores the registration under a new ID.
+func (r *pendingRegistrationRepository) Save(ctx context.Context, registration *models.PendingRegistration) error {
+	registration.ID = uuid.New()
+	return r.db.WithContext(ctx).Create(registration).Error
+}
+
+// GetByID returns an unexpired registration.
+func (r *pendingRegistrationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.PendingRegistration, error) {
+	var registration models.PendingRegistration
+	err := r.db.WithContext(ctx).First(&registration, "id = ? AND expires_at > ?", id, time.Now()).Error
+	if err != nil {
+		return nil, err
+	}
+	return &registration, nil
+}
+
+// ListByEmail returns the unexpired registrations for the email, newest first.
+func (r *pendingRegistrationRepository) ListByEmail(ctx context.Context, email string) ([]models.PendingRegistration, error) {
+	var registrations []models.PendingRegistration
+	err := r.db.WithContext(ctx).
+		Where("email = ? AND expires_at > ?", email, time.Now()).
+		Order("created_at DESC").
+		Find(&registrations).Error
+	if err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+// Delete removes the registration.
+func (r *pendingRegistrationRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&models.PendingRegistration{}, "id = ?", id).Error
+}
+
+// DeleteByEmail removes all registrations for the email.
+func (r *pendingRegistrationRepository) DeleteByEmail(ctx context.Context, email string) error {
+	return r.db.WithContext(ctx).Delete(&models.PendingRegistration{}, "email = ?", email).Error
+}
+
+// DeleteExpired removes expired registrations.
+func (r *pendingRegistrationRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Delete(&models.PendingRegistration{}, "expires_at <= ?", now)
+	return result.RowsAffected, result.Error
+}
+
+// memoryPendingRegistrationRepository implements PendingRegistrationRepository in memory, for tests and local development.
+type memoryPendingRegistrationRepository struct {
+	mu            sync.Mutex
+	registrations map[uuid.UUID]models.PendingRegistration
+}
+
+// NewMemoryPendingRegistrationRepository creates an in-memory PendingRegistrationRepository.
+func NewMemoryPendingRegistrationRepository() PendingRegistrationRepository {
+	return &memoryPendingRegistrationRepository{
+		registrations: make(map[uuid.UUID]models.PendingRegistration),
+	}
+}
+
+// Save stores the registration under a new ID.
+func (r *memoryPendingRegistrationRepository) Save(ctx context.Context, registration *models.PendingRegistration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	registration.ID = uuid.New()
+	registration.CreatedAt = now
+	registration.UpdatedAt = now
+	r.registrations[registration.ID] = *registration
+	return nil
+}
+
+// GetByID returns an unexpired registration.
+func (r *memoryPendingRegistrationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.PendingRegistration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registration, ok := r.registrations[id]
+	if !ok || !registration.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &registration, nil
+}
+
+// ListByEmail returns the unexpired registrations for the email, newest first.
+func (r *memoryPendingRegistrationRepository) ListByEmail(ctx context.Context, email string) ([]models.PendingRegistration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var registrations []models.PendingRegistration
+	for _, registration := range r.registrations {
+		if registration.Email == email && registration.ExpiresAt.After(time.Now()) {
+			registrations = append(registrations, registration)
+		}
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].CreatedAt.After(registrations[j].CreatedAt)
+	})
+	return registrations, nil
+}
+
+// Delete removes the registration.
+func (r *memoryPendingRegistrationRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.registrations, id)
+	return nil
+}
+
+// DeleteByEmail removes all registrations for the email.
+func (r *memoryPendingRegistrationRepository) DeleteByEmail(ctx context.Context, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, registration := range r.registrations {
+		if registration.Email == email {
+			delete(r.registrations, id)
+		}
+	}
+	return nil
+}
+
+// DeleteExpired removes expired registrations.
+func (r *memoryPendingRegistrationRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, registration := range r.registrations {
+		if !registration.ExpiresAt.After(now) {
+			delete(r.registrations, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
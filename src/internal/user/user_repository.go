@@ -5,18 +5,24 @@ import (
 	"context"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"time"
 )
 
 // UserRepository defines database operations for user management.
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	UpdateUser(ctx context.Context, user *models.User) error
+	// UpdateLastLogin sets only the last login time of the user, leaving concurrent changes to other
+	// columns in place.
+	UpdateLastLogin(ctx context.Context, userID uuid.UUID, at time.Time) error
 	GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	DeleteUser(ctx context.Context, userID uuid.UUID, permanent bool) error
 
 	ListUsers(ctx context.Context, limit, offset int) ([]models.User, error)
 	GetUsersByIDs(ctx context.Context, userIDs []uuid.UUID) ([]*models.User, error)
+	// PurgeDeletedUsers permanently removes users soft-deleted before the given time and returns how many were removed.
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 // userRepository implements UserRepository for user database logic.
@@ -41,6 +47,18 @@ func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) erro
 	return r.db.WithContext(ctx).Save(user).Error
 }
 
+// UpdateLastLogin sets the last login time of a user.
+func (r *userRepository) UpdateLastLogin(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).UpdateColumn("last_login_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 // GetUserByID retrieves a user by ID from the database.
 func (r *userRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
 	var user models.User
@@ -51,10 +69,10 @@ func (r *userRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*mo
 	return &user, nil
 }
 
-// GetUserByEmail retrieves a user by email
+// GetUserByEmail retrieves a user by email, ignoring the case of addresses stored before they were normalized
 func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	err := r.db.WithContext(ctx).First(&user, "email = ?", email).Error
+	err := r.db.WithContext(ctx).First(&user, "LOWER(email) = LOWER(?)", email).Error
 	if err != nil {
 		return nil, err
 	}
@@ -93,3 +111,9 @@ func (r *userRepository) GetUsersByIDs(ctx context.Context, userIDs []uuid.UUID)
 	}
 	return users, nil
 }
+
+// PurgeDeletedUsers permanently removes users soft-deleted before the given time
+func (r *userRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().Delete(&models.User{}, "deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore)
+	return result.RowsAffected, result.Error
+}
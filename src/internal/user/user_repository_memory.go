@@ -0,0 +1,175 @@
+package user
+
+import (
+	"authentication/src/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryUserRepository implements UserRepository in memory, for tests and local development.
+// It mirrors the Postgres behaviour the service relies on: gorm.ErrRecordNotFound for
+// missing rows, soft deletes and a unique email index.
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[uuid.UUID]models.User
+}
+
+// NewMemoryUserRepository creates an in-memory UserRepository.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{
+		users: make(map[uuid.UUID]models.User),
+	}
+}
+
+// CreateUser creates a new user.
+func (r *memoryUserRepository) CreateUser(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if strings.EqualFold(existing.Email, user.Email) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	r.users[user.ID] = *user
+	return nil
+}
+
+// UpdateUser saves an existing user, creating it if it does not exist.
+func (r *memoryUserRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, existing := range r.users {
+		if id != user.ID && existing.Email == user.Email {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+
+	user.UpdatedAt = time.Now()
+	r.users[user.ID] = *user
+	return nil
+}
+
+// UpdateLastLogin sets the last login time of a user.
+func (r *memoryUserRepository) UpdateLastLogin(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.DeletedAt.Valid {
+		return gorm.ErrRecordNotFound
+	}
+	user.LastLoginAt = &at
+	r.users[userID] = user
+	return nil
+}
+
+// GetUserByID retrieves a user by ID.
+func (r *memoryUserRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email.
+func (r *memoryUserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) && !user.DeletedAt.Valid {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// DeleteUser deletes a user, permanently or softly.
+func (r *memoryUserRepository) DeleteUser(ctx context.Context, userID uuid.UUID, permanent bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil
+	}
+	if permanent {
+		delete(r.users, userID)
+		return nil
+	}
+	user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.users[userID] = user
+	return nil
+}
+
+// ListUsers retrieves users ordered by creation time with pagination.
+func (r *memoryUserRepository) ListUsers(ctx context.Context, limit, offset int) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, user := range r.users {
+		if !user.DeletedAt.Valid {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	if offset >= len(users) {
+		return []models.User{}, nil
+	}
+	users = users[offset:]
+	if limit >= 0 && limit < len(users) {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// GetUsersByIDs retrieves users by a slice of IDs.
+func (r *memoryUserRepository) GetUsersByIDs(ctx context.Context, userIDs []uuid.UUID) ([]*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*models.User, 0, len(userIDs))
+	for _, id := range userIDs {
+		if user, ok := r.users[id]; ok && !user.DeletedAt.Valid {
+			users = append(users, &user)
+		}
+	}
+	return users, nil
+}
+
+// PurgeDeletedUsers permanently removes users soft-deleted before the given time.
+func (r *memoryUserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, user := range r.users {
+		if user.DeletedAt.Valid && user.DeletedAt.Time.Before(deletedBefore) {
+			delete(r.users, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
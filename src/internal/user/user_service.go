@@ -4,11 +4,14 @@ import (
 	"authentication/src/internal/dto"
 	"authentication/src/internal/errs"
 	"authentication/src/internal/models"
+	"authentication/src/internal/password"
 	"authentication/src/utils"
 	"context"
 	"errors"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"log"
+	"time"
 )
 
 // UserService defines user-related operations for the application.
@@ -19,8 +22,21 @@ type UserService interface {
 	GetUserByEmail(ctx context.Context, emailDTO *dto.GetUserByEmailDTO) (*models.User, error)
 	// CreateUser creates a new user.
 	CreateUser(ctx context.Context, userDTO *dto.CreateUserDTO) (*models.User, error)
+	// RegisterPending stores a signup until its email address is verified. Registering the
+	// same email again adds another pending registration and leaves the earlier ones in place.
+	RegisterPending(ctx context.Context, userDTO *dto.CreateUserDTO) (*models.PendingRegistration, error)
+	// GetPendingRegistration retrieves the newest unexpired pending registration by email, or nil if there is none.
+	GetPendingRegistration(ctx context.Context, email string) (*models.PendingRegistration, error)
+	// ListPendingRegistrations retrieves the unexpired pending registrations by email, newest first.
+	ListPendingRegistrations(ctx context.Context, email string) ([]models.PendingRegistration, error)
+	// GetPendingRegistrationByID retrieves an unexpired pending registration by ID, or nil if there is none.
+	GetPendingRegistrationByID(ctx context.Context, registrationID uuid.UUID) (*models.PendingRegistration, error)
+	// CompleteRegistration turns a pending registration into a verified user.
+	CompleteRegistration(ctx context.Context, registrationID uuid.UUID) (*models.User, error)
 	// UpdateUser updates an existing user.
 	UpdateUser(ctx context.Context, user *models.User) (*models.User, error)
+	// UpdateLastLogin records when the user last logged in.
+	UpdateLastLogin(ctx context.Context, userID uuid.UUID, at time.Time) error
 	// DeleteUser deletes a user by ID.
 	DeleteUser(ctx context.Context, userID uuid.UUID) error
 	// ListUsers lists users with pagination.
@@ -29,14 +45,47 @@ type UserService interface {
 
 // userService implements UserService for user management logic.
 type userService struct {
-	ur UserRepository
+	ur            UserRepository
+	pr            PendingRegistrationRepository
+	hasher        password.Hasher
+	breachChecker password.BreachChecker
+	pendingTTL    time.Duration
+}
+
+// defaultPendingRegistrationTTL is how long an unverified signup is kept by default.
+const defaultPendingRegistrationTTL = 24 * time.Hour
+
+// UserServiceOption configures optional behaviour of the UserService.
+type UserServiceOption func(*userService)
+
+// WithBreachChecker rejects new users whose password is known from a data breach.
+func WithBreachChecker(checker password.BreachChecker) UserServiceOption {
+	return func(u *userService) {
+		u.breachChecker = checker
+	}
+}
+
+// WithPendingRegistrationTTL sets how long an unverified signup is kept before it must be repeated.
+func WithPendingRegistrationTTL(ttl time.Duration) UserServiceOption {
+	return func(u *userService) {
+		if ttl > 0 {
+			u.pendingTTL = ttl
+		}
+	}
 }
 
 // NewUserService creates a new UserService instance.
-func NewUserService(ur UserRepository) UserService {
-	return &userService{
-		ur: ur,
+func NewUserService(ur UserRepository, pr PendingRegistrationRepository, hasher password.Hasher, opts ...UserServiceOption) UserService {
+	u := &userService{
+		ur:         ur,
+		pr:         pr,
+		hasher:     hasher,
+		pendingTTL: defaultPendingRegistrationTTL,
 	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
 }
 
 // GetUserByID retrieves a user by ID.
@@ -53,7 +102,7 @@ func (u userService) GetUserByID(ctx context.Context, userID uuid.UUID) (*models
 
 // GetUserByEmail retrieves a user by email.
 func (u userService) GetUserByEmail(ctx context.Context, emailDTO *dto.GetUserByEmailDTO) (*models.User, error) {
-	user, err := u.ur.GetUserByEmail(ctx, emailDTO.Email)
+	user, err := u.ur.GetUserByEmail(ctx, utils.NormalizeEmail(emailDTO.Email))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil // User not found
@@ -67,7 +116,12 @@ func (u userService) GetUserByEmail(ctx context.Context, emailDTO *dto.GetUserBy
 // CreateUser creates a new user.
 func (u userService) CreateUser(ctx context.Context, userDTO *dto.CreateUserDTO) (*models.User, error) {
 
-	existingUser, err := u.ur.GetUserByEmail(ctx, userDTO.Email)
+	if err := password.CheckBreached(u.breachChecker, userDTO.Password); err != nil {
+		return nil, err
+	}
+
+	email := utils.NormalizeEmail(userDTO.Email)
+	existingUser, err := u.ur.GetUserByEmail(ctx, email)
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -79,26 +133,22 @@ func (u userService) CreateUser(ctx context.Context, userDTO *dto.CreateUserDTO)
 	}
 
 	if existingUser != nil {
-		if !existingUser.Verified {
-			err := u.ur.DeleteUser(ctx, existingUser.ID, true)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, errs.ErrUserAlreadyExists
-		}
-
+		return nil, errs.ErrUserAlreadyExists
 	}
 
-	hashedPassword, err := utils.HashPassword(userDTO.Password)
+	hashedPassword, err := u.hasher.Hash(userDTO.Password)
 	if err != nil {
 		return nil, errs.ErrInternalServerError // Error hashing password
 	}
 
+	now := time.Now()
 	newUser := &models.User{
-		Email:        userDTO.Email,
-		PasswordHash: hashedPassword,
-		FullName:     userDTO.FullName,
+		Email:             email,
+		PasswordHash:      hashedPassword,
+		FullName:          userDTO.FullName,
+		PasswordChangedAt: &now,
+		Role:              models.RoleUser,
+		Status:            models.AccountStatusActive,
 	}
 
 	err = u.ur.CreateUser(ctx, newUser)
@@ -110,6 +160,120 @@ func (u userService) CreateUser(ctx context.Context, userDTO *dto.CreateUserDTO)
 	return newUser, nil
 }
 
+// RegisterPending stores a signup until its email address is verified.
+func (u userService) RegisterPending(ctx context.Context, userDTO *dto.CreateUserDTO) (*models.PendingRegistration, error) {
+
+	if err := password.CheckBreached(u.breachChecker, userDTO.Password); err != nil {
+		return nil, err
+	}
+
+	// Hashed before the lookup, so an existing account does not make registering faster
+	hashedPassword, err := u.hasher.Hash(userDTO.Password)
+	if err != nil {
+		return nil, errs.ErrInternalServerError // Error hashing password
+	}
+
+	email := utils.NormalizeEmail(userDTO.Email)
+	existingUser, err := u.ur.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if existingUser != nil && existingUser.Verified {
+		return nil, errs.ErrUserAlreadyExists
+	}
+
+	registration := &models.PendingRegistration{
+		Email:        email,
+		FullName:     userDTO.FullName,
+		PasswordHash: hashedPassword,
+		ExpiresAt:    time.Now().Add(u.pendingTTL),
+	}
+	if err := u.pr.Save(ctx, registration); err != nil {
+		return nil, err
+	}
+
+	return registration, nil
+}
+
+// GetPendingRegistration retrieves the newest unexpired pending registration by email.
+func (u userService) GetPendingRegistration(ctx context.Context, email string) (*models.PendingRegistration, error) {
+	registrations, err := u.ListPendingRegistrations(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if len(registrations) == 0 {
+		return nil, nil // No pending registration
+	}
+	return &registrations[0], nil
+}
+
+// ListPendingRegistrations retrieves the unexpired pending registrations by email, newest first.
+func (u userService) ListPendingRegistrations(ctx context.Context, email string) ([]models.PendingRegistration, error) {
+	return u.pr.ListByEmail(ctx, utils.NormalizeEmail(email))
+}
+
+// GetPendingRegistrationByID retrieves an unexpired pending registration by ID.
+func (u userService) GetPendingRegistrationByID(ctx context.Context, registrationID uuid.UUID) (*models.PendingRegistration, error) {
+	registration, err := u.pr.GetByID(ctx, registrationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil // No pending registration
+		}
+		return nil, err
+	}
+	return registration, nil
+}
+
+// CompleteRegistration creates the verified user for a pending registration and removes the registrations of its email.
+func (u userService) CompleteRegistration(ctx context.Context, registrationID uuid.UUID) (*models.User, error) {
+
+	registration, err := u.pr.GetByID(ctx, registrationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	existingUser, err := u.ur.GetUserByEmail(ctx, registration.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if existingUser != nil {
+		if existingUser.Verified {
+			return nil, errs.ErrUserAlreadyExists
+		}
+		// An unverified user left over from before pending registrations existed; the
+		// address owner has just proven control, so the newer signup wins
+		if err := u.ur.DeleteUser(ctx, existingUser.ID, true); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	newUser := &models.User{
+		ID:                registration.ID,
+		Email:             registration.Email,
+		PasswordHash:      registration.PasswordHash,
+		FullName:          registration.FullName,
+		Verified:          true,
+		PasswordChangedAt: &now,
+		Role:              models.RoleUser,
+		Status:            models.AccountStatusActive,
+	}
+	if err := u.ur.CreateUser(ctx, newUser); err != nil {
+		return nil, err
+	}
+
+	// Other signups of the address can no longer be completed
+	if err := u.pr.DeleteByEmail(ctx, registration.Email); err != nil {
+		// The user exists now; leftover registrations only expire later
+		log.Printf("Error deleting pending registrations of %s: %v", registration.ID, err)
+	}
+
+	return newUser, nil
+}
+
 // UpdateUser updates an existing user.
 func (u userService) UpdateUser(ctx context.Context, user *models.User) (*models.User, error) {
 
@@ -131,6 +295,15 @@ func (u userService) UpdateUser(ctx context.Context, user *models.User) (*models
 	return user, nil
 }
 
+// UpdateLastLogin records when the user last logged in.
+func (u userService) UpdateLastLogin(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	err := u.ur.UpdateLastLogin(ctx, userID, at)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errs.ErrUserNotFound
+	}
+	return err
+}
+
 // DeleteUser deletes a user by ID.
 func (u userService) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 
@@ -1,23 +1,159 @@
 package user_test
 
 import (
+	"authentication/src/internal/dto"
+	"authentication/src/internal/errs"
+	"authentication/src/internal/models"
+	"authentication/src/internal/password"
 	"authentication/src/internal/user"
-	"authentication/src/models"
+	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
+func newUserService(t *testing.T) user.UserService {
+	hasher, err := password.NewHasher(password.Params{Argon2Memory: 1024, Argon2Time: 1, Argon2Parallelism: 1})
+	if err != nil {
+		t.Fatalf("Failed to create password hasher: %v", err)
+	}
+	return user.NewUserService(user.NewMemoryUserRepository(), user.NewMemoryPendingRegistrationRepository(), hasher)
+}
+
 func TestCreateUser(t *testing.T) {
-	service := user.NewService(nil) // Pass nil or mock repository
-	newUser := models.User{
-		Username: "testuser",
+	service := newUserService(t)
+	newUser := &dto.CreateUserDTO{
+		FullName: "Test User",
 		Email:    "test@example.com",
 		Password: "password123",
 	}
-	created, err := service.CreateUser(newUser)
+	created, err := service.CreateUser(context.Background(), newUser)
 	if err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
-	if created.Username != newUser.Username {
-		t.Error("Usernames do not match")
+	if created.FullName != newUser.FullName {
+		t.Error("Names do not match")
+	}
+	if created.PasswordHash == newUser.Password {
+		t.Error("Password should be stored hashed")
+	}
+}
+
+func TestCreateUserRejectsExistingEmail(t *testing.T) {
+	ctx := context.Background()
+	service := newUserService(t)
+	newUser := &dto.CreateUserDTO{FullName: "Test User", Email: "test@example.com", Password: "password123"}
+
+	if _, err := service.CreateUser(ctx, newUser); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := service.CreateUser(ctx, newUser); !errors.Is(err, errs.ErrUserAlreadyExists) {
+		t.Errorf("Expected ErrUserAlreadyExists, got %v", err)
+	}
+}
+
+func TestUpdateLastLoginKeepsOtherChanges(t *testing.T) {
+	ctx := context.Background()
+	service := newUserService(t)
+	created, err := service.CreateUser(ctx, &dto.CreateUserDTO{FullName: "Test User", Email: "test@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// A login that loaded the user before the status change only writes its login time
+	stale := *created
+	created.Status = models.AccountStatusSuspended
+	if _, err := service.UpdateUser(ctx, created); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	loginTime := time.Now().Truncate(time.Second)
+	if err := service.UpdateLastLogin(ctx, stale.ID, loginTime); err != nil {
+		t.Fatalf("Failed to update last login: %v", err)
+	}
+
+	stored, err := service.GetUserByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if stored.Status != models.AccountStatusSuspended || stored.LastLoginAt == nil || !stored.LastLoginAt.Equal(loginTime) {
+		t.Errorf("Unexpected user after recording the login: %+v", stored)
+	}
+}
+
+func TestRegisterPendingKeepsEarlierRegistrations(t *testing.T) {
+	ctx := context.Background()
+	service := newUserService(t)
+
+	first, err := service.RegisterPending(ctx, &dto.CreateUserDTO{FullName: "Test User", Email: "test@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	second, err := service.RegisterPending(ctx, &dto.CreateUserDTO{FullName: "Other Name", Email: " Test@Example.com", Password: "password456"})
+	if err != nil {
+		t.Fatalf("Failed to register again: %v", err)
+	}
+	if first.ID == second.ID || second.Email != "test@example.com" {
+		t.Errorf("Expected re-registration to add a pending registration under the normalized address: %+v", second)
+	}
+	pending, err := service.ListPendingRegistrations(ctx, "test@example.com")
+	if err != nil || len(pending) != 2 || pending[0].ID != second.ID || pending[1].ID != first.ID {
+		t.Errorf("Expected both registrations, newest first, got %+v (%v)", pending, err)
+	}
+
+	if existing, _ := service.GetUserByEmail(ctx, &dto.GetUserByEmailDTO{Email: "test@example.com"}); existing != nil {
+		t.Error("Expected no user before the email address is verified")
+	}
+
+	// The earlier registration is still completed with its own details
+	created, err := service.CompleteRegistration(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("Failed to complete registration: %v", err)
+	}
+	if created.ID != first.ID || !created.Verified || created.FullName != "Test User" {
+		t.Errorf("Unexpected user after completing registration: %+v", created)
+	}
+	if pending, _ := service.GetPendingRegistrationByID(ctx, second.ID); pending != nil {
+		t.Error("Expected the other pending registrations of the address to be removed")
+	}
+	if _, err := service.CompleteRegistration(ctx, second.ID); !errors.Is(err, errs.ErrUserNotFound) {
+		t.Errorf("Expected the removed registration not to be completed, got %v", err)
+	}
+
+	if _, err := service.RegisterPending(ctx, &dto.CreateUserDTO{FullName: "Test User", Email: "TEST@example.com", Password: "password123"}); !errors.Is(err, errs.ErrUserAlreadyExists) {
+		t.Errorf("Expected ErrUserAlreadyExists, got %v", err)
+	}
+}
+
+func TestPendingRegistrationExpires(t *testing.T) {
+	ctx := context.Background()
+	registrations := user.NewMemoryPendingRegistrationRepository()
+
+	registration := &models.PendingRegistration{Email: "test@example.com", FullName: "Test User", PasswordHash: "hash", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := registrations.Save(ctx, registration); err != nil {
+		t.Fatalf("Failed to save registration: %v", err)
+	}
+	if listed, err := registrations.ListByEmail(ctx, registration.Email); err != nil || len(listed) != 0 {
+		t.Errorf("Expected an expired registration not to be returned, got %+v (%v)", listed, err)
+	}
+
+	deleted, err := registrations.DeleteExpired(ctx, time.Now())
+	if err != nil || deleted != 1 {
+		t.Errorf("Expected one expired registration to be deleted, got %d (%v)", deleted, err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	service := newUserService(t)
+	created, err := service.CreateUser(ctx, &dto.CreateUserDTO{FullName: "Test User", Email: "test@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if err := service.DeleteUser(ctx, created.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if _, err := service.GetUserByID(ctx, created.ID); !errors.Is(err, errs.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound after deletion, got %v", err)
 	}
 }
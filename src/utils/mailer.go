@@ -7,6 +7,13 @@ type Mailer interface {
 	SendVerificationMail(to, verificationLink string) error
 	SendPasswordResetMail(to, passwordResetLink string) error
 	SendPasswordChangeMail(to, passwordChangeLink string) error
+	SendVerificationCodeMail(to, code string) error
+	SendPasswordResetCodeMail(to, code string) error
+	SendMagicLinkMail(to, magicLink string) error
+	SendLoginCodeMail(to, code string) error
+	SendRegistrationAttemptMail(to string) error
+	SendNewDeviceLoginMail(to, details string) error
+	SendReauthenticationCodeMail(to, code string) error
 }
 
 type mailer struct {
@@ -35,3 +42,38 @@ func (m mailer) SendPasswordChangeMail(to, passwordChangeLink string) error {
 	fmt.Printf("TO: %s, Content: %s\n", to, passwordChangeLink)
 	return nil
 }
+
+func (m mailer) SendVerificationCodeMail(to, code string) error {
+	fmt.Printf("TO: %s, Content: Your verification code is %s\n", to, code)
+	return nil
+}
+
+func (m mailer) SendPasswordResetCodeMail(to, code string) error {
+	fmt.Printf("TO: %s, Content: Your password reset code is %s\n", to, code)
+	return nil
+}
+
+func (m mailer) SendMagicLinkMail(to, magicLink string) error {
+	fmt.Printf("TO: %s, Content: %s\n", to, magicLink)
+	return nil
+}
+
+func (m mailer) SendLoginCodeMail(to, code string) error {
+	fmt.Printf("TO: %s, Content: Your sign-in code is %s\n", to, code)
+	return nil
+}
+
+func (m mailer) SendRegistrationAttemptMail(to string) error {
+	fmt.Printf("TO: %s, Content: Someone tried to create an account with your email address. If this was you, you can log in or reset your password instead.\n", to)
+	return nil
+}
+
+func (m mailer) SendNewDeviceLoginMail(to, details string) error {
+	fmt.Printf("TO: %s, Content: New sign-in to your account from an unrecognized device: %s. If this was not you, reset your password and log out all sessions.\n", to, details)
+	return nil
+}
+
+func (m mailer) SendReauthenticationCodeMail(to, code string) error {
+	fmt.Printf("TO: %s, Content: Your confirmation code is %s. Someone is confirming their identity to change sensitive account settings; if this was not you, change your password.\n", to, code)
+	return nil
+}
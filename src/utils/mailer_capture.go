@@ -0,0 +1,117 @@
+package utils
+
+import "sync"
+
+// Mail kinds recorded by CaptureMailer.
+const (
+	MailKindGeneric              = "generic"
+	MailKindVerification         = "verification"
+	MailKindPasswordReset        = "password_reset"
+	MailKindPasswordChange       = "password_change"
+	MailKindVerificationCode     = "verification_code"
+	MailKindPasswordResetCode    = "password_reset_code"
+	MailKindMagicLink            = "magic_link"
+	MailKindLoginCode            = "login_code"
+	MailKindRegistrationAttempt  = "registration_attempt"
+	MailKindNewDeviceLogin       = "new_device_login"
+	MailKindReauthenticationCode = "reauthentication_code"
+)
+
+// CapturedMail is a message recorded by CaptureMailer.
+type CapturedMail struct {
+	Kind    string
+	To      string
+	Content string
+}
+
+// CaptureMailer is a Mailer that records messages instead of sending them, for tests and local development.
+type CaptureMailer struct {
+	mu       sync.Mutex
+	messages []CapturedMail
+}
+
+// NewCaptureMailer creates a new CaptureMailer.
+func NewCaptureMailer() *CaptureMailer {
+	return &CaptureMailer{}
+}
+
+func (m *CaptureMailer) record(kind, to, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, CapturedMail{Kind: kind, To: to, Content: content})
+	return nil
+}
+
+func (m *CaptureMailer) SendMail(to, content string) error {
+	return m.record(MailKindGeneric, to, content)
+}
+
+func (m *CaptureMailer) SendVerificationMail(to, verificationLink string) error {
+	return m.record(MailKindVerification, to, verificationLink)
+}
+
+func (m *CaptureMailer) SendPasswordResetMail(to, passwordResetLink string) error {
+	return m.record(MailKindPasswordReset, to, passwordResetLink)
+}
+
+func (m *CaptureMailer) SendPasswordChangeMail(to, passwordChangeLink string) error {
+	return m.record(MailKindPasswordChange, to, passwordChangeLink)
+}
+
+func (m *CaptureMailer) SendVerificationCodeMail(to, code string) error {
+	return m.record(MailKindVerificationCode, to, code)
+}
+
+func (m *CaptureMailer) SendPasswordResetCodeMail(to, code string) error {
+	return m.record(MailKindPasswordResetCode, to, code)
+}
+
+func (m *CaptureMailer) SendMagicLinkMail(to, magicLink string) error {
+	return m.record(MailKindMagicLink, to, magicLink)
+}
+
+func (m *CaptureMailer) SendLoginCodeMail(to, code string) error {
+	return m.record(MailKindLoginCode, to, code)
+}
+
+func (m *CaptureMailer) SendRegistrationAttemptMail(to string) error {
+	return m.record(MailKindRegistrationAttempt, to, "")
+}
+
+func (m *CaptureMailer) SendNewDeviceLoginMail(to, details string) error {
+	return m.record(MailKindNewDeviceLogin, to, details)
+}
+
+func (m *CaptureMailer) SendReauthenticationCodeMail(to, code string) error {
+	return m.record(MailKindReauthenticationCode, to, code)
+}
+
+// Messages returns every recorded message in the order it was sent.
+func (m *CaptureMailer) Messages() []CapturedMail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]CapturedMail(nil), m.messages...)
+}
+
+// Last returns the most recent message of the given kind sent to the address.
+func (m *CaptureMailer) Last(kind, to string) (CapturedMail, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].Kind == kind && m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+	return CapturedMail{}, false
+}
+
+// Reset discards every recorded message.
+func (m *CaptureMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import "strings"
+
+// Device classes recognized by ParseUserAgent.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgentInfo is the device, browser and operating system recognized in a User-Agent header.
+type UserAgentInfo struct {
+	Device  string
+	Browser string
+	OS      string
+}
+
+// String describes the client for people, for example "Firefox on Windows".
+func (i UserAgentInfo) String() string {
+	return i.Browser + " on " + i.OS
+}
+
+// browserTokens are checked in order, since most browsers also claim to be Chrome or Safari.
+var browserTokens = []struct {
+	token string
+	name  string
+}{
+	{"Edg", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+// osTokens are checked in order, since iOS claims to be "like Mac OS X" and Android is Linux.
+var osTokens = []struct {
+	token string
+	name  string
+}{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"iPod", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// ParseUserAgent recognizes common browsers and operating systems in a User-Agent header. It is a
+// best-effort heuristic for display, not a means of identifying clients.
+func ParseUserAgent(userAgent string) UserAgentInfo {
+	info := UserAgentInfo{Device: DeviceUnknown, Browser: "Unknown browser", OS: "unknown OS"}
+
+	for _, b := range browserTokens {
+		if strings.Contains(userAgent, b.token) {
+			info.Browser = b.name
+			break
+		}
+	}
+	for _, o := range osTokens {
+		if strings.Contains(userAgent, o.token) {
+			info.OS = o.name
+			break
+		}
+	}
+
+	lower := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "crawler") || strings.Contains(lower, "spider"):
+		info.Device = DeviceBot
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") ||
+		(strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile")):
+		info.Device = DeviceTablet
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "Android"):
+		info.Device = DeviceMobile
+	case info.OS == "Windows" || info.OS == "macOS" || info.OS == "Linux" || info.OS == "ChromeOS":
+		info.Device = DeviceDesktop
+	}
+	return info
+}
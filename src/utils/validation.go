@@ -2,6 +2,7 @@ package utils
 
 import (
 	"github.com/go-playground/validator/v10"
+	"strings"
 )
 
 var validate = validator.New()
@@ -10,3 +11,9 @@ var validate = validator.New()
 func ValidateStruct(s interface{}) error {
 	return validate.Struct(s)
 }
+
+// NormalizeEmail returns the form email addresses are stored and compared in, independent of their
+// case and surrounding spaces.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}